@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+	"time"
+	"tutorial-auth/internal/admin"
+	"tutorial-auth/internal/config"
+	"tutorial-auth/internal/database"
+	"tutorial-auth/internal/health"
+	"tutorial-auth/internal/i18n"
+	"tutorial-auth/internal/lifecycle"
+	"tutorial-auth/internal/metrics"
+	"tutorial-auth/internal/mongodb"
+	"tutorial-auth/internal/mongodb/migrations"
+	"tutorial-auth/internal/notify"
+	"tutorial-auth/internal/risk"
+	"tutorial-auth/internal/rpc"
+	"tutorial-auth/internal/server"
+	"tutorial-auth/internal/services"
+	"tutorial-auth/internal/tracing"
+)
+
+// application holds the subsystems of the server. Its lifecycle hooks create them in dependency
+// order (Mongo, SQL, services, background workers, HTTP, gRPC and admin) and tear them down in reverse,
+// after readiness has failed for the drain delay.
+type application struct {
+	cfg    *config.Config
+	logger *zap.Logger
+
+	mongo       *mongodb.MongoDB
+	db          *sqlx.DB
+	userService *services.UserService
+	notifier    *notify.Dispatcher
+	health      *health.Checker
+	web         *server.WebServer
+	grpc        *rpc.Server
+	admin       *admin.Server
+
+	shutdownTracing func(ctx context.Context) error
+}
+
+func newApplication(cfg *config.Config, logger *zap.Logger) *application {
+	return &application{cfg: cfg, logger: logger}
+}
+
+func (a *application) lifecycle() *lifecycle.Lifecycle {
+	lc := lifecycle.New(a.logger)
+	lc.Append(lifecycle.Hook{Name: "logger", Stop: a.syncLogger})
+	lc.Append(lifecycle.Hook{Name: "tracing", Start: a.startTracing, Stop: a.stopTracing})
+	if !a.cfg.UsersInSQL() {
+		lc.Append(lifecycle.Hook{Name: "mongodb", Start: a.startMongo, Stop: a.stopMongo})
+	}
+	lc.Append(lifecycle.Hook{Name: "sql", Start: a.startSQL, Stop: a.stopSQL})
+	lc.Append(lifecycle.Hook{Name: "services", Start: a.startServices})
+	// stops after the workers and servers that record events, and writes what they have queued
+	lc.Append(backgroundHook("audit log", func(ctx context.Context) {
+		a.userService.AuditLog().Run(ctx)
+	}))
+	lc.Append(backgroundHook("registration recovery", func(ctx context.Context) {
+		services.NewRegistrationRecovery(a.cfg.App, a.logger, a.userService).Run(ctx)
+	}))
+	lc.Append(backgroundHook("login history purge", func(ctx context.Context) {
+		a.userService.LoginHistory().Run(ctx)
+	}))
+	lc.Append(backgroundHook("devices purge", func(ctx context.Context) {
+		a.userService.LoginMonitor().Run(ctx)
+	}))
+	lc.Append(backgroundHook("login challenges purge", func(ctx context.Context) {
+		a.userService.LoginChallenges().Run(ctx)
+	}))
+	lc.Append(backgroundHook("notifications", func(ctx context.Context) {
+		a.notifier.Run(ctx)
+	}))
+	lc.Append(lifecycle.Hook{Name: "http", Start: a.startHTTP(lc), Stop: a.stopHTTP})
+	if a.cfg.Grpc.Enabled {
+		lc.Append(lifecycle.Hook{Name: "grpc", Start: a.startGrpc(lc), Stop: a.stopGrpc})
+	}
+	if a.cfg.Admin.Enabled {
+		lc.Append(lifecycle.Hook{Name: "admin", Start: a.startAdmin(lc), Stop: a.stopAdmin})
+	}
+	lc.Append(lifecycle.Hook{Name: "drain", Stop: a.drain})
+	return lc
+}
+
+func (a *application) syncLogger(context.Context) error {
+	// syncing stdout fails on some platforms, which is not worth failing the shutdown for
+	_ = a.logger.Sync()
+	return nil
+}
+
+func (a *application) startTracing(ctx context.Context) error {
+	shutdown, err := tracing.Setup(ctx, &a.cfg.Tracing, a.cfg.App.Name)
+	if err != nil {
+		return err
+	}
+	a.shutdownTracing = shutdown
+	return nil
+}
+
+// stopTracing exports the spans that are still buffered.
+func (a *application) stopTracing(ctx context.Context) error {
+	return a.shutdownTracing(ctx)
+}
+
+func (a *application) startMongo(ctx context.Context) error {
+	const op = "cmd.application.startMongo"
+
+	a.mongo = mongodb.NewMongoDB(a.logger, &a.cfg.Mongo)
+	if err := a.mongo.ConnectWithRetry(ctx); err != nil {
+		return err
+	}
+	migrator := migrations.NewMigrator(a.logger, a.mongo.GetDB())
+	if err := migrator.UpSchema(ctx); err != nil {
+		a.mongo.Disconnect()
+		return fmt.Errorf("apply schema: %w", err)
+	}
+	a.logger.Info("applied mongodb schema", zap.String("op", op))
+
+	if pending, err := migrator.Pending(ctx); err != nil {
+		a.logger.Error("failed to read mongodb migrations", zap.String("op", op), zap.Error(err))
+	} else if pending > 0 {
+		a.logger.Warn("mongodb migrations are pending, run mongo-migrate up", zap.String("op", op), zap.Int("pending", pending))
+	}
+	return nil
+}
+
+func (a *application) stopMongo(context.Context) error {
+	a.mongo.Disconnect()
+	return nil
+}
+
+func (a *application) startSQL(context.Context) error {
+	const op = "cmd.application.startSQL"
+
+	db, err := database.NewConnectionDB(&a.cfg.Db)
+	if err != nil {
+		return err
+	}
+	a.db = db
+	metrics.RegisterSQLPool(db.DB, a.cfg.Db.Type)
+	if err = database.ApplyMigration(a.logger, a.cfg.Db.Type, db); err != nil {
+		db.Close()
+		return fmt.Errorf("apply migrations: %w", err)
+	}
+	a.logger.Info("applied migrations", zap.String("op", op), zap.String("type", a.cfg.Db.Type))
+	return nil
+}
+
+func (a *application) stopSQL(context.Context) error {
+	return a.db.Close()
+}
+
+func (a *application) startServices(context.Context) error {
+	// without an SMTP server the links and codes that log users in would only be written to the log
+	if a.cfg.App.Passwordless.Enabled && !a.cfg.Notify.Email.Enabled {
+		return errors.New("app.passwordless.enabled needs notify.email.enabled")
+	}
+	var users services.UserStore
+	if a.cfg.UsersInSQL() {
+		users = database.NewUserStore(a.db)
+	} else {
+		users = mongodb.NewUserStore(a.mongo)
+	}
+	a.userService = services.NewUserService(a.cfg.App, a.logger, users, a.db)
+	notifier, err := newNotifier(a.cfg, a.logger, a.db)
+	if err != nil {
+		return err
+	}
+	a.notifier = notifier
+	a.userService.SetNotifier(notifier)
+	if file := a.cfg.App.LoginAlerts.GeoIPFile; file != "" {
+		geo, err := risk.LoadGeoIP(file)
+		if err != nil {
+			return err
+		}
+		a.userService.LoginMonitor().SetGeoIP(geo)
+	}
+
+	translator, err := i18n.NewTranslator(a.cfg.I18n.DefaultLocale)
+	if err != nil {
+		return err
+	}
+	a.health = a.readinessChecks()
+	a.web = server.NewWebServer(a.logger, &a.cfg.Web, translator)
+	registerRoutes(a.cfg.App, a.logger, a.userService, a.health, a.web)
+	if a.cfg.Grpc.Enabled {
+		a.grpc = rpc.NewServer(a.logger, &a.cfg.Grpc, a.cfg.App, translator,
+			services.NewAuthService(a.cfg.App, a.logger, a.userService), a.userService)
+	}
+	return nil
+}
+
+// newNotifier sends email through the configured SMTP server, or logs it when there is none.
+func newNotifier(cfg *config.Config, logger *zap.Logger, db *sqlx.DB) (*notify.Dispatcher, error) {
+	var email notify.Provider = notify.NewLogProvider(logger)
+	if cfg.Notify.Email.Enabled {
+		email = notify.NewSMTPMailer(&cfg.Notify.Email)
+	}
+	sms, err := notify.NewSMSProvider(&cfg.Notify.SMS, logger)
+	if err != nil {
+		return nil, err
+	}
+	return notify.NewDispatcher(&cfg.Notify, logger, notify.NewTemplates(cfg.I18n.DefaultLocale, cfg.Notify.Templates),
+		map[string]notify.Provider{notify.ChannelEmail: email, notify.ChannelSMS: sms},
+		database.NewDeadLetterStore(db)), nil
+}
+
+func (a *application) readinessChecks() *health.Checker {
+	timeouts := a.cfg.Health.Timeouts
+	checker := health.NewChecker(a.logger,
+		health.SQL(a.db, timeouts.SQL),
+		health.Migrations(a.cfg.Db.Type, a.db, a.mongo, timeouts.Migrations),
+		health.SigningKey(a.cfg.App),
+		health.HashingPool(a.userService.HashingPool(), a.cfg.Health.MaxHashingQueue),
+	)
+	if a.mongo != nil {
+		checker.Add(health.Mongo(a.mongo, timeouts.Mongo))
+	}
+	return checker
+}
+
+// backgroundHook runs a worker from start until stop, which cancels it and waits for it to return.
+func backgroundHook(name string, run func(ctx context.Context)) lifecycle.Hook {
+	var cancel context.CancelFunc
+	done := make(chan struct{})
+	return lifecycle.Hook{
+		Name: name,
+		Start: func(context.Context) error {
+			var ctx context.Context
+			ctx, cancel = context.WithCancel(context.Background())
+			go func() {
+				defer close(done)
+				run(ctx)
+			}()
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			cancel()
+			select {
+			case <-done:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
+	}
+}
+
+func (a *application) startHTTP(lc *lifecycle.Lifecycle) func(context.Context) error {
+	return func(context.Context) error {
+		go func() {
+			if err := a.web.Run(); err != nil {
+				lc.Fail(fmt.Errorf("http: %w", err))
+			}
+		}()
+		return nil
+	}
+}
+
+func (a *application) stopHTTP(ctx context.Context) error {
+	return a.web.Shutdown(ctx)
+}
+
+func (a *application) startGrpc(lc *lifecycle.Lifecycle) func(context.Context) error {
+	return func(context.Context) error {
+		go func() {
+			if err := a.grpc.Run(); err != nil {
+				lc.Fail(fmt.Errorf("grpc: %w", err))
+			}
+		}()
+		return nil
+	}
+}
+
+func (a *application) stopGrpc(ctx context.Context) error {
+	return a.grpc.Shutdown(ctx)
+}
+
+func (a *application) startAdmin(lc *lifecycle.Lifecycle) func(context.Context) error {
+	return func(context.Context) error {
+		a.admin = admin.NewServer(a.logger, &a.cfg.Admin)
+		go func() {
+			if err := a.admin.Run(); err != nil {
+				lc.Fail(fmt.Errorf("admin: %w", err))
+			}
+		}()
+		return nil
+	}
+}
+
+func (a *application) stopAdmin(ctx context.Context) error {
+	return a.admin.Shutdown(ctx)
+}
+
+// drain fails readiness, on HTTP and gRPC, and gives load balancers the drain delay to notice
+// before the listeners close.
+func (a *application) drain(ctx context.Context) error {
+	a.health.Drain()
+	if a.grpc != nil {
+		a.grpc.Drain()
+	}
+	select {
+	case <-time.After(a.cfg.Health.DrainDelay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"path/filepath"
+	"testing"
+	"time"
+	"tutorial-auth/internal/config"
+	"tutorial-auth/internal/health"
+)
+
+func TestApplicationLifecycle(t *testing.T) {
+	cfg := &config.Config{
+		Storage: "sql",
+		App:     &config.AppConfig{RegistrationRecoveryInterval: time.Minute, TokenSecret: "secret"},
+		I18n:    config.I18nConfig{DefaultLocale: "en"},
+		Db:      config.DBConnectionConfig{Type: "sqlite", Database: filepath.Join(t.TempDir(), "auth.db")},
+		Grpc:    config.GrpcServerConfig{Enabled: true},
+		Admin:   config.AdminServerConfig{Enabled: true},
+	}
+	app := newApplication(cfg, zap.NewNop())
+	lc := app.lifecycle()
+
+	require.NoError(t, lc.Start(context.Background(), time.Second))
+	require.NotNil(t, app.userService)
+	require.NotNil(t, app.web)
+	require.NotNil(t, app.grpc)
+	require.NotNil(t, app.admin)
+	require.NoError(t, app.db.Ping())
+	require.Equal(t, health.StatusOK, app.health.Ready(context.Background()).Status)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, lc.Stop(ctx))
+	require.Error(t, app.db.Ping())
+	require.True(t, app.health.Draining())
+}
+
+func TestPasswordlessNeedsEmail(t *testing.T) {
+	cfg := &config.Config{App: &config.AppConfig{Passwordless: config.PasswordlessConfig{Enabled: true}}}
+	app := newApplication(cfg, zap.NewNop())
+	require.ErrorContains(t, app.startServices(context.Background()), "needs notify.email.enabled")
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"go.uber.org/zap"
+	"os"
+	"time"
+	"tutorial-auth/internal/config"
+	"tutorial-auth/internal/database"
+	"tutorial-auth/internal/notify"
+	"tutorial-auth/pkg/logging"
+)
+
+// deadLetters looks into the notifications that could not be delivered: list prints the newest,
+// and resend sends the ones given by ID once more and removes those that are delivered.
+func deadLetters(args []string) {
+	const op = "cmd.deadLetters"
+
+	flags := flag.NewFlagSet("dead-letters", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "print the list as JSON")
+	limit := flags.Int("limit", 50, "number of dead letters listed")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: go-auth dead-letters [flags] list | resend id...")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+	command := flags.Arg(0)
+	if (command != "list" || flags.NArg() != 1) && (command != "resend" || flags.NArg() < 2) || *limit <= 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	cfg := config.InitConfiguration()
+	logger := logging.NewLogger(&cfg.Logging, "dead-letters.log")
+	ctx := context.Background()
+
+	db := connectDB(logger, cfg)
+	defer db.Close()
+	store := database.NewDeadLetterStore(db)
+
+	if command == "list" {
+		letters, err := store.List(ctx, *limit)
+		if err != nil {
+			logger.Fatal("failed to list dead letters", zap.String("op", op), zap.Error(err))
+		}
+		if *asJSON {
+			b, _ := json.MarshalIndent(letters, "", "  ")
+			fmt.Println(string(b))
+			return
+		}
+		for _, letter := range letters {
+			fmt.Printf("%s %s %-5s %-18s %-30s %d attempts: %s\n", letter.ID, letter.CreatedAt.Format(time.RFC3339),
+				letter.Channel, letter.Template, letter.Recipient, letter.Attempts, letter.Error)
+		}
+		return
+	}
+
+	notifier, err := newNotifier(cfg, logger, db)
+	if err != nil {
+		logger.Fatal("failed to set up notifications", zap.String("op", op), zap.Error(err))
+	}
+	failed := 0
+	for _, id := range flags.Args()[1:] {
+		if err = resendDeadLetter(ctx, store, notifier, id); err != nil {
+			failed++
+			logger.Error("failed to resend dead letter", zap.String("op", op), zap.String("id", id), zap.Error(err))
+			fmt.Fprintf(os.Stderr, "%s: %s\n", id, err)
+			continue
+		}
+		fmt.Printf("%s: sent\n", id)
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func resendDeadLetter(ctx context.Context, store *database.DeadLetterStore, notifier *notify.Dispatcher, id string) error {
+	letter, err := store.Get(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("no dead letter %s", id)
+	} else if err != nil {
+		return err
+	}
+	if err = notifier.Resend(ctx, letter); err != nil {
+		return err
+	}
+	return store.Delete(ctx, id)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go.uber.org/zap"
+	"io"
+	"os"
+	"strings"
+	"tutorial-auth/internal/audit"
+	"tutorial-auth/internal/config"
+	"tutorial-auth/internal/database"
+	"tutorial-auth/internal/doctor"
+	"tutorial-auth/internal/mongodb"
+	"tutorial-auth/pkg/logging"
+)
+
+// runDoctor checks the user store and the credentials for inconsistencies and optionally repairs them.
+// Without --fix or --interactive nothing is changed.
+func runDoctor(args []string) {
+	const op = "cmd.runDoctor"
+
+	flags := flag.NewFlagSet("doctor", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "print the report as JSON")
+	fix := flags.Bool("fix", false, "apply every available fix")
+	interactive := flags.Bool("interactive", false, "ask before applying each fix")
+	batch := flags.Int("batch", 500, "number of records read per batch")
+	_ = flags.Parse(args)
+
+	cfg := config.InitConfiguration()
+	logger := logging.NewLogger(&cfg.Logging, "doctor.log")
+	ctx := context.Background()
+
+	db := connectDB(logger, cfg)
+	defer db.Close()
+
+	var users doctor.UserStore
+	if cfg.UsersInSQL() {
+		users = database.NewUserStore(db)
+	} else {
+		mongoClient := connectMongo(logger, cfg)
+		defer mongoClient.Disconnect()
+		users = mongodb.NewUserStore(mongoClient)
+	}
+	d := doctor.NewDoctor(logger, users, database.NewPasswordStore(db), database.NewRegistrationOutbox(db),
+		audit.NewLog(logger, database.NewAuditStore(db)), *batch)
+
+	stdin := bufio.NewReader(os.Stdin)
+	decide := func(issue *doctor.Issue) bool {
+		if !*interactive {
+			return *fix
+		}
+		fmt.Fprintf(os.Stderr, "%s %s %s: %s. Fix? [y/N] ", issue.Kind, issue.UserID, issue.Login, issue.Detail)
+		answer, _ := stdin.ReadString('\n')
+		return strings.EqualFold(strings.TrimSpace(answer), "y")
+	}
+
+	var report reportWriter = &textReport{w: os.Stdout}
+	if *asJSON {
+		report = &jsonReport{w: os.Stdout}
+	}
+
+	summary, err := d.Run(ctx, decide, report.issue)
+	if err != nil {
+		logger.Error("doctor failed", zap.String("op", op), zap.Error(err))
+	}
+	report.summary(summary, err)
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+type reportWriter interface {
+	issue(issue *doctor.Issue) error
+	summary(summary *doctor.Summary, err error)
+}
+
+type textReport struct {
+	w io.Writer
+}
+
+func (r *textReport) issue(issue *doctor.Issue) error {
+	status := ""
+	if issue.Fixed {
+		status = " [fixed]"
+	}
+	_, err := fmt.Fprintf(r.w, "%-18s %-36s %s: %s%s\n", issue.Kind, issue.UserID, issue.Login, issue.Detail, status)
+	return err
+}
+
+func (r *textReport) summary(summary *doctor.Summary, err error) {
+	fmt.Fprintf(r.w, "\nscanned %d users and %d credentials\n", summary.Users, summary.Credentials)
+	for kind, count := range summary.Issues {
+		fmt.Fprintf(r.w, "%-18s %d\n", kind, count)
+	}
+	fmt.Fprintf(r.w, "fixed %d issues\n", summary.Fixed)
+	if err != nil {
+		fmt.Fprintf(r.w, "stopped: %s\n", err)
+	}
+}
+
+// jsonReport writes {"issues": [...], "summary": {...}} one issue at a time, so the report is never held in memory.
+type jsonReport struct {
+	w     io.Writer
+	count int
+}
+
+func (r *jsonReport) issue(issue *doctor.Issue) error {
+	prefix := ",\n  "
+	if r.count == 0 {
+		prefix = "{\"issues\": [\n  "
+	}
+	r.count++
+
+	b, err := json.Marshal(issue)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(r.w, "%s%s", prefix, b)
+	return err
+}
+
+func (r *jsonReport) summary(summary *doctor.Summary, err error) {
+	if r.count == 0 {
+		fmt.Fprint(r.w, "{\"issues\": [")
+	}
+	b, _ := json.Marshal(summary)
+	fmt.Fprintf(r.w, "\n], \"summary\": %s", b)
+	if err != nil {
+		e, _ := json.Marshal(err.Error())
+		fmt.Fprintf(r.w, ", \"error\": %s", e)
+	}
+	fmt.Fprintln(r.w, "}")
+}
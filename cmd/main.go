@@ -1,14 +1,16 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"github.com/jmoiron/sqlx"
 	"go.uber.org/zap"
 	"math/rand"
 	"os"
-	"os/signal"
 	"time"
 	"tutorial-auth/internal/config"
 	"tutorial-auth/internal/database"
+	"tutorial-auth/internal/health"
 	"tutorial-auth/internal/mongodb"
 	"tutorial-auth/internal/server"
 	"tutorial-auth/internal/server/controllers"
@@ -21,60 +23,78 @@ func init() {
 }
 
 func main() {
-	const op = "cmd.main.main"
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate-users":
+			migrateUsers(os.Args[2:])
+		case "doctor":
+			runDoctor(os.Args[2:])
+		case "mongo-migrate":
+			mongoMigrate(os.Args[2:])
+		case "audit-verify":
+			verifyAudit(os.Args[2:])
+		case "dead-letters":
+			deadLetters(os.Args[2:])
+		default:
+			fmt.Fprintf(os.Stderr, "unknown command %q\n", os.Args[1])
+			os.Exit(2)
+		}
+		return
+	}
+
+	serve()
+}
+
+func serve() {
+	const op = "cmd.main.serve"
 	cfg := config.InitConfiguration()
 
 	logger := logging.NewLogger(&cfg.Logging, "auth.log")
 	logger.Debug("run this configuration", zap.Any("config", cfg), zap.String("op", op))
 
-	mongoClient := mongodb.NewMongoDB(logger, &cfg.Mongo)
-	defer mongoClient.Disconnect()
-	err := mongoClient.Connect()
-	if err != nil {
-		logger.Fatal("failed to connect to mongodb", zap.String("op", op), zap.Error(err))
+	if err := newApplication(cfg, logger).lifecycle().Run(context.Background(), cfg.ShutdownTimeout); err != nil {
+		logger.Error("stopped with errors", zap.String("op", op), zap.Error(err))
+		_ = logger.Sync()
+		os.Exit(1)
 	}
+	logger.Info("stopped", zap.String("op", op))
+}
 
-	for {
-		if mongoClient.IsConnected() {
-			logger.Info("connected to mongodb", zap.String("op", op))
-			break
-		}
-		time.Sleep(1 * time.Second)
-	}
+func connectDB(logger *zap.Logger, cfg *config.Config) *sqlx.DB {
+	const op = "cmd.main.connectDB"
 
 	db, err := database.NewConnectionDB(&cfg.Db)
-	defer db.Close()
 	if err != nil {
-		logger.Fatal("failed to connect to postgresql", zap.String("op", op), zap.Error(err))
+		logger.Fatal("failed to connect to sql database", zap.String("op", op), zap.String("type", cfg.Db.Type), zap.Error(err))
 	}
-	logger.Info("connected to postgresql", zap.String("op", op))
+	logger.Info("connected to sql database", zap.String("op", op), zap.String("type", cfg.Db.Type))
+	return db
+}
+
+func connectMongo(logger *zap.Logger, cfg *config.Config) *mongodb.MongoDB {
+	const op = "cmd.main.connectMongo"
 
-	err = database.ApplyMigration(logger, cfg.Db.Type, db)
+	mongoClient := mongodb.NewMongoDB(logger, &cfg.Mongo)
+	err := mongoClient.ConnectWithRetry(context.Background())
 	if err != nil {
-		logger.Fatal("failed to apply migrations", zap.String("op", op), zap.Error(err))
+		logger.Fatal("failed to connect to mongodb", zap.String("op", op), zap.Error(err))
 	}
-	logger.Info("applied migrations", zap.String("op", op))
-
-	wApp := server.NewWebServer(logger, &cfg.Web)
-	registerRoutes(cfg.App, logger, mongoClient, db, wApp)
-	go wApp.Run(cfg.App, logger, mongoClient, db)
-
-	// Graceful shutdown
-	SigCh := make(chan os.Signal)
-	signal.Notify(SigCh, os.Interrupt, os.Kill)
-	takeSig := <-SigCh
-	logger.Info("received signal", zap.String("signal", takeSig.String()))
+	logger.Info("connected to mongodb", zap.String("op", op))
+	return mongoClient
 }
 
-func registerRoutes(cfg *config.AppConfig, logger *zap.Logger, mongoClient *mongodb.MongoDB, db *sqlx.DB, wApp *server.WebServer) {
+func registerRoutes(cfg *config.AppConfig, logger *zap.Logger, userService *services.UserService, checker *health.Checker, wApp *server.WebServer) {
 	const op = "cmd.main.registerRoutes"
 	logger.Info("registering routes", zap.String("op", op))
 
-	userService := services.NewUserService(logger, mongoClient, db)
 	authService := services.NewAuthService(cfg, logger, userService)
 
 	wApp.RegisterRoutes([]controllers.GroupController{
 		controllers.NewAuthController(cfg, logger, authService),
 		controllers.NewRegisterController(cfg, logger, userService),
+		controllers.NewPasswordlessController(cfg, logger, authService, userService),
+		controllers.NewForwardAuthController(cfg, logger, authService),
+		controllers.NewLoginHistoryController(cfg, logger, authService, userService),
+		controllers.NewHealthController(logger, checker),
 	})
 }
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"testing"
+	"tutorial-auth/internal/config"
+	"tutorial-auth/internal/server"
+)
+
+// TestRoutesDocumented fails when a route served by the application is missing from /openapi.json.
+func TestRoutesDocumented(t *testing.T) {
+	wApp := server.NewWebServer(zap.NewNop(), &config.WebServerConfig{}, nil)
+	registerRoutes(&config.AppConfig{}, zap.NewNop(), nil, nil, wApp)
+
+	require.Empty(t, wApp.UndocumentedRoutes(), "add a controllers.Doc to these routes")
+	require.NotEmpty(t, wApp.OpenAPI().Paths)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	"tutorial-auth/internal/config"
+	"tutorial-auth/internal/database"
+	"tutorial-auth/internal/mongodb"
+	"tutorial-auth/pkg/logging"
+)
+
+const importName = "mongo-users"
+
+// migrateUsers copies users from MongoDB into the SQL users table, in _id order and in batches.
+// Progress is checkpointed after every batch, so an interrupted run continues where it stopped,
+// and users that already exist in SQL are skipped, so running it again is harmless. A user whose
+// login belongs to another user in SQL is reported and left out, for the conflict to be resolved by hand.
+func migrateUsers(args []string) {
+	const op = "cmd.migrateUsers"
+
+	flags := flag.NewFlagSet("migrate-users", flag.ExitOnError)
+	batch := flags.Int64("batch", 500, "number of users copied per batch")
+	restart := flags.Bool("restart", false, "ignore the saved checkpoint and scan the collection from the start")
+	_ = flags.Parse(args)
+
+	cfg := config.InitConfiguration()
+	logger := logging.NewLogger(&cfg.Logging, "migrate-users.log")
+	ctx := context.Background()
+
+	db := connectDB(logger, cfg)
+	defer db.Close()
+	if err := database.ApplyMigration(logger, cfg.Db.Type, db); err != nil {
+		logger.Fatal("failed to apply migrations", zap.String("op", op), zap.Error(err))
+	}
+
+	mongoClient := connectMongo(logger, cfg)
+	defer mongoClient.Disconnect()
+
+	if *restart {
+		if err := database.ResetImportState(ctx, db, importName); err != nil {
+			logger.Fatal("failed to reset checkpoint", zap.String("op", op), zap.Error(err))
+		}
+	}
+	state, err := database.GetImportState(ctx, db, importName)
+	if err != nil {
+		logger.Fatal("failed to read checkpoint", zap.String("op", op), zap.Error(err))
+	}
+
+	after := primitive.NilObjectID
+	if state.LastID != "" {
+		if after, err = primitive.ObjectIDFromHex(state.LastID); err != nil {
+			logger.Fatal("invalid checkpoint", zap.String("op", op), zap.String("lastID", state.LastID), zap.Error(err))
+		}
+		logger.Info("resuming import", zap.String("op", op), zap.String("after", state.LastID), zap.Int64("imported", state.Imported))
+	}
+
+	source := mongodb.NewUserStore(mongoClient)
+	target := database.NewUserStore(db)
+	var skipped, conflicts int64
+	for {
+		users, err := source.FindAfter(ctx, after, *batch)
+		if err != nil {
+			logger.Fatal("failed to read users from mongodb", zap.String("op", op), zap.Error(err))
+		}
+		if len(users) == 0 {
+			break
+		}
+
+		for _, user := range users {
+			imported, err := target.Import(ctx, user)
+			if database.IsUniqueViolation(err) {
+				logger.Warn("login belongs to another user, not imported", zap.String("op", op),
+					zap.String("guid", user.GUID), zap.String("login", user.Login))
+				conflicts++
+				after = user.ID
+				continue
+			}
+			if err != nil {
+				logger.Fatal("failed to import user", zap.String("op", op), zap.String("guid", user.GUID), zap.Error(err))
+			}
+			if imported {
+				state.Imported++
+			} else {
+				skipped++
+			}
+			after = user.ID
+		}
+
+		state.LastID = after.Hex()
+		if err = database.SaveImportState(ctx, db, state); err != nil {
+			logger.Fatal("failed to save checkpoint", zap.String("op", op), zap.Error(err))
+		}
+		logger.Info("imported batch", zap.String("op", op), zap.String("lastID", state.LastID), zap.Int64("imported", state.Imported))
+	}
+
+	logger.Info("import finished", zap.String("op", op), zap.Int64("imported", state.Imported), zap.Int64("skipped", skipped),
+		zap.Int64("conflicts", conflicts))
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"go.uber.org/zap"
+	"os"
+	"time"
+	"tutorial-auth/internal/config"
+	"tutorial-auth/internal/mongodb/migrations"
+	"tutorial-auth/pkg/logging"
+)
+
+// mongoMigrate runs the document migrations of internal/mongodb/migrations: up applies every pending
+// migration, down reverts the last applied one, and status lists them.
+func mongoMigrate(args []string) {
+	const op = "cmd.mongoMigrate"
+
+	flags := flag.NewFlagSet("mongo-migrate", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "report what would change without writing")
+	batch := flags.Int("batch", 1000, "number of documents changed per write")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: go-auth mongo-migrate [flags] up|down|status")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	cfg := config.InitConfiguration()
+	logger := logging.NewLogger(&cfg.Logging, "mongo-migrate.log")
+	ctx := context.Background()
+
+	mongoClient := connectMongo(logger, cfg)
+	defer mongoClient.Disconnect()
+	migrator := migrations.NewMigrator(logger, mongoClient.GetDB())
+
+	var err error
+	switch flags.Arg(0) {
+	case "up":
+		err = migrator.Up(ctx, *dryRun, *batch)
+	case "down":
+		err = migrator.Down(ctx, *dryRun, *batch)
+	case "status":
+		var statuses []migrations.Status
+		statuses, err = migrator.Status(ctx)
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%-16d %-26s %s\n", status.Version, applied, status.Description)
+		}
+	default:
+		flags.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		logger.Fatal("mongodb migration failed", zap.String("op", op), zap.String("command", flags.Arg(0)), zap.Error(err))
+	}
+}
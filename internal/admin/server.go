@@ -0,0 +1,60 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+	"net"
+	"net/http"
+	"time"
+	"tutorial-auth/internal/config"
+	"tutorial-auth/internal/metrics"
+)
+
+// Server is the admin listener. It serves /metrics on its own port, so that operational
+// endpoints are not exposed wherever the API is.
+type Server struct {
+	log    *zap.Logger
+	cfg    *config.AdminServerConfig
+	server *http.Server
+}
+
+func NewServer(logger *zap.Logger, cfg *config.AdminServerConfig) *Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{
+		ErrorLog: zap.NewStdLog(logger),
+	}))
+	return &Server{
+		log: logger,
+		cfg: cfg,
+		server: &http.Server{
+			Handler:           mux,
+			ReadHeaderTimeout: 5 * time.Second,
+		},
+	}
+}
+
+func (s *Server) Run() error {
+	const op = "admin.Server.Run"
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", s.cfg.Port))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	s.log.Info("serving admin endpoints", zap.String("op", op), zap.Int("port", s.cfg.Port))
+	return s.Serve(listener)
+}
+
+func (s *Server) Serve(listener net.Listener) error {
+	if err := s.server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Shutdown stops accepting connections and waits for in-flight scrapes until ctx is done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
@@ -0,0 +1,35 @@
+package admin
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"tutorial-auth/internal/config"
+	"tutorial-auth/internal/metrics"
+)
+
+func TestMetricsEndpoint(t *testing.T) {
+	metrics.Logins.WithLabelValues(metrics.ResultSuccess).Inc()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := NewServer(zap.NewNop(), &config.AdminServerConfig{})
+	stopped := make(chan error, 1)
+	go func() { stopped <- server.Serve(listener) }()
+
+	resp, err := http.Get("http://" + listener.Addr().String() + "/metrics")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Contains(t, string(body), `auth_logins_total{result="success"}`)
+	require.Contains(t, string(body), "go_goroutines")
+
+	require.NoError(t, server.Shutdown(context.Background()))
+	require.NoError(t, <-stopped)
+}
@@ -0,0 +1,190 @@
+// Package audit records security events in a tamper-evident log. Every event carries the hash of
+// the event before it, so changing, removing or reordering stored events breaks the chain, which
+// Verify detects.
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"go.uber.org/zap"
+	"os/user"
+	"sync"
+	"time"
+	"tutorial-auth/internal/metrics"
+	"tutorial-auth/pkg/logging"
+)
+
+// Event types.
+const (
+	Login           = "login"
+	Registration    = "registration"
+	PasswordChange  = "password_change"
+	SessionRevoked  = "session_revoked"
+	AdminAction     = "admin_action"
+	SuspiciousLogin = "suspicious_login" // follows a login that risk rules flagged, which Detail lists
+	EmailVerified   = "email_verified"
+)
+
+// ResultSuccess is the result of events that succeeded; any other result is the code of the service error.
+const ResultSuccess = metrics.ResultSuccess
+
+// recordTimeout bounds writing one event, which goes on after the request that caused it has ended.
+const recordTimeout = 5 * time.Second
+
+// queueSize is the number of events Log holds for Run to write.
+const queueSize = 1024
+
+// Event is one entry of the audit log. Actor is who acted: the account holder for self-service
+// events, identified like Subject, or the operator for admin actions. Subject is the account the
+// event is about, by user ID, or by login when no user is known.
+type Event struct {
+	Seq       int64     `db:"seq" json:"seq"`
+	Type      string    `db:"type" json:"type"`
+	Actor     string    `db:"actor" json:"actor"`
+	Subject   string    `db:"subject" json:"subject"`
+	IP        string    `db:"ip" json:"ip"`
+	UserAgent string    `db:"user_agent" json:"user_agent"`
+	Result    string    `db:"result" json:"result"`
+	Detail    string    `db:"detail" json:"detail,omitempty"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	PrevHash  string    `db:"prev_hash" json:"prev_hash"`
+	Hash      string    `db:"hash" json:"hash"`
+}
+
+// ComputeHash returns the hex encoded SHA-256 of the event and the hash of the event before it.
+// CreatedAt counts in microseconds, the precision every supported database keeps.
+func (e *Event) ComputeHash() string {
+	content, _ := json.Marshal(struct {
+		Seq       int64
+		Type      string
+		Actor     string
+		Subject   string
+		IP        string
+		UserAgent string
+		Result    string
+		Detail    string
+		CreatedAt int64
+		PrevHash  string
+	}{e.Seq, e.Type, e.Actor, e.Subject, e.IP, e.UserAgent, e.Result, e.Detail, e.CreatedAt.UnixMicro(), e.PrevHash})
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// Store keeps the chain of events, database.AuditStore. Append links the event to the last one
+// by setting Seq, PrevHash and Hash; Range returns up to limit events after seq, in order.
+type Store interface {
+	Append(ctx context.Context, event *Event) error
+	Range(ctx context.Context, after int64, limit int) ([]Event, error)
+}
+
+// Client is the address and the user agent of the client a request came from.
+type Client struct {
+	IP        string
+	UserAgent string
+}
+
+type clientKey struct{}
+
+// WithClient returns a context that attributes the events recorded in it to client.
+func WithClient(ctx context.Context, client Client) context.Context {
+	return context.WithValue(ctx, clientKey{}, client)
+}
+
+// ClientFrom returns the client of ctx, which is empty outside of requests.
+func ClientFrom(ctx context.Context) Client {
+	client, _ := ctx.Value(clientKey{}).(Client)
+	return client
+}
+
+// Operator identifies the person running a command line tool, as the actor of admin actions.
+func Operator() string {
+	if current, err := user.Current(); err == nil {
+		return "cli:" + current.Username
+	}
+	return "cli"
+}
+
+// Log records events. Until Run starts, Record writes each event before it returns; while Run
+// runs, Record queues the event and Run writes the queue in order, off the path of the request.
+type Log struct {
+	logger *zap.Logger
+	store  Store
+	queue  chan queued
+
+	mu      sync.RWMutex
+	running bool
+}
+
+type queued struct {
+	ctx   context.Context
+	event Event
+}
+
+func NewLog(logger *zap.Logger, store Store) *Log {
+	return &Log{logger: logger, store: store, queue: make(chan queued, queueSize)}
+}
+
+// Record appends the event, attributed to the client of ctx. It is written even when ctx has
+// been cancelled, and a failure to write it is logged and counted but does not fail the operation
+// being audited. When the queue is full the event is written right away, which slows the caller
+// down rather than losing it.
+func (l *Log) Record(ctx context.Context, event Event) {
+	client := ClientFrom(ctx)
+	event.IP = client.IP
+	event.UserAgent = client.UserAgent
+	event.CreatedAt = time.Now()
+	ctx = context.WithoutCancel(ctx)
+
+	l.mu.RLock()
+	if l.running {
+		select {
+		case l.queue <- queued{ctx: ctx, event: event}:
+			l.mu.RUnlock()
+			return
+		default:
+		}
+	}
+	l.mu.RUnlock()
+	l.write(ctx, event)
+}
+
+// Run writes queued events until ctx is done, and then the events still queued.
+func (l *Log) Run(ctx context.Context) {
+	l.mu.Lock()
+	l.running = true
+	l.mu.Unlock()
+
+	for {
+		select {
+		case q := <-l.queue:
+			l.write(q.ctx, q.event)
+		case <-ctx.Done():
+			// Record writes by itself from now on, so nothing is queued after the queue is drained
+			l.mu.Lock()
+			l.running = false
+			l.mu.Unlock()
+			for {
+				select {
+				case q := <-l.queue:
+					l.write(q.ctx, q.event)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (l *Log) write(ctx context.Context, event Event) {
+	const op = "audit.Log.write"
+
+	ctx, cancel := context.WithTimeout(ctx, recordTimeout)
+	defer cancel()
+	if err := l.store.Append(ctx, &event); err != nil {
+		metrics.AuditWriteFailures.Inc()
+		logging.WithContext(ctx, l.logger).Error("failed to record audit event", zap.String("op", op),
+			zap.String("type", event.Type), zap.String("subject", event.Subject), zap.String("result", event.Result), zap.Error(err))
+	}
+}
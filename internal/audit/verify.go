@@ -0,0 +1,89 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+)
+
+// Anchor is the hash of an event noted down outside of the database, for example from an
+// earlier Report. The chain alone cannot tell events removed from its end, or a chain rewritten
+// as a whole, from a valid one; an anchor can.
+type Anchor struct {
+	Seq  int64
+	Hash string
+}
+
+// Problem is a place where the chain is broken.
+type Problem struct {
+	Seq    int64  `json:"seq"`
+	Reason string `json:"reason"`
+}
+
+type Report struct {
+	Events   int64     `json:"events"`
+	HeadSeq  int64     `json:"head_seq"`
+	HeadHash string    `json:"head_hash"`
+	Problems []Problem `json:"problems"`
+}
+
+// Intact reports whether no problem was found.
+func (r *Report) Intact() bool {
+	return len(r.Problems) == 0
+}
+
+// Verify reads the whole chain batch by batch and reports every event that is missing, does not
+// link to the event before it or does not match its own hash, and every anchor that does not match.
+func Verify(ctx context.Context, store Store, batchSize int, anchors ...Anchor) (*Report, error) {
+	report := &Report{Problems: []Problem{}}
+	if batchSize <= 0 {
+		return report, fmt.Errorf("batch size %d is not positive", batchSize)
+	}
+	expected := map[int64]string{}
+	for _, anchor := range anchors {
+		expected[anchor.Seq] = anchor.Hash
+	}
+
+	for {
+		events, err := store.Range(ctx, report.HeadSeq, batchSize)
+		if err != nil {
+			return report, err
+		}
+		if len(events) == 0 {
+			break
+		}
+
+		for i := range events {
+			event := &events[i]
+			switch {
+			case event.Seq != report.HeadSeq+1:
+				report.problem(event.Seq, fmt.Sprintf("events %d to %d are missing", report.HeadSeq+1, event.Seq-1))
+			case event.PrevHash != report.HeadHash:
+				report.problem(event.Seq, "does not link to the event before it")
+			}
+			if event.ComputeHash() != event.Hash {
+				report.problem(event.Seq, "does not match its hash")
+			}
+			if hash, ok := expected[event.Seq]; ok {
+				if hash != event.Hash {
+					report.problem(event.Seq, "does not match the anchor")
+				}
+				delete(expected, event.Seq)
+			}
+
+			report.Events++
+			report.HeadSeq = event.Seq
+			report.HeadHash = event.Hash
+		}
+	}
+
+	for _, anchor := range anchors {
+		if _, ok := expected[anchor.Seq]; ok {
+			report.problem(anchor.Seq, "anchored event is missing")
+		}
+	}
+	return report, nil
+}
+
+func (r *Report) problem(seq int64, reason string) {
+	r.Problems = append(r.Problems, Problem{Seq: seq, Reason: reason})
+}
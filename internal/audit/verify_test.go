@@ -0,0 +1,114 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"testing"
+	"time"
+)
+
+type memoryStore struct {
+	events []Event
+}
+
+func (s *memoryStore) Append(_ context.Context, event *Event) error {
+	event.Seq = int64(len(s.events)) + 1
+	if len(s.events) > 0 {
+		event.PrevHash = s.events[len(s.events)-1].Hash
+	}
+	event.Hash = event.ComputeHash()
+	s.events = append(s.events, *event)
+	return nil
+}
+
+func (s *memoryStore) Range(_ context.Context, after int64, limit int) ([]Event, error) {
+	var events []Event
+	for _, event := range s.events {
+		if event.Seq > after && len(events) < limit {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+	chain := func() *memoryStore {
+		store := &memoryStore{}
+		log := NewLog(nil, store)
+		for _, subject := range []string{"a", "b", "c", "d"} {
+			log.Record(WithClient(ctx, Client{IP: "10.0.0.1"}), Event{Type: Login, Actor: subject, Subject: subject, Result: ResultSuccess})
+		}
+		return store
+	}
+
+	store := chain()
+	require.Equal(t, "10.0.0.1", store.events[0].IP)
+	report, err := Verify(ctx, store, 3, Anchor{Seq: 2, Hash: store.events[1].Hash})
+	require.NoError(t, err)
+	require.True(t, report.Intact())
+	require.Equal(t, &Report{Events: 4, HeadSeq: 4, HeadHash: store.events[3].Hash, Problems: []Problem{}}, report)
+
+	store = chain()
+	store.events[1].Result = "invalid_credentials"
+	report, err = Verify(ctx, store, 3)
+	require.NoError(t, err)
+	require.Equal(t, []Problem{{Seq: 2, Reason: "does not match its hash"}}, report.Problems)
+
+	store = chain()
+	store.events[1].CreatedAt = store.events[1].CreatedAt.Add(time.Hour)
+	store.events[1].Hash = store.events[1].ComputeHash()
+	report, err = Verify(ctx, store, 3)
+	require.NoError(t, err)
+	require.Equal(t, []Problem{{Seq: 3, Reason: "does not link to the event before it"}}, report.Problems)
+
+	store = chain()
+	store.events = append(store.events[:1], store.events[2:]...)
+	report, err = Verify(ctx, store, 3)
+	require.NoError(t, err)
+	require.Equal(t, []Problem{{Seq: 3, Reason: "events 2 to 2 are missing"}}, report.Problems)
+
+	// removing events from the end only shows against an anchor
+	store = chain()
+	anchor := Anchor{Seq: 4, Hash: store.events[3].Hash}
+	store.events = store.events[:3]
+	report, err = Verify(ctx, store, 3, anchor)
+	require.NoError(t, err)
+	require.Equal(t, []Problem{{Seq: 4, Reason: "anchored event is missing"}}, report.Problems)
+
+	_, err = Verify(ctx, store, 0)
+	require.Error(t, err)
+}
+
+func TestLogRun(t *testing.T) {
+	store := &memoryStore{}
+	log := NewLog(zap.NewNop(), store)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		log.Run(ctx)
+	}()
+	require.Eventually(t, func() bool {
+		log.mu.RLock()
+		defer log.mu.RUnlock()
+		return log.running
+	}, time.Second, time.Millisecond)
+
+	for i := 0; i < 100; i++ {
+		log.Record(ctx, Event{Type: Login, Actor: fmt.Sprint(i), Subject: fmt.Sprint(i), Result: ResultSuccess})
+	}
+	cancel()
+	<-done
+
+	// the events queued when Run stops are written all the same, in order
+	require.Len(t, store.events, 100)
+	for i, event := range store.events {
+		require.Equal(t, fmt.Sprint(i), event.Subject)
+	}
+	// and later ones are written right away
+	log.Record(ctx, Event{Type: Login, Actor: "late", Subject: "late", Result: ResultSuccess})
+	require.Len(t, store.events, 101)
+}
@@ -8,17 +8,35 @@ import (
 )
 
 type WebServerConfig struct {
-	Port int
+	Port            int
+	SwaggerUI       bool     `mapstructure:"swagger_ui"`        // serve Swagger UI for /openapi.json at /docs
+	SwaggerUIAssets string   `mapstructure:"swagger_ui_assets"` // base URL of the swagger-ui-dist files; empty serves the embedded ones
+	ProxyHeader     string   `mapstructure:"proxy_header"`      // header with the client address set by a reverse proxy, such as X-Forwarded-For
+	TrustedProxies  []string `mapstructure:"trusted_proxies"`   // addresses or CIDR ranges of the proxies whose proxy header and X-Forwarded-Proto are believed
+}
+
+// GrpcServerConfig configures the gRPC API, which is served without TLS and is off by default.
+type GrpcServerConfig struct {
+	Enabled    bool
+	Port       int
+	Reflection bool // register the server reflection service, for grpcurl and similar tools; off by default
+}
+
+// AdminServerConfig configures the listener of operational endpoints such as /metrics.
+type AdminServerConfig struct {
+	Enabled bool
+	Port    int
 }
 
 type DBConnectionConfig struct {
-	Type     string
-	Host     string
-	Port     int
-	Database string
-	Username string `json:"-"`
-	Password string `json:"-"`
-	Pool     struct {
+	Type        string
+	Host        string
+	Port        int
+	Database    string        // file path for sqlite
+	Username    string        `json:"-"`
+	Password    string        `json:"-"`
+	BusyTimeout time.Duration `mapstructure:"busy_timeout"` // sqlite only
+	Pool        struct {
 		MaxIdleConns int           `mapstructure:"max_idle_conns"`
 		MaxOpenConns int           `mapstructure:"max_open_conns"`
 		IdleTimeout  time.Duration `mapstructure:"idle_timeout"`
@@ -26,11 +44,40 @@ type DBConnectionConfig struct {
 }
 
 type MongoDbConnectionConfig struct {
-	Host     string
-	Port     int
-	Database string
-	Username string `json:"-"`
-	Password string `json:"-"`
+	URI        string `json:"-"` // full connection string, e.g. mongodb+srv://..., overrides host and port
+	Host       string
+	Port       int
+	Database   string
+	Username   string `json:"-"` // no default; credentials in the URI take precedence
+	Password   string `json:"-"`
+	AuthSource string `mapstructure:"auth_source"`
+	ReplicaSet string `mapstructure:"replica_set"`
+	TLS        struct {
+		Enabled            bool
+		CAFile             string `mapstructure:"ca_file"`
+		CertFile           string `mapstructure:"cert_file"`
+		KeyFile            string `mapstructure:"key_file"`
+		InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"`
+	}
+	ReadPreference string `mapstructure:"read_preference"` // primary, primaryPreferred, secondary, secondaryPreferred, nearest
+	WriteConcern   struct {
+		W        string // number of nodes or "majority"
+		Journal  bool
+		WTimeout time.Duration `mapstructure:"wtimeout"`
+	} `mapstructure:"write_concern"`
+	ConnectTimeout         time.Duration `mapstructure:"connect_timeout"`
+	ServerSelectionTimeout time.Duration `mapstructure:"server_selection_timeout"`
+	SocketTimeout          time.Duration `mapstructure:"socket_timeout"`
+	Pool                   struct {
+		MinSize     uint64        `mapstructure:"min_size"`
+		MaxSize     uint64        `mapstructure:"max_size"`
+		MaxIdleTime time.Duration `mapstructure:"max_idle_time"`
+	}
+	Startup struct {
+		Timeout         time.Duration // give up connecting at startup after this long
+		InitialInterval time.Duration `mapstructure:"initial_interval"`
+		MaxInterval     time.Duration `mapstructure:"max_interval"`
+	}
 }
 
 type AppConfig struct {
@@ -40,6 +87,131 @@ type AppConfig struct {
 	TokenExpirationTimeMinutes        int    `mapstructure:"token_expiration_time_minutes"`         // in minutes
 	RefreshTokenExpirationTimeMinutes int    `mapstructure:"refresh_token_expiration_time_minutes"` // in minutes
 	TokenSecret                       string `mapstructure:"token_secret"`
+	// registrations that have not progressed for RegistrationTimeout are completed or rolled back
+	RegistrationTimeout          time.Duration           `mapstructure:"registration_timeout"`
+	RegistrationRecoveryInterval time.Duration           `mapstructure:"registration_recovery_interval"`
+	Timeouts                     TimeoutsConfig          `mapstructure:"timeouts"`
+	ForwardAuth                  ForwardAuthConfig       `mapstructure:"forward_auth"`
+	HashingPoolSize              int                     `mapstructure:"hashing_pool_size"` // concurrent bcrypt operations, one per CPU when 0
+	LoginHistory                 LoginHistoryConfig      `mapstructure:"login_history"`
+	LoginAlerts                  LoginAlertsConfig       `mapstructure:"login_alerts"`
+	EmailVerification            EmailVerificationConfig `mapstructure:"email_verification"`
+	Passwordless                 PasswordlessConfig      `mapstructure:"passwordless"`
+}
+
+// LoginHistoryConfig configures how long the login attempts of users are kept.
+type LoginHistoryConfig struct {
+	Retention     time.Duration // attempts older than this are removed; 0 keeps them forever
+	PurgeInterval time.Duration `mapstructure:"purge_interval"`
+}
+
+// LoginAlertsConfig configures the recognition of devices and the rules that flag suspicious logins,
+// of which users are notified.
+type LoginAlertsConfig struct {
+	Enabled               bool
+	DeviceCookie          string        `mapstructure:"device_cookie"`            // name of the cookie holding the device token
+	DeviceLifetime        time.Duration `mapstructure:"device_lifetime"`          // how long the device cookie is kept by browsers
+	DeviceRetention       time.Duration `mapstructure:"device_retention"`         // devices unseen for longer are removed; 0 keeps them forever
+	HistoryWindow         time.Duration `mapstructure:"history_window"`           // logins within this window make up what is usual for a user
+	GeoIPFile             string        `mapstructure:"geoip_file"`               // DB-IP "IP to City Lite" CSV; impossible travel is not checked without it
+	MaxTravelSpeed        float64       `mapstructure:"max_travel_speed"`         // in km/h, faster travel between logins is impossible
+	UnusualHoursMinLogins int           `mapstructure:"unusual_hours_min_logins"` // logins needed before unusual hours are flagged; 0 disables the rule
+}
+
+// EmailVerificationConfig configures the verification of the email addresses users register with.
+type EmailVerificationConfig struct {
+	Enabled         bool          // send verification links; RequireVerified only applies when enabled
+	RequireVerified bool          `mapstructure:"require_verified"` // refuse logins of users who have not verified their email
+	URL             string        // page of the client that verification links point to; the token is added as the token query parameter
+	TokenLifetime   time.Duration `mapstructure:"token_lifetime"`
+	ResendInterval  time.Duration `mapstructure:"resend_interval"` // minimum time between two verification emails to a user
+}
+
+// PasswordlessConfig configures logins with magic links and one-time codes, and registration without a password.
+type PasswordlessConfig struct {
+	Enabled           bool          // needs notify.email.enabled, so that links and codes are not only written to the log
+	MagicLinkURL      string        `mapstructure:"magic_link_url"` // page of the client that magic links point to; the token is added as the token query parameter
+	MagicLinkLifetime time.Duration `mapstructure:"magic_link_lifetime"`
+	CodeLifetime      time.Duration `mapstructure:"code_lifetime"`
+	MaxAttempts       int           `mapstructure:"max_attempts"`    // attempts to use a code or a link, right or wrong, after which it no longer works
+	PurgeInterval     time.Duration `mapstructure:"purge_interval"`  // how often expired challenges are removed
+	ResendInterval    time.Duration `mapstructure:"resend_interval"` // minimum time between two links or codes to a user
+	ClientLimit       int           `mapstructure:"client_limit"`    // links and codes requested from one client address per client window
+	ClientWindow      time.Duration `mapstructure:"client_window"`
+}
+
+// ForwardAuthConfig configures the forward-auth endpoint used by reverse proxies.
+type ForwardAuthConfig struct {
+	Cookie string // name of the cookie holding the access token, read when there is no bearer token
+}
+
+// TimeoutsConfig bounds each API operation as a whole, and every single database call within it.
+type TimeoutsConfig struct {
+	Login    time.Duration
+	Refresh  time.Duration
+	Register time.Duration
+	Query    time.Duration
+}
+
+// HealthConfig configures the readiness checks and the draining at shutdown.
+type HealthConfig struct {
+	DrainDelay      time.Duration        `mapstructure:"drain_delay"`       // readiness fails for this long before the listeners close
+	MaxHashingQueue int64                `mapstructure:"max_hashing_queue"` // password hashes waiting for the pool beyond which the server is not ready
+	Timeouts        HealthTimeoutsConfig `mapstructure:"timeouts"`
+}
+
+// HealthTimeoutsConfig bounds each readiness check.
+type HealthTimeoutsConfig struct {
+	Mongo      time.Duration
+	SQL        time.Duration
+	Migrations time.Duration
+}
+
+// TracingConfig configures the export of OpenTelemetry traces.
+type TracingConfig struct {
+	Enabled     bool
+	Exporter    string  // "otlp" or "stdout"
+	Endpoint    string  // host:port of the OTLP gRPC receiver; OTEL_EXPORTER_OTLP_ENDPOINT applies when empty
+	Insecure    bool    // connect to the OTLP receiver without TLS
+	File        string  // file the stdout exporter writes to instead of stdout
+	SampleRatio float64 `mapstructure:"sample_ratio"` // share of new traces that are recorded; traces sampled by the caller always are
+}
+
+// NotifyConfig configures the delivery of notifications to users.
+type NotifyConfig struct {
+	Email     EmailConfig
+	SMS       SMSConfig `mapstructure:"sms"`
+	Templates string    // directory of the template overrides of tenants, one subdirectory per tenant
+	QueueSize int       `mapstructure:"queue_size"` // notifications waiting for delivery beyond which new ones are dead-lettered
+	Workers   int
+	Retry     struct {
+		Attempts        int           // deliveries of a notification before it is dead-lettered
+		InitialInterval time.Duration `mapstructure:"initial_interval"`
+		MaxInterval     time.Duration `mapstructure:"max_interval"`
+	}
+}
+
+// EmailConfig configures the SMTP server emails are sent through. Without it emails are logged.
+type EmailConfig struct {
+	Enabled    bool
+	Host       string
+	Port       int
+	Username   string `json:"-"` // authenticate with PLAIN when set
+	Password   string `json:"-"`
+	From       string
+	StartTLS   bool          `mapstructure:"starttls"`    // upgrade to TLS when the server offers it
+	RequireTLS bool          `mapstructure:"require_tls"` // refuse to send to a server that does not offer STARTTLS
+	Timeout    time.Duration // for the whole conversation with the server
+}
+
+// SMSConfig configures the provider text messages are sent through.
+type SMSConfig struct {
+	Provider string // "log", or "file" to append every message to File
+	File     string
+}
+
+type I18nConfig struct {
+	DefaultLocale string `mapstructure:"default_locale"` // used when neither the user nor Accept-Language picks a supported locale
 }
 
 type LoggingConfig struct {
@@ -51,16 +223,30 @@ type LoggingConfig struct {
 }
 
 type Config struct {
-	Debug   bool                    `mapstructure:"debug"`
-	App     *AppConfig              `mapstructure:"app"`
-	Logging LoggingConfig           `mapstructure:"logging"`
-	Mongo   MongoDbConnectionConfig `mapstructure:"mongo"`
-	Web     WebServerConfig         `mapstructure:"web"`
-	Db      DBConnectionConfig      `mapstructure:"db"`
+	Debug           bool                    `mapstructure:"debug"`
+	Storage         string                  `mapstructure:"storage"` // "mongo" or "sql"
+	App             *AppConfig              `mapstructure:"app"`
+	Logging         LoggingConfig           `mapstructure:"logging"`
+	I18n            I18nConfig              `mapstructure:"i18n"`
+	Mongo           MongoDbConnectionConfig `mapstructure:"mongo"`
+	Web             WebServerConfig         `mapstructure:"web"`
+	Grpc            GrpcServerConfig        `mapstructure:"grpc"`
+	Admin           AdminServerConfig       `mapstructure:"admin"`
+	Db              DBConnectionConfig      `mapstructure:"db"`
+	Health          HealthConfig            `mapstructure:"health"`
+	Tracing         TracingConfig           `mapstructure:"tracing"`
+	Notify          NotifyConfig            `mapstructure:"notify"`
+	ShutdownTimeout time.Duration           `mapstructure:"shutdown_timeout"` // for in-flight requests and background work to finish
 }
 
 var C = new(Config)
 
+// UsersInSQL reports whether user documents are kept in the SQL database instead of MongoDB.
+// sqlite deployments always run without MongoDB.
+func (c *Config) UsersInSQL() bool {
+	return c.Storage == "sql" || c.Db.Type == "sqlite"
+}
+
 func InitConfiguration() *Config {
 	initConfig()
 	viper.WatchConfig()
@@ -84,12 +270,71 @@ func initConfig() {
 
 func LoadDefault() {
 	viper.SetDefault("debug", false)
+	viper.SetDefault("storage", "mongo")
+	viper.SetDefault("shutdown_timeout", 30*time.Second)
+	viper.SetDefault("i18n.default_locale", "en")
 	viper.SetDefault("app.name", "tutorial-auth")
 	viper.SetDefault("app.password_life_time", 1)
 	viper.SetDefault("app.password_min_length", 8)
 	viper.SetDefault("app.token_expiration_time_minutes", 5)
 	viper.SetDefault("app.refresh_token_expiration_time_hours", 60)
 	viper.SetDefault("app.token_secret", "secret")
+	viper.SetDefault("app.registration_timeout", time.Minute)
+	viper.SetDefault("app.registration_recovery_interval", 5*time.Minute)
+	viper.SetDefault("app.timeouts.login", 5*time.Second)
+	viper.SetDefault("app.timeouts.refresh", 3*time.Second)
+	viper.SetDefault("app.timeouts.register", 10*time.Second)
+	viper.SetDefault("app.timeouts.query", 2*time.Second)
+	viper.SetDefault("app.forward_auth.cookie", "access_token")
+	viper.SetDefault("app.hashing_pool_size", 0)
+	viper.SetDefault("app.login_history.retention", 90*24*time.Hour)
+	viper.SetDefault("app.login_history.purge_interval", time.Hour)
+	viper.SetDefault("app.login_alerts.enabled", true)
+	viper.SetDefault("app.login_alerts.device_cookie", "device_id")
+	viper.SetDefault("app.login_alerts.device_lifetime", 365*24*time.Hour)
+	viper.SetDefault("app.login_alerts.device_retention", 365*24*time.Hour)
+	viper.SetDefault("app.login_alerts.history_window", 90*24*time.Hour)
+	viper.SetDefault("app.login_alerts.max_travel_speed", 1000)
+	viper.SetDefault("app.login_alerts.unusual_hours_min_logins", 20)
+	viper.SetDefault("app.email_verification.enabled", true)
+	viper.SetDefault("app.email_verification.require_verified", false)
+	viper.SetDefault("app.email_verification.url", "http://localhost:3000/verify-email")
+	viper.SetDefault("app.email_verification.token_lifetime", 24*time.Hour)
+	viper.SetDefault("app.email_verification.resend_interval", time.Minute)
+	viper.SetDefault("app.passwordless.enabled", false)
+	viper.SetDefault("app.passwordless.magic_link_url", "http://localhost:3000/magic-link")
+	viper.SetDefault("app.passwordless.magic_link_lifetime", 15*time.Minute)
+	viper.SetDefault("app.passwordless.code_lifetime", 10*time.Minute)
+	viper.SetDefault("app.passwordless.max_attempts", 5)
+	viper.SetDefault("app.passwordless.purge_interval", time.Hour)
+	viper.SetDefault("app.passwordless.resend_interval", time.Minute)
+	viper.SetDefault("app.passwordless.client_limit", 20)
+	viper.SetDefault("app.passwordless.client_window", time.Hour)
+
+	viper.SetDefault("tracing.enabled", false)
+	viper.SetDefault("tracing.exporter", "otlp")
+	viper.SetDefault("tracing.sample_ratio", 1.0)
+
+	viper.SetDefault("notify.email.enabled", false)
+	viper.SetDefault("notify.email.host", "localhost")
+	viper.SetDefault("notify.email.port", 1025)
+	viper.SetDefault("notify.email.from", "no-reply@localhost")
+	viper.SetDefault("notify.email.starttls", true)
+	viper.SetDefault("notify.email.require_tls", false)
+	viper.SetDefault("notify.email.timeout", 10*time.Second)
+	viper.SetDefault("notify.sms.provider", "log")
+	viper.SetDefault("notify.sms.file", "logs/sms.log")
+	viper.SetDefault("notify.queue_size", 1000)
+	viper.SetDefault("notify.workers", 2)
+	viper.SetDefault("notify.retry.attempts", 5)
+	viper.SetDefault("notify.retry.initial_interval", time.Second)
+	viper.SetDefault("notify.retry.max_interval", time.Minute)
+
+	viper.SetDefault("health.drain_delay", 5*time.Second)
+	viper.SetDefault("health.max_hashing_queue", 32)
+	viper.SetDefault("health.timeouts.mongo", 2*time.Second)
+	viper.SetDefault("health.timeouts.sql", 2*time.Second)
+	viper.SetDefault("health.timeouts.migrations", 5*time.Second)
 
 	viper.SetDefault("logging.level", "info")
 	viper.SetDefault("logging.path", "logs")
@@ -100,10 +345,27 @@ func LoadDefault() {
 	viper.SetDefault("mongo.host", "localhost")
 	viper.SetDefault("mongo.port", 27018)
 	viper.SetDefault("mongo.database", "mongo-auth-db")
-	viper.SetDefault("mongo.username", "root")
-	viper.SetDefault("mongo.password", "root")
+	viper.SetDefault("mongo.auth_source", "admin")
+	viper.SetDefault("mongo.read_preference", "primary")
+	viper.SetDefault("mongo.write_concern.w", "majority")
+	viper.SetDefault("mongo.connect_timeout", 10*time.Second)
+	viper.SetDefault("mongo.server_selection_timeout", 10*time.Second)
+	viper.SetDefault("mongo.pool.max_size", 100)
+	viper.SetDefault("mongo.pool.max_idle_time", 5*time.Minute)
+	viper.SetDefault("mongo.startup.timeout", 2*time.Minute)
+	viper.SetDefault("mongo.startup.initial_interval", 500*time.Millisecond)
+	viper.SetDefault("mongo.startup.max_interval", 15*time.Second)
 
 	viper.SetDefault("web.port", 8080)
+	viper.SetDefault("grpc.enabled", false)
+	viper.SetDefault("grpc.port", 9090)
+	viper.SetDefault("grpc.reflection", false)
+	viper.SetDefault("admin.enabled", true)
+	viper.SetDefault("admin.port", 8081)
+	viper.SetDefault("web.swagger_ui", false)
+	viper.SetDefault("web.swagger_ui_assets", "")
+	viper.SetDefault("web.proxy_header", "")
+	viper.SetDefault("web.trusted_proxies", []string{})
 
 	viper.SetDefault("db.type", "postgres")
 	viper.SetDefault("db.host", "localhost")
@@ -114,6 +376,7 @@ func LoadDefault() {
 	viper.SetDefault("db.pool.max_idle_conns", 1)
 	viper.SetDefault("db.pool.max_open_conns", 10)
 	viper.SetDefault("db.pool.idle_timeout", 300*time.Second)
+	viper.SetDefault("db.busy_timeout", 5*time.Second)
 }
 
 func LoadEnv() {
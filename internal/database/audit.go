@@ -0,0 +1,65 @@
+package database
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+	"time"
+	"tutorial-auth/internal/audit"
+)
+
+// AuditStore keeps the audit log in the audit_events table. Rows are only ever inserted, and the
+// triggers of the table refuse to update or delete them. The single row of audit_head holds the
+// sequence number and the hash of the last event.
+type AuditStore struct {
+	db *sqlx.DB
+}
+
+func NewAuditStore(db *sqlx.DB) *AuditStore {
+	return &AuditStore{db: db}
+}
+
+// Append links the event to the last one and inserts it. Advancing the head locks its row until
+// the transaction ends, so appends of every instance take turns and never claim the same number.
+func (s *AuditStore) Append(ctx context.Context, event *audit.Event) error {
+	// the hash covers the time as the database returns it
+	event.CreatedAt = event.CreatedAt.UTC().Truncate(time.Microsecond)
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, "UPDATE audit_head SET seq = seq + 1 WHERE id = 1"); err != nil {
+		return err
+	}
+	var head audit.Event
+	if err = tx.GetContext(ctx, &head, "SELECT seq, hash FROM audit_head WHERE id = 1"); err != nil {
+		return err
+	}
+
+	event.Seq = head.Seq
+	event.PrevHash = head.Hash
+	event.Hash = event.ComputeHash()
+	_, err = tx.NamedExecContext(ctx, `INSERT INTO audit_events
+		(seq, type, actor, subject, ip, user_agent, result, detail, created_at, prev_hash, hash)
+		VALUES (:seq, :type, :actor, :subject, :ip, :user_agent, :result, :detail, :created_at, :prev_hash, :hash)`, event)
+	if err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, tx.Rebind("UPDATE audit_head SET hash = ? WHERE id = 1"), event.Hash); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Range returns up to limit events after the sequence number after, in order.
+func (s *AuditStore) Range(ctx context.Context, after int64, limit int) ([]audit.Event, error) {
+	var events []audit.Event
+	query := s.db.Rebind(`SELECT seq, type, actor, subject, ip, user_agent, result, detail, created_at, prev_hash, hash
+		FROM audit_events WHERE seq > ? ORDER BY seq LIMIT ?`)
+	if err := s.db.SelectContext(ctx, &events, query, after, limit); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
@@ -0,0 +1,49 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+	"tutorial-auth/internal/audit"
+)
+
+func TestAuditStoreConformance(t *testing.T) {
+	for name, cfg := range dialects(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			db := openDB(t, cfg)
+
+			// two stores append like two instances would
+			stores := []*AuditStore{NewAuditStore(db), NewAuditStore(db)}
+			errs := make(chan error, 10)
+			for i := 0; i < cap(errs); i++ {
+				go func(i int) {
+					errs <- stores[i%2].Append(ctx, &audit.Event{
+						Type: audit.Login, Actor: "user", Subject: "user", IP: "127.0.0.1", UserAgent: "test",
+						Result: audit.ResultSuccess, Detail: fmt.Sprint(i), CreatedAt: time.Now(),
+					})
+				}(i)
+			}
+			for i := 0; i < cap(errs); i++ {
+				require.NoError(t, <-errs)
+			}
+
+			report, err := audit.Verify(ctx, stores[0], 3)
+			require.NoError(t, err)
+			require.True(t, report.Intact(), "%v", report.Problems)
+			require.EqualValues(t, 10, report.Events)
+			require.EqualValues(t, 10, report.HeadSeq)
+			var head audit.Event
+			require.NoError(t, db.GetContext(ctx, &head, "SELECT seq, hash FROM audit_head"))
+			require.Equal(t, report.HeadSeq, head.Seq)
+			require.Equal(t, report.HeadHash, head.Hash)
+
+			_, err = db.ExecContext(ctx, "UPDATE audit_events SET result = 'invalid_credentials'")
+			require.Error(t, err)
+			_, err = db.ExecContext(ctx, "DELETE FROM audit_events")
+			require.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+// LoginChallenge is a row of the login_challenges table: a magic link or a one-time code sent to a
+// user, which logs the user in once. Only a keyed hash of its secret is stored.
+type LoginChallenge struct {
+	ID         string       `db:"id"`
+	UserID     string       `db:"user_id"`
+	Method     string       `db:"method"`
+	Channel    string       `db:"channel"`
+	SecretHash string       `db:"secret_hash"`
+	Attempts   int          `db:"attempts"`
+	ExpiresAt  time.Time    `db:"expires_at"`
+	ConsumedAt sql.NullTime `db:"consumed_at"`
+	CreatedAt  time.Time    `db:"created_at"`
+}
+
+// LoginChallengeStore keeps the challenges of passwordless logins in the login_challenges table.
+// Attempts and consumption are conditional updates, so that concurrent requests cannot go past the
+// limit of attempts or use a challenge twice.
+type LoginChallengeStore struct {
+	db *sqlx.DB
+}
+
+func NewLoginChallengeStore(db *sqlx.DB) *LoginChallengeStore {
+	return &LoginChallengeStore{db: db}
+}
+
+func (s *LoginChallengeStore) Insert(ctx context.Context, challenge *LoginChallenge) error {
+	challenge.ExpiresAt = challenge.ExpiresAt.UTC().Truncate(time.Microsecond)
+	challenge.CreatedAt = challenge.CreatedAt.UTC().Truncate(time.Microsecond)
+	_, err := s.db.NamedExecContext(ctx, `INSERT INTO login_challenges
+		(id, user_id, method, channel, secret_hash, attempts, expires_at, created_at)
+		VALUES (:id, :user_id, :method, :channel, :secret_hash, :attempts, :expires_at, :created_at)`, challenge)
+	return err
+}
+
+// Get returns the challenge, or sql.ErrNoRows if there is none.
+func (s *LoginChallengeStore) Get(ctx context.Context, id string) (*LoginChallenge, error) {
+	var challenge LoginChallenge
+	query := s.db.Rebind(`SELECT id, user_id, method, channel, secret_hash, attempts, expires_at, consumed_at, created_at
+		FROM login_challenges WHERE id = ?`)
+	if err := s.db.GetContext(ctx, &challenge, query, id); err != nil {
+		return nil, err
+	}
+	return &challenge, nil
+}
+
+// Attempt counts an attempt to answer the challenge. It returns false without counting when the
+// challenge has been used or has had maxAttempts attempts already.
+func (s *LoginChallengeStore) Attempt(ctx context.Context, id string, maxAttempts int) (bool, error) {
+	query := s.db.Rebind(`UPDATE login_challenges SET attempts = attempts + 1
+		WHERE id = ? AND consumed_at IS NULL AND attempts < ?`)
+	return affected(s.db.ExecContext(ctx, query, id, maxAttempts))
+}
+
+// Consume marks the challenge as used at now. It returns false if it was used already or has
+// expired, so that a challenge logs in once at most.
+func (s *LoginChallengeStore) Consume(ctx context.Context, id string, now time.Time) (bool, error) {
+	now = now.UTC().Truncate(time.Microsecond)
+	query := s.db.Rebind("UPDATE login_challenges SET consumed_at = ? WHERE id = ? AND consumed_at IS NULL AND expires_at > ?")
+	return affected(s.db.ExecContext(ctx, query, now, id, now))
+}
+
+// Revoke uses up the open challenges of method of the user at now, so that only a challenge issued
+// after it works.
+func (s *LoginChallengeStore) Revoke(ctx context.Context, userID string, method string, now time.Time) error {
+	query := s.db.Rebind("UPDATE login_challenges SET consumed_at = ? WHERE user_id = ? AND method = ? AND consumed_at IS NULL")
+	_, err := s.db.ExecContext(ctx, query, now.UTC().Truncate(time.Microsecond), userID, method)
+	return err
+}
+
+// Limit counts a challenge issued to subject, a user or a client address, at now and reports
+// whether it is one of the first limit in its window. A window starts with the first challenge
+// after the previous one has passed. Every step is a conditional update or an insert of the
+// primary key, so that concurrent requests cannot go past the limit.
+func (s *LoginChallengeStore) Limit(ctx context.Context, subject string, now time.Time, window time.Duration, limit int) (bool, error) {
+	now = now.UTC().Truncate(time.Microsecond)
+	windowStart := now.Add(-window)
+	for i := 0; i < 2; i++ {
+		query := s.db.Rebind("UPDATE login_challenge_limits SET issued = issued + 1 WHERE subject = ? AND window_start > ? AND issued < ?")
+		counted, err := affected(s.db.ExecContext(ctx, query, subject, windowStart, limit))
+		if err != nil || counted {
+			return counted, err
+		}
+		query = s.db.Rebind("UPDATE login_challenge_limits SET window_start = ?, issued = 1 WHERE subject = ? AND window_start <= ?")
+		counted, err = affected(s.db.ExecContext(ctx, query, now, subject, windowStart))
+		if err != nil || counted {
+			return counted, err
+		}
+		query = s.db.Rebind("INSERT INTO login_challenge_limits (subject, window_start, issued) VALUES (?, ?, 1)")
+		if _, err = s.db.ExecContext(ctx, query, subject, now); !IsUniqueViolation(err) {
+			return err == nil, err
+		}
+		// a concurrent challenge started the window, count against it
+	}
+	return false, nil
+}
+
+// DeleteExpiredLimits removes up to limit limits whose window started before before and returns
+// how many it removed.
+func (s *LoginChallengeStore) DeleteExpiredLimits(ctx context.Context, before time.Time, limit int) (int, error) {
+	var subjects []string
+	query := s.db.Rebind("SELECT subject FROM login_challenge_limits WHERE window_start < ? LIMIT ?")
+	if err := s.db.SelectContext(ctx, &subjects, query, before.UTC(), limit); err != nil || len(subjects) == 0 {
+		return 0, err
+	}
+
+	query, args, err := sqlx.In("DELETE FROM login_challenge_limits WHERE subject IN (?) AND window_start < ?", subjects, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	res, err := s.db.ExecContext(ctx, s.db.Rebind(query), args...)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// DeleteExpired removes up to limit challenges that expired before before and returns how many it removed.
+func (s *LoginChallengeStore) DeleteExpired(ctx context.Context, before time.Time, limit int) (int, error) {
+	var ids []string
+	query := s.db.Rebind("SELECT id FROM login_challenges WHERE expires_at < ? LIMIT ?")
+	if err := s.db.SelectContext(ctx, &ids, query, before.UTC(), limit); err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	query, args, err := sqlx.In("DELETE FROM login_challenges WHERE id IN (?)", ids)
+	if err != nil {
+		return 0, err
+	}
+	res, err := s.db.ExecContext(ctx, s.db.Rebind(query), args...)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+func affected(res sql.Result, err error) (bool, error) {
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
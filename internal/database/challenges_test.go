@@ -0,0 +1,70 @@
+package database
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestLoginChallengeLimitConformance(t *testing.T) {
+	for name, cfg := range dialects(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			store := NewLoginChallengeStore(openDB(t, cfg))
+			now := time.Now()
+
+			// concurrent challenges, the first of which starts the window, only get up to the limit
+			counted := make(chan bool, 10)
+			for i := 0; i < cap(counted); i++ {
+				go func() {
+					allowed, err := store.Limit(ctx, "client:203.0.113.5", now, time.Minute, 3)
+					require.NoError(t, err)
+					counted <- allowed
+				}()
+			}
+			allowed := 0
+			for i := 0; i < cap(counted); i++ {
+				if <-counted {
+					allowed++
+				}
+			}
+			require.Equal(t, 3, allowed)
+
+			// the next window starts over
+			ok, err := store.Limit(ctx, "client:203.0.113.5", now.Add(2*time.Minute), time.Minute, 3)
+			require.NoError(t, err)
+			require.True(t, ok)
+			ok, err = store.Limit(ctx, "user:guid", now, time.Minute, 1)
+			require.NoError(t, err)
+			require.True(t, ok)
+
+			removed, err := store.DeleteExpiredLimits(ctx, now.Add(time.Minute), 10)
+			require.NoError(t, err)
+			require.Equal(t, 1, removed)
+		})
+	}
+}
+
+func TestLoginChallengeRevokeConformance(t *testing.T) {
+	for name, cfg := range dialects(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			store := NewLoginChallengeStore(openDB(t, cfg))
+			now := time.Now()
+
+			for _, id := range []string{"code", "link"} {
+				require.NoError(t, store.Insert(ctx, &LoginChallenge{ID: id, UserID: "guid", Method: id, Channel: "email",
+					SecretHash: "hash", ExpiresAt: now.Add(time.Hour), CreatedAt: now}))
+			}
+			require.NoError(t, store.Revoke(ctx, "guid", "code", now))
+
+			consumed, err := store.Consume(ctx, "code", now)
+			require.NoError(t, err)
+			require.False(t, consumed)
+			consumed, err = store.Consume(ctx, "link", now)
+			require.NoError(t, err)
+			require.True(t, consumed)
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+	"tutorial-auth/internal/config"
+	"tutorial-auth/internal/mongodb/models"
+)
+
+// dialects returns the databases the conformance tests run against. sqlite always runs;
+// mysql and postgres run when AUTH_TEST_MYSQL_ADDR or AUTH_TEST_POSTGRES_ADDR point at a
+// server started from docker-compose.dev.yml, e.g. AUTH_TEST_MYSQL_ADDR=localhost:3307.
+func dialects(t *testing.T) map[string]*config.DBConnectionConfig {
+	sqlite := &config.DBConnectionConfig{
+		Type:        "sqlite",
+		Database:    filepath.Join(t.TempDir(), "auth.db"),
+		BusyTimeout: 5 * time.Second,
+	}
+	sqlite.Pool.MaxOpenConns = 4
+	result := map[string]*config.DBConnectionConfig{"sqlite": sqlite}
+
+	servers := map[string]*config.DBConnectionConfig{
+		"AUTH_TEST_MYSQL_ADDR":    {Type: "mysql", Database: "mysql-auth-database", Username: "user", Password: "password"},
+		"AUTH_TEST_POSTGRES_ADDR": {Type: "postgres", Database: "postgres-auth-database", Username: "user", Password: "password"},
+	}
+	for env, cfg := range servers {
+		addr := os.Getenv(env)
+		if addr == "" {
+			continue
+		}
+		host, port, err := net.SplitHostPort(addr)
+		require.NoError(t, err)
+		cfg.Host = host
+		cfg.Port, err = strconv.Atoi(port)
+		require.NoError(t, err)
+		cfg.Pool.MaxOpenConns = 4
+		result[cfg.Type] = cfg
+	}
+	return result
+}
+
+func openDB(t *testing.T, cfg *config.DBConnectionConfig) *sqlx.DB {
+	db, err := NewConnectionDB(cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	require.NoError(t, ApplyMigration(zap.NewNop(), cfg.Type, db))
+	return db
+}
+
+func newUser() *models.User {
+	guid := uuid.New().String()
+	return &models.User{
+		GUID:      guid,
+		Login:     guid + "@example.com",
+		LoginType: models.LoginType{ID: 1, Name: "email"},
+		Name:      "Ivan",
+		CreatedAt: time.Now(),
+	}
+}
+
+func TestUserStoreConformance(t *testing.T) {
+	for name, cfg := range dialects(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			store := NewUserStore(openDB(t, cfg))
+
+			user := newUser()
+			require.NoError(t, store.Insert(ctx, user))
+			require.True(t, IsUniqueViolation(store.Insert(ctx, user)))
+
+			found, err := store.GetByLogin(ctx, user.Login)
+			require.NoError(t, err)
+			require.Equal(t, user.GUID, found.GUID)
+			require.Equal(t, user.LoginType, found.LoginType)
+			require.True(t, found.LastLoginAt.IsZero())
+			require.False(t, found.EmailVerified)
+			require.NoError(t, store.SetEmailVerified(ctx, user.GUID, true))
+			found, err = store.GetByLogin(ctx, user.Login)
+			require.NoError(t, err)
+			require.True(t, found.EmailVerified)
+
+			missing, err := store.GetByLogin(ctx, "nobody-"+user.Login)
+			require.NoError(t, err)
+			require.Nil(t, missing)
+
+			require.NoError(t, store.UpdateRefreshTokenAndLastLoginAt(ctx, user.GUID, "token"))
+			require.NoError(t, store.UpdateRefreshToken(ctx, user.GUID, "rotated"))
+			found, err = store.GetByGuid(ctx, user.GUID)
+			require.NoError(t, err)
+			require.Equal(t, "rotated", found.RefreshToken)
+			require.WithinDuration(t, time.Now(), found.LastLoginAt, time.Minute)
+
+			require.NoError(t, store.DeleteByGuid(ctx, user.GUID))
+			_, err = store.GetByGuid(ctx, user.GUID)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestUserStoreImportConformance(t *testing.T) {
+	for name, cfg := range dialects(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			store := NewUserStore(openDB(t, cfg))
+
+			user := newUser()
+			user.LastLoginAt = time.Now()
+			user.RefreshToken = "token"
+			user.Attributes = map[string]any{"locale": "ru"}
+
+			imported, err := store.Import(ctx, user)
+			require.NoError(t, err)
+			require.True(t, imported)
+
+			imported, err = store.Import(ctx, user)
+			require.NoError(t, err)
+			require.False(t, imported)
+
+			found, err := store.GetByGuid(ctx, user.GUID)
+			require.NoError(t, err)
+			require.Equal(t, "token", found.RefreshToken)
+			require.Equal(t, "ru", found.Attributes["locale"])
+			require.False(t, found.LastLoginAt.IsZero())
+
+			// another user with the same login is a conflict the import reports
+			conflicting := newUser()
+			conflicting.Login = user.Login
+			_, err = store.Import(ctx, conflicting)
+			require.True(t, IsUniqueViolation(err))
+		})
+	}
+}
+
+func TestPasswordQueriesConformance(t *testing.T) {
+	for name, cfg := range dialects(t) {
+		t.Run(name, func(t *testing.T) {
+			db := openDB(t, cfg)
+			guid := uuid.New().String()
+
+			_, err := db.Exec(db.Rebind("INSERT INTO passwords (user_id, password, expires_at) VALUES (?, ?, ?)"),
+				guid, "hash", time.Now().Add(time.Hour))
+			require.NoError(t, err)
+
+			var password string
+			query := db.Rebind("SELECT password FROM passwords WHERE user_id = ? AND expires_at > ? ORDER BY expires_at DESC LIMIT 1")
+			require.NoError(t, db.QueryRow(query, guid, time.Now()).Scan(&password))
+			require.Equal(t, "hash", password)
+
+			err = db.QueryRow(query, guid, time.Now().Add(2*time.Hour)).Scan(&password)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestSqliteConcurrentWrites(t *testing.T) {
+	ctx := context.Background()
+	store := NewUserStore(openDB(t, dialects(t)["sqlite"]))
+
+	errs := make(chan error, 20)
+	for i := 0; i < cap(errs); i++ {
+		go func(i int) {
+			user := newUser()
+			user.Login = fmt.Sprintf("user%d@example.com", i)
+			errs <- store.Insert(ctx, user)
+		}(i)
+	}
+	for i := 0; i < cap(errs); i++ {
+		require.NoError(t, <-errs)
+	}
+}
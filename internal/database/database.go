@@ -1,12 +1,13 @@
 package database
 
 import (
+	"context"
 	"embed"
 	"fmt"
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
 	"github.com/pressly/goose/v3"
 	"go.uber.org/zap"
+	"sync"
 	"tutorial-auth/internal/config"
 )
 
@@ -16,11 +17,13 @@ func NewConnectionDB(cfg *config.DBConnectionConfig) (*sqlx.DB, error) {
 
 	switch cfg.Type {
 	case "postgres":
-		db, err = sqlx.Open("postgres", fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
+		db, err = openInstrumented("postgres", fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
 			cfg.Host, cfg.Port, cfg.Username, cfg.Password, cfg.Database))
 	case "mysql":
-		db, err = sqlx.Open("mysql", fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?parseTime=true",
+		db, err = openInstrumented("mysql", fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?parseTime=true",
 			cfg.Username, cfg.Password, cfg.Host, cfg.Port, cfg.Database))
+	case "sqlite":
+		db, err = openSqlite(cfg)
 	default:
 		db, err = nil, fmt.Errorf("unsupported db type: %s", cfg.Type)
 	}
@@ -32,15 +35,38 @@ func NewConnectionDB(cfg *config.DBConnectionConfig) (*sqlx.DB, error) {
 	db.SetMaxIdleConns(cfg.Pool.MaxIdleConns)
 	db.SetConnMaxIdleTime(cfg.Pool.IdleTimeout)
 
+	if cfg.Type == "sqlite" && cfg.Database == ":memory:" {
+		// every connection to :memory: opens its own empty database
+		db.SetMaxOpenConns(1)
+	}
+
 	return db, nil
 }
 
-//go:embed migrations/*.sql
+// openSqlite opens the database file in WAL mode, so readers do not block the writer.
+// SQLite allows a single writer at a time: busy_timeout makes a blocked connection wait
+// for the lock instead of failing with SQLITE_BUSY, and is set first so that connections opened
+// while another switches the file to WAL wait as well. _txlock=immediate takes the write
+// lock when a transaction begins, so two transactions can never deadlock on a lock upgrade.
+func openSqlite(cfg *config.DBConnectionConfig) (*sqlx.DB, error) {
+	dsn := fmt.Sprintf(
+		"file:%s?_pragma=busy_timeout(%d)&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_pragma=foreign_keys(1)&_txlock=immediate",
+		cfg.Database, cfg.BusyTimeout.Milliseconds(),
+	)
+	return openInstrumented("sqlite", dsn)
+}
+
+//go:embed migrations
 var embedMigrations embed.FS
 
+// gooseMu guards the package-level settings of goose.
+var gooseMu sync.Mutex
+
 func ApplyMigration(logger *zap.Logger, DBType string, db *sqlx.DB) error {
 	const op = "database.ApplyMigration"
 
+	gooseMu.Lock()
+	defer gooseMu.Unlock()
 	goose.SetBaseFS(embedMigrations)
 
 	var dialect string
@@ -49,6 +75,8 @@ func ApplyMigration(logger *zap.Logger, DBType string, db *sqlx.DB) error {
 		dialect = "postgres"
 	case "mysql":
 		dialect = "mysql"
+	case "sqlite":
+		dialect = "sqlite"
 	default:
 		logger.Panic("unsupported db type", zap.String("op", op), zap.String("dbType", DBType))
 	}
@@ -57,8 +85,34 @@ func ApplyMigration(logger *zap.Logger, DBType string, db *sqlx.DB) error {
 		return err
 	}
 
-	if err := goose.Up(db.DB, "migrations"); err != nil {
+	if err := goose.Up(db.DB, "migrations/"+dialect); err != nil {
 		return err
 	}
 	return nil
 }
+
+// PendingMigrations counts the embedded migrations that have not been applied to the database.
+func PendingMigrations(ctx context.Context, DBType string, db *sqlx.DB) (int, error) {
+	gooseMu.Lock()
+	defer gooseMu.Unlock()
+	goose.SetBaseFS(embedMigrations)
+	if err := goose.SetDialect(DBType); err != nil {
+		return 0, err
+	}
+
+	current, err := goose.GetDBVersionContext(ctx, db.DB)
+	if err != nil {
+		return 0, err
+	}
+	migrations, err := goose.CollectMigrations("migrations/"+DBType, 0, goose.MaxVersion)
+	if err != nil {
+		return 0, err
+	}
+	pending := 0
+	for _, migration := range migrations {
+		if migration.Version > current {
+			pending++
+		}
+	}
+	return pending, nil
+}
@@ -0,0 +1,40 @@
+package database
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+	"time"
+	"tutorial-auth/internal/config"
+)
+
+// TestSqliteConcurrentConnections opens several connections at once that read and write. Every
+// connection sets the journal mode as it opens, which fails with SQLITE_BUSY while another one
+// writes unless busy_timeout is set before it.
+func TestSqliteConcurrentConnections(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.DBConnectionConfig{Type: "sqlite", Database: filepath.Join(t.TempDir(), "auth.db"), BusyTimeout: 5 * time.Second}
+	cfg.Pool.MaxOpenConns = 4
+	db, err := NewConnectionDB(cfg)
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.ExecContext(ctx, "CREATE TABLE t (id INTEGER)")
+	require.NoError(t, err)
+
+	errs := make(chan error, 10)
+	for i := 0; i < cap(errs); i++ {
+		go func(i int) {
+			var n int
+			if err := db.GetContext(ctx, &n, "SELECT COUNT(*) FROM t"); err != nil {
+				errs <- err
+				return
+			}
+			_, err := db.ExecContext(ctx, "INSERT INTO t (id) VALUES (?)", i)
+			errs <- err
+		}(i)
+	}
+	for i := 0; i < cap(errs); i++ {
+		require.NoError(t, <-errs)
+	}
+}
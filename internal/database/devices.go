@@ -0,0 +1,76 @@
+package database
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+// Device is a row of the devices table: a device a user has logged in from. The device keeps a
+// token, of which only the SHA-256 is stored, and is also told by the fingerprint of its user agent.
+type Device struct {
+	ID          string    `db:"id"`
+	UserID      string    `db:"user_id"`
+	TokenHash   string    `db:"token_hash"`
+	Fingerprint string    `db:"fingerprint"`
+	Description string    `db:"description"`
+	CreatedAt   time.Time `db:"created_at"`
+	LastSeenAt  time.Time `db:"last_seen_at"`
+}
+
+// DeviceStore keeps the devices of users in the devices table.
+type DeviceStore struct {
+	db *sqlx.DB
+}
+
+func NewDeviceStore(db *sqlx.DB) *DeviceStore {
+	return &DeviceStore{db: db}
+}
+
+// Find returns the device of the user with the token hash, or sql.ErrNoRows.
+func (s *DeviceStore) Find(ctx context.Context, userID string, tokenHash string) (*Device, error) {
+	var device Device
+	query := s.db.Rebind(`SELECT id, user_id, token_hash, fingerprint, description, created_at, last_seen_at
+		FROM devices WHERE user_id = ? AND token_hash = ?`)
+	if err := s.db.GetContext(ctx, &device, query, userID, tokenHash); err != nil {
+		return nil, err
+	}
+	return &device, nil
+}
+
+func (s *DeviceStore) Insert(ctx context.Context, device *Device) error {
+	device.CreatedAt = device.CreatedAt.UTC().Truncate(time.Microsecond)
+	device.LastSeenAt = device.LastSeenAt.UTC().Truncate(time.Microsecond)
+	_, err := s.db.NamedExecContext(ctx, `INSERT INTO devices
+		(id, user_id, token_hash, fingerprint, description, created_at, last_seen_at)
+		VALUES (:id, :user_id, :token_hash, :fingerprint, :description, :created_at, :last_seen_at)`, device)
+	return err
+}
+
+// Touch records that the device has been seen again, with the user agent it has now.
+func (s *DeviceStore) Touch(ctx context.Context, device *Device) error {
+	device.LastSeenAt = device.LastSeenAt.UTC().Truncate(time.Microsecond)
+	_, err := s.db.NamedExecContext(ctx, `UPDATE devices SET fingerprint = :fingerprint, description = :description,
+		last_seen_at = :last_seen_at WHERE id = :id`, device)
+	return err
+}
+
+// DeleteUnseenSince removes up to limit devices last seen before before and returns how many it removed.
+func (s *DeviceStore) DeleteUnseenSince(ctx context.Context, before time.Time, limit int) (int, error) {
+	var ids []string
+	query := s.db.Rebind("SELECT id FROM devices WHERE last_seen_at < ? LIMIT ?")
+	if err := s.db.SelectContext(ctx, &ids, query, before.UTC(), limit); err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	query, args, err := sqlx.In("DELETE FROM devices WHERE id IN (?)", ids)
+	if err != nil {
+		return 0, err
+	}
+	res, err := s.db.ExecContext(ctx, s.db.Rebind(query), args...)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
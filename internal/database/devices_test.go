@@ -0,0 +1,38 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestDeviceStoreConformance(t *testing.T) {
+	for name, cfg := range dialects(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			store := NewDeviceStore(openDB(t, cfg))
+			now := time.Now()
+
+			for i, id := range []string{"stale", "recent"} {
+				seen := now.Add(-time.Duration(1-i) * 48 * time.Hour)
+				require.NoError(t, store.Insert(ctx, &Device{ID: id, UserID: "guid", TokenHash: id + "-hash",
+					Fingerprint: "fingerprint", Description: "Chrome on Windows", CreatedAt: seen, LastSeenAt: seen}))
+			}
+
+			// a device is only found with the token hash of its own user
+			device, err := store.Find(ctx, "guid", "recent-hash")
+			require.NoError(t, err)
+			require.Equal(t, "recent", device.ID)
+			_, err = store.Find(ctx, "other", "recent-hash")
+			require.ErrorIs(t, err, sql.ErrNoRows)
+
+			removed, err := store.DeleteUnseenSince(ctx, now.Add(-24*time.Hour), 10)
+			require.NoError(t, err)
+			require.Equal(t, 1, removed)
+			_, err = store.Find(ctx, "guid", "stale-hash")
+			require.ErrorIs(t, err, sql.ErrNoRows)
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+// ImportState remembers how far a bulk import has progressed, so it can be resumed.
+type ImportState struct {
+	Name      string    `db:"name"`
+	LastID    string    `db:"last_id"`
+	Imported  int64     `db:"imported"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+func GetImportState(ctx context.Context, db *sqlx.DB, name string) (*ImportState, error) {
+	var state ImportState
+	err := db.GetContext(ctx, &state, db.Rebind("SELECT name, last_id, imported, updated_at FROM import_state WHERE name = ?"), name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &ImportState{Name: name}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func SaveImportState(ctx context.Context, db *sqlx.DB, state *ImportState) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	state.UpdatedAt = time.Now()
+	if _, err = tx.ExecContext(ctx, tx.Rebind("DELETE FROM import_state WHERE name = ?"), state.Name); err != nil {
+		return err
+	}
+	query := tx.Rebind("INSERT INTO import_state (name, last_id, imported, updated_at) VALUES (?, ?, ?, ?)")
+	if _, err = tx.ExecContext(ctx, query, state.Name, state.LastID, state.Imported, state.UpdatedAt); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func ResetImportState(ctx context.Context, db *sqlx.DB, name string) error {
+	_, err := db.ExecContext(ctx, db.Rebind("DELETE FROM import_state WHERE name = ?"), name)
+	return err
+}
@@ -0,0 +1,118 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/ngrok/sqlmw"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"modernc.org/sqlite"
+	"sync"
+	"time"
+	"tutorial-auth/internal/metrics"
+)
+
+var tracer = otel.Tracer("tutorial-auth/internal/database")
+
+var registerDrivers sync.Once
+
+// openInstrumented opens the database through its driver wrapped by sqlInterceptor. The sqlx
+// driver name stays the database type, so that Rebind picks the placeholders of the database.
+func openInstrumented(dbType string, dsn string) (*sqlx.DB, error) {
+	registerDrivers.Do(func() {
+		sql.Register("instrumented-postgres", sqlmw.Driver(&pq.Driver{}, sqlInterceptor{system: semconv.DBSystemPostgreSQL}))
+		sql.Register("instrumented-mysql", sqlmw.Driver(&mysql.MySQLDriver{}, sqlInterceptor{system: semconv.DBSystemMySQL}))
+		sql.Register("instrumented-sqlite", sqlmw.Driver(&sqlite.Driver{}, sqlInterceptor{system: semconv.DBSystemSqlite}))
+	})
+
+	db, err := sql.Open("instrumented-"+dbType, dsn)
+	if err != nil {
+		return nil, err
+	}
+	return sqlx.NewDb(db, dbType), nil
+}
+
+// sqlInterceptor traces and measures the SQL calls of the application.
+type sqlInterceptor struct {
+	sqlmw.NullInterceptor
+	system attribute.KeyValue
+}
+
+func (i sqlInterceptor) ConnBeginTx(ctx context.Context, conn driver.ConnBeginTx, opts driver.TxOptions) (_ context.Context, tx driver.Tx, err error) {
+	spanCtx, finish := i.start(ctx, "begin", "")
+	defer func() { finish(err) }()
+	tx, err = conn.BeginTx(spanCtx, opts)
+	return ctx, tx, err
+}
+
+func (i sqlInterceptor) ConnExecContext(ctx context.Context, conn driver.ExecerContext, query string, args []driver.NamedValue) (_ driver.Result, err error) {
+	ctx, finish := i.start(ctx, "exec", query)
+	defer func() { finish(err) }()
+	return conn.ExecContext(ctx, query, args)
+}
+
+func (i sqlInterceptor) ConnQueryContext(ctx context.Context, conn driver.QueryerContext, query string, args []driver.NamedValue) (_ context.Context, rows driver.Rows, err error) {
+	spanCtx, finish := i.start(ctx, "query", query)
+	defer func() { finish(err) }()
+	rows, err = conn.QueryContext(spanCtx, query, args)
+	return ctx, rows, err
+}
+
+func (i sqlInterceptor) StmtExecContext(ctx context.Context, stmt driver.StmtExecContext, query string, args []driver.NamedValue) (_ driver.Result, err error) {
+	ctx, finish := i.start(ctx, "exec", query)
+	defer func() { finish(err) }()
+	return stmt.ExecContext(ctx, args)
+}
+
+func (i sqlInterceptor) StmtQueryContext(ctx context.Context, stmt driver.StmtQueryContext, query string, args []driver.NamedValue) (_ context.Context, rows driver.Rows, err error) {
+	spanCtx, finish := i.start(ctx, "query", query)
+	defer func() { finish(err) }()
+	rows, err = stmt.QueryContext(spanCtx, args)
+	return ctx, rows, err
+}
+
+func (i sqlInterceptor) TxCommit(ctx context.Context, tx driver.Tx) (err error) {
+	_, finish := i.start(ctx, "commit", "")
+	defer func() { finish(err) }()
+	return tx.Commit()
+}
+
+func (i sqlInterceptor) TxRollback(ctx context.Context, tx driver.Tx) (err error) {
+	_, finish := i.start(ctx, "rollback", "")
+	defer func() { finish(err) }()
+	return tx.Rollback()
+}
+
+// start begins the span of a call and returns the function that ends it and records the duration.
+// Queries are recorded with their placeholders only, never with the arguments.
+func (i sqlInterceptor) start(ctx context.Context, operation string, query string) (context.Context, func(err error)) {
+	started := time.Now()
+	attributes := []attribute.KeyValue{i.system}
+	if query != "" {
+		attributes = append(attributes, semconv.DBStatement(query))
+	}
+	ctx, span := tracer.Start(ctx, "sql."+operation, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attributes...))
+
+	return ctx, func(err error) {
+		defer span.End()
+		result := metrics.ResultSuccess
+		if err != nil {
+			// driver.ErrSkip only makes database/sql retry the call another way, which is measured then
+			if errors.Is(err, driver.ErrSkip) {
+				return
+			}
+			result = "error"
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "")
+		}
+		metrics.SQLQueryDuration.WithLabelValues(operation, result).Observe(time.Since(started).Seconds())
+	}
+}
@@ -0,0 +1,47 @@
+package database
+
+import (
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+	"time"
+	"tutorial-auth/internal/config"
+	"tutorial-auth/internal/metrics"
+	"tutorial-auth/internal/metrics/metricstest"
+)
+
+func sampleCount(t *testing.T, operation string, result string) uint64 {
+	return metricstest.SampleCount(t, metrics.SQLQueryDuration.WithLabelValues(operation, result))
+}
+
+func TestInstrumentedDriver(t *testing.T) {
+	db, err := NewConnectionDB(&config.DBConnectionConfig{Type: "sqlite", Database: filepath.Join(t.TempDir(), "auth.db"), BusyTimeout: time.Second})
+	require.NoError(t, err)
+	defer db.Close()
+	require.Equal(t, "sqlite", db.DriverName())
+
+	before := map[string]uint64{}
+	for _, operation := range []string{"exec", "query", "begin", "commit"} {
+		before[operation] = sampleCount(t, operation, metrics.ResultSuccess)
+	}
+	failed := sampleCount(t, "exec", "error")
+
+	_, err = db.Exec("CREATE TABLE items (id INTEGER PRIMARY KEY)")
+	require.NoError(t, err)
+	tx, err := db.Beginx()
+	require.NoError(t, err)
+	_, err = tx.Exec(db.Rebind("INSERT INTO items (id) VALUES (?)"), 1)
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit())
+	var count int
+	require.NoError(t, db.Get(&count, "SELECT COUNT(*) FROM items"))
+	require.Equal(t, 1, count)
+	_, err = db.Exec("INSERT INTO items (id) VALUES (1)")
+	require.True(t, IsUniqueViolation(err))
+
+	require.Equal(t, before["exec"]+2, sampleCount(t, "exec", metrics.ResultSuccess))
+	require.Equal(t, before["query"]+1, sampleCount(t, "query", metrics.ResultSuccess))
+	require.Equal(t, before["begin"]+1, sampleCount(t, "begin", metrics.ResultSuccess))
+	require.Equal(t, before["commit"]+1, sampleCount(t, "commit", metrics.ResultSuccess))
+	require.Equal(t, failed+1, sampleCount(t, "exec", "error"))
+}
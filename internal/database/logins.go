@@ -0,0 +1,112 @@
+package database
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+	"strings"
+	"time"
+)
+
+// LoginAttempt is a row of the login_attempts table. UserID is empty when the login did not
+// resolve to a user.
+type LoginAttempt struct {
+	ID        string    `db:"id" json:"id"`
+	UserID    string    `db:"user_id" json:"user_id,omitempty"`
+	Login     string    `db:"login" json:"login"`
+	Method    string    `db:"method" json:"method"`
+	Result    string    `db:"result" json:"result"`
+	IP        string    `db:"ip" json:"ip"`
+	UserAgent string    `db:"user_agent" json:"user_agent"`
+	Device    string    `db:"device" json:"device"`
+	Browser   string    `db:"browser" json:"browser"`
+	OS        string    `db:"os" json:"os"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+// LoginAttemptFilter selects login attempts. Zero fields do not restrict the selection.
+type LoginAttemptFilter struct {
+	UserID        string
+	From          time.Time     // inclusive
+	To            time.Time     // exclusive
+	Result        string        // only attempts with this result
+	ExcludeResult string        // only attempts with another result
+	Before        *LoginAttempt // only attempts listed after this one, the cursor of the previous page
+	Limit         int
+}
+
+// LoginHistoryStore keeps the login attempts of users in the login_attempts table.
+type LoginHistoryStore struct {
+	db *sqlx.DB
+}
+
+func NewLoginHistoryStore(db *sqlx.DB) *LoginHistoryStore {
+	return &LoginHistoryStore{db: db}
+}
+
+func (s *LoginHistoryStore) Insert(ctx context.Context, attempt *LoginAttempt) error {
+	// the time is compared as the database returns it when pages continue from a cursor
+	attempt.CreatedAt = attempt.CreatedAt.UTC().Truncate(time.Microsecond)
+	_, err := s.db.NamedExecContext(ctx, `INSERT INTO login_attempts
+		(id, user_id, login, method, result, ip, user_agent, device, browser, os, created_at)
+		VALUES (:id, :user_id, :login, :method, :result, :ip, :user_agent, :device, :browser, :os, :created_at)`, attempt)
+	return err
+}
+
+// List returns the attempts selected by filter, newest first.
+func (s *LoginHistoryStore) List(ctx context.Context, filter *LoginAttemptFilter) ([]LoginAttempt, error) {
+	conditions := []string{"1 = 1"}
+	var args []any
+	if filter.UserID != "" {
+		conditions = append(conditions, "user_id = ?")
+		args = append(args, filter.UserID)
+	}
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, filter.From.UTC())
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, filter.To.UTC())
+	}
+	if filter.Result != "" {
+		conditions = append(conditions, "result = ?")
+		args = append(args, filter.Result)
+	}
+	if filter.ExcludeResult != "" {
+		conditions = append(conditions, "result <> ?")
+		args = append(args, filter.ExcludeResult)
+	}
+	if filter.Before != nil {
+		conditions = append(conditions, "(created_at < ? OR (created_at = ? AND id < ?))")
+		args = append(args, filter.Before.CreatedAt.UTC(), filter.Before.CreatedAt.UTC(), filter.Before.ID)
+	}
+	args = append(args, filter.Limit)
+
+	var attempts []LoginAttempt
+	query := s.db.Rebind(`SELECT id, user_id, login, method, result, ip, user_agent, device, browser, os, created_at
+		FROM login_attempts WHERE ` + strings.Join(conditions, " AND ") + ` ORDER BY created_at DESC, id DESC LIMIT ?`)
+	if err := s.db.SelectContext(ctx, &attempts, query, args...); err != nil {
+		return nil, err
+	}
+	return attempts, nil
+}
+
+// DeleteBefore removes up to limit attempts made before before and returns how many it removed.
+func (s *LoginHistoryStore) DeleteBefore(ctx context.Context, before time.Time, limit int) (int, error) {
+	var ids []string
+	query := s.db.Rebind("SELECT id FROM login_attempts WHERE created_at < ? LIMIT ?")
+	if err := s.db.SelectContext(ctx, &ids, query, before.UTC(), limit); err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	query, args, err := sqlx.In("DELETE FROM login_attempts WHERE id IN (?)", ids)
+	if err != nil {
+		return 0, err
+	}
+	res, err := s.db.ExecContext(ctx, s.db.Rebind(query), args...)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
@@ -0,0 +1,12 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS passwords
+(
+    user_id VARCHAR(36) NOT NULL,
+    password VARCHAR(255) NOT NULL,
+    created_at DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+    expires_at DATETIME(6) NOT NULL,
+    PRIMARY KEY (user_id)
+);
+
+-- +goose Down
+DROP TABLE passwords;
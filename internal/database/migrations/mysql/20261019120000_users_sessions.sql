@@ -0,0 +1,38 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS users
+(
+    guid VARCHAR(36) NOT NULL,
+    login VARCHAR(255) NOT NULL,
+    login_type_id INTEGER NOT NULL DEFAULT 1,
+    login_type_name VARCHAR(32) NOT NULL DEFAULT 'email',
+    name VARCHAR(255) NOT NULL DEFAULT '',
+    last_name VARCHAR(255) NOT NULL DEFAULT '',
+    attributes JSON NOT NULL,
+    last_login_at DATETIME(6),
+    created_at DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+    PRIMARY KEY (guid),
+    UNIQUE KEY users_login_idx (login)
+);
+
+CREATE TABLE IF NOT EXISTS sessions
+(
+    user_id VARCHAR(36) NOT NULL,
+    refresh_token TEXT NOT NULL,
+    created_at DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+    PRIMARY KEY (user_id),
+    CONSTRAINT sessions_user_fk FOREIGN KEY (user_id) REFERENCES users (guid) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS import_state
+(
+    name VARCHAR(64) NOT NULL,
+    last_id VARCHAR(64) NOT NULL,
+    imported BIGINT NOT NULL DEFAULT 0,
+    updated_at DATETIME(6) NOT NULL,
+    PRIMARY KEY (name)
+);
+
+-- +goose Down
+DROP TABLE import_state;
+DROP TABLE sessions;
+DROP TABLE users;
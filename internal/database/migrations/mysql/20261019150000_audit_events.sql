@@ -0,0 +1,31 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS audit_events
+(
+    seq BIGINT NOT NULL,
+    type VARCHAR(32) NOT NULL,
+    actor VARCHAR(255) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    ip VARCHAR(45) NOT NULL,
+    user_agent TEXT NOT NULL,
+    result VARCHAR(64) NOT NULL,
+    detail TEXT NOT NULL,
+    created_at DATETIME(6) NOT NULL,
+    prev_hash VARCHAR(64) NOT NULL,
+    hash VARCHAR(64) NOT NULL,
+    PRIMARY KEY (seq)
+);
+
+CREATE INDEX audit_events_subject_idx ON audit_events (subject, created_at);
+
+-- +goose StatementBegin
+CREATE TRIGGER audit_events_no_update BEFORE UPDATE ON audit_events
+FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_events is append-only';
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER audit_events_no_delete BEFORE DELETE ON audit_events
+FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_events is append-only';
+-- +goose StatementEnd
+
+-- +goose Down
+DROP TABLE audit_events;
@@ -0,0 +1,22 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS login_attempts
+(
+    id VARCHAR(36) NOT NULL,
+    user_id VARCHAR(36) NOT NULL,
+    login VARCHAR(255) NOT NULL,
+    method VARCHAR(32) NOT NULL,
+    result VARCHAR(64) NOT NULL,
+    ip VARCHAR(45) NOT NULL,
+    user_agent TEXT NOT NULL,
+    device VARCHAR(16) NOT NULL,
+    browser VARCHAR(64) NOT NULL,
+    os VARCHAR(64) NOT NULL,
+    created_at DATETIME(6) NOT NULL,
+    PRIMARY KEY (id)
+);
+
+CREATE INDEX login_attempts_user_id_idx ON login_attempts (user_id, created_at);
+CREATE INDEX login_attempts_created_at_idx ON login_attempts (created_at);
+
+-- +goose Down
+DROP TABLE login_attempts;
@@ -0,0 +1,17 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS devices
+(
+    id VARCHAR(36) NOT NULL,
+    user_id VARCHAR(36) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL,
+    fingerprint VARCHAR(64) NOT NULL,
+    description VARCHAR(255) NOT NULL,
+    created_at DATETIME(6) NOT NULL,
+    last_seen_at DATETIME(6) NOT NULL,
+    PRIMARY KEY (id)
+);
+
+CREATE UNIQUE INDEX devices_user_id_token_hash_idx ON devices (user_id, token_hash);
+
+-- +goose Down
+DROP TABLE devices;
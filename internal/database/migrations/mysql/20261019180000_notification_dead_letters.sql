@@ -0,0 +1,19 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS notification_dead_letters
+(
+    id VARCHAR(36) NOT NULL,
+    channel VARCHAR(16) NOT NULL,
+    template VARCHAR(64) NOT NULL,
+    user_id VARCHAR(36) NOT NULL,
+    recipient VARCHAR(255) NOT NULL,
+    payload TEXT NOT NULL,
+    error TEXT NOT NULL,
+    attempts INTEGER NOT NULL,
+    created_at DATETIME(6) NOT NULL,
+    PRIMARY KEY (id)
+);
+
+CREATE INDEX notification_dead_letters_created_at_idx ON notification_dead_letters (created_at);
+
+-- +goose Down
+DROP TABLE notification_dead_letters;
@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS audit_head
+(
+    id INTEGER NOT NULL,
+    seq BIGINT NOT NULL,
+    hash VARCHAR(64) NOT NULL,
+    PRIMARY KEY (id),
+    CHECK (id = 1)
+);
+
+INSERT INTO audit_head (id, seq, hash)
+SELECT 1, COALESCE(MAX(seq), 0), COALESCE((SELECT hash FROM audit_events ORDER BY seq DESC LIMIT 1), '')
+FROM audit_events;
+
+-- +goose Down
+DROP TABLE audit_head;
@@ -0,0 +1,15 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS login_challenge_limits
+(
+    subject VARCHAR(128) NOT NULL,
+    window_start DATETIME(6) NOT NULL,
+    issued INTEGER NOT NULL,
+    PRIMARY KEY (subject)
+);
+
+CREATE INDEX login_challenge_limits_window_start_idx ON login_challenge_limits (window_start);
+CREATE INDEX login_challenges_user_id_idx ON login_challenges (user_id);
+
+-- +goose Down
+DROP INDEX login_challenges_user_id_idx ON login_challenges;
+DROP TABLE login_challenge_limits;
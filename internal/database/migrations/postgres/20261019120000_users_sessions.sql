@@ -0,0 +1,39 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS users
+(
+    guid VARCHAR(36) NOT NULL,
+    login VARCHAR(255) NOT NULL,
+    login_type_id INTEGER NOT NULL DEFAULT 1,
+    login_type_name VARCHAR(32) NOT NULL DEFAULT 'email',
+    name VARCHAR(255) NOT NULL DEFAULT '',
+    last_name VARCHAR(255) NOT NULL DEFAULT '',
+    attributes JSONB NOT NULL DEFAULT '{}',
+    last_login_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT (NOW() AT TIME ZONE 'Europe/Moscow'),
+    PRIMARY KEY (guid)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_login_idx ON users (login);
+
+CREATE TABLE IF NOT EXISTS sessions
+(
+    user_id VARCHAR(36) NOT NULL REFERENCES users (guid) ON DELETE CASCADE,
+    refresh_token TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT (NOW() AT TIME ZONE 'Europe/Moscow'),
+    PRIMARY KEY (user_id)
+);
+
+CREATE TABLE IF NOT EXISTS import_state
+(
+    name VARCHAR(64) NOT NULL,
+    last_id VARCHAR(64) NOT NULL,
+    imported BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (name)
+);
+
+-- +goose Down
+DROP TABLE import_state;
+DROP TABLE sessions;
+DROP INDEX users_login_idx;
+DROP TABLE users;
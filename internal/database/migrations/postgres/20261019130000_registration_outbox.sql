@@ -0,0 +1,18 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN status VARCHAR(16) NOT NULL DEFAULT 'active';
+
+CREATE TABLE IF NOT EXISTS registration_outbox
+(
+    user_id VARCHAR(36) NOT NULL,
+    login VARCHAR(255) NOT NULL,
+    step VARCHAR(16) NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id)
+);
+
+CREATE INDEX registration_outbox_updated_at_idx ON registration_outbox (updated_at);
+
+-- +goose Down
+DROP TABLE registration_outbox;
+ALTER TABLE users DROP COLUMN status;
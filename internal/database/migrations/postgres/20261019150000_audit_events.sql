@@ -0,0 +1,36 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS audit_events
+(
+    seq BIGINT NOT NULL,
+    type VARCHAR(32) NOT NULL,
+    actor VARCHAR(255) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    ip VARCHAR(45) NOT NULL,
+    user_agent TEXT NOT NULL,
+    result VARCHAR(64) NOT NULL,
+    detail TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    prev_hash VARCHAR(64) NOT NULL,
+    hash VARCHAR(64) NOT NULL,
+    PRIMARY KEY (seq)
+);
+
+CREATE INDEX audit_events_subject_idx ON audit_events (subject, created_at);
+
+-- +goose StatementBegin
+CREATE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER audit_events_no_change BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+
+CREATE TRIGGER audit_events_no_truncate BEFORE TRUNCATE ON audit_events
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only();
+
+-- +goose Down
+DROP TABLE audit_events;
+DROP FUNCTION audit_events_append_only();
@@ -0,0 +1,13 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT TRUE;
+
+CREATE TABLE IF NOT EXISTS email_verifications
+(
+    user_id VARCHAR(36) NOT NULL,
+    sent_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id)
+);
+
+-- +goose Down
+DROP TABLE email_verifications;
+ALTER TABLE users DROP COLUMN email_verified;
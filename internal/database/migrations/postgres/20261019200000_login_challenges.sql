@@ -0,0 +1,22 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN passwordless BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS login_challenges
+(
+    id VARCHAR(36) NOT NULL,
+    user_id VARCHAR(36) NOT NULL,
+    method VARCHAR(16) NOT NULL,
+    channel VARCHAR(16) NOT NULL,
+    secret_hash VARCHAR(64) NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NOT NULL,
+    consumed_at TIMESTAMP NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (id)
+);
+
+CREATE INDEX login_challenges_expires_at_idx ON login_challenges (expires_at);
+
+-- +goose Down
+DROP TABLE login_challenges;
+ALTER TABLE users DROP COLUMN passwordless;
@@ -0,0 +1,30 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS passwords
+(
+    user_id VARCHAR(36) NOT NULL,
+    password VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id)
+);
+
+CREATE TABLE IF NOT EXISTS users
+(
+    guid VARCHAR(36) NOT NULL,
+    login VARCHAR(255) NOT NULL,
+    login_type_id INTEGER NOT NULL DEFAULT 1,
+    login_type_name VARCHAR(32) NOT NULL DEFAULT 'email',
+    name VARCHAR(255) NOT NULL DEFAULT '',
+    last_name VARCHAR(255) NOT NULL DEFAULT '',
+    refresh_token TEXT NOT NULL DEFAULT '',
+    last_login_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (guid)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_login_idx ON users (login);
+
+-- +goose Down
+DROP INDEX users_login_idx;
+DROP TABLE users;
+DROP TABLE passwords;
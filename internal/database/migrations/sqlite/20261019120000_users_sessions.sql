@@ -0,0 +1,31 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN attributes TEXT NOT NULL DEFAULT '{}';
+
+CREATE TABLE IF NOT EXISTS sessions
+(
+    user_id VARCHAR(36) NOT NULL REFERENCES users (guid) ON DELETE CASCADE,
+    refresh_token TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id)
+);
+
+INSERT INTO sessions (user_id, refresh_token)
+SELECT guid, refresh_token FROM users WHERE refresh_token <> '';
+
+ALTER TABLE users DROP COLUMN refresh_token;
+
+CREATE TABLE IF NOT EXISTS import_state
+(
+    name VARCHAR(64) NOT NULL,
+    last_id VARCHAR(64) NOT NULL,
+    imported BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (name)
+);
+
+-- +goose Down
+DROP TABLE import_state;
+ALTER TABLE users ADD COLUMN refresh_token TEXT NOT NULL DEFAULT '';
+UPDATE users SET refresh_token = COALESCE((SELECT refresh_token FROM sessions WHERE user_id = users.guid), '');
+DROP TABLE sessions;
+ALTER TABLE users DROP COLUMN attributes;
@@ -0,0 +1,20 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN status TEXT NOT NULL DEFAULT 'active';
+
+-- SQLite ignores the length of VARCHAR, so strings are TEXT. Times stay TIMESTAMP, the declared
+-- type the driver reads back as a time.
+CREATE TABLE IF NOT EXISTS registration_outbox
+(
+    user_id TEXT NOT NULL,
+    login TEXT NOT NULL,
+    step TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id)
+) WITHOUT ROWID;
+
+CREATE INDEX IF NOT EXISTS registration_outbox_updated_at_idx ON registration_outbox (updated_at);
+
+-- +goose Down
+DROP TABLE registration_outbox;
+ALTER TABLE users DROP COLUMN status;
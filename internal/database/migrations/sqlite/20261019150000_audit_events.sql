@@ -0,0 +1,35 @@
+-- +goose Up
+-- seq is an INTEGER PRIMARY KEY, which SQLite keeps as the rowid
+CREATE TABLE IF NOT EXISTS audit_events
+(
+    seq INTEGER NOT NULL PRIMARY KEY,
+    type TEXT NOT NULL,
+    actor TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    ip TEXT NOT NULL,
+    user_agent TEXT NOT NULL,
+    result TEXT NOT NULL,
+    detail TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    prev_hash TEXT NOT NULL,
+    hash TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS audit_events_subject_idx ON audit_events (subject, created_at);
+
+-- +goose StatementBegin
+CREATE TRIGGER IF NOT EXISTS audit_events_no_update BEFORE UPDATE ON audit_events
+BEGIN
+    SELECT RAISE(ABORT, 'audit_events is append-only');
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER IF NOT EXISTS audit_events_no_delete BEFORE DELETE ON audit_events
+BEGIN
+    SELECT RAISE(ABORT, 'audit_events is append-only');
+END;
+-- +goose StatementEnd
+
+-- +goose Down
+DROP TABLE audit_events;
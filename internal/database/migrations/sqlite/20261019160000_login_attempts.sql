@@ -0,0 +1,24 @@
+-- +goose Up
+-- SQLite ignores the length of VARCHAR, so strings are TEXT. Times stay TIMESTAMP, the declared
+-- type the driver reads back as a time.
+CREATE TABLE IF NOT EXISTS login_attempts
+(
+    id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    login TEXT NOT NULL,
+    method TEXT NOT NULL,
+    result TEXT NOT NULL,
+    ip TEXT NOT NULL,
+    user_agent TEXT NOT NULL,
+    device TEXT NOT NULL,
+    browser TEXT NOT NULL,
+    os TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS login_attempts_user_id_idx ON login_attempts (user_id, created_at);
+CREATE INDEX IF NOT EXISTS login_attempts_created_at_idx ON login_attempts (created_at);
+
+-- +goose Down
+DROP TABLE login_attempts;
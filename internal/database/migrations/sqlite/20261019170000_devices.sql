@@ -0,0 +1,18 @@
+-- +goose Up
+-- small rows looked up by their text key are stored in the key's own b-tree
+CREATE TABLE IF NOT EXISTS devices
+(
+    id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    token_hash TEXT NOT NULL,
+    fingerprint TEXT NOT NULL,
+    description TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    last_seen_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (id)
+) WITHOUT ROWID;
+
+CREATE UNIQUE INDEX IF NOT EXISTS devices_user_id_token_hash_idx ON devices (user_id, token_hash);
+
+-- +goose Down
+DROP TABLE devices;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- sqlite keeps booleans as 0 and 1; the declared type lets the driver scan them as booleans
+ALTER TABLE users ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT 1;
+
+CREATE TABLE IF NOT EXISTS email_verifications
+(
+    user_id TEXT NOT NULL,
+    sent_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id)
+) WITHOUT ROWID;
+
+-- +goose Down
+DROP TABLE email_verifications;
+ALTER TABLE users DROP COLUMN email_verified;
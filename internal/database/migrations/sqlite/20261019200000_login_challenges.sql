@@ -0,0 +1,22 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN passwordless BOOLEAN NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS login_challenges
+(
+    id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    method TEXT NOT NULL,
+    channel TEXT NOT NULL,
+    secret_hash TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NOT NULL,
+    consumed_at TIMESTAMP NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (id)
+) WITHOUT ROWID;
+
+CREATE INDEX IF NOT EXISTS login_challenges_expires_at_idx ON login_challenges (expires_at);
+
+-- +goose Down
+DROP TABLE login_challenges;
+ALTER TABLE users DROP COLUMN passwordless;
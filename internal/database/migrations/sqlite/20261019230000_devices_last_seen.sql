@@ -0,0 +1,5 @@
+-- +goose Up
+CREATE INDEX IF NOT EXISTS devices_last_seen_at_idx ON devices (last_seen_at);
+
+-- +goose Down
+DROP INDEX devices_last_seen_at_idx;
@@ -0,0 +1,42 @@
+package database
+
+import (
+	"context"
+	"github.com/pressly/goose/v3"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"testing"
+)
+
+// TestMigrationsRoundTrip reverts every migration and applies them again, so that a Down that does
+// not undo its Up fails here rather than in a rollback.
+func TestMigrationsRoundTrip(t *testing.T) {
+	for name, cfg := range dialects(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			db := openDB(t, cfg)
+
+			pending, err := PendingMigrations(ctx, cfg.Type, db)
+			require.NoError(t, err)
+			require.Zero(t, pending)
+
+			gooseMu.Lock()
+			goose.SetBaseFS(embedMigrations)
+			require.NoError(t, goose.SetDialect(cfg.Type))
+			migrations, err := goose.CollectMigrations("migrations/"+cfg.Type, 0, goose.MaxVersion)
+			require.NoError(t, err)
+			err = goose.DownTo(db.DB, "migrations/"+cfg.Type, 0)
+			gooseMu.Unlock()
+			require.NoError(t, err)
+
+			pending, err = PendingMigrations(ctx, cfg.Type, db)
+			require.NoError(t, err)
+			require.Equal(t, len(migrations), pending)
+
+			require.NoError(t, ApplyMigration(zap.NewNop(), cfg.Type, db))
+			pending, err = PendingMigrations(ctx, cfg.Type, db)
+			require.NoError(t, err)
+			require.Zero(t, pending)
+		})
+	}
+}
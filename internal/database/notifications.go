@@ -0,0 +1,68 @@
+package database
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+// DeadLetter is a row of the notification_dead_letters table: a notification that could not be
+// delivered, kept with the reason it was given up on. Payload is the notification as JSON, with its
+// links and codes redacted.
+type DeadLetter struct {
+	ID        string    `db:"id" json:"id"`
+	Channel   string    `db:"channel" json:"channel"`
+	Template  string    `db:"template" json:"template"`
+	UserID    string    `db:"user_id" json:"user_id"`
+	Recipient string    `db:"recipient" json:"recipient"`
+	Payload   string    `db:"payload" json:"payload"`
+	Error     string    `db:"error" json:"error"`
+	Attempts  int       `db:"attempts" json:"attempts"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+// DeadLetterStore keeps the notifications that could not be delivered in the
+// notification_dead_letters table, for operators to look into and send again.
+type DeadLetterStore struct {
+	db *sqlx.DB
+}
+
+func NewDeadLetterStore(db *sqlx.DB) *DeadLetterStore {
+	return &DeadLetterStore{db: db}
+}
+
+func (s *DeadLetterStore) Add(ctx context.Context, letter *DeadLetter) error {
+	letter.CreatedAt = letter.CreatedAt.UTC().Truncate(time.Microsecond)
+	_, err := s.db.NamedExecContext(ctx, `INSERT INTO notification_dead_letters
+		(id, channel, template, user_id, recipient, payload, error, attempts, created_at)
+		VALUES (:id, :channel, :template, :user_id, :recipient, :payload, :error, :attempts, :created_at)`, letter)
+	return err
+}
+
+// Get returns the dead letter id, or sql.ErrNoRows.
+func (s *DeadLetterStore) Get(ctx context.Context, id string) (*DeadLetter, error) {
+	var letter DeadLetter
+	query := s.db.Rebind(`SELECT id, channel, template, user_id, recipient, payload, error, attempts, created_at
+		FROM notification_dead_letters WHERE id = ?`)
+	if err := s.db.GetContext(ctx, &letter, query, id); err != nil {
+		return nil, err
+	}
+	return &letter, nil
+}
+
+// Delete removes the dead letter id, once it has been sent after all.
+func (s *DeadLetterStore) Delete(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, s.db.Rebind("DELETE FROM notification_dead_letters WHERE id = ?"), id)
+	return err
+}
+
+// List returns up to limit dead letters, the newest first.
+func (s *DeadLetterStore) List(ctx context.Context, limit int) ([]DeadLetter, error) {
+	var letters []DeadLetter
+	query := s.db.Rebind(`SELECT id, channel, template, user_id, recipient, payload, error, attempts, created_at
+		FROM notification_dead_letters ORDER BY created_at DESC, id DESC LIMIT ?`)
+	if err := s.db.SelectContext(ctx, &letters, query, limit); err != nil {
+		return nil, err
+	}
+	return letters, nil
+}
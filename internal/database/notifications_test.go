@@ -0,0 +1,46 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestDeadLetterStoreConformance(t *testing.T) {
+	for name, cfg := range dialects(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			store := NewDeadLetterStore(openDB(t, cfg))
+
+			now := time.Now()
+			for i, id := range []string{"older", "newer"} {
+				require.NoError(t, store.Add(ctx, &DeadLetter{
+					ID: id, Channel: "email", Template: "suspicious_login", UserID: "guid",
+					Recipient: "user@example.com", Payload: `{"channel":"email"}`, Error: "550 no such user",
+					Attempts: 1, CreatedAt: now.Add(time.Duration(i) * time.Second),
+				}))
+			}
+
+			letters, err := store.List(ctx, 1)
+			require.NoError(t, err)
+			require.Len(t, letters, 1)
+			require.Equal(t, "newer", letters[0].ID)
+
+			letter, err := store.Get(ctx, "older")
+			require.NoError(t, err)
+			require.Equal(t, "user@example.com", letter.Recipient)
+			require.Equal(t, `{"channel":"email"}`, letter.Payload)
+			require.Equal(t, 1, letter.Attempts)
+			require.WithinDuration(t, now, letter.CreatedAt, time.Millisecond)
+
+			require.NoError(t, store.Delete(ctx, "older"))
+			_, err = store.Get(ctx, "older")
+			require.ErrorIs(t, err, sql.ErrNoRows)
+			letters, err = store.List(ctx, 10)
+			require.NoError(t, err)
+			require.Len(t, letters, 1)
+		})
+	}
+}
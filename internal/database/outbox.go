@@ -0,0 +1,123 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+// Registration steps recorded in the outbox.
+const (
+	RegistrationStarted    = "started"    // the user may have been written as pending, the credential is not
+	RegistrationCredential = "credential" // the credential is written, the user is not active yet
+	RegistrationAborted    = "aborted"    // the registration is being rolled back
+)
+
+var (
+	RegistrationAbortedError  = fmt.Errorf("registration was rolled back")
+	RegistrationNotFoundError = fmt.Errorf("registration not found")
+)
+
+// Registration is an unfinished registration saga.
+type Registration struct {
+	UserID    string    `db:"user_id"`
+	Login     string    `db:"login"`
+	Step      string    `db:"step"`
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+// RegistrationOutbox records every registration before the user is written, so a
+// registration interrupted by a crash can be found and completed or rolled back.
+// The credential and the step that marks it as written are committed together.
+type RegistrationOutbox struct {
+	db *sqlx.DB
+}
+
+func NewRegistrationOutbox(db *sqlx.DB) *RegistrationOutbox {
+	return &RegistrationOutbox{db: db}
+}
+
+func (o *RegistrationOutbox) Start(ctx context.Context, guid string, login string) error {
+	now := time.Now()
+	query := o.db.Rebind("INSERT INTO registration_outbox (user_id, login, step, created_at, updated_at) VALUES (?, ?, ?, ?, ?)")
+	_, err := o.db.ExecContext(ctx, query, guid, login, RegistrationStarted, now, now)
+	return err
+}
+
+// WriteCredential stores the password hash and advances the registration in one transaction.
+// A user who registers without a password has an empty hash, and only the registration advances.
+// It fails with RegistrationAbortedError if the recovery worker has already rolled it back.
+func (o *RegistrationOutbox) WriteCredential(ctx context.Context, guid string, hash string, expiresAt time.Time) error {
+	tx, err := o.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := tx.Rebind("UPDATE registration_outbox SET step = ?, updated_at = ? WHERE user_id = ? AND step = ?")
+	res, err := tx.ExecContext(ctx, query, RegistrationCredential, time.Now(), guid, RegistrationStarted)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return RegistrationAbortedError
+	}
+	if hash == "" {
+		return tx.Commit()
+	}
+
+	query = tx.Rebind("INSERT INTO passwords (user_id, password, expires_at) VALUES (?, ?, ?)")
+	if _, err = tx.ExecContext(ctx, query, guid, hash, expiresAt); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Abort marks the registration as being rolled back. It returns false if the credential
+// is already written, in which case the registration must be completed instead, and
+// RegistrationNotFoundError if the registration has already been finished or rolled back.
+func (o *RegistrationOutbox) Abort(ctx context.Context, guid string) (bool, error) {
+	query := o.db.Rebind("UPDATE registration_outbox SET step = ?, updated_at = ? WHERE user_id = ? AND step <> ?")
+	res, err := o.db.ExecContext(ctx, query, RegistrationAborted, time.Now(), guid, RegistrationCredential)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return n > 0, err
+	}
+
+	var exists int
+	if err = o.db.GetContext(ctx, &exists, o.db.Rebind("SELECT COUNT(*) FROM registration_outbox WHERE user_id = ?"), guid); err != nil {
+		return false, err
+	}
+	if exists == 0 {
+		return false, RegistrationNotFoundError
+	}
+	return false, nil
+}
+
+// Finish removes the registration once the saga has completed or has been rolled back.
+func (o *RegistrationOutbox) Finish(ctx context.Context, guid string) error {
+	_, err := o.db.ExecContext(ctx, o.db.Rebind("DELETE FROM registration_outbox WHERE user_id = ?"), guid)
+	return err
+}
+
+// Stale returns up to limit registrations that have not moved since before.
+func (o *RegistrationOutbox) Stale(ctx context.Context, before time.Time, limit int) ([]Registration, error) {
+	var registrations []Registration
+	query := o.db.Rebind(`SELECT user_id, login, step, created_at, updated_at FROM registration_outbox
+		WHERE updated_at < ? ORDER BY updated_at LIMIT ?`)
+	if err := o.db.SelectContext(ctx, &registrations, query, before, limit); err != nil {
+		return nil, err
+	}
+	return registrations, nil
+}
+
+// Existing returns which of the users have an unfinished registration.
+func (o *RegistrationOutbox) Existing(ctx context.Context, guids []string) (map[string]bool, error) {
+	return existing(ctx, o.db, "SELECT user_id FROM registration_outbox WHERE user_id IN (?)", guids)
+}
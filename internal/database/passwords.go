@@ -0,0 +1,91 @@
+package database
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+// Password is a row of the passwords table.
+type Password struct {
+	UserID    string    `db:"user_id"`
+	CreatedAt time.Time `db:"created_at"`
+	ExpiresAt time.Time `db:"expires_at"`
+}
+
+// PasswordStore gives maintenance access to the passwords table.
+type PasswordStore struct {
+	db *sqlx.DB
+}
+
+func NewPasswordStore(db *sqlx.DB) *PasswordStore {
+	return &PasswordStore{db: db}
+}
+
+// EachBatch calls fn with the password rows in user_id order, size rows at a time.
+func (s *PasswordStore) EachBatch(ctx context.Context, size int, fn func([]Password) error) error {
+	query := s.db.Rebind("SELECT user_id, created_at, expires_at FROM passwords WHERE user_id > ? ORDER BY user_id LIMIT ?")
+	after := ""
+	for {
+		var batch []Password
+		if err := s.db.SelectContext(ctx, &batch, query, after, size); err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := fn(batch); err != nil {
+			return err
+		}
+		after = batch[len(batch)-1].UserID
+	}
+}
+
+// Existing returns which of the users have a password row.
+func (s *PasswordStore) Existing(ctx context.Context, guids []string) (map[string]bool, error) {
+	return existing(ctx, s.db, "SELECT user_id FROM passwords WHERE user_id IN (?)", guids)
+}
+
+// Save replaces the password of the user.
+func (s *PasswordStore) Save(ctx context.Context, guid string, hash string, expiresAt time.Time) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, tx.Rebind("DELETE FROM passwords WHERE user_id = ?"), guid); err != nil {
+		return err
+	}
+	query := tx.Rebind("INSERT INTO passwords (user_id, password, expires_at) VALUES (?, ?, ?)")
+	if _, err = tx.ExecContext(ctx, query, guid, hash, expiresAt); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *PasswordStore) Delete(ctx context.Context, guid string) error {
+	_, err := s.db.ExecContext(ctx, s.db.Rebind("DELETE FROM passwords WHERE user_id = ?"), guid)
+	return err
+}
+
+// existing runs a query selecting one key column with an IN (?) clause and returns the keys found.
+func existing(ctx context.Context, db *sqlx.DB, query string, keys []string) (map[string]bool, error) {
+	found := make(map[string]bool, len(keys))
+	if len(keys) == 0 {
+		return found, nil
+	}
+
+	query, args, err := sqlx.In(query, keys)
+	if err != nil {
+		return nil, err
+	}
+	var rows []string
+	if err = db.SelectContext(ctx, &rows, db.Rebind(query), args...); err != nil {
+		return nil, err
+	}
+	for _, key := range rows {
+		found[key] = true
+	}
+	return found, nil
+}
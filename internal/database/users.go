@@ -0,0 +1,281 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"time"
+	"tutorial-auth/internal/mongodb/models"
+)
+
+// UserStore keeps user documents in the users table, for deployments without MongoDB.
+// Refresh tokens live in the sessions table.
+type UserStore struct {
+	db *sqlx.DB
+}
+
+type userRow struct {
+	GUID          string         `db:"guid"`
+	Login         string         `db:"login"`
+	LoginTypeID   int            `db:"login_type_id"`
+	LoginTypeName string         `db:"login_type_name"`
+	Name          string         `db:"name"`
+	LastName      string         `db:"last_name"`
+	Attributes    attributes     `db:"attributes"`
+	Status        string         `db:"status"`
+	EmailVerified bool           `db:"email_verified"`
+	Passwordless  bool           `db:"passwordless"`
+	RefreshToken  sql.NullString `db:"refresh_token"`
+	LastLoginAt   sql.NullTime   `db:"last_login_at"`
+	CreatedAt     time.Time      `db:"created_at"`
+}
+
+const selectUsers = `SELECT u.guid, u.login, u.login_type_id, u.login_type_name, u.name, u.last_name, u.attributes, u.status,
+	u.email_verified, u.passwordless, s.refresh_token, u.last_login_at, u.created_at
+	FROM users u LEFT JOIN sessions s ON s.user_id = u.guid`
+
+// attributes stores the free-form part of the user document as a JSON object.
+type attributes map[string]any
+
+func (a attributes) Value() (driver.Value, error) {
+	if a == nil {
+		return "{}", nil
+	}
+	b, err := json.Marshal(a)
+	return string(b), err
+}
+
+func (a *attributes) Scan(src any) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, a)
+	case string:
+		return json.Unmarshal([]byte(v), a)
+	case nil:
+		*a = nil
+		return nil
+	default:
+		return fmt.Errorf("unsupported attributes type %T", src)
+	}
+}
+
+func NewUserStore(db *sqlx.DB) *UserStore {
+	return &UserStore{db: db}
+}
+
+func (s *UserStore) GetByGuid(ctx context.Context, guid string) (*models.User, error) {
+	var row userRow
+	if err := s.db.GetContext(ctx, &row, s.db.Rebind(selectUsers+" WHERE u.guid = ?"), guid); err != nil {
+		return nil, err
+	}
+	return row.toModel(), nil
+}
+
+func (s *UserStore) GetByLogin(ctx context.Context, login string) (*models.User, error) {
+	var row userRow
+	err := s.db.GetContext(ctx, &row, s.db.Rebind(selectUsers+" WHERE u.login = ?"), login)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return row.toModel(), nil
+}
+
+// EachBatch calls fn with all users in guid order, size users at a time.
+func (s *UserStore) EachBatch(ctx context.Context, size int, fn func([]*models.User) error) error {
+	query := s.db.Rebind(selectUsers + " WHERE u.guid > ? ORDER BY u.guid LIMIT ?")
+	after := ""
+	for {
+		var rows []userRow
+		if err := s.db.SelectContext(ctx, &rows, query, after, size); err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+
+		batch := make([]*models.User, len(rows))
+		for i := range rows {
+			batch[i] = rows[i].toModel()
+		}
+		if err := fn(batch); err != nil {
+			return err
+		}
+		after = rows[len(rows)-1].GUID
+	}
+}
+
+// Existing returns which of the users exist.
+func (s *UserStore) Existing(ctx context.Context, guids []string) (map[string]bool, error) {
+	return existing(ctx, s.db, "SELECT guid FROM users WHERE guid IN (?)", guids)
+}
+
+// EachDuplicateLogin calls fn with every login that belongs to more than one user, and those users.
+func (s *UserStore) EachDuplicateLogin(ctx context.Context, fn func(login string, users []*models.User) error) error {
+	rows, err := s.db.QueryxContext(ctx, "SELECT login FROM users GROUP BY login HAVING COUNT(*) > 1")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var login string
+		if err = rows.Scan(&login); err != nil {
+			return err
+		}
+
+		var users []userRow
+		if err = s.db.SelectContext(ctx, &users, s.db.Rebind(selectUsers+" WHERE u.login = ? ORDER BY u.created_at"), login); err != nil {
+			return err
+		}
+		duplicates := make([]*models.User, len(users))
+		for i := range users {
+			duplicates[i] = users[i].toModel()
+		}
+		if err = fn(login, duplicates); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (s *UserStore) Insert(ctx context.Context, user *models.User) error {
+	return insertUser(ctx, s.db, user)
+}
+
+// Import copies a user document that was created elsewhere, keeping its session.
+// It returns false without changing anything if the user is already present, so
+// an interrupted import can simply be run again.
+func (s *UserStore) Import(ctx context.Context, user *models.User) (bool, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var exists int
+	err = tx.GetContext(ctx, &exists, tx.Rebind("SELECT COUNT(*) FROM users WHERE guid = ?"), user.GUID)
+	if err != nil {
+		return false, err
+	}
+	if exists > 0 {
+		return false, nil
+	}
+
+	if err = insertUser(ctx, tx, user); err != nil {
+		return false, err
+	}
+	if !user.LastLoginAt.IsZero() {
+		query := tx.Rebind("UPDATE users SET last_login_at = ? WHERE guid = ?")
+		if _, err = tx.ExecContext(ctx, query, user.LastLoginAt, user.GUID); err != nil {
+			return false, err
+		}
+	}
+	if user.RefreshToken != "" {
+		if err = saveSession(ctx, tx, user.GUID, user.RefreshToken); err != nil {
+			return false, err
+		}
+	}
+
+	return true, tx.Commit()
+}
+
+func (s *UserStore) DeleteByGuid(ctx context.Context, guid string) error {
+	_, err := s.db.ExecContext(ctx, s.db.Rebind("DELETE FROM users WHERE guid = ?"), guid)
+	return err
+}
+
+func (s *UserStore) UpdateRefreshToken(ctx context.Context, guid string, refreshToken string) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = saveSession(ctx, tx, guid, refreshToken); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *UserStore) SetStatus(ctx context.Context, guid string, status string) error {
+	_, err := s.db.ExecContext(ctx, s.db.Rebind("UPDATE users SET status = ? WHERE guid = ?"), status, guid)
+	return err
+}
+
+func (s *UserStore) SetEmailVerified(ctx context.Context, guid string, verified bool) error {
+	_, err := s.db.ExecContext(ctx, s.db.Rebind("UPDATE users SET email_verified = ? WHERE guid = ?"), verified, guid)
+	return err
+}
+
+func (s *UserStore) SetPasswordless(ctx context.Context, guid string, passwordless bool) error {
+	_, err := s.db.ExecContext(ctx, s.db.Rebind("UPDATE users SET passwordless = ? WHERE guid = ?"), passwordless, guid)
+	return err
+}
+
+func (s *UserStore) UpdateLastLoginAt(ctx context.Context, guid string) error {
+	_, err := s.db.ExecContext(ctx, s.db.Rebind("UPDATE users SET last_login_at = ? WHERE guid = ?"), time.Now(), guid)
+	return err
+}
+
+func (s *UserStore) UpdateRefreshTokenAndLastLoginAt(ctx context.Context, guid string, refreshToken string) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = saveSession(ctx, tx, guid, refreshToken); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, tx.Rebind("UPDATE users SET last_login_at = ? WHERE guid = ?"), time.Now(), guid)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func insertUser(ctx context.Context, db sqlx.ExtContext, user *models.User) error {
+	status := user.Status
+	if status == "" {
+		status = models.UserStatusActive
+	}
+	query := db.Rebind(`INSERT INTO users (guid, login, login_type_id, login_type_name, name, last_name, attributes, status,
+		email_verified, passwordless, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	_, err := db.ExecContext(ctx, query, user.GUID, user.Login, user.LoginType.ID, user.LoginType.Name,
+		user.Name, user.LastName, attributes(user.Attributes), status, user.EmailVerified, user.Passwordless, user.CreatedAt)
+	return err
+}
+
+// saveSession replaces the session of the user; delete and insert keeps it portable across dialects.
+func saveSession(ctx context.Context, tx *sqlx.Tx, guid string, refreshToken string) error {
+	if _, err := tx.ExecContext(ctx, tx.Rebind("DELETE FROM sessions WHERE user_id = ?"), guid); err != nil {
+		return err
+	}
+	query := tx.Rebind("INSERT INTO sessions (user_id, refresh_token, created_at) VALUES (?, ?, ?)")
+	_, err := tx.ExecContext(ctx, query, guid, refreshToken, time.Now())
+	return err
+}
+
+func (r *userRow) toModel() *models.User {
+	return &models.User{
+		GUID:          r.GUID,
+		Login:         r.Login,
+		LoginType:     models.LoginType{ID: r.LoginTypeID, Name: r.LoginTypeName},
+		Name:          r.Name,
+		LastName:      r.LastName,
+		LastLoginAt:   r.LastLoginAt.Time,
+		CreatedAt:     r.CreatedAt,
+		Attributes:    r.Attributes,
+		Status:        r.Status,
+		EmailVerified: r.EmailVerified,
+		Passwordless:  r.Passwordless,
+		RefreshToken:  r.RefreshToken.String,
+	}
+}
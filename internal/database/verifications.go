@@ -0,0 +1,59 @@
+package database
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+// EmailVerificationStore keeps when a verification email was last sent to each unverified user in
+// the email_verifications table, so that resending can be throttled.
+type EmailVerificationStore struct {
+	db *sqlx.DB
+}
+
+func NewEmailVerificationStore(db *sqlx.DB) *EmailVerificationStore {
+	return &EmailVerificationStore{db: db}
+}
+
+// Claim records that a verification email is sent to the user at now, unless one was sent after
+// notBefore, and reports whether it did. Of concurrent claims at most one succeeds: the update only
+// takes a row that is old enough, and the insert only a user without one.
+func (s *EmailVerificationStore) Claim(ctx context.Context, userID string, now time.Time, notBefore time.Time) (bool, error) {
+	query := s.db.Rebind("UPDATE email_verifications SET sent_at = ? WHERE user_id = ? AND sent_at <= ?")
+	claimed, err := affected(s.db.ExecContext(ctx, query, now.UTC().Truncate(time.Microsecond), userID, notBefore.UTC()))
+	if err != nil || claimed {
+		return claimed, err
+	}
+
+	query = s.db.Rebind("INSERT INTO email_verifications (user_id, sent_at) VALUES (?, ?)")
+	_, err = s.db.ExecContext(ctx, query, userID, now.UTC().Truncate(time.Microsecond))
+	if IsUniqueViolation(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Sent records that a verification email was sent to the user at sentAt.
+func (s *EmailVerificationStore) Sent(ctx context.Context, userID string, sentAt time.Time) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, tx.Rebind("DELETE FROM email_verifications WHERE user_id = ?"), userID); err != nil {
+		return err
+	}
+	query := tx.Rebind("INSERT INTO email_verifications (user_id, sent_at) VALUES (?, ?)")
+	if _, err = tx.ExecContext(ctx, query, userID, sentAt.UTC().Truncate(time.Microsecond)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Delete forgets the user, once verified.
+func (s *EmailVerificationStore) Delete(ctx context.Context, userID string) error {
+	_, err := s.db.ExecContext(ctx, s.db.Rebind("DELETE FROM email_verifications WHERE user_id = ?"), userID)
+	return err
+}
@@ -0,0 +1,49 @@
+package database
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestEmailVerificationStoreConformance(t *testing.T) {
+	for name, cfg := range dialects(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			store := NewEmailVerificationStore(openDB(t, cfg))
+			now := time.Now()
+
+			// of concurrent claims only one is let through, whether the user has a row or not
+			for _, sentAt := range []time.Time{{}, now.Add(-time.Hour)} {
+				if !sentAt.IsZero() {
+					require.NoError(t, store.Sent(ctx, "guid", sentAt))
+				} else {
+					require.NoError(t, store.Delete(ctx, "guid"))
+				}
+				claims := make(chan bool, 10)
+				for i := 0; i < cap(claims); i++ {
+					go func() {
+						claimed, err := store.Claim(ctx, "guid", now, now.Add(-time.Minute))
+						require.NoError(t, err)
+						claims <- claimed
+					}()
+				}
+				succeeded := 0
+				for i := 0; i < cap(claims); i++ {
+					if <-claims {
+						succeeded++
+					}
+				}
+				require.Equal(t, 1, succeeded)
+			}
+
+			claimed, err := store.Claim(ctx, "guid", now.Add(30*time.Second), now.Add(-30*time.Second))
+			require.NoError(t, err)
+			require.False(t, claimed)
+			claimed, err = store.Claim(ctx, "guid", now.Add(2*time.Minute), now.Add(time.Minute))
+			require.NoError(t, err)
+			require.True(t, claimed)
+		})
+	}
+}
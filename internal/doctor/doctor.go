@@ -0,0 +1,269 @@
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"go.uber.org/zap"
+	"time"
+	"tutorial-auth/internal/audit"
+	"tutorial-auth/internal/database"
+	"tutorial-auth/internal/mongodb/models"
+)
+
+// Issue kinds.
+const (
+	OrphanUser        = "orphan_user"        // user without a credential who is not passwordless, and can never log in
+	OrphanCredential  = "orphan_credential"  // credential without a user
+	DuplicateLogin    = "duplicate_login"    // login shared with an older user
+	ExpiredCredential = "expired_credential" // credential past its expiry date
+	MissingField      = "missing_field"      // user without a required field
+)
+
+type Issue struct {
+	Kind    string `json:"kind"`
+	UserID  string `json:"user_id,omitempty"`
+	Login   string `json:"login,omitempty"`
+	Detail  string `json:"detail"`
+	Fixable bool   `json:"fixable"`
+	Fixed   bool   `json:"fixed"`
+
+	fix func(ctx context.Context) error
+}
+
+type Summary struct {
+	Users       int            `json:"users"`
+	Credentials int            `json:"credentials"`
+	Issues      map[string]int `json:"issues"`
+	Fixed       int            `json:"fixed"`
+}
+
+// UserStore is the user store being checked, mongodb.UserStore or database.UserStore.
+type UserStore interface {
+	EachBatch(ctx context.Context, size int, fn func([]*models.User) error) error
+	Existing(ctx context.Context, guids []string) (map[string]bool, error)
+	EachDuplicateLogin(ctx context.Context, fn func(login string, users []*models.User) error) error
+	DeleteByGuid(ctx context.Context, guid string) error
+}
+
+// Decide is asked whether the fix of a fixable issue should be applied.
+type Decide func(issue *Issue) bool
+
+// Reporter receives every issue once it has been found and, if decided so, fixed.
+type Reporter func(issue *Issue) error
+
+// Doctor checks that the user store and the credentials in the SQL database agree. Both stores
+// are read batch by batch and cross-checked with lookups, so memory use does not grow with them.
+// Every fix it applies is recorded in the audit log as an admin action of the operator.
+type Doctor struct {
+	logger    *zap.Logger
+	users     UserStore
+	passwords *database.PasswordStore
+	outbox    *database.RegistrationOutbox
+	auditLog  *audit.Log
+	batchSize int
+}
+
+func NewDoctor(logger *zap.Logger, users UserStore, passwords *database.PasswordStore, outbox *database.RegistrationOutbox,
+	auditLog *audit.Log, batchSize int) *Doctor {
+	return &Doctor{
+		logger:    logger,
+		users:     users,
+		passwords: passwords,
+		outbox:    outbox,
+		auditLog:  auditLog,
+		batchSize: batchSize,
+	}
+}
+
+func (d *Doctor) Run(ctx context.Context, decide Decide, report Reporter) (*Summary, error) {
+	summary := &Summary{Issues: map[string]int{}}
+	emit := func(issue *Issue) error {
+		summary.Issues[issue.Kind]++
+		if issue.Fixable && decide(issue) {
+			err := issue.fix(ctx)
+			d.auditFix(ctx, issue, err)
+			if err != nil {
+				return fmt.Errorf("fix %s of %s: %w", issue.Kind, issue.UserID, err)
+			}
+			issue.Fixed = true
+			summary.Fixed++
+		}
+		return report(issue)
+	}
+
+	if err := d.checkUsers(ctx, summary, emit); err != nil {
+		return summary, err
+	}
+	if err := d.checkCredentials(ctx, summary, emit); err != nil {
+		return summary, err
+	}
+	if err := d.checkDuplicateLogins(ctx, emit); err != nil {
+		return summary, err
+	}
+	return summary, nil
+}
+
+func (d *Doctor) auditFix(ctx context.Context, issue *Issue, err error) {
+	subject := issue.UserID
+	if subject == "" {
+		subject = issue.Login
+	}
+	result := audit.ResultSuccess
+	if err != nil {
+		result = "error"
+	}
+	d.auditLog.Record(ctx, audit.Event{Type: audit.AdminAction, Actor: audit.Operator(), Subject: subject, Result: result,
+		Detail: "doctor fixed " + issue.Kind + ": " + issue.Detail})
+}
+
+func (d *Doctor) checkUsers(ctx context.Context, summary *Summary, emit Reporter) error {
+	return d.users.EachBatch(ctx, d.batchSize, func(users []*models.User) error {
+		summary.Users += len(users)
+
+		guids := make([]string, 0, len(users))
+		for _, user := range users {
+			if user.GUID != "" {
+				guids = append(guids, user.GUID)
+			}
+		}
+		// a registration writes its credential before it leaves the outbox, so reading the outbox
+		// first cannot miss a registration that completes between the two reads
+		registering, err := d.outbox.Existing(ctx, guids)
+		if err != nil {
+			return err
+		}
+		withPassword, err := d.passwords.Existing(ctx, guids)
+		if err != nil {
+			return err
+		}
+
+		for _, user := range users {
+			for _, field := range missingFields(user) {
+				if err = emit(&Issue{Kind: MissingField, UserID: user.GUID, Login: user.Login, Detail: field + " is empty"}); err != nil {
+					return err
+				}
+			}
+
+			// unfinished registrations belong to the recovery worker, and passwordless users log in without one
+			if user.GUID == "" || user.Passwordless || withPassword[user.GUID] || registering[user.GUID] {
+				continue
+			}
+			guid := user.GUID
+			err = emit(&Issue{
+				Kind: OrphanUser, UserID: guid, Login: user.Login, Detail: "user has no credential",
+				Fixable: true,
+				fix:     func(ctx context.Context) error { return d.deleteOrphanUser(ctx, guid) },
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// deleteOrphanUser deletes the user unless a credential or a registration has appeared since the check.
+func (d *Doctor) deleteOrphanUser(ctx context.Context, guid string) error {
+	registering, err := d.outbox.Existing(ctx, []string{guid})
+	if err != nil || registering[guid] {
+		return err
+	}
+	withPassword, err := d.passwords.Existing(ctx, []string{guid})
+	if err != nil || withPassword[guid] {
+		return err
+	}
+	return d.users.DeleteByGuid(ctx, guid)
+}
+
+func (d *Doctor) checkCredentials(ctx context.Context, summary *Summary, emit Reporter) error {
+	now := time.Now()
+	return d.passwords.EachBatch(ctx, d.batchSize, func(passwords []database.Password) error {
+		summary.Credentials += len(passwords)
+
+		guids := make([]string, len(passwords))
+		for i, password := range passwords {
+			guids[i] = password.UserID
+		}
+		users, err := d.users.Existing(ctx, guids)
+		if err != nil {
+			return err
+		}
+		registering, err := d.outbox.Existing(ctx, guids)
+		if err != nil {
+			return err
+		}
+
+		for _, password := range passwords {
+			guid := password.UserID
+			if !users[guid] && !registering[guid] {
+				err = emit(&Issue{
+					Kind: OrphanCredential, UserID: guid, Detail: "credential has no user",
+					Fixable: true,
+					fix:     func(ctx context.Context) error { return d.passwords.Delete(ctx, guid) },
+				})
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
+			if password.ExpiresAt.Before(now) {
+				detail := fmt.Sprintf("credential expired at %s", password.ExpiresAt.Format(time.RFC3339))
+				if err = emit(&Issue{Kind: ExpiredCredential, UserID: guid, Detail: detail}); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// checkDuplicateLogins keeps the oldest user of every login; fixing removes the others.
+func (d *Doctor) checkDuplicateLogins(ctx context.Context, emit Reporter) error {
+	return d.users.EachDuplicateLogin(ctx, func(login string, users []*models.User) error {
+		kept := users[0].GUID
+		for _, user := range users[1:] {
+			guid := user.GUID
+			err := emit(&Issue{
+				Kind: DuplicateLogin, UserID: guid, Login: login,
+				Detail:  fmt.Sprintf("login already belongs to user %s", kept),
+				Fixable: true,
+				fix:     func(ctx context.Context) error { return d.deleteDuplicateUser(ctx, guid, kept) },
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// deleteDuplicateUser deletes the user and its credential unless the user or the user kept for the
+// login has been deleted since the check, which would leave the login without a user.
+func (d *Doctor) deleteDuplicateUser(ctx context.Context, guid string, kept string) error {
+	existing, err := d.users.Existing(ctx, []string{guid, kept})
+	if err != nil || !existing[guid] || !existing[kept] {
+		return err
+	}
+	if err = d.passwords.Delete(ctx, guid); err != nil {
+		return err
+	}
+	return d.users.DeleteByGuid(ctx, guid)
+}
+
+func missingFields(user *models.User) []string {
+	var missing []string
+	if user.GUID == "" {
+		missing = append(missing, "guid")
+	}
+	if user.Login == "" {
+		missing = append(missing, "login")
+	}
+	if user.LoginType.Name == "" {
+		missing = append(missing, "login_type")
+	}
+	if user.CreatedAt.IsZero() {
+		missing = append(missing, "created_at")
+	}
+	return missing
+}
@@ -0,0 +1,140 @@
+package doctor
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"path/filepath"
+	"testing"
+	"time"
+	"tutorial-auth/internal/audit"
+	"tutorial-auth/internal/config"
+	"tutorial-auth/internal/database"
+	"tutorial-auth/internal/mongodb/models"
+)
+
+func TestDoctor(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.DBConnectionConfig{
+		Type:        "sqlite",
+		Database:    filepath.Join(t.TempDir(), "auth.db"),
+		BusyTimeout: 5 * time.Second,
+	}
+	db, err := database.NewConnectionDB(cfg)
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, database.ApplyMigration(zap.NewNop(), cfg.Type, db))
+
+	users := database.NewUserStore(db)
+	addUser := func(guid string, login string) {
+		require.NoError(t, users.Insert(ctx, &models.User{
+			GUID: guid, Login: login, LoginType: models.LoginType{ID: 1, Name: "email"}, CreatedAt: time.Now(),
+		}))
+	}
+	addPassword := func(guid string, expiresAt time.Time) {
+		_, err := db.Exec("INSERT INTO passwords (user_id, password, expires_at) VALUES (?, ?, ?)", guid, "hash", expiresAt)
+		require.NoError(t, err)
+	}
+
+	addUser("healthy", "healthy@example.com")
+	addPassword("healthy", time.Now().Add(time.Hour))
+	addUser("orphan", "orphan@example.com")
+	addPassword("no-user", time.Now().Add(time.Hour))
+	addUser("expired", "expired@example.com")
+	addPassword("expired", time.Now().Add(-time.Hour))
+	require.NoError(t, users.Insert(ctx, &models.User{GUID: "incomplete", Login: "incomplete@example.com"}))
+	addPassword("incomplete", time.Now().Add(time.Hour))
+
+	auditStore := database.NewAuditStore(db)
+	d := NewDoctor(zap.NewNop(), users, database.NewPasswordStore(db), database.NewRegistrationOutbox(db),
+		audit.NewLog(zap.NewNop(), auditStore), 2)
+
+	var found []*Issue
+	summary, err := d.Run(ctx, func(*Issue) bool { return false }, func(issue *Issue) error {
+		found = append(found, issue)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 4, summary.Users)
+	require.Equal(t, 4, summary.Credentials)
+	require.Equal(t, map[string]int{OrphanUser: 1, OrphanCredential: 1, ExpiredCredential: 1, MissingField: 2}, summary.Issues)
+	require.Len(t, found, 5)
+	require.Zero(t, summary.Fixed)
+
+	summary, err = d.Run(ctx, func(*Issue) bool { return true }, func(*Issue) error { return nil })
+	require.NoError(t, err)
+	require.Equal(t, 2, summary.Fixed)
+
+	// every fix is an admin action of the operator
+	events, err := auditStore.Range(ctx, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	for _, event := range events {
+		require.Equal(t, audit.AdminAction, event.Type)
+		require.Equal(t, audit.Operator(), event.Actor)
+		require.Equal(t, audit.ResultSuccess, event.Result)
+	}
+
+	summary, err = d.Run(ctx, func(*Issue) bool { return true }, func(*Issue) error { return nil })
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{ExpiredCredential: 1, MissingField: 2}, summary.Issues)
+
+	// a registration that writes its credential after the check keeps its user
+	addUser("late", "late@example.com")
+	_, err = d.Run(ctx, func(issue *Issue) bool {
+		if issue.Kind == OrphanUser {
+			addPassword(issue.UserID, time.Now().Add(time.Hour))
+		}
+		return true
+	}, func(*Issue) error { return nil })
+	require.NoError(t, err)
+	late, err := users.GetByGuid(ctx, "late")
+	require.NoError(t, err)
+	require.Equal(t, "late@example.com", late.Login)
+}
+
+// duplicateUsers reports the users given as sharing a login, which the unique index of the SQL
+// store otherwise rules out.
+type duplicateUsers struct {
+	*database.UserStore
+	login string
+	guids []string
+}
+
+func (s *duplicateUsers) EachDuplicateLogin(ctx context.Context, fn func(login string, users []*models.User) error) error {
+	users := make([]*models.User, len(s.guids))
+	for i, guid := range s.guids {
+		users[i] = &models.User{GUID: guid, Login: s.login}
+	}
+	return fn(s.login, users)
+}
+
+func TestDoctorDuplicateLogins(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.DBConnectionConfig{Type: "sqlite", Database: filepath.Join(t.TempDir(), "auth.db"), BusyTimeout: 5 * time.Second}
+	db, err := database.NewConnectionDB(cfg)
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, database.ApplyMigration(zap.NewNop(), cfg.Type, db))
+
+	users := &duplicateUsers{UserStore: database.NewUserStore(db), login: "user@example.com", guids: []string{"kept", "duplicate"}}
+	for _, guid := range users.guids {
+		require.NoError(t, users.Insert(ctx, &models.User{
+			GUID: guid, Login: guid + "@example.com", LoginType: models.LoginType{ID: 1, Name: "email"}, Passwordless: true, CreatedAt: time.Now(),
+		}))
+	}
+	d := NewDoctor(zap.NewNop(), users, database.NewPasswordStore(db), database.NewRegistrationOutbox(db),
+		audit.NewLog(zap.NewNop(), database.NewAuditStore(db)), 10)
+
+	// the kept user is deleted between the report and the fix, so the duplicate is all that is left
+	_, err = d.Run(ctx, func(issue *Issue) bool {
+		if issue.Kind == DuplicateLogin {
+			require.NoError(t, users.DeleteByGuid(ctx, "kept"))
+		}
+		return true
+	}, func(*Issue) error { return nil })
+	require.NoError(t, err)
+	existing, err := users.Existing(ctx, users.guids)
+	require.NoError(t, err)
+	require.Equal(t, map[string]bool{"duplicate": true}, existing)
+}
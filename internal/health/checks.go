@@ -0,0 +1,89 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+	"time"
+	"tutorial-auth/internal/config"
+	"tutorial-auth/internal/database"
+	"tutorial-auth/internal/mongodb"
+	"tutorial-auth/internal/mongodb/migrations"
+	"tutorial-auth/internal/services"
+)
+
+var (
+	ErrNoSigningKey     = errors.New("token signing key is not configured")
+	ErrHashingSaturated = errors.New("hashing pool is saturated")
+)
+
+// Mongo pings the primary.
+func Mongo(db *mongodb.MongoDB, timeout time.Duration) Check {
+	return Check{Name: "mongo", Timeout: timeout, Run: func(ctx context.Context) (any, error) {
+		return nil, db.Ping(ctx)
+	}}
+}
+
+// SQL pings the database and reports the state of the connection pool.
+func SQL(db *sqlx.DB, timeout time.Duration) Check {
+	return Check{Name: "sql", Timeout: timeout, Run: func(ctx context.Context) (any, error) {
+		stats := db.Stats()
+		detail := map[string]int{
+			"open":     stats.OpenConnections,
+			"in_use":   stats.InUse,
+			"max_open": stats.MaxOpenConnections,
+		}
+		return detail, db.PingContext(ctx)
+	}}
+}
+
+// Migrations fails when SQL migrations are pending, which means the schema is older than the code.
+// Pending MongoDB migrations are reported but do not fail, since they are applied by mongo-migrate
+// after the deployment and the code works with the schema before them.
+func Migrations(dbType string, db *sqlx.DB, mongo *mongodb.MongoDB, timeout time.Duration) Check {
+	return Check{Name: "migrations", Timeout: timeout, Run: func(ctx context.Context) (any, error) {
+		detail := map[string]int{}
+		pending, err := database.PendingMigrations(ctx, dbType, db)
+		if err != nil {
+			return nil, err
+		}
+		detail["sql_pending"] = pending
+
+		if mongo != nil {
+			mongoPending, err := migrations.NewMigrator(zap.NewNop(), mongo.GetDB()).Pending(ctx)
+			if err != nil {
+				return detail, err
+			}
+			detail["mongo_pending"] = mongoPending
+		}
+
+		if pending > 0 {
+			return detail, fmt.Errorf("%d sql migrations are pending", pending)
+		}
+		return detail, nil
+	}}
+}
+
+// SigningKey fails when there is no key to sign and verify tokens with.
+func SigningKey(cfg *config.AppConfig) Check {
+	return Check{Name: "signing_key", Run: func(context.Context) (any, error) {
+		if cfg.TokenSecret == "" {
+			return nil, ErrNoSigningKey
+		}
+		return nil, nil
+	}}
+}
+
+// HashingPool fails when more than maxQueue password hashes are waiting for a slot, as logins
+// sent to this server would wait behind them.
+func HashingPool(pool *services.HashingPool, maxQueue int64) Check {
+	return Check{Name: "hashing_pool", Run: func(context.Context) (any, error) {
+		stats := pool.Stats()
+		if stats.Waiting > maxQueue {
+			return stats, ErrHashingSaturated
+		}
+		return stats, nil
+	}}
+}
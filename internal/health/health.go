@@ -0,0 +1,126 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"sync"
+	"sync/atomic"
+	"time"
+	"tutorial-auth/pkg/logging"
+)
+
+const (
+	StatusOK       = "ok"
+	StatusFail     = "fail"
+	StatusDraining = "draining"
+)
+
+// defaultTimeout bounds checks that do not set their own timeout.
+const defaultTimeout = time.Second
+
+// Check is one dependency of readiness. Run returns details to report, which may be nil, and
+// an error when the dependency is not usable.
+type Check struct {
+	Name    string
+	Timeout time.Duration
+	Run     func(ctx context.Context) (any, error)
+}
+
+type Result struct {
+	Status     string  `json:"status"`
+	DurationMs float64 `json:"duration_ms"`
+	Detail     any     `json:"detail,omitempty"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// Report is the readiness of the server with a breakdown per dependency.
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks,omitempty"`
+}
+
+// Checker runs the readiness checks. Once Drain has been called, the server is reported as
+// draining without running the checks, so load balancers stop sending it new requests.
+type Checker struct {
+	log      *zap.Logger
+	checks   []Check
+	draining atomic.Bool
+}
+
+func NewChecker(logger *zap.Logger, checks ...Check) *Checker {
+	return &Checker{
+		log:    logger,
+		checks: checks,
+	}
+}
+
+func (c *Checker) Add(check Check) {
+	c.checks = append(c.checks, check)
+}
+
+// Drain makes the server not ready for good, at the start of the shutdown.
+func (c *Checker) Drain() {
+	c.draining.Store(true)
+}
+
+func (c *Checker) Draining() bool {
+	return c.draining.Load()
+}
+
+// Ready runs all checks in parallel, each within its own timeout.
+func (c *Checker) Ready(ctx context.Context) *Report {
+	const op = "health.Checker.Ready"
+
+	if c.Draining() {
+		return &Report{Status: StatusDraining}
+	}
+
+	results := make([]Result, len(c.checks))
+	var wg sync.WaitGroup
+	for i, check := range c.checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			results[i] = run(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	report := &Report{Status: StatusOK, Checks: make(map[string]Result, len(c.checks))}
+	for i, check := range c.checks {
+		report.Checks[check.Name] = results[i]
+		if results[i].Status != StatusOK {
+			report.Status = StatusFail
+			logging.WithContext(ctx, c.log).Warn("readiness check failed", zap.String("op", op), zap.String("check", check.Name),
+				zap.String("error", results[i].Error))
+		}
+	}
+	return report
+}
+
+func run(ctx context.Context, check Check) Result {
+	timeout := check.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	started := time.Now()
+	detail, err := check.Run(ctx)
+	result := Result{
+		Status:     StatusOK,
+		DurationMs: float64(time.Since(started).Microseconds()) / 1000,
+		Detail:     detail,
+	}
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("timed out after %s: %w", timeout, err)
+		}
+		result.Status = StatusFail
+		result.Error = err.Error()
+	}
+	return result
+}
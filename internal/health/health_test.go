@@ -0,0 +1,88 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"path/filepath"
+	"testing"
+	"time"
+	"tutorial-auth/internal/config"
+	"tutorial-auth/internal/database"
+	"tutorial-auth/internal/services"
+)
+
+func newTestDB(t *testing.T) *sqlx.DB {
+	cfg := &config.DBConnectionConfig{Type: "sqlite", Database: filepath.Join(t.TempDir(), "auth.db"), BusyTimeout: 5 * time.Second}
+	db, err := database.NewConnectionDB(cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestReady(t *testing.T) {
+	slow := Check{Name: "slow", Timeout: 10 * time.Millisecond, Run: func(ctx context.Context) (any, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}}
+	failing := Check{Name: "failing", Run: func(context.Context) (any, error) {
+		return map[string]int{"pending": 1}, errors.New("broken")
+	}}
+
+	checker := NewChecker(zap.NewNop(), SigningKey(&config.AppConfig{TokenSecret: "secret"}))
+	report := checker.Ready(context.Background())
+	require.Equal(t, StatusOK, report.Status)
+	require.Equal(t, StatusOK, report.Checks["signing_key"].Status)
+
+	checker.Add(slow)
+	checker.Add(failing)
+	report = checker.Ready(context.Background())
+	require.Equal(t, StatusFail, report.Status)
+	require.Equal(t, StatusOK, report.Checks["signing_key"].Status)
+	require.Equal(t, StatusFail, report.Checks["slow"].Status)
+	require.Contains(t, report.Checks["slow"].Error, "timed out after 10ms")
+	require.Equal(t, "broken", report.Checks["failing"].Error)
+	require.Equal(t, map[string]int{"pending": 1}, report.Checks["failing"].Detail)
+
+	checker.Drain()
+	require.Equal(t, &Report{Status: StatusDraining}, checker.Ready(context.Background()))
+}
+
+func TestChecks(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	migrations := Migrations("sqlite", db, nil, time.Second)
+
+	_, err := migrations.Run(ctx)
+	require.ErrorContains(t, err, "sql migrations are pending")
+
+	require.NoError(t, database.ApplyMigration(zap.NewNop(), "sqlite", db))
+	detail, err := migrations.Run(ctx)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"sql_pending": 0}, detail)
+
+	_, err = SQL(db, time.Second).Run(ctx)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+	_, err = SQL(db, time.Second).Run(ctx)
+	require.Error(t, err)
+
+	_, err = SigningKey(&config.AppConfig{}).Run(ctx)
+	require.ErrorIs(t, err, ErrNoSigningKey)
+
+	pool := services.NewHashingPool(1)
+	_, err = HashingPool(pool, 0).Run(ctx)
+	require.NoError(t, err)
+
+	release := make(chan struct{})
+	go pool.Do(ctx, func() { <-release })
+	require.Eventually(t, func() bool { return pool.Stats().InUse == 1 }, time.Second, time.Millisecond)
+	go pool.Do(ctx, func() {})
+	require.Eventually(t, func() bool { return pool.Stats().Waiting == 1 }, time.Second, time.Millisecond)
+	detail, err = HashingPool(pool, 0).Run(ctx)
+	require.ErrorIs(t, err, ErrHashingSaturated)
+	require.Equal(t, services.HashingStats{Size: 1, InUse: 1, Waiting: 1}, detail)
+	close(release)
+}
@@ -0,0 +1,157 @@
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed locales/*.json
+var locales embed.FS
+
+// LocaleKey is the fiber local that holds the locale a handler has chosen for the request,
+// usually the stored preference of the user the request is about.
+const LocaleKey = "locale"
+
+// Translator renders messages from the catalogs in locales/. Catalogs are flat maps from message
+// keys to templates, where {name} is replaced by the parameter of that name.
+type Translator struct {
+	defaultLocale string
+	catalogs      map[string]map[string]string
+}
+
+func NewTranslator(defaultLocale string) (*Translator, error) {
+	const op = "i18n.NewTranslator"
+
+	files, err := locales.ReadDir("locales")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	t := &Translator{defaultLocale: normalize(defaultLocale), catalogs: make(map[string]map[string]string)}
+	for _, file := range files {
+		data, err := locales.ReadFile(path.Join("locales", file.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		var catalog map[string]string
+		if err = json.Unmarshal(data, &catalog); err != nil {
+			return nil, fmt.Errorf("%s: parse %s: %w", op, file.Name(), err)
+		}
+		t.catalogs[normalize(strings.TrimSuffix(file.Name(), ".json"))] = catalog
+	}
+	if _, ok := t.catalogs[t.defaultLocale]; !ok {
+		return nil, fmt.Errorf("%s: no catalog for default locale %q", op, defaultLocale)
+	}
+	return t, nil
+}
+
+// Locales returns the supported locales in alphabetical order.
+func (t *Translator) Locales() []string {
+	result := make([]string, 0, len(t.catalogs))
+	for locale := range t.catalogs {
+		result = append(result, locale)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Supported returns the catalog locale for locale, trying the language without its region
+// ("ru" for "ru-RU"), or "" when there is none.
+func (t *Translator) Supported(locale string) string {
+	locale = normalize(locale)
+	if _, ok := t.catalogs[locale]; ok {
+		return locale
+	}
+	language, _, _ := strings.Cut(locale, "-")
+	if _, ok := t.catalogs[language]; ok {
+		return language
+	}
+	return ""
+}
+
+// Match picks the supported locale the client prefers most in an Accept-Language header,
+// or the default locale.
+func (t *Translator) Match(acceptLanguage string) string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var tags []weighted
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if tag == "" {
+			continue
+		}
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q > 0 {
+			tags = append(tags, weighted{tag: tag, q: q})
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+
+	for _, tag := range tags {
+		if tag.tag == "*" {
+			break
+		}
+		if locale := t.Supported(tag.tag); locale != "" {
+			return locale
+		}
+	}
+	return t.defaultLocale
+}
+
+// RequestLocale returns the locale chosen by a handler, or the one matching Accept-Language.
+func (t *Translator) RequestLocale(fc *fiber.Ctx) string {
+	if locale, ok := fc.Locals(LocaleKey).(string); ok {
+		if supported := t.Supported(locale); supported != "" {
+			return supported
+		}
+	}
+	return t.Match(fc.Get(fiber.HeaderAcceptLanguage))
+}
+
+// Text renders key in locale, falling back to the default locale and then to fallback.
+// A nil Translator always returns fallback.
+func (t *Translator) Text(locale string, key string, params map[string]any, fallback string) string {
+	if t == nil {
+		return fallback
+	}
+	template, ok := t.catalogs[t.Supported(locale)][key]
+	if !ok {
+		if template, ok = t.catalogs[t.defaultLocale][key]; !ok {
+			return fallback
+		}
+	}
+	if len(params) == 0 {
+		return template
+	}
+	replacements := make([]string, 0, 2*len(params))
+	for name, value := range params {
+		replacements = append(replacements, "{"+name+"}", fmt.Sprint(value))
+	}
+	return strings.NewReplacer(replacements...).Replace(template)
+}
+
+// SetUserLocale makes the stored locale preference of a user, kept in the "locale" attribute,
+// the locale of the request.
+func SetUserLocale(fc *fiber.Ctx, attributes map[string]any) {
+	if locale, ok := attributes["locale"].(string); ok && locale != "" {
+		fc.Locals(LocaleKey, locale)
+	}
+}
+
+func normalize(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+}
@@ -0,0 +1,56 @@
+package i18n
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestCatalogsHaveSameKeys(t *testing.T) {
+	translator, err := NewTranslator("en")
+	require.NoError(t, err)
+
+	for _, locale := range translator.Locales() {
+		for key := range translator.catalogs["en"] {
+			require.Contains(t, translator.catalogs[locale], key, "locale %s", locale)
+		}
+		require.Len(t, translator.catalogs[locale], len(translator.catalogs["en"]), "locale %s", locale)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	translator, err := NewTranslator("en")
+	require.NoError(t, err)
+
+	testCases := []struct {
+		Header string
+		Locale string
+	}{
+		{Header: "", Locale: "en"},
+		{Header: "ru", Locale: "ru"},
+		{Header: "ru-RU", Locale: "ru"},
+		{Header: "de-DE,ru;q=0.5,en;q=0.7", Locale: "en"},
+		{Header: "de, ru;q=0.1", Locale: "ru"},
+		{Header: "ru;q=0, de", Locale: "en"},
+		{Header: "*", Locale: "en"},
+		{Header: "ru;q=bad", Locale: "en"},
+	}
+
+	for _, testCase := range testCases {
+		require.Equal(t, testCase.Locale, translator.Match(testCase.Header), "header %q", testCase.Header)
+	}
+}
+
+func TestText(t *testing.T) {
+	translator, err := NewTranslator("ru")
+	require.NoError(t, err)
+
+	require.Equal(t, "must match password", translator.Text("en-GB", "validation.must_match", map[string]any{"field": "password"}, ""))
+	require.Equal(t, "обязательное поле", translator.Text("de", "validation.required", nil, ""))
+	require.Equal(t, "fallback", translator.Text("en", "validation.unknown", nil, "fallback"))
+
+	var nilTranslator *Translator
+	require.Equal(t, "fallback", nilTranslator.Text("en", "validation.required", nil, "fallback"))
+
+	_, err = NewTranslator("fr")
+	require.Error(t, err)
+}
@@ -0,0 +1,117 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Hook is one subsystem of the application. Start and Stop are both optional.
+// Start must not block: long-running work belongs in a goroutine that reports failures with Fail.
+type Hook struct {
+	Name  string
+	Start func(ctx context.Context) error
+	Stop  func(ctx context.Context) error
+}
+
+// Lifecycle starts hooks in the order they were appended and stops the started ones in reverse
+// order, so every subsystem is stopped before the subsystems it depends on.
+type Lifecycle struct {
+	log     *zap.Logger
+	hooks   []Hook
+	started int
+
+	failOnce sync.Once
+	failed   chan error
+}
+
+func New(logger *zap.Logger) *Lifecycle {
+	return &Lifecycle{
+		log:    logger,
+		failed: make(chan error, 1),
+	}
+}
+
+func (l *Lifecycle) Append(hook Hook) {
+	l.hooks = append(l.hooks, hook)
+}
+
+// Start runs the start hooks in order. When one fails, the hooks started before it are stopped
+// within stopTimeout and the error of the failed hook is returned.
+func (l *Lifecycle) Start(ctx context.Context, stopTimeout time.Duration) error {
+	const op = "lifecycle.Start"
+
+	for _, hook := range l.hooks[l.started:] {
+		if hook.Start != nil {
+			l.log.Info("starting", zap.String("op", op), zap.String("hook", hook.Name))
+			if err := hook.Start(ctx); err != nil {
+				err = fmt.Errorf("start %s: %w", hook.Name, err)
+				stopCtx, cancel := context.WithTimeout(context.Background(), stopTimeout)
+				defer cancel()
+				return errors.Join(err, l.Stop(stopCtx))
+			}
+		}
+		l.started++
+	}
+	return nil
+}
+
+// Stop runs the stop hooks of the started hooks in reverse order. Every hook gets to stop even when
+// an earlier one failed or ctx expired, since closing connections late is better than never.
+func (l *Lifecycle) Stop(ctx context.Context) error {
+	const op = "lifecycle.Stop"
+
+	var errs []error
+	for ; l.started > 0; l.started-- {
+		hook := l.hooks[l.started-1]
+		if hook.Stop == nil {
+			continue
+		}
+		l.log.Info("stopping", zap.String("op", op), zap.String("hook", hook.Name))
+		if err := hook.Stop(ctx); err != nil {
+			l.log.Error("failed to stop", zap.String("op", op), zap.String("hook", hook.Name), zap.Error(err))
+			errs = append(errs, fmt.Errorf("stop %s: %w", hook.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Fail makes Run shut the application down, for subsystems that fail after they started.
+// Only the first failure is kept.
+func (l *Lifecycle) Fail(err error) {
+	l.failOnce.Do(func() { l.failed <- err })
+}
+
+// Run starts the hooks, waits until ctx is done, SIGINT or SIGTERM arrives or a subsystem fails,
+// and then stops the hooks within stopTimeout. It returns the first failure and any stop errors.
+func (l *Lifecycle) Run(ctx context.Context, stopTimeout time.Duration) error {
+	const op = "lifecycle.Run"
+
+	ctx, stopSignals := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+
+	if err := l.Start(ctx, stopTimeout); err != nil {
+		return err
+	}
+	l.log.Info("started", zap.String("op", op))
+
+	var failure error
+	select {
+	case <-ctx.Done():
+		l.log.Info("shutting down", zap.String("op", op))
+	case failure = <-l.failed:
+		l.log.Error("shutting down after failure", zap.String("op", op), zap.Error(failure))
+	}
+	// a second signal during shutdown kills the process the default way
+	stopSignals()
+
+	stopCtx, cancel := context.WithTimeout(context.Background(), stopTimeout)
+	defer cancel()
+	return errors.Join(failure, l.Stop(stopCtx))
+}
@@ -0,0 +1,111 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"testing"
+	"time"
+)
+
+// recorder appends hooks that record their calls.
+type recorder struct {
+	calls []string
+}
+
+func (r *recorder) hook(name string, startErr error) Hook {
+	return Hook{
+		Name: name,
+		Start: func(context.Context) error {
+			r.calls = append(r.calls, "start "+name)
+			return startErr
+		},
+		Stop: func(context.Context) error {
+			r.calls = append(r.calls, "stop "+name)
+			return nil
+		},
+	}
+}
+
+func TestStartStopOrder(t *testing.T) {
+	r := &recorder{}
+	lc := New(zap.NewNop())
+	lc.Append(r.hook("db", nil))
+	lc.Append(Hook{Name: "no-op"})
+	lc.Append(r.hook("http", nil))
+
+	require.NoError(t, lc.Start(context.Background(), time.Second))
+	require.NoError(t, lc.Stop(context.Background()))
+	require.Equal(t, []string{"start db", "start http", "stop http", "stop db"}, r.calls)
+
+	// stopping twice does nothing
+	require.NoError(t, lc.Stop(context.Background()))
+	require.Len(t, r.calls, 4)
+}
+
+func TestStartFailureStopsStartedHooks(t *testing.T) {
+	r := &recorder{}
+	failure := errors.New("no connection")
+	lc := New(zap.NewNop())
+	lc.Append(r.hook("mongo", nil))
+	lc.Append(r.hook("sql", failure))
+	lc.Append(r.hook("http", nil))
+
+	err := lc.Start(context.Background(), time.Second)
+	require.ErrorIs(t, err, failure)
+	require.ErrorContains(t, err, "start sql")
+	require.Equal(t, []string{"start mongo", "start sql", "stop mongo"}, r.calls)
+}
+
+func TestStopErrorsDoNotStopOthers(t *testing.T) {
+	r := &recorder{}
+	lc := New(zap.NewNop())
+	lc.Append(r.hook("db", nil))
+	lc.Append(Hook{Name: "broken", Stop: func(context.Context) error { return errors.New("stuck") }})
+
+	require.NoError(t, lc.Start(context.Background(), time.Second))
+	err := lc.Stop(context.Background())
+	require.ErrorContains(t, err, "stop broken: stuck")
+	require.Equal(t, []string{"start db", "stop db"}, r.calls)
+}
+
+func TestRunStopsWhenContextIsDone(t *testing.T) {
+	r := &recorder{}
+	lc := New(zap.NewNop())
+	lc.Append(r.hook("http", nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.NoError(t, lc.Run(ctx, time.Second))
+	require.Equal(t, []string{"start http", "stop http"}, r.calls)
+}
+
+func TestRunStopsOnFailure(t *testing.T) {
+	r := &recorder{}
+	failure := errors.New("address already in use")
+	lc := New(zap.NewNop())
+	lc.Append(r.hook("db", nil))
+	lc.Append(Hook{Name: "http", Start: func(context.Context) error {
+		lc.Fail(failure)
+		lc.Fail(errors.New("second failure"))
+		return nil
+	}})
+
+	err := lc.Run(context.Background(), time.Second)
+	require.ErrorIs(t, err, failure)
+	require.Equal(t, []string{"start db", "stop db"}, r.calls)
+}
+
+func TestStopTimeout(t *testing.T) {
+	lc := New(zap.NewNop())
+	lc.Append(Hook{Name: "slow", Stop: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}})
+
+	require.NoError(t, lc.Start(context.Background(), time.Second))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, lc.Stop(ctx), context.DeadlineExceeded)
+}
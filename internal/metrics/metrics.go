@@ -0,0 +1,158 @@
+// Package metrics defines the Prometheus metrics of the server, served on the admin listener at
+// /metrics. Every metric is listed here; TestMetricsDocumented fails for one that is not.
+//
+// Auth flows, where result is "success" or the code of the service error, such as invalid_credentials:
+//
+//	auth_logins_total{result}                 login attempts
+//	auth_registrations_total{result}          registration attempts
+//	auth_refreshes_total{result}              token refreshes
+//	auth_token_verifications_total{result}    access token verifications, including forward-auth and ext_authz checks
+//	auth_lockouts_total{reason}               logins refused because the account is locked, such as registration_pending
+//	auth_suspicious_logins_total{rule}        successful logins flagged by a risk rule, such as new_device
+//	auth_email_verifications_total{result}    email verifications with a token from a verification link
+//
+// Latencies, in seconds:
+//
+//	auth_password_hash_duration_seconds{operation}           bcrypt "hash" and "compare", without the wait for the hashing pool
+//	auth_sql_query_duration_seconds{operation,result}        SQL "query", "exec", "begin", "commit" and "rollback" calls
+//	auth_mongo_command_duration_seconds{command,result}      MongoDB commands, such as find or insert
+//	auth_http_request_duration_seconds{method,route,status}  HTTP requests by route template, "unmatched" when no route matched
+//
+// Connection pools:
+//
+//	auth_mongo_pool_connections                  open connections of the MongoDB driver
+//	auth_mongo_pool_connections_in_use           connections checked out of the pool
+//	auth_mongo_pool_checkout_failures_total      failed checkouts, for example when the pool wait timed out
+//	go_sql_max_open_connections{db_name}         and the other go_sql_* metrics of sql.DB.Stats
+//	go_sql_open_connections{db_name}
+//	go_sql_in_use_connections{db_name}
+//	go_sql_idle_connections{db_name}
+//	go_sql_wait_count_total{db_name}
+//	go_sql_wait_duration_seconds_total{db_name}
+//	go_sql_max_idle_closed_total{db_name}
+//	go_sql_max_idle_time_closed_total{db_name}
+//	go_sql_max_lifetime_closed_total{db_name}
+//
+// Audit log:
+//
+//	auth_audit_write_failures_total              audit events that could not be written
+//
+// Notifications, where result is "success" or "dead_letter":
+//
+//	auth_notifications_total{channel,result}     notifications delivered or given up on, by channel such as email
+//
+// The go_* and process_* metrics of the Go runtime and the process are served as well.
+package metrics
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "auth"
+
+// ResultSuccess is the result label of operations that succeeded.
+const ResultSuccess = "success"
+
+// Registry holds every metric of the server.
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+var (
+	Logins = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Name: "logins_total",
+		Help: "Login attempts by result.",
+	}, []string{"result"})
+	Registrations = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Name: "registrations_total",
+		Help: "Registration attempts by result.",
+	}, []string{"result"})
+	Refreshes = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Name: "refreshes_total",
+		Help: "Token refreshes by result.",
+	}, []string{"result"})
+	TokenVerifications = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Name: "token_verifications_total",
+		Help: "Access token verifications by result.",
+	}, []string{"result"})
+	Lockouts = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Name: "lockouts_total",
+		Help: "Logins refused because the account is locked, by reason.",
+	}, []string{"reason"})
+	SuspiciousLogins = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Name: "suspicious_logins_total",
+		Help: "Successful logins flagged as suspicious, by rule.",
+	}, []string{"rule"})
+	EmailVerifications = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Name: "email_verifications_total",
+		Help: "Email verifications by result.",
+	}, []string{"result"})
+
+	PasswordHashDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace, Name: "password_hash_duration_seconds",
+		Help:    "Duration of bcrypt operations.",
+		Buckets: prometheus.ExponentialBuckets(0.05, 2, 9),
+	}, []string{"operation"})
+	SQLQueryDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace, Name: "sql_query_duration_seconds",
+		Help:    "Duration of SQL calls.",
+		Buckets: prometheus.ExponentialBuckets(0.0005, 2, 14),
+	}, []string{"operation", "result"})
+	MongoCommandDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace, Name: "mongo_command_duration_seconds",
+		Help:    "Duration of MongoDB commands.",
+		Buckets: prometheus.ExponentialBuckets(0.0005, 2, 14),
+	}, []string{"command", "result"})
+	HTTPRequestDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace, Name: "http_request_duration_seconds",
+		Help:    "Duration of HTTP requests by route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	MongoPoolConnections = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace, Name: "mongo_pool_connections",
+		Help: "Open connections of the MongoDB driver.",
+	})
+	MongoPoolConnectionsInUse = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace, Name: "mongo_pool_connections_in_use",
+		Help: "MongoDB connections checked out of the pool.",
+	})
+	MongoPoolCheckoutFailures = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace, Name: "mongo_pool_checkout_failures_total",
+		Help: "Failed checkouts of MongoDB connections.",
+	})
+
+	AuditWriteFailures = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace, Name: "audit_write_failures_total",
+		Help: "Audit events that could not be written.",
+	})
+
+	Notifications = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Name: "notifications_total",
+		Help: "Notifications delivered or given up on, by channel and result.",
+	}, []string{"channel", "result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// RegisterSQLPool serves the stats of the connection pool of db as go_sql_* metrics.
+// A pool registered before under the same name is replaced.
+func RegisterSQLPool(db *sql.DB, name string) {
+	collector := collectors.NewDBStatsCollector(db, name)
+	if err := Registry.Register(collector); err != nil {
+		var registered prometheus.AlreadyRegisteredError
+		if errors.As(err, &registered) {
+			Registry.Unregister(registered.ExistingCollector)
+			Registry.MustRegister(collector)
+		}
+	}
+}
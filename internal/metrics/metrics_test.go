@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"database/sql"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// TestMetricsDocumented fails when a metric is missing from the package documentation, or
+// the documentation lists a metric that does not exist.
+func TestMetricsDocumented(t *testing.T) {
+	source, err := os.ReadFile("metrics.go")
+	require.NoError(t, err)
+	doc := string(source[:strings.Index(string(source), "package metrics")])
+	documented := map[string]bool{}
+	for _, match := range regexp.MustCompile(`(?m)^//\t((?:auth|go_sql)_\w+)`).FindAllStringSubmatch(doc, -1) {
+		documented[match[1]] = true
+	}
+
+	db, err := sql.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	RegisterSQLPool(db, "sqlite")
+	// registering the pool again replaces it
+	RegisterSQLPool(db, "sqlite")
+
+	// vectors are only gathered once they have a child
+	Logins.WithLabelValues(ResultSuccess)
+	Registrations.WithLabelValues(ResultSuccess)
+	Refreshes.WithLabelValues(ResultSuccess)
+	TokenVerifications.WithLabelValues(ResultSuccess)
+	Lockouts.WithLabelValues("registration_pending")
+	SuspiciousLogins.WithLabelValues("new_device")
+	EmailVerifications.WithLabelValues(ResultSuccess)
+	Notifications.WithLabelValues("email", ResultSuccess)
+	PasswordHashDuration.WithLabelValues("hash")
+	SQLQueryDuration.WithLabelValues("query", ResultSuccess)
+	MongoCommandDuration.WithLabelValues("find", ResultSuccess)
+	HTTPRequestDuration.WithLabelValues("GET", "/readyz", "200")
+
+	families, err := Registry.Gather()
+	require.NoError(t, err)
+	gathered := map[string]bool{}
+	for _, family := range families {
+		name := family.GetName()
+		if strings.HasPrefix(name, namespace+"_") || strings.HasPrefix(name, "go_sql_") {
+			gathered[name] = true
+			require.True(t, documented[name], "document %s in the package comment", name)
+		}
+	}
+	for name := range documented {
+		require.True(t, gathered[name], "%s is documented but not registered", name)
+	}
+}
@@ -0,0 +1,16 @@
+// Package metricstest reads the metrics of package metrics in tests.
+package metricstest
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// SampleCount returns how many observations the histogram of observer has recorded.
+func SampleCount(t testing.TB, observer prometheus.Observer) uint64 {
+	var m dto.Metric
+	require.NoError(t, observer.(prometheus.Metric).Write(&m))
+	return m.GetHistogram().GetSampleCount()
+}
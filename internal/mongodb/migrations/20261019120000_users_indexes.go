@@ -0,0 +1,57 @@
+package migrations
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var userIndexes = []mongo.IndexModel{
+	{
+		Keys:    bson.D{{Key: "guid", Value: 1}},
+		Options: options.Index().SetName("guid_unique").SetUnique(true),
+	},
+	{
+		Keys:    bson.D{{Key: "login", Value: 1}},
+		Options: options.Index().SetName("login_unique").SetUnique(true),
+	},
+	{
+		// only the few unfinished registrations are indexed
+		Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: 1}},
+		Options: options.Index().SetName("status_pending").
+			SetPartialFilterExpression(bson.M{"status": "pending"}),
+	},
+	{
+		Keys: bson.D{{Key: "refresh_token", Value: 1}},
+		Options: options.Index().SetName("refresh_token_partial").
+			SetPartialFilterExpression(bson.M{"refresh_token": bson.M{"$type": "string"}}),
+	},
+}
+
+// Creating the unique indexes fails while duplicate logins or guids exist; `doctor --fix` removes them.
+func init() {
+	Register(&Migration{
+		Version:     20261019120000,
+		Description: "unique users indexes",
+		Schema:      true,
+		Up: func(ctx context.Context, env *Env) error {
+			if env.DryRun {
+				return nil
+			}
+			_, err := env.DB.Collection("users").Indexes().CreateMany(ctx, userIndexes)
+			return err
+		},
+		Down: func(ctx context.Context, env *Env) error {
+			if env.DryRun {
+				return nil
+			}
+			for _, index := range userIndexes {
+				if _, err := env.DB.Collection("users").Indexes().DropOne(ctx, *index.Options.Name); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
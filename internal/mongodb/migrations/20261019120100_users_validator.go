@@ -0,0 +1,69 @@
+package migrations
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var userValidator = bson.M{"$jsonSchema": bson.M{
+	"bsonType": "object",
+	"required": bson.A{"guid", "login", "created_at"},
+	"properties": bson.M{
+		"guid":       bson.M{"bsonType": "string", "minLength": 1},
+		"login":      bson.M{"bsonType": "string", "minLength": 1},
+		"name":       bson.M{"bsonType": "string"},
+		"last_name":  bson.M{"bsonType": "string"},
+		"created_at": bson.M{"bsonType": "date"},
+		"status":     bson.M{"enum": bson.A{"pending", "active"}},
+		"login_type": bson.M{
+			"bsonType": "object",
+			"required": bson.A{"id", "name"},
+			"properties": bson.M{
+				"id":   bson.M{"bsonType": bson.A{"int", "long"}},
+				"name": bson.M{"bsonType": "string"},
+			},
+		},
+		"attributes": bson.M{"bsonType": "object"},
+	},
+}}
+
+// The validator rejects new or changed user documents without the fields every user needs. The
+// moderate level leaves updates of documents that were already invalid alone.
+func init() {
+	Register(&Migration{
+		Version:     20261019120100,
+		Description: "users json schema validator",
+		Schema:      true,
+		Up: func(ctx context.Context, env *Env) error {
+			if env.DryRun {
+				return nil
+			}
+			names, err := env.DB.ListCollectionNames(ctx, bson.M{"name": "users"})
+			if err != nil {
+				return err
+			}
+			if len(names) == 0 {
+				opts := options.CreateCollection().SetValidator(userValidator).
+					SetValidationLevel("moderate").SetValidationAction("error")
+				return env.DB.CreateCollection(ctx, "users", opts)
+			}
+			return env.DB.RunCommand(ctx, bson.D{
+				{Key: "collMod", Value: "users"},
+				{Key: "validator", Value: userValidator},
+				{Key: "validationLevel", Value: "moderate"},
+				{Key: "validationAction", Value: "error"},
+			}).Err()
+		},
+		Down: func(ctx context.Context, env *Env) error {
+			if env.DryRun {
+				return nil
+			}
+			return env.DB.RunCommand(ctx, bson.D{
+				{Key: "collMod", Value: "users"},
+				{Key: "validator", Value: bson.M{}},
+				{Key: "validationLevel", Value: "off"},
+			}).Err()
+		},
+	})
+}
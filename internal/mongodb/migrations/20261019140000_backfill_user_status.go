@@ -0,0 +1,29 @@
+package migrations
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.uber.org/zap"
+)
+
+// Users registered before the registration saga have no status and are treated as active.
+func init() {
+	Register(&Migration{
+		Version:     20261019140000,
+		Description: "backfill user status",
+		Up: func(ctx context.Context, env *Env) error {
+			n, err := env.UpdateInBatches(ctx, "users",
+				bson.M{"status": bson.M{"$exists": false}},
+				bson.M{"$set": bson.M{"status": "active"}})
+			env.Logger.Info("backfilled user status", zap.Int64("users", n))
+			return err
+		},
+		Down: func(ctx context.Context, env *Env) error {
+			n, err := env.UpdateInBatches(ctx, "users",
+				bson.M{"status": "active"},
+				bson.M{"$unset": bson.M{"status": ""}})
+			env.Logger.Info("removed user status", zap.Int64("users", n))
+			return err
+		},
+	})
+}
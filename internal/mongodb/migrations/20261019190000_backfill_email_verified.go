@@ -0,0 +1,29 @@
+package migrations
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.uber.org/zap"
+)
+
+// Users registered before email verification have no verification status and are treated as verified.
+func init() {
+	Register(&Migration{
+		Version:     20261019190000,
+		Description: "backfill email verification",
+		Up: func(ctx context.Context, env *Env) error {
+			n, err := env.UpdateInBatches(ctx, "users",
+				bson.M{"email_verified": bson.M{"$exists": false}},
+				bson.M{"$set": bson.M{"email_verified": true}})
+			env.Logger.Info("backfilled email verification", zap.Int64("users", n))
+			return err
+		},
+		Down: func(ctx context.Context, env *Env) error {
+			n, err := env.UpdateInBatches(ctx, "users",
+				bson.M{"email_verified": true},
+				bson.M{"$unset": bson.M{"email_verified": ""}})
+			env.Logger.Info("removed email verification", zap.Int64("users", n))
+			return err
+		},
+	})
+}
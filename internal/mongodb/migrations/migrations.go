@@ -0,0 +1,295 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+	"sort"
+	"time"
+)
+
+const collection = "schema_migrations"
+
+// legacyCollection is where the versions of the schema steps were stored before they became
+// migrations; legacyVersions maps those versions to the migrations that replaced them.
+const legacyCollection = "schema_version"
+
+var legacyVersions = map[int]int64{1: 20261019120000, 2: 20261019120100}
+
+// Migration changes the shape of documents. Versions are timestamps like the goose migrations on the SQL side.
+// Schema migrations only change indexes or validation rules and are applied at startup.
+type Migration struct {
+	Version     int64
+	Description string
+	Schema      bool
+	Up          func(ctx context.Context, env *Env) error
+	Down        func(ctx context.Context, env *Env) error
+}
+
+var registry []*Migration
+
+// Register adds a migration; migration files call it from init.
+func Register(m *Migration) {
+	for _, registered := range registry {
+		if registered.Version == m.Version {
+			panic(fmt.Sprintf("duplicate mongodb migration version %d", m.Version))
+		}
+	}
+	registry = append(registry, m)
+	sort.Slice(registry, func(i, j int) bool { return registry[i].Version < registry[j].Version })
+}
+
+// Env is what a migration works with.
+type Env struct {
+	DB        *mongo.Database
+	Logger    *zap.Logger
+	DryRun    bool
+	BatchSize int
+}
+
+// UpdateInBatches applies update to the documents of the collection matching filter, BatchSize
+// documents at a time, so every write is short and the collection stays available while it runs.
+// In a dry run the matching documents are only counted.
+func (e *Env) UpdateInBatches(ctx context.Context, name string, filter bson.M, update bson.M) (int64, error) {
+	coll := e.DB.Collection(name)
+	opts := options.Find().SetSort(bson.M{"_id": 1}).SetLimit(int64(e.BatchSize)).SetProjection(bson.M{"_id": 1})
+
+	var total int64
+	after := primitive.NilObjectID
+	for {
+		page := bson.M{"$and": bson.A{filter, bson.M{"_id": bson.M{"$gt": after}}}}
+		cursor, err := coll.Find(ctx, page, opts)
+		if err != nil {
+			return total, err
+		}
+		var docs []struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		if err = cursor.All(ctx, &docs); err != nil {
+			return total, err
+		}
+		if len(docs) == 0 {
+			return total, nil
+		}
+
+		ids := make(bson.A, len(docs))
+		for i, doc := range docs {
+			ids[i] = doc.ID
+		}
+		after = docs[len(docs)-1].ID
+
+		if e.DryRun {
+			total += int64(len(docs))
+			continue
+		}
+		res, err := coll.UpdateMany(ctx, bson.M{"$and": bson.A{filter, bson.M{"_id": bson.M{"$in": ids}}}}, update)
+		if err != nil {
+			return total, err
+		}
+		total += res.ModifiedCount
+	}
+}
+
+type Status struct {
+	Version     int64      `json:"version"`
+	Description string     `json:"description"`
+	AppliedAt   *time.Time `json:"applied_at,omitempty"`
+}
+
+type applied struct {
+	Version     int64     `bson:"_id"`
+	Description string    `bson:"description"`
+	AppliedAt   time.Time `bson:"applied_at"`
+}
+
+// Migrator applies the registered migrations and records them in the schema_migrations collection.
+type Migrator struct {
+	logger *zap.Logger
+	db     *mongo.Database
+}
+
+func NewMigrator(logger *zap.Logger, db *mongo.Database) *Migrator {
+	return &Migrator{
+		logger: logger,
+		db:     db,
+	}
+}
+
+// Status lists every registered migration and when it was applied.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	done, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, len(registry))
+	for i, migration := range registry {
+		statuses[i] = Status{Version: migration.Version, Description: migration.Description}
+		if record, ok := done[migration.Version]; ok {
+			statuses[i].AppliedAt = &record.AppliedAt
+		}
+	}
+	return statuses, nil
+}
+
+// Pending returns the number of registered migrations that have not been applied.
+func (m *Migrator) Pending(ctx context.Context) (int, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return 0, err
+	}
+	pending := 0
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			pending++
+		}
+	}
+	return pending, nil
+}
+
+// Up applies every pending migration in version order.
+func (m *Migrator) Up(ctx context.Context, dryRun bool, batchSize int) error {
+	return m.up(ctx, m.env(dryRun, batchSize), false)
+}
+
+// UpSchema applies the pending schema migrations; the document migrations are left to Up.
+func (m *Migrator) UpSchema(ctx context.Context) error {
+	return m.up(ctx, m.env(false, 0), true)
+}
+
+func (m *Migrator) up(ctx context.Context, env *Env, schemaOnly bool) error {
+	const op = "mongodb.migrations.Up"
+
+	done, err := m.applied(ctx)
+	if err != nil {
+		return err
+	}
+
+	dryRun := env.DryRun
+	for _, migration := range registry {
+		if _, ok := done[migration.Version]; ok || (schemaOnly && !migration.Schema) {
+			continue
+		}
+
+		m.logger.Info("applying migration", zap.String("op", op), zap.Int64("version", migration.Version),
+			zap.String("description", migration.Description), zap.Bool("dryRun", dryRun))
+		if err = migration.Up(ctx, env); err != nil {
+			return fmt.Errorf("migration %d: %w", migration.Version, err)
+		}
+		if dryRun {
+			continue
+		}
+
+		_, err = m.db.Collection(collection).InsertOne(ctx, applied{
+			Version:     migration.Version,
+			Description: migration.Description,
+			AppliedAt:   time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Down reverts the most recently applied migration.
+func (m *Migrator) Down(ctx context.Context, dryRun bool, batchSize int) error {
+	const op = "mongodb.migrations.Down"
+
+	done, err := m.applied(ctx)
+	if err != nil {
+		return err
+	}
+
+	for i := len(registry) - 1; i >= 0; i-- {
+		migration := registry[i]
+		if _, ok := done[migration.Version]; !ok {
+			continue
+		}
+		if migration.Down == nil {
+			return fmt.Errorf("migration %d cannot be reverted", migration.Version)
+		}
+
+		m.logger.Info("reverting migration", zap.String("op", op), zap.Int64("version", migration.Version),
+			zap.String("description", migration.Description), zap.Bool("dryRun", dryRun))
+		if err = migration.Down(ctx, m.env(dryRun, batchSize)); err != nil {
+			return fmt.Errorf("migration %d: %w", migration.Version, err)
+		}
+		if dryRun {
+			return nil
+		}
+		_, err = m.db.Collection(collection).DeleteOne(ctx, bson.M{"_id": migration.Version})
+		return err
+	}
+	return errors.New("no migration to revert")
+}
+
+func (m *Migrator) env(dryRun bool, batchSize int) *Env {
+	return &Env{
+		DB:        m.db,
+		Logger:    m.logger,
+		DryRun:    dryRun,
+		BatchSize: batchSize,
+	}
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int64]applied, error) {
+	if err := m.adoptLegacy(ctx); err != nil {
+		return nil, err
+	}
+	cursor, err := m.db.Collection(collection).Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	var records []applied
+	if err = cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+
+	done := make(map[int64]applied, len(records))
+	for _, record := range records {
+		done[record.Version] = record
+	}
+	return done, nil
+}
+
+// adoptLegacy records the schema steps a database got before they became migrations as applied
+// migrations and drops the schema_version collection, so only schema_migrations is left.
+func (m *Migrator) adoptLegacy(ctx context.Context) error {
+	const op = "mongodb.migrations.adoptLegacy"
+
+	var legacy struct {
+		Version int `bson:"version"`
+	}
+	err := m.db.Collection(legacyCollection).FindOne(ctx, bson.M{"_id": "users"}).Decode(&legacy)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for step, version := range legacyVersions {
+		if step > legacy.Version {
+			continue
+		}
+		description := ""
+		for _, migration := range registry {
+			if migration.Version == version {
+				description = migration.Description
+			}
+		}
+		_, err = m.db.Collection(collection).UpdateOne(ctx, bson.M{"_id": version},
+			bson.M{"$setOnInsert": bson.M{"description": description, "applied_at": time.Now()}},
+			options.Update().SetUpsert(true))
+		if err != nil {
+			return err
+		}
+	}
+	m.logger.Info("adopted legacy schema version", zap.String("op", op), zap.Int("version", legacy.Version))
+	return m.db.Collection(legacyCollection).Drop(ctx)
+}
@@ -0,0 +1,131 @@
+package migrations
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRegisterKeepsVersionOrder(t *testing.T) {
+	saved := registry
+	defer func() { registry = saved }()
+
+	registry = nil
+	Register(&Migration{Version: 3})
+	Register(&Migration{Version: 1})
+	Register(&Migration{Version: 2})
+
+	var versions []int64
+	for _, migration := range registry {
+		versions = append(versions, migration.Version)
+	}
+	require.Equal(t, []int64{1, 2, 3}, versions)
+	require.Panics(t, func() { Register(&Migration{Version: 2}) })
+}
+
+func TestRegisteredMigrationsAreReversible(t *testing.T) {
+	require.NotEmpty(t, registry)
+	for _, migration := range registry {
+		require.NotEmpty(t, migration.Description, migration.Version)
+		require.NotNil(t, migration.Up, migration.Version)
+		require.NotNil(t, migration.Down, migration.Version)
+	}
+}
+
+func TestLegacyVersionsAreSchemaMigrations(t *testing.T) {
+	for step, version := range legacyVersions {
+		found := false
+		for _, migration := range registry {
+			if migration.Version == version {
+				found = true
+				require.True(t, migration.Schema, step)
+			}
+		}
+		require.True(t, found, step)
+	}
+}
+
+// testDB returns a database of its own on the server that AUTH_TEST_MONGO_URI points at, e.g.
+// mongodb://localhost:27018 from docker-compose.dev.yml.
+func testDB(t *testing.T) *mongo.Database {
+	uri := os.Getenv("AUTH_TEST_MONGO_URI")
+	if uri == "" {
+		t.Skip("AUTH_TEST_MONGO_URI is not set")
+	}
+	ctx := context.Background()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Disconnect(ctx) })
+	db := client.Database("migrations_test_" + strconv.FormatInt(time.Now().UnixNano(), 36))
+	t.Cleanup(func() { db.Drop(ctx) })
+	return db
+}
+
+func TestMigratorRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	db := testDB(t)
+
+	_, err := db.Collection("users").InsertOne(ctx, bson.M{"guid": "legacy"})
+	require.NoError(t, err)
+	migrator := NewMigrator(zap.NewNop(), db)
+
+	// a dry run changes nothing and records nothing
+	require.NoError(t, migrator.Up(ctx, true, 10))
+	pending, err := migrator.Pending(ctx)
+	require.NoError(t, err)
+	require.Equal(t, len(registry), pending)
+
+	require.NoError(t, migrator.Up(ctx, false, 10))
+	statuses, err := migrator.Status(ctx)
+	require.NoError(t, err)
+	for _, status := range statuses {
+		require.NotNil(t, status.AppliedAt, status.Version)
+	}
+	var user bson.M
+	require.NoError(t, db.Collection("users").FindOne(ctx, bson.M{"guid": "legacy"}).Decode(&user))
+	require.Equal(t, "active", user["status"])
+
+	// down reverts one migration at a time, newest first
+	for i := len(registry) - 1; i >= 0; i-- {
+		require.NoError(t, migrator.Down(ctx, false, 10))
+		statuses, err = migrator.Status(ctx)
+		require.NoError(t, err)
+		require.Nil(t, statuses[i].AppliedAt, registry[i].Version)
+	}
+	require.Error(t, migrator.Down(ctx, false, 10))
+	require.NoError(t, db.Collection("users").FindOne(ctx, bson.M{"guid": "legacy"}).Decode(&user))
+	require.NotContains(t, user, "status")
+}
+
+func TestMigratorAdoptsLegacySchemaVersion(t *testing.T) {
+	ctx := context.Background()
+	db := testDB(t)
+
+	_, err := db.Collection(legacyCollection).InsertOne(ctx, bson.M{"_id": "users", "version": 1})
+	require.NoError(t, err)
+	migrator := NewMigrator(zap.NewNop(), db)
+
+	statuses, err := migrator.Status(ctx)
+	require.NoError(t, err)
+	for _, status := range statuses {
+		require.Equal(t, status.Version == legacyVersions[1], status.AppliedAt != nil, status.Version)
+	}
+	names, err := db.ListCollectionNames(ctx, bson.M{"name": legacyCollection})
+	require.NoError(t, err)
+	require.Empty(t, names)
+
+	// the schema migrations that were not applied yet run at startup, the document migrations do not
+	require.NoError(t, migrator.UpSchema(ctx))
+	statuses, err = migrator.Status(ctx)
+	require.NoError(t, err)
+	for i, status := range statuses {
+		require.Equal(t, registry[i].Schema, status.AppliedAt != nil, status.Version)
+	}
+}
@@ -6,19 +6,56 @@ import (
 	"time"
 )
 
+const (
+	UserStatusPending = "pending"
+	UserStatusActive  = "active"
+)
+
 type LoginType struct {
 	ID   int    `bson:"id" json:"id"`
 	Name string `bson:"name" json:"name"`
 }
 
 type User struct {
-	ID           primitive.ObjectID `bson:"_id,omitempty"`
-	GUID         string             `bson:"guid,omitempty" json:"guid,omitempty"`
-	Login        string             `bson:"login,omitempty" json:"login,omitempty"`
-	LoginType    LoginType          `bson:"login_type,omitempty" json:"login_type,omitempty"`
-	Name         string             `bson:"name,omitempty" json:"name,omitempty"`
-	LastName     string             `bson:"last_name,omitempty" json:"last_name,omitempty"`
-	LastLoginAt  time.Time          `bson:"last_login_at,omitempty" json:"last_login_at,omitempty"`
-	CreatedAt    time.Time          `bson:"created_at,omitempty" json:"created_at,omitempty"`
-	RefreshToken string             `bson:"refresh_token,omitempty" json:"-"`
+	ID            primitive.ObjectID `bson:"_id,omitempty"`
+	GUID          string             `bson:"guid,omitempty" json:"guid,omitempty"`
+	Login         string             `bson:"login,omitempty" json:"login,omitempty"`
+	LoginType     LoginType          `bson:"login_type,omitempty" json:"login_type,omitempty"`
+	Name          string             `bson:"name,omitempty" json:"name,omitempty"`
+	LastName      string             `bson:"last_name,omitempty" json:"last_name,omitempty"`
+	LastLoginAt   time.Time          `bson:"last_login_at,omitempty" json:"last_login_at,omitempty"`
+	CreatedAt     time.Time          `bson:"created_at,omitempty" json:"created_at,omitempty"`
+	Attributes    map[string]any     `bson:"attributes,omitempty" json:"attributes,omitempty"`
+	Status        string             `bson:"status,omitempty" json:"status,omitempty"`
+	EmailVerified bool               `bson:"email_verified" json:"email_verified"`                 // users registered before verification count as verified
+	Passwordless  bool               `bson:"passwordless,omitempty" json:"passwordless,omitempty"` // registered without a password and has not set one
+	RefreshToken  string             `bson:"refresh_token,omitempty" json:"-"`
+}
+
+// IsActive reports whether the registration of the user has completed.
+// Users created before registration statuses were introduced have no status and are active.
+func (u *User) IsActive() bool {
+	return u.Status == "" || u.Status == UserStatusActive
+}
+
+// Roles returns the roles of the user, kept as a list of strings in the "roles" attribute.
+func (u *User) Roles() []string {
+	var roles []string
+	switch values := u.Attributes["roles"].(type) {
+	case []string:
+		roles = append(roles, values...)
+	case []any:
+		for _, value := range values {
+			if role, ok := value.(string); ok {
+				roles = append(roles, role)
+			}
+		}
+	case primitive.A:
+		for _, value := range values {
+			if role, ok := value.(string); ok {
+				roles = append(roles, role)
+			}
+		}
+	}
+	return roles
 }
@@ -2,53 +2,110 @@ package mongodb
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
 	"go.uber.org/zap"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
 	"tutorial-auth/internal/config"
 )
 
+var ErrNotConnected = errors.New("mongodb is not connected")
+
 type MongoDB struct {
 	Client    *mongo.Client
 	log       *zap.Logger
 	cfg       *config.MongoDbConnectionConfig
-	connected bool
+	connected atomic.Bool
 }
 
 func NewMongoDB(logger *zap.Logger, cfg *config.MongoDbConnectionConfig) *MongoDB {
 	return &MongoDB{
-		Client:    nil,
-		log:       logger,
-		cfg:       cfg,
-		connected: false,
+		Client: nil,
+		log:    logger,
+		cfg:    cfg,
 	}
 }
 
-func (m *MongoDB) Connect() error {
-	var err error
-	uri := fmt.Sprintf("mongodb://%s:%s@%s:%d/%s?ssl=false&authSource=admin", m.cfg.Username, m.cfg.Password, m.cfg.Host, m.cfg.Port, m.cfg.Database)
-
-	serverAPI := options.ServerAPI(options.ServerAPIVersion1)
-	opts := options.Client().ApplyURI(uri).SetServerAPIOptions(serverAPI)
+// Connect connects and pings the primary; ctx bounds both.
+func (m *MongoDB) Connect(ctx context.Context) error {
+	opts, err := m.clientOptions()
+	if err != nil {
+		return err
+	}
 
-	m.Client, err = mongo.Connect(context.TODO(), opts)
+	m.Client, err = mongo.Connect(ctx, opts)
 	if err != nil {
 		return err
 	}
 
 	var result bson.M
-	if err = m.Client.Database("admin").RunCommand(context.TODO(), bson.M{"ping": 1}).Decode(&result); err != nil {
+	if err = m.Client.Database("admin").RunCommand(ctx, bson.M{"ping": 1}).Decode(&result); err != nil {
+		// ctx may be done already, and disconnecting must still release the pool
+		m.Client.Disconnect(context.Background())
+		m.Client = nil
 		return err
 	}
 
-	m.connected = true
 	return nil
 }
 
+// ConnectWithRetry connects, retrying with exponential backoff until the startup timeout runs out
+// or ctx is done. Every attempt is bounded by the time left before the deadline.
+func (m *MongoDB) ConnectWithRetry(ctx context.Context) error {
+	const op = "mongodb.ConnectWithRetry"
+
+	ctx, cancel := context.WithTimeout(ctx, m.cfg.Startup.Timeout)
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+	interval := m.cfg.Startup.InitialInterval
+	for attempt := 1; ; attempt++ {
+		err := m.Connect(ctx)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil || time.Now().Add(interval).After(deadline) {
+			return fmt.Errorf("gave up connecting to mongodb after %d attempts: %w", attempt, err)
+		}
+
+		m.log.Warn("failed to connect to mongodb, retrying", zap.String("op", op),
+			zap.Int("attempt", attempt), zap.Duration("retryIn", interval), zap.Error(err))
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("gave up connecting to mongodb after %d attempts: %w", attempt, err)
+		case <-time.After(interval):
+		}
+
+		interval *= 2
+		if interval > m.cfg.Startup.MaxInterval {
+			interval = m.cfg.Startup.MaxInterval
+		}
+	}
+}
+
+// IsConnected reports whether the driver currently sees a server it can write to.
+// It follows the driver's server monitoring, so it turns false when the primary is lost and
+// true again once the driver has reconnected.
 func (m *MongoDB) IsConnected() bool {
-	return m.connected
+	return m.connected.Load()
+}
+
+// Ping asks the primary for a round trip.
+func (m *MongoDB) Ping(ctx context.Context) error {
+	if m.Client == nil {
+		return ErrNotConnected
+	}
+	return m.Client.Ping(ctx, readpref.Primary())
 }
 
 func (m *MongoDB) Disconnect() {
@@ -64,3 +121,125 @@ func (m *MongoDB) GetDB() *mongo.Database {
 func (m *MongoDB) GetCollection(name string) *mongo.Collection {
 	return m.GetDB().Collection(name)
 }
+
+func (m *MongoDB) clientOptions() (*options.ClientOptions, error) {
+	uri := m.cfg.URI
+	if uri == "" {
+		uri = fmt.Sprintf("mongodb://%s:%d/%s", m.cfg.Host, m.cfg.Port, m.cfg.Database)
+	}
+
+	serverAPI := options.ServerAPI(options.ServerAPIVersion1)
+	opts := options.Client().ApplyURI(uri).SetServerAPIOptions(serverAPI).SetServerMonitor(m.serverMonitor()).
+		SetMonitor(commandMonitor()).SetPoolMonitor(poolMonitor())
+
+	// credentials given in the URI are not overridden
+	if m.cfg.Username != "" && opts.Auth == nil {
+		opts.SetAuth(options.Credential{
+			AuthSource: m.cfg.AuthSource,
+			Username:   m.cfg.Username,
+			Password:   m.cfg.Password,
+		})
+	}
+	if m.cfg.ReplicaSet != "" {
+		opts.SetReplicaSet(m.cfg.ReplicaSet)
+	}
+
+	if m.cfg.TLS.Enabled {
+		tlsConfig, err := m.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		opts.SetTLSConfig(tlsConfig)
+	}
+
+	if m.cfg.ReadPreference != "" {
+		mode, err := readpref.ModeFromString(m.cfg.ReadPreference)
+		if err != nil {
+			return nil, err
+		}
+		readPref, err := readpref.New(mode)
+		if err != nil {
+			return nil, err
+		}
+		opts.SetReadPreference(readPref)
+	}
+
+	if m.cfg.WriteConcern.W != "" || m.cfg.WriteConcern.Journal {
+		wc := &writeconcern.WriteConcern{WTimeout: m.cfg.WriteConcern.WTimeout}
+		if w, err := strconv.Atoi(m.cfg.WriteConcern.W); err == nil {
+			wc.W = w
+		} else if m.cfg.WriteConcern.W != "" {
+			wc.W = m.cfg.WriteConcern.W
+		}
+		if m.cfg.WriteConcern.Journal {
+			journal := true
+			wc.Journal = &journal
+		}
+		opts.SetWriteConcern(wc)
+	}
+
+	if m.cfg.ConnectTimeout > 0 {
+		opts.SetConnectTimeout(m.cfg.ConnectTimeout)
+	}
+	if m.cfg.ServerSelectionTimeout > 0 {
+		opts.SetServerSelectionTimeout(m.cfg.ServerSelectionTimeout)
+	}
+	if m.cfg.SocketTimeout > 0 {
+		opts.SetSocketTimeout(m.cfg.SocketTimeout)
+	}
+	if m.cfg.Pool.MaxSize > 0 {
+		opts.SetMaxPoolSize(m.cfg.Pool.MaxSize)
+	}
+	opts.SetMinPoolSize(m.cfg.Pool.MinSize)
+	if m.cfg.Pool.MaxIdleTime > 0 {
+		opts.SetMaxConnIdleTime(m.cfg.Pool.MaxIdleTime)
+	}
+
+	return opts, opts.Validate()
+}
+
+func (m *MongoDB) tlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: m.cfg.TLS.InsecureSkipVerify,
+	}
+
+	if m.cfg.TLS.CAFile != "" {
+		ca, err := os.ReadFile(m.cfg.TLS.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in %s", m.cfg.TLS.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if m.cfg.TLS.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(m.cfg.TLS.CertFile, m.cfg.TLS.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+func (m *MongoDB) serverMonitor() *event.ServerMonitor {
+	const op = "mongodb.serverMonitor"
+
+	return &event.ServerMonitor{
+		TopologyDescriptionChanged: func(e *event.TopologyDescriptionChangedEvent) {
+			connected := e.NewDescription.HasWritableServer()
+			if m.connected.Swap(connected) != connected {
+				if connected {
+					m.log.Info("mongodb is available", zap.String("op", op), zap.String("topology", e.NewDescription.Kind.String()))
+				} else {
+					m.log.Warn("mongodb is unavailable", zap.String("op", op), zap.String("topology", e.NewDescription.Kind.String()))
+				}
+			}
+		},
+	}
+}
@@ -0,0 +1,45 @@
+package mongodb
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
+	"tutorial-auth/internal/metrics"
+)
+
+// commandMonitor measures the duration of every command sent to MongoDB and passes the events
+// on to tracing, since the driver takes a single command monitor.
+func commandMonitor() *event.CommandMonitor {
+	tracing := otelmongo.NewMonitor()
+	return &event.CommandMonitor{
+		Started: tracing.Started,
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			tracing.Succeeded(ctx, e)
+			metrics.MongoCommandDuration.WithLabelValues(e.CommandName, metrics.ResultSuccess).Observe(e.Duration.Seconds())
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			tracing.Failed(ctx, e)
+			metrics.MongoCommandDuration.WithLabelValues(e.CommandName, "error").Observe(e.Duration.Seconds())
+		},
+	}
+}
+
+// poolMonitor follows the connections of the driver.
+func poolMonitor() *event.PoolMonitor {
+	return &event.PoolMonitor{
+		Event: func(e *event.PoolEvent) {
+			switch e.Type {
+			case event.ConnectionCreated:
+				metrics.MongoPoolConnections.Inc()
+			case event.ConnectionClosed:
+				metrics.MongoPoolConnections.Dec()
+			case event.GetSucceeded:
+				metrics.MongoPoolConnectionsInUse.Inc()
+			case event.ConnectionReturned:
+				metrics.MongoPoolConnectionsInUse.Dec()
+			case event.GetFailed:
+				metrics.MongoPoolCheckoutFailures.Inc()
+			}
+		},
+	}
+}
@@ -0,0 +1,181 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+	"tutorial-auth/internal/mongodb/models"
+)
+
+// UserStore keeps user documents in the users collection.
+type UserStore struct {
+	client     *MongoDB
+	collection string
+}
+
+func NewUserStore(client *MongoDB) *UserStore {
+	return &UserStore{
+		client:     client,
+		collection: "users",
+	}
+}
+
+func (s *UserStore) GetByGuid(ctx context.Context, guid string) (*models.User, error) {
+	var user *models.User
+	err := s.client.GetCollection(s.collection).FindOne(ctx, bson.M{"guid": guid}).Decode(&user)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *UserStore) GetByLogin(ctx context.Context, login string) (*models.User, error) {
+	var user *models.User
+	err := s.client.GetCollection(s.collection).FindOne(ctx, bson.M{"login": login}).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// FindAfter returns up to limit users whose _id follows after, in _id order.
+// Passing the _id of the last returned user pages through the whole collection.
+func (s *UserStore) FindAfter(ctx context.Context, after primitive.ObjectID, limit int64) ([]*models.User, error) {
+	opts := options.Find().SetSort(bson.M{"_id": 1}).SetLimit(limit)
+	cursor, err := s.client.GetCollection(s.collection).Find(ctx, bson.M{"_id": bson.M{"$gt": after}}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var users []*models.User
+	if err = cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// EachBatch calls fn with all users in _id order, size users at a time.
+func (s *UserStore) EachBatch(ctx context.Context, size int, fn func([]*models.User) error) error {
+	after := primitive.NilObjectID
+	for {
+		batch, err := s.FindAfter(ctx, after, int64(size))
+		if err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		if err = fn(batch); err != nil {
+			return err
+		}
+		after = batch[len(batch)-1].ID
+	}
+}
+
+// Existing returns which of the users exist.
+func (s *UserStore) Existing(ctx context.Context, guids []string) (map[string]bool, error) {
+	found := make(map[string]bool, len(guids))
+	if len(guids) == 0 {
+		return found, nil
+	}
+
+	opts := options.Find().SetProjection(bson.M{"guid": 1})
+	cursor, err := s.client.GetCollection(s.collection).Find(ctx, bson.M{"guid": bson.M{"$in": guids}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var user models.User
+		if err = cursor.Decode(&user); err != nil {
+			return nil, err
+		}
+		found[user.GUID] = true
+	}
+	return found, cursor.Err()
+}
+
+// EachDuplicateLogin calls fn with every login that belongs to more than one user, and those users.
+func (s *UserStore) EachDuplicateLogin(ctx context.Context, fn func(login string, users []*models.User) error) error {
+	collection := s.client.GetCollection(s.collection)
+	pipeline := mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{"_id": "$login", "count": bson.M{"$sum": 1}}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+	}
+	cursor, err := collection.Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var group struct {
+			Login string `bson:"_id"`
+		}
+		if err = cursor.Decode(&group); err != nil {
+			return err
+		}
+
+		users, err := collection.Find(ctx, bson.M{"login": group.Login}, options.Find().SetSort(bson.M{"created_at": 1}))
+		if err != nil {
+			return err
+		}
+		var duplicates []*models.User
+		if err = users.All(ctx, &duplicates); err != nil {
+			return err
+		}
+		if err = fn(group.Login, duplicates); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+func (s *UserStore) Insert(ctx context.Context, user *models.User) error {
+	_, err := s.client.GetCollection(s.collection).InsertOne(ctx, user)
+	return err
+}
+
+func (s *UserStore) DeleteByGuid(ctx context.Context, guid string) error {
+	_, err := s.client.GetCollection(s.collection).DeleteOne(ctx, bson.M{"guid": guid})
+	return err
+}
+
+func (s *UserStore) UpdateRefreshToken(ctx context.Context, guid string, refreshToken string) error {
+	return s.update(ctx, guid, bson.M{"refresh_token": refreshToken})
+}
+
+func (s *UserStore) SetStatus(ctx context.Context, guid string, status string) error {
+	return s.update(ctx, guid, bson.M{"status": status})
+}
+
+func (s *UserStore) SetEmailVerified(ctx context.Context, guid string, verified bool) error {
+	return s.update(ctx, guid, bson.M{"email_verified": verified})
+}
+
+func (s *UserStore) SetPasswordless(ctx context.Context, guid string, passwordless bool) error {
+	return s.update(ctx, guid, bson.M{"passwordless": passwordless})
+}
+
+func (s *UserStore) UpdateLastLoginAt(ctx context.Context, guid string) error {
+	return s.update(ctx, guid, bson.M{"last_login_at": time.Now()})
+}
+
+func (s *UserStore) UpdateRefreshTokenAndLastLoginAt(ctx context.Context, guid string, refreshToken string) error {
+	return s.update(ctx, guid, bson.M{
+		"refresh_token": refreshToken,
+		"last_login_at": time.Now(),
+	})
+}
+
+func (s *UserStore) update(ctx context.Context, guid string, fields bson.M) error {
+	_, err := s.client.GetCollection(s.collection).UpdateOne(ctx, bson.M{"guid": guid}, bson.M{"$set": fields})
+	return err
+}
@@ -0,0 +1,215 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+	"tutorial-auth/internal/config"
+	"tutorial-auth/internal/database"
+	"tutorial-auth/internal/metrics"
+	"tutorial-auth/pkg/logging"
+)
+
+// deadLetterTimeout bounds storing one dead letter, which may happen while shutting down.
+const deadLetterTimeout = 5 * time.Second
+
+// Results of deliveries in metrics.
+const resultDeadLetter = "dead_letter"
+
+// ErrQueueFull is returned by Dispatcher.Notify when the queue holds as many notifications as it can.
+var ErrQueueFull = errors.New("notification queue is full")
+
+// ErrRedacted is returned by Dispatcher.Resend for a dead letter whose link or code was not kept.
+var ErrRedacted = errors.New("notification carried a link or code that was not kept, the user has to ask for a new one")
+
+// decodeDeadLetter decodes the payload of a dead letter. JSON keeps times as RFC 3339 strings, which
+// are parsed back for the templates to format.
+func decodeDeadLetter(letter *database.DeadLetter) (*Notification, error) {
+	var notification Notification
+	if err := json.Unmarshal([]byte(letter.Payload), &notification); err != nil {
+		return nil, fmt.Errorf("dead letter %s: %w", letter.ID, err)
+	}
+	for key, value := range notification.Data {
+		if s, ok := value.(string); ok {
+			if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+				notification.Data[key] = t
+			}
+		}
+	}
+	return &notification, nil
+}
+
+// DeadLetterStore keeps the notifications that could not be delivered, database.DeadLetterStore.
+type DeadLetterStore interface {
+	Add(ctx context.Context, letter *database.DeadLetter) error
+}
+
+// Dispatcher delivers notifications in the background. Notify queues a notification and returns;
+// workers render it and send it through the provider of its channel, retrying with exponential
+// backoff. A notification that fails permanently, runs out of attempts, does not fit in the queue
+// or is still queued at shutdown is kept in the dead-letter store.
+type Dispatcher struct {
+	cfg         *config.NotifyConfig
+	logger      *zap.Logger
+	templates   *Templates
+	providers   map[string]Provider
+	deadLetters DeadLetterStore
+	queue       chan *Notification
+}
+
+// NewDispatcher returns a dispatcher that sends through providers by channel, such as ChannelEmail.
+func NewDispatcher(cfg *config.NotifyConfig, logger *zap.Logger, templates *Templates, providers map[string]Provider,
+	deadLetters DeadLetterStore) *Dispatcher {
+	return &Dispatcher{
+		cfg:         cfg,
+		logger:      logger,
+		templates:   templates,
+		providers:   providers,
+		deadLetters: deadLetters,
+		queue:       make(chan *Notification, max(cfg.QueueSize, 1)),
+	}
+}
+
+// Notify queues the notification for delivery. When the queue is full the notification is
+// dead-lettered right away and ErrQueueFull is returned.
+func (d *Dispatcher) Notify(ctx context.Context, notification *Notification) error {
+	select {
+	case d.queue <- notification:
+		return nil
+	default:
+		metrics.Notifications.WithLabelValues(notification.Channel, resultDeadLetter).Inc()
+		d.deadLetter(ctx, notification, 0, ErrQueueFull)
+		return ErrQueueFull
+	}
+}
+
+// Run delivers queued notifications with the configured number of workers until ctx is done.
+// Deliveries in progress then stop retrying, and they and the notifications still queued are
+// dead-lettered.
+func (d *Dispatcher) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < max(d.cfg.Workers, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				select {
+				case <-ctx.Done():
+					return
+				case notification := <-d.queue:
+					d.deliver(ctx, notification)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for {
+		select {
+		case notification := <-d.queue:
+			metrics.Notifications.WithLabelValues(notification.Channel, resultDeadLetter).Inc()
+			d.deadLetter(ctx, notification, 0, ctx.Err())
+		default:
+			return
+		}
+	}
+}
+
+// Resend renders the notification of a dead letter and sends it once, without retrying it or
+// dead-lettering it again. Notifications with a link or a code cannot be resent.
+func (d *Dispatcher) Resend(ctx context.Context, letter *database.DeadLetter) error {
+	notification, err := decodeDeadLetter(letter)
+	if err != nil {
+		return err
+	}
+	if notification.redacted() {
+		return ErrRedacted
+	}
+	message, err := d.templates.Render(notification)
+	if err != nil {
+		return err
+	}
+	if err = d.send(ctx, message); err != nil {
+		return err
+	}
+	metrics.Notifications.WithLabelValues(notification.Channel, metrics.ResultSuccess).Inc()
+	return nil
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, notification *Notification) {
+	const op = "notify.Dispatcher.deliver"
+
+	message, err := d.templates.Render(notification)
+	attempt := 0
+	if err == nil {
+		interval := d.cfg.Retry.InitialInterval
+	retry:
+		for attempt = 1; ; attempt++ {
+			if err = d.send(ctx, message); err == nil {
+				metrics.Notifications.WithLabelValues(notification.Channel, metrics.ResultSuccess).Inc()
+				return
+			}
+			if IsPermanent(err) || attempt >= d.cfg.Retry.Attempts {
+				break
+			}
+
+			logging.WithContext(ctx, d.logger).Warn("failed to deliver notification, retrying", zap.String("op", op),
+				zap.String("channel", notification.Channel), zap.String("template", notification.Template),
+				zap.String("guid", notification.UserID), zap.Int("attempt", attempt), zap.Duration("retryIn", interval), zap.Error(err))
+			select {
+			case <-ctx.Done():
+				break retry
+			case <-time.After(interval):
+			}
+			interval = min(interval*2, d.cfg.Retry.MaxInterval)
+		}
+	}
+	metrics.Notifications.WithLabelValues(notification.Channel, resultDeadLetter).Inc()
+	d.deadLetter(ctx, notification, attempt, err)
+}
+
+func (d *Dispatcher) send(ctx context.Context, message *Message) error {
+	provider, ok := d.providers[message.Channel]
+	if !ok {
+		return Permanent(fmt.Errorf("no provider for channel %q", message.Channel))
+	}
+	return provider.Send(ctx, message)
+}
+
+// deadLetter stores a notification that is given up on after attempts deliveries because of cause.
+// A dead letter that cannot be stored is logged in full instead.
+func (d *Dispatcher) deadLetter(ctx context.Context, notification *Notification, attempts int, cause error) {
+	const op = "notify.Dispatcher.deadLetter"
+
+	payload, err := json.Marshal(notification.redact())
+	if err != nil {
+		payload = []byte("{}")
+	}
+	letter := &database.DeadLetter{
+		ID:        uuid.NewString(),
+		Channel:   notification.Channel,
+		Template:  notification.Template,
+		UserID:    notification.UserID,
+		Recipient: notification.To,
+		Payload:   string(payload),
+		Error:     fmt.Sprint(cause),
+		Attempts:  attempts,
+		CreatedAt: time.Now(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), deadLetterTimeout)
+	defer cancel()
+	if err = d.deadLetters.Add(ctx, letter); err != nil {
+		logging.WithContext(ctx, d.logger).Error("failed to store undelivered notification", zap.String("op", op),
+			zap.String("payload", letter.Payload), zap.String("cause", letter.Error), zap.Error(err))
+		return
+	}
+	logging.WithContext(ctx, d.logger).Warn("gave up delivering notification", zap.String("op", op), zap.String("id", letter.ID),
+		zap.String("channel", letter.Channel), zap.String("template", letter.Template),
+		zap.String("guid", letter.UserID), zap.Int("attempts", attempts), zap.String("cause", letter.Error))
+}
@@ -0,0 +1,148 @@
+// Package notify tells users about events on their account, by email or SMS. Notifications are
+// rendered from templates in the locale of the user, which tenants may override, and delivered in
+// the background by a Dispatcher that retries failed deliveries and keeps those that keep failing
+// in a dead-letter store.
+package notify
+
+import (
+	"context"
+	"errors"
+	"go.uber.org/zap"
+	"slices"
+	"tutorial-auth/pkg/logging"
+)
+
+// Templates of notifications.
+const (
+	SuspiciousLogin   = "suspicious_login"
+	EmailVerification = "email_verification"
+	MagicLink         = "magic_link"
+	LoginCode         = "login_code"
+)
+
+// Channels notifications are delivered through.
+const (
+	ChannelEmail = "email"
+	ChannelSMS   = "sms"
+)
+
+// Notification is a message to a user, rendered from Template in the locale of the user with Data.
+// To is the address of the user on Channel, an email address or a phone number. Tenant selects the
+// overrides of the templates, if any.
+type Notification struct {
+	Channel  string         `json:"channel"`
+	Template string         `json:"template"`
+	UserID   string         `json:"user_id"`
+	To       string         `json:"to"`
+	Locale   string         `json:"locale,omitempty"`
+	Tenant   string         `json:"tenant,omitempty"`
+	Data     map[string]any `json:"data,omitempty"`
+}
+
+// secretData are the keys of Data that let the recipient log in or verify an address. They are
+// redacted wherever a notification is logged or kept.
+var secretData = []string{"link", "code"}
+
+const redactedValue = "[redacted]"
+
+// redact returns a copy of the notification with its secret data redacted.
+func (n *Notification) redact() *Notification {
+	redacted := *n
+	redacted.Data = make(map[string]any, len(n.Data))
+	for key, value := range n.Data {
+		if slices.Contains(secretData, key) {
+			value = redactedValue
+		}
+		redacted.Data[key] = value
+	}
+	return &redacted
+}
+
+// redacted reports whether secret data of the notification was redacted.
+func (n *Notification) redacted() bool {
+	for _, key := range secretData {
+		if n.Data[key] == redactedValue {
+			return true
+		}
+	}
+	return false
+}
+
+// Notifier delivers notifications.
+type Notifier interface {
+	Notify(ctx context.Context, notification *Notification) error
+}
+
+// Message is a rendered notification. Subject and HTML are only rendered for email.
+type Message struct {
+	Channel string
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Provider sends rendered messages through one channel. Errors wrapped by Permanent are not retried.
+type Provider interface {
+	Send(ctx context.Context, message *Message) error
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as a failure that retrying does not fix, such as a rejected recipient.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err is marked by Permanent.
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
+
+// LogNotifier writes notifications to the log instead of delivering them, for tests and for code
+// that runs without a Dispatcher.
+type LogNotifier struct {
+	logger *zap.Logger
+}
+
+func NewLogNotifier(logger *zap.Logger) *LogNotifier {
+	return &LogNotifier{logger: logger}
+}
+
+func (n *LogNotifier) Notify(ctx context.Context, notification *Notification) error {
+	const op = "notify.LogNotifier.Notify"
+
+	logging.WithContext(ctx, n.logger).Info("notification", zap.String("op", op),
+		zap.String("channel", notification.Channel), zap.String("template", notification.Template),
+		zap.String("guid", notification.UserID), zap.String("to", notification.To), zap.Any("data", notification.redact().Data))
+	return nil
+}
+
+// LogProvider writes messages to the log instead of sending them, for development. The text, which
+// may carry a link or a code, is only logged at the debug level.
+type LogProvider struct {
+	logger *zap.Logger
+}
+
+func NewLogProvider(logger *zap.Logger) *LogProvider {
+	return &LogProvider{logger: logger}
+}
+
+func (p *LogProvider) Send(ctx context.Context, message *Message) error {
+	const op = "notify.LogProvider.Send"
+
+	logger := logging.WithContext(ctx, p.logger).With(zap.String("op", op), zap.String("channel", message.Channel),
+		zap.String("to", message.To), zap.String("subject", message.Subject))
+	logger.Info("message")
+	logger.Debug("message text", zap.String("text", message.Text))
+	return nil
+}
@@ -0,0 +1,193 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+	"tutorial-auth/internal/config"
+	"tutorial-auth/internal/database"
+)
+
+func suspiciousLogin(channel string, locale string, tenant string) *Notification {
+	return &Notification{
+		Channel:  channel,
+		Template: SuspiciousLogin,
+		UserID:   "guid",
+		To:       "user@example.com",
+		Locale:   locale,
+		Tenant:   tenant,
+		Data: map[string]any{
+			"time":   time.Date(2026, 10, 19, 3, 4, 0, 0, time.UTC),
+			"ip":     "203.0.113.5",
+			"device": "Safari 17.0 on <iPhone>",
+			"flags":  []struct{ Rule, Detail string }{{Rule: "new_device"}, {Rule: "unusual_hours", Detail: "03:00 UTC"}},
+		},
+	}
+}
+
+func TestTemplates(t *testing.T) {
+	overrides := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(overrides, "acme", "en"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(overrides, "acme", "en", "suspicious_login.subject.tmpl"),
+		[]byte("ACME: new sign-in from {{.ip}}\n"), 0o644))
+	templates := NewTemplates("en", overrides)
+
+	message, err := templates.Render(suspiciousLogin(ChannelEmail, "", ""))
+	require.NoError(t, err)
+	require.Equal(t, "New sign-in to your account", message.Subject)
+	require.Contains(t, message.Text, "- from a device you have not used before\n- at an hour you do not usually sign in at (03:00 UTC)\n")
+	require.Contains(t, message.Text, "Time: 2026-10-19 03:04 UTC")
+	require.Contains(t, message.Text, "Device: Safari 17.0 on <iPhone>")
+	require.Contains(t, message.HTML, "Safari 17.0 on &lt;iPhone&gt;")
+
+	// the language of a regional locale, and the default locale for an unsupported one
+	message, err = templates.Render(suspiciousLogin(ChannelEmail, "ru_RU", ""))
+	require.NoError(t, err)
+	require.Equal(t, "Новый вход в ваш аккаунт", message.Subject)
+	message, err = templates.Render(suspiciousLogin(ChannelSMS, "fr", ""))
+	require.NoError(t, err)
+	require.Equal(t, "New sign-in to your account from Safari 17.0 on <iPhone>, IP 203.0.113.5. If it was not you, change your password.", message.Text)
+
+	// a tenant overrides single templates in its locales, and the rest are built in
+	message, err = templates.Render(suspiciousLogin(ChannelEmail, "en", "acme"))
+	require.NoError(t, err)
+	require.Equal(t, "ACME: new sign-in from 203.0.113.5", message.Subject)
+	require.Contains(t, message.Text, "Device: Safari 17.0 on <iPhone>")
+	message, err = templates.Render(suspiciousLogin(ChannelEmail, "ru", "acme"))
+	require.NoError(t, err)
+	require.Equal(t, "Новый вход в ваш аккаунт", message.Subject)
+	message, err = templates.Render(suspiciousLogin(ChannelEmail, "en", "../acme"))
+	require.NoError(t, err)
+	require.Equal(t, "New sign-in to your account", message.Subject)
+
+	notification := suspiciousLogin(ChannelEmail, "en", "")
+	notification.Template = "missing"
+	_, err = templates.Render(notification)
+	require.ErrorIs(t, err, ErrNoTemplate)
+	require.True(t, IsPermanent(err))
+}
+
+type memoryDeadLetters struct {
+	mu      sync.Mutex
+	letters []database.DeadLetter
+}
+
+func (s *memoryDeadLetters) Add(_ context.Context, letter *database.DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.letters = append(s.letters, *letter)
+	return nil
+}
+
+func (s *memoryDeadLetters) all() []database.DeadLetter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]database.DeadLetter(nil), s.letters...)
+}
+
+// flakyProvider fails the first failures sends to each recipient with err.
+type flakyProvider struct {
+	mu       sync.Mutex
+	failures int
+	err      error
+	attempts map[string]int
+	sent     chan *Message
+}
+
+func (p *flakyProvider) Send(_ context.Context, message *Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.attempts[message.To]++
+	if p.attempts[message.To] <= p.failures {
+		return p.err
+	}
+	p.sent <- message
+	return nil
+}
+
+func TestDispatcher(t *testing.T) {
+	cfg := &config.NotifyConfig{QueueSize: 2, Workers: 1}
+	cfg.Retry.Attempts = 3
+	cfg.Retry.InitialInterval = time.Millisecond
+	cfg.Retry.MaxInterval = 2 * time.Millisecond
+	deadLetters := &memoryDeadLetters{}
+	sms := &flakyProvider{failures: 2, err: errors.New("gateway timeout"), attempts: map[string]int{}, sent: make(chan *Message, 10)}
+	email := &flakyProvider{failures: 1, err: Permanent(errors.New("550 no such user")), attempts: map[string]int{}, sent: make(chan *Message, 10)}
+	d := NewDispatcher(cfg, zap.NewNop(), NewTemplates("en", ""), map[string]Provider{ChannelSMS: sms, ChannelEmail: email}, deadLetters)
+
+	// the queue holds two notifications until the dispatcher runs
+	ctx := context.Background()
+	require.NoError(t, d.Notify(ctx, suspiciousLogin(ChannelSMS, "en", "")))
+	require.NoError(t, d.Notify(ctx, suspiciousLogin(ChannelEmail, "en", "")))
+	require.ErrorIs(t, d.Notify(ctx, suspiciousLogin(ChannelSMS, "ru", "")), ErrQueueFull)
+	require.Len(t, deadLetters.all(), 1)
+
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		d.Run(runCtx)
+	}()
+
+	// transient failures are retried, permanent ones are dead-lettered at once
+	message := <-sms.sent
+	require.Equal(t, "user@example.com", message.To)
+	require.Eventually(t, func() bool { return len(deadLetters.all()) == 2 }, time.Second, time.Millisecond)
+	letters := deadLetters.all()
+	require.Equal(t, ErrQueueFull.Error(), letters[0].Error)
+	require.Equal(t, 0, letters[0].Attempts)
+	require.Equal(t, ChannelEmail, letters[1].Channel)
+	require.Equal(t, SuspiciousLogin, letters[1].Template)
+	require.Equal(t, "guid", letters[1].UserID)
+	require.Equal(t, 1, letters[1].Attempts)
+	require.Contains(t, letters[1].Error, "550 no such user")
+	require.Contains(t, letters[1].Payload, `"ip":"203.0.113.5"`)
+
+	// a notification that keeps failing runs out of attempts
+	sms.mu.Lock()
+	sms.failures = 10
+	sms.mu.Unlock()
+	require.NoError(t, d.Notify(ctx, suspiciousLogin(ChannelSMS, "en", "")))
+	require.Eventually(t, func() bool { return len(deadLetters.all()) == 3 }, time.Second, time.Millisecond)
+	require.Equal(t, 3, deadLetters.all()[2].Attempts)
+	require.Equal(t, "gateway timeout", deadLetters.all()[2].Error)
+
+	cancel()
+	<-done
+	// what is still queued when the dispatcher stops is dead-lettered
+	require.NoError(t, d.Notify(ctx, suspiciousLogin(ChannelSMS, "en", "")))
+	d.Run(runCtx)
+	require.Len(t, deadLetters.all(), 4)
+	require.Equal(t, context.Canceled.Error(), deadLetters.all()[3].Error)
+
+	// a dead letter is sent again as it was, times included
+	require.NoError(t, d.Resend(ctx, &letters[1]))
+	message = <-email.sent
+	require.Equal(t, "user@example.com", message.To)
+	require.Contains(t, message.Text, "Time: 2026-10-19 03:04 UTC")
+	require.Error(t, d.Resend(ctx, &database.DeadLetter{ID: "broken", Payload: "{"}))
+}
+
+func TestDispatcherRedactsSecrets(t *testing.T) {
+	deadLetters := &memoryDeadLetters{}
+	d := NewDispatcher(&config.NotifyConfig{QueueSize: 1}, zap.NewNop(), NewTemplates("en", ""), map[string]Provider{}, deadLetters)
+	ctx := context.Background()
+
+	link := &Notification{Channel: ChannelEmail, Template: MagicLink, UserID: "guid", To: "user@example.com",
+		Data: map[string]any{"name": "Ivan", "link": "https://example.com/magic?token=secret", "expires_at": time.Now()}}
+	require.NoError(t, d.Notify(ctx, suspiciousLogin(ChannelEmail, "en", "")))
+	require.ErrorIs(t, d.Notify(ctx, link), ErrQueueFull)
+
+	// links and codes are not kept, so the letter cannot be sent again
+	letter := deadLetters.all()[0]
+	require.NotContains(t, letter.Payload, "secret")
+	require.Contains(t, letter.Payload, `"name":"Ivan"`)
+	require.ErrorIs(t, d.Resend(ctx, &letter), ErrRedacted)
+	require.Equal(t, "https://example.com/magic?token=secret", link.Data["link"])
+}
@@ -0,0 +1,180 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+	"tutorial-auth/internal/config"
+)
+
+// ErrTLSNotOffered is returned by SMTPMailer when TLS is required and the server does not offer STARTTLS.
+var ErrTLSNotOffered = errors.New("smtp server does not offer STARTTLS")
+
+// SMTPMailer sends email through an SMTP server, such as a relay or a local MailHog.
+type SMTPMailer struct {
+	cfg *config.EmailConfig
+}
+
+func NewSMTPMailer(cfg *config.EmailConfig) *SMTPMailer {
+	return &SMTPMailer{cfg: cfg}
+}
+
+// Send delivers message in one conversation with the server, bounded by the timeout and by ctx.
+// Replies in the 5xx range are permanent errors.
+func (m *SMTPMailer) Send(ctx context.Context, message *Message) error {
+	body, err := m.compose(message)
+	if err != nil {
+		return Permanent(err)
+	}
+
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(m.cfg.Host, strconv.Itoa(m.cfg.Port)))
+	if err != nil {
+		return err
+	}
+	var deadline time.Time
+	if m.cfg.Timeout > 0 {
+		deadline = time.Now().Add(m.cfg.Timeout)
+	}
+	if d, ok := ctx.Deadline(); ok && (deadline.IsZero() || d.Before(deadline)) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, m.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+	return smtpError(m.converse(client, message, body))
+}
+
+func (m *SMTPMailer) converse(client *smtp.Client, message *Message, body []byte) error {
+	offered, _ := client.Extension("STARTTLS")
+	if offered && (m.cfg.StartTLS || m.cfg.RequireTLS) {
+		if err := client.StartTLS(&tls.Config{ServerName: m.cfg.Host}); err != nil {
+			return err
+		}
+	} else if m.cfg.RequireTLS {
+		return Permanent(ErrTLSNotOffered)
+	}
+	if m.cfg.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)); err != nil {
+			return err
+		}
+	}
+	from, err := mail.ParseAddress(m.cfg.From)
+	if err != nil {
+		return Permanent(err)
+	}
+	if err = client.Mail(from.Address); err != nil {
+		return err
+	}
+	if err = client.Rcpt(message.To); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(body); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// smtpError marks the replies of the server that retrying does not change as permanent.
+func smtpError(err error) error {
+	var reply *textproto.Error
+	if errors.As(err, &reply) && reply.Code >= 500 {
+		return Permanent(err)
+	}
+	return err
+}
+
+// compose renders message as a MIME email, multipart/alternative when it has an HTML body.
+func (m *SMTPMailer) compose(message *Message) ([]byte, error) {
+	from, err := mail.ParseAddress(m.cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender %q: %w", m.cfg.From, err)
+	}
+	to, err := mail.ParseAddress(message.To)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient %q: %w", message.To, err)
+	}
+
+	var buf bytes.Buffer
+	for _, field := range [][2]string{
+		{"From", from.String()},
+		{"To", to.String()},
+		{"Subject", mime.QEncoding.Encode("utf-8", message.Subject)},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"Message-ID", "<" + uuid.NewString() + "@" + domainOf(from.Address) + ">"},
+		{"MIME-Version", "1.0"},
+	} {
+		buf.WriteString(field[0] + ": " + field[1] + "\r\n")
+	}
+
+	if message.HTML == "" {
+		buf.WriteString("Content-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n")
+		if err = writeQuotedPrintable(&buf, message.Text); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	parts := multipart.NewWriter(&buf)
+	buf.WriteString("Content-Type: multipart/alternative; boundary=" + parts.Boundary() + "\r\n\r\n")
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", message.Text},
+		{"text/html; charset=utf-8", message.HTML},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err = writeQuotedPrintable(w, part.content); err != nil {
+			return nil, err
+		}
+	}
+	if err = parts.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeQuotedPrintable(w io.Writer, content string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(content)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+func domainOf(address string) string {
+	if i := strings.LastIndex(address, "@"); i >= 0 {
+		return address[i+1:]
+	}
+	return "localhost"
+}
@@ -0,0 +1,128 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"github.com/stretchr/testify/require"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+	"tutorial-auth/internal/config"
+)
+
+// smtpServer accepts one message per connection, as MailHog does, and rejects recipients at reject.example.
+type smtpServer struct {
+	listener net.Listener
+	messages chan string
+}
+
+func newSMTPServer(t *testing.T) *smtpServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	s := &smtpServer{listener: listener, messages: make(chan string, 10)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(command, "EHLO"):
+			reply("250-localhost")
+			reply("250 8BITMIME")
+		case strings.HasPrefix(command, "RCPT") && strings.Contains(command, "@REJECT.EXAMPLE"):
+			reply("550 no such user")
+		case command == "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				line, err = r.ReadString('\n')
+				if err != nil || line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			s.messages <- data.String()
+			reply("250 queued")
+		case command == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func TestSMTPMailer(t *testing.T) {
+	server := newSMTPServer(t)
+	port := server.listener.Addr().(*net.TCPAddr).Port
+	mailer := NewSMTPMailer(&config.EmailConfig{Host: "127.0.0.1", Port: port, From: "Auth <no-reply@example.com>", StartTLS: true, Timeout: 5 * time.Second})
+	ctx := context.Background()
+
+	require.NoError(t, mailer.Send(ctx, &Message{Channel: ChannelEmail, To: "user@example.com", Subject: "Новый вход", Text: "Hello,\nworld", HTML: "<p>Hello</p>"}))
+	msg, err := mail.ReadMessage(strings.NewReader(<-server.messages))
+	require.NoError(t, err)
+	require.Equal(t, `"Auth" <no-reply@example.com>`, msg.Header.Get("From"))
+	require.Equal(t, "<user@example.com>", msg.Header.Get("To"))
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	require.NoError(t, err)
+	require.Equal(t, "Новый вход", subject)
+	require.True(t, strings.HasSuffix(msg.Header.Get("Message-ID"), "@example.com>"))
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	require.Equal(t, "multipart/alternative", mediaType)
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	for _, expected := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", "Hello,\r\nworld"},
+		{"text/html; charset=utf-8", "<p>Hello</p>"},
+	} {
+		part, err := parts.NextPart()
+		require.NoError(t, err)
+		require.Equal(t, expected.contentType, part.Header.Get("Content-Type"))
+		content, err := io.ReadAll(part)
+		require.NoError(t, err)
+		require.Equal(t, expected.content, string(content))
+	}
+
+	err = mailer.Send(ctx, &Message{Channel: ChannelEmail, To: "user@reject.example", Subject: "Hi", Text: "Hi"})
+	require.ErrorContains(t, err, "no such user")
+	require.True(t, IsPermanent(err))
+	err = mailer.Send(ctx, &Message{Channel: ChannelEmail, To: "not an address", Subject: "Hi", Text: "Hi"})
+	require.True(t, IsPermanent(err))
+
+	// a server that offers no TLS gets nothing when TLS is required
+	required := NewSMTPMailer(&config.EmailConfig{Host: "127.0.0.1", Port: port, From: "no-reply@example.com", RequireTLS: true, Timeout: 5 * time.Second})
+	err = required.Send(ctx, &Message{Channel: ChannelEmail, To: "user@example.com", Subject: "Hi", Text: "Hi"})
+	require.ErrorIs(t, err, ErrTLSNotOffered)
+	require.True(t, IsPermanent(err))
+	require.Empty(t, server.messages)
+
+	server.listener.Close()
+	err = mailer.Send(ctx, &Message{Channel: ChannelEmail, To: "user@example.com", Subject: "Hi", Text: "Hi"})
+	require.Error(t, err)
+	require.False(t, IsPermanent(err))
+}
@@ -0,0 +1,130 @@
+package notify
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+)
+
+//go:embed templates
+var embedded embed.FS
+
+// ErrNoTemplate is returned for notifications whose template does not exist for their channel.
+var ErrNoTemplate = errors.New("no such template")
+
+// Templates renders notifications from the templates in templates/<locale>/:
+//
+//	<name>.subject.tmpl   subject of the email, text/template
+//	<name>.text.tmpl      plain text body of the email, text/template
+//	<name>.html.tmpl      HTML body of the email, html/template, optional
+//	<name>.sms.tmpl       text of the SMS, text/template
+//
+// A tenant overrides any of them with a file of the same name in <overrides>/<tenant>/<locale>/,
+// which is read at every rendering, so that changes apply without a restart. A template is looked
+// up in the locale of the user, then in its language ("ru" for "ru-RU"), then in the default locale.
+type Templates struct {
+	defaultLocale string
+	overrides     string
+}
+
+// NewTemplates returns templates that fall back to defaultLocale. overrides is the directory of the
+// tenant overrides; without it tenants use the built-in templates.
+func NewTemplates(defaultLocale string, overrides string) *Templates {
+	return &Templates{defaultLocale: normalizeLocale(defaultLocale), overrides: overrides}
+}
+
+// Render renders the notification into the message of its channel. Missing templates and
+// templates that fail to render are permanent errors.
+func (t *Templates) Render(notification *Notification) (*Message, error) {
+	message := &Message{Channel: notification.Channel, To: notification.To}
+	var err error
+	switch notification.Channel {
+	case ChannelEmail:
+		if message.Subject, err = t.renderText(notification, "subject"); err != nil {
+			return nil, Permanent(err)
+		}
+		message.Subject = strings.Join(strings.Fields(message.Subject), " ")
+		if message.Text, err = t.renderText(notification, "text"); err != nil {
+			return nil, Permanent(err)
+		}
+		if message.HTML, err = t.renderHTML(notification); err != nil && !errors.Is(err, ErrNoTemplate) {
+			return nil, Permanent(err)
+		}
+	case ChannelSMS:
+		if message.Text, err = t.renderText(notification, "sms"); err != nil {
+			return nil, Permanent(err)
+		}
+		message.Text = strings.TrimSpace(message.Text)
+	default:
+		return nil, Permanent(fmt.Errorf("unknown channel %q", notification.Channel))
+	}
+	return message, nil
+}
+
+func (t *Templates) renderText(notification *Notification, part string) (string, error) {
+	name := notification.Template + "." + part + ".tmpl"
+	source, err := t.lookup(notification, name)
+	if err != nil {
+		return "", err
+	}
+	tmpl, err := texttemplate.New(name).Option("missingkey=zero").Parse(string(source))
+	if err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	err = tmpl.Execute(&out, notification.Data)
+	return out.String(), err
+}
+
+func (t *Templates) renderHTML(notification *Notification) (string, error) {
+	name := notification.Template + ".html.tmpl"
+	source, err := t.lookup(notification, name)
+	if err != nil {
+		return "", err
+	}
+	tmpl, err := htmltemplate.New(name).Option("missingkey=zero").Parse(string(source))
+	if err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	err = tmpl.Execute(&out, notification.Data)
+	return out.String(), err
+}
+
+// lookup returns the source of the template file name for the locale and the tenant of notification.
+func (t *Templates) lookup(notification *Notification, name string) ([]byte, error) {
+	locale := normalizeLocale(notification.Locale)
+	language, _, _ := strings.Cut(locale, "-")
+	// tenants name directories, so one that is not a plain name has no overrides
+	tenant := notification.Tenant
+	overrides := t.overrides != "" && tenant != "" && filepath.IsLocal(tenant) && !strings.ContainsAny(tenant, `/\`)
+
+	for _, candidate := range []string{locale, language, t.defaultLocale} {
+		if candidate == "" {
+			continue
+		}
+		if overrides {
+			source, err := os.ReadFile(filepath.Join(t.overrides, tenant, candidate, name))
+			if err == nil || !errors.Is(err, fs.ErrNotExist) {
+				return source, err
+			}
+		}
+		source, err := embedded.ReadFile(path.Join("templates", candidate, name))
+		if err == nil {
+			return source, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNoTemplate, name)
+}
+
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+}
@@ -0,0 +1,141 @@
+package risk
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+)
+
+const earthRadius = 6371 // km
+
+// Location is where an IP address is, as far as the GeoIP database knows.
+type Location struct {
+	Country   string
+	City      string
+	Latitude  float64
+	Longitude float64
+}
+
+func (l Location) String() string {
+	if l.City == "" {
+		return l.Country
+	}
+	return l.City + ", " + l.Country
+}
+
+// DistanceTo returns the great-circle distance to other in kilometres.
+func (l Location) DistanceTo(other Location) float64 {
+	lat1, lat2 := l.Latitude*math.Pi/180, other.Latitude*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (other.Longitude - l.Longitude) * math.Pi / 180
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+type ipRange struct {
+	start    netip.Addr
+	end      netip.Addr
+	location Location
+}
+
+// GeoIP locates IP addresses with a local database kept in memory.
+type GeoIP struct {
+	ranges []ipRange
+}
+
+// LoadGeoIP reads a database in the CSV format of the DB-IP "IP to City Lite" download:
+//
+//	ip_start,ip_end,continent,country,stateprov,city,latitude,longitude
+//
+// IPv4 and IPv6 ranges may be mixed.
+func LoadGeoIP(path string) (*GeoIP, error) {
+	const op = "risk.LoadGeoIP"
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer file.Close()
+
+	geo, err := ReadGeoIP(bufio.NewReader(file))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s: %w", op, path, err)
+	}
+	return geo, nil
+}
+
+// ReadGeoIP reads a database in the format of LoadGeoIP.
+func ReadGeoIP(r io.Reader) (*GeoIP, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 8
+	reader.ReuseRecord = true
+
+	geo := &GeoIP{}
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		parsed, err := parseRange(record)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		geo.ranges = append(geo.ranges, parsed)
+	}
+	sort.Slice(geo.ranges, func(i, j int) bool { return geo.ranges[i].start.Less(geo.ranges[j].start) })
+	return geo, nil
+}
+
+func parseRange(record []string) (ipRange, error) {
+	start, err := netip.ParseAddr(record[0])
+	if err != nil {
+		return ipRange{}, err
+	}
+	end, err := netip.ParseAddr(record[1])
+	if err != nil {
+		return ipRange{}, err
+	}
+	if start.Is4() != end.Is4() || end.Less(start) {
+		return ipRange{}, fmt.Errorf("invalid range %s-%s", start, end)
+	}
+	latitude, err := strconv.ParseFloat(record[6], 64)
+	if err != nil {
+		return ipRange{}, err
+	}
+	longitude, err := strconv.ParseFloat(record[7], 64)
+	if err != nil {
+		return ipRange{}, err
+	}
+	return ipRange{start: start, end: end, location: Location{
+		Country:   record[3],
+		City:      record[5],
+		Latitude:  latitude,
+		Longitude: longitude,
+	}}, nil
+}
+
+// Locate returns the location of ip. Addresses outside of the database, private ones among them,
+// have none; neither has any address when geo is nil.
+func (geo *GeoIP) Locate(ip string) (Location, bool) {
+	addr, err := netip.ParseAddr(ip)
+	if geo == nil || err != nil {
+		return Location{}, false
+	}
+	addr = addr.Unmap()
+	// the last range starting at or before addr is the only one that can hold it
+	i := sort.Search(len(geo.ranges), func(i int) bool { return addr.Less(geo.ranges[i].start) }) - 1
+	if i < 0 || geo.ranges[i].end.Less(addr) || geo.ranges[i].end.Is4() != addr.Is4() {
+		return Location{}, false
+	}
+	return geo.ranges[i].location, true
+}
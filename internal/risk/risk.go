@@ -0,0 +1,78 @@
+// Package risk flags suspicious logins. An Engine runs a set of rules over the signals of a
+// successful login and the logins of the same user before it; every rule that matches adds a Flag.
+package risk
+
+import (
+	"time"
+)
+
+// Rule names, the Rule of the flags they raise.
+const (
+	NewDevice        = "new_device"
+	NewNetwork       = "new_network"
+	ImpossibleTravel = "impossible_travel"
+	UnusualHours     = "unusual_hours"
+)
+
+// Login is a successful login to assess. History holds the earlier successful logins of the user,
+// newest first; KnownDevice tells whether the device has logged in to the account before.
+type Login struct {
+	UserID      string
+	IP          string
+	Time        time.Time
+	KnownDevice bool
+	History     []Attempt
+}
+
+// Attempt is an earlier login of the user.
+type Attempt struct {
+	IP   string
+	Time time.Time
+}
+
+// Flag is raised by a rule for a suspicious login. Detail explains it to the account holder.
+type Flag struct {
+	Rule   string `json:"rule"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Rule inspects a login and returns a flag when it is suspicious, or nil.
+type Rule interface {
+	Check(login *Login) *Flag
+}
+
+// RuleFunc adapts a function to a Rule.
+type RuleFunc func(login *Login) *Flag
+
+func (f RuleFunc) Check(login *Login) *Flag {
+	return f(login)
+}
+
+// Engine runs rules in order.
+type Engine struct {
+	rules []Rule
+}
+
+func NewEngine(rules ...Rule) *Engine {
+	return &Engine{rules: rules}
+}
+
+// Evaluate returns the flags that the rules raise for login, none when it looks as usual.
+func (e *Engine) Evaluate(login *Login) []Flag {
+	var flags []Flag
+	for _, rule := range e.rules {
+		if flag := rule.Check(login); flag != nil {
+			flags = append(flags, *flag)
+		}
+	}
+	return flags
+}
+
+// Rules returns the names of flags, in order.
+func Rules(flags []Flag) []string {
+	names := make([]string, len(flags))
+	for i, flag := range flags {
+		names[i] = flag.Rule
+	}
+	return names
+}
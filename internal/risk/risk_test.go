@@ -0,0 +1,75 @@
+package risk
+
+import (
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+const geoCSV = `2001:db8::,2001:db8:ffff:ffff:ffff:ffff:ffff:ffff,EU,DE,Berlin,Berlin,52.52,13.405
+5.255.255.0,5.255.255.255,EU,RU,Moscow,Moscow,55.7558,37.6173
+81.2.69.0,81.2.69.255,EU,GB,England,London,51.5074,-0.1278
+81.2.70.0,81.2.70.255,EU,GB,England,Croydon,51.3762,-0.0982
+`
+
+func TestGeoIP(t *testing.T) {
+	geo, err := ReadGeoIP(strings.NewReader(geoCSV))
+	require.NoError(t, err)
+
+	location, ok := geo.Locate("81.2.69.142")
+	require.True(t, ok)
+	require.Equal(t, "London, GB", location.String())
+	location, ok = geo.Locate("::ffff:5.255.255.5")
+	require.True(t, ok)
+	require.Equal(t, "Moscow, RU", location.String())
+	location, ok = geo.Locate("2001:db8::1")
+	require.True(t, ok)
+	require.Equal(t, "Berlin, DE", location.String())
+
+	for _, ip := range []string{"81.2.71.1", "10.0.0.1", "2001:db9::1", "not an ip", ""} {
+		_, ok = geo.Locate(ip)
+		require.False(t, ok, ip)
+	}
+	var missing *GeoIP
+	_, ok = missing.Locate("81.2.69.142")
+	require.False(t, ok)
+
+	london, _ := geo.Locate("81.2.69.1")
+	moscow, _ := geo.Locate("5.255.255.1")
+	require.InDelta(t, 2500, london.DistanceTo(moscow), 10)
+
+	_, err = ReadGeoIP(strings.NewReader("81.2.69.255,81.2.69.0,EU,GB,England,London,51.5,-0.1\n"))
+	require.ErrorContains(t, err, "line 1")
+}
+
+func TestRules(t *testing.T) {
+	geo, err := ReadGeoIP(strings.NewReader(geoCSV))
+	require.NoError(t, err)
+	engine := NewEngine(NewDeviceRule(), NewNetworkRule(), ImpossibleTravelRule(geo, 1000), UnusualHoursRule(3))
+	at := func(hour int, minute int) time.Time { return time.Date(2026, 10, 19, hour, minute, 0, 0, time.UTC) }
+
+	// the first login has nothing to be compared with
+	require.Empty(t, engine.Evaluate(&Login{IP: "81.2.69.1", Time: at(3, 0)}))
+
+	history := []Attempt{{IP: "81.2.69.12", Time: at(11, 0)}, {IP: "81.2.69.11", Time: at(10, 0)}, {IP: "81.2.69.10", Time: at(9, 0)}}
+	require.Empty(t, engine.Evaluate(&Login{IP: "81.2.69.1", Time: at(12, 0), KnownDevice: true, History: history}))
+
+	// London to Croydon is too close to compare, but is another network
+	flags := engine.Evaluate(&Login{IP: "81.2.70.1", Time: at(11, 5), KnownDevice: true, History: history})
+	require.Equal(t, []string{NewNetwork}, Rules(flags))
+	require.Equal(t, "81.2.70.0/24", flags[0].Detail)
+
+	flags = engine.Evaluate(&Login{IP: "5.255.255.1", Time: at(12, 0), History: history})
+	require.Equal(t, []string{NewDevice, NewNetwork, ImpossibleTravel}, Rules(flags))
+	require.Equal(t, "London, GB to Moscow, RU, 2501 km in 1h0m0s", flags[2].Detail)
+	// a known device on a known network, but at 03:00, far from the usual hours
+	flags = engine.Evaluate(&Login{IP: "81.2.69.1", Time: at(3, 0).Add(24 * time.Hour), KnownDevice: true, History: history})
+	require.Equal(t, []string{UnusualHours}, Rules(flags))
+	require.Equal(t, "03:00 UTC", flags[0].Detail)
+
+	// hours are compared around midnight too, and only with enough history
+	late := []Attempt{{IP: "81.2.69.1", Time: at(23, 30)}, {IP: "81.2.69.1", Time: at(22, 0)}, {IP: "81.2.69.1", Time: at(23, 0)}}
+	require.Empty(t, engine.Evaluate(&Login{IP: "81.2.69.1", Time: at(0, 15), KnownDevice: true, History: late}))
+	require.Empty(t, engine.Evaluate(&Login{IP: "81.2.69.1", Time: at(5, 0), KnownDevice: true, History: late[:2]}))
+}
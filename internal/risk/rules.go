@@ -0,0 +1,104 @@
+package risk
+
+import (
+	"fmt"
+	"net/netip"
+	"time"
+)
+
+// minTravelDistance is the distance in kilometres below which locations are not compared, as
+// GeoIP databases often place addresses of one city tens of kilometres apart.
+const minTravelDistance = 100
+
+// NewDeviceRule flags logins from a device the account has not logged in from before. The first
+// login of an account is not flagged: there is nothing yet to compare it with.
+func NewDeviceRule() Rule {
+	return RuleFunc(func(login *Login) *Flag {
+		if login.KnownDevice || len(login.History) == 0 {
+			return nil
+		}
+		return &Flag{Rule: NewDevice}
+	})
+}
+
+// NewNetworkRule flags logins from an IP range, a /24 for IPv4 and a /48 for IPv6, that none of
+// the earlier logins came from.
+func NewNetworkRule() Rule {
+	return RuleFunc(func(login *Login) *Flag {
+		prefix, ok := networkOf(login.IP)
+		if !ok || len(login.History) == 0 {
+			return nil
+		}
+		for _, attempt := range login.History {
+			if addr, err := netip.ParseAddr(attempt.IP); err == nil && prefix.Contains(addr.Unmap()) {
+				return nil
+			}
+		}
+		return &Flag{Rule: NewNetwork, Detail: prefix.String()}
+	})
+}
+
+func networkOf(ip string) (netip.Prefix, bool) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return netip.Prefix{}, false
+	}
+	addr = addr.Unmap()
+	bits := 48
+	if addr.Is4() {
+		bits = 24
+	}
+	prefix, err := addr.Prefix(bits)
+	return prefix, err == nil
+}
+
+// ImpossibleTravelRule flags logins from a place that could not have been reached from the place
+// of the previous login, in the time between them, at maxSpeed kilometres per hour.
+func ImpossibleTravelRule(geo *GeoIP, maxSpeed float64) Rule {
+	return RuleFunc(func(login *Login) *Flag {
+		if len(login.History) == 0 {
+			return nil
+		}
+		previous := login.History[0]
+		from, ok := geo.Locate(previous.IP)
+		if !ok {
+			return nil
+		}
+		to, ok := geo.Locate(login.IP)
+		if !ok {
+			return nil
+		}
+		distance := from.DistanceTo(to)
+		if distance < minTravelDistance {
+			return nil
+		}
+		elapsed := login.Time.Sub(previous.Time)
+		if elapsed > 0 && distance/elapsed.Hours() <= maxSpeed {
+			return nil
+		}
+		return &Flag{
+			Rule:   ImpossibleTravel,
+			Detail: fmt.Sprintf("%s to %s, %.0f km in %s", from, to, distance, elapsed.Round(time.Minute)),
+		}
+	})
+}
+
+// UnusualHoursRule flags logins at an hour of the day, within an hour either way, at which none
+// of the earlier logins happened. Users with fewer than minHistory earlier logins have no usual
+// hours yet and are not flagged. Hours are compared in UTC, the pattern of the user being the same
+// in any time zone.
+func UnusualHoursRule(minHistory int) Rule {
+	return RuleFunc(func(login *Login) *Flag {
+		if minHistory <= 0 || len(login.History) < minHistory {
+			return nil
+		}
+		hour := login.Time.UTC().Hour()
+		for _, attempt := range login.History {
+			diff := (attempt.Time.UTC().Hour() - hour + 24) % 24
+			if diff <= 1 || diff == 23 {
+				return nil
+			}
+		}
+		return &Flag{Rule: UnusualHours, Detail: fmt.Sprintf("%02d:00 UTC", hour)}
+	})
+}
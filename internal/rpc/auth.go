@@ -0,0 +1,205 @@
+package rpc
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"slices"
+	"time"
+	"tutorial-auth/internal/config"
+	"tutorial-auth/internal/mongodb/models"
+	"tutorial-auth/internal/services"
+	"tutorial-auth/internal/transport"
+	authv1 "tutorial-auth/pkg/api/auth/v1"
+	"tutorial-auth/pkg/authToken"
+)
+
+// deviceTokenKey is the metadata key of the device token, which Login returns in a header for the
+// client to send with its next login, as browsers do with the device cookie.
+const deviceTokenKey = "x-device-token"
+
+// authServer implements the AuthService of the gRPC API on top of the same services, request
+// validation and timeouts as the HTTP controllers.
+type authServer struct {
+	authv1.UnimplementedAuthServiceServer
+	cfg         *config.AppConfig
+	authService *services.AuthService
+	userService *services.UserService
+}
+
+func (s *authServer) Login(ctx context.Context, req *authv1.LoginRequest) (*authv1.TokenResponse, error) {
+	dto := transport.AuthRequest{Login: req.GetLogin(), Password: req.GetPassword()}
+	if err := transport.ValidateRequest(ctx, transport.PasswordPolicy{}, &dto); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := withTimeout(ctx, s.cfg.Timeouts.Login)
+	defer cancel()
+	if token := metadata.ValueFromIncomingContext(ctx, deviceTokenKey); s.cfg.LoginAlerts.Enabled && len(token) > 0 {
+		ctx = services.WithDeviceToken(ctx, token[0])
+	}
+
+	result := s.authService.Login(ctx, dto.Login, dto.Password)
+	if result.DeviceToken != "" {
+		// a header the client cannot receive is no reason to fail the login
+		_ = grpc.SetHeader(ctx, metadata.Pairs(deviceTokenKey, result.DeviceToken))
+	}
+	return tokenResponse(result)
+}
+
+func (s *authServer) Refresh(ctx context.Context, req *authv1.RefreshRequest) (*authv1.TokenResponse, error) {
+	dto := transport.RefreshAuthRequest{ID: req.GetId(), RefreshToken: req.GetRefreshToken()}
+	if err := transport.ValidateRequest(ctx, transport.PasswordPolicy{}, &dto); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := withTimeout(ctx, s.cfg.Timeouts.Refresh)
+	defer cancel()
+	return tokenResponse(s.authService.Refresh(ctx, dto.ID, dto.RefreshToken))
+}
+
+func (s *authServer) Register(ctx context.Context, req *authv1.RegisterRequest) (*authv1.RegisterResponse, error) {
+	dto := transport.RegisterRequest{
+		Login:           req.GetLogin(),
+		Password:        req.GetPassword(),
+		ConfirmPassword: req.GetConfirmPassword(),
+		Name:            req.GetName(),
+		LastName:        req.GetLastName(),
+	}
+	policy := transport.PasswordPolicy{MinLength: s.cfg.PasswordMinLength}
+	if err := transport.ValidateRequest(ctx, policy, &dto); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := withTimeout(ctx, s.cfg.Timeouts.Register)
+	defer cancel()
+	user, err := s.userService.Register(ctx, &services.NewUser{
+		Login:    dto.Login,
+		Password: dto.Password,
+		Name:     dto.Name,
+		LastName: dto.LastName,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &authv1.RegisterResponse{User: toProtoUser(user)}, nil
+}
+
+func (s *authServer) Logout(ctx context.Context, req *authv1.LogoutRequest) (*authv1.LogoutResponse, error) {
+	dto := transport.RefreshAuthRequest{ID: req.GetId(), RefreshToken: req.GetRefreshToken()}
+	if err := transport.ValidateRequest(ctx, transport.PasswordPolicy{}, &dto); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := withTimeout(ctx, s.cfg.Timeouts.Refresh)
+	defer cancel()
+	if err := s.authService.Logout(ctx, dto.ID, dto.RefreshToken); err != nil {
+		return nil, err
+	}
+	return &authv1.LogoutResponse{}, nil
+}
+
+func (s *authServer) VerifyToken(ctx context.Context, req *authv1.VerifyTokenRequest) (*authv1.VerifyTokenResponse, error) {
+	if req.GetToken() == "" {
+		return nil, services.ValidationFailed("request validation failed",
+			services.InvalidParam{Name: "token", Code: "required", Reason: "is required"})
+	}
+
+	// the check is local, so the timeout only turns away calls whose deadline has already passed
+	ctx, cancel := withTimeout(ctx, s.cfg.Timeouts.Query)
+	defer cancel()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	user, expiresAt, err := s.authService.VerifyToken(req.GetToken())
+	if err != nil {
+		return nil, err
+	}
+	return &authv1.VerifyTokenResponse{
+		UserId:    user.ID,
+		Login:     user.Login,
+		Name:      user.Name,
+		ExpiresAt: timestamppb.New(expiresAt),
+	}, nil
+}
+
+func (s *authServer) GetUser(ctx context.Context, req *authv1.GetUserRequest) (*authv1.GetUserResponse, error) {
+	if req.GetId() == "" {
+		return nil, services.ValidationFailed("request validation failed",
+			services.InvalidParam{Name: "id", Code: "required", Reason: "is required"})
+	}
+
+	claims, err := s.authService.Authorize(bearerToken(ctx), nil)
+	if err != nil {
+		return nil, err
+	}
+	if claims.ID != req.GetId() && !slices.Contains(claims.Roles, services.RoleAdmin) {
+		return nil, services.AccessDenied
+	}
+
+	ctx, cancel := withTimeout(ctx, s.cfg.Timeouts.Query)
+	defer cancel()
+	user, err := s.userService.GetUser(ctx, req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	return &authv1.GetUserResponse{User: toProtoUser(user)}, nil
+}
+
+// bearerToken returns the access token of the authorization metadata of the call.
+func bearerToken(ctx context.Context) string {
+	values := metadata.ValueFromIncomingContext(ctx, "authorization")
+	if len(values) == 0 {
+		return ""
+	}
+	return authToken.FromAuthorizationHeader(values[0])
+}
+
+func tokenResponse(result *services.AuthResult) (*authv1.TokenResponse, error) {
+	if result.Err != nil {
+		return nil, result.Err
+	}
+	return &authv1.TokenResponse{
+		Token:        result.Token,
+		RefreshToken: result.RefreshToken,
+		User:         toProtoUser(result.User),
+	}, nil
+}
+
+func toProtoUser(user *models.User) *authv1.User {
+	if user == nil {
+		return nil
+	}
+	result := &authv1.User{
+		Guid:        user.GUID,
+		Login:       user.Login,
+		Name:        user.Name,
+		LastName:    user.LastName,
+		Status:      user.Status,
+		CreatedAt:   timestamp(user.CreatedAt),
+		LastLoginAt: timestamp(user.LastLoginAt),
+	}
+	if len(user.Attributes) > 0 {
+		// attributes that have no JSON equivalent are left out rather than failing the call
+		if attributes, err := structpb.NewStruct(user.Attributes); err == nil {
+			result.Attributes = attributes
+		}
+	}
+	return result
+}
+
+func timestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
@@ -0,0 +1,97 @@
+package rpc
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"tutorial-auth/internal/i18n"
+	"tutorial-auth/internal/services"
+	"tutorial-auth/pkg/logging"
+)
+
+const errorDomain = "go-auth"
+
+var kindCodes = map[services.ErrorKind]codes.Code{
+	services.KindInternal:           codes.Internal,
+	services.KindValidation:         codes.InvalidArgument,
+	services.KindInvalidCredentials: codes.Unauthenticated,
+	services.KindConflict:           codes.AlreadyExists,
+	services.KindLocked:             codes.FailedPrecondition,
+	services.KindExpired:            codes.Unauthenticated,
+	services.KindTimeout:            codes.DeadlineExceeded,
+	services.KindNotFound:           codes.NotFound,
+	services.KindForbidden:          codes.PermissionDenied,
+	services.KindRateLimited:        codes.ResourceExhausted,
+}
+
+// errorInterceptor turns the errors of handlers into statuses, the way server.ErrorHandler turns
+// them into problem responses: the message is translated into the locale of the accept-language
+// metadata, and the stable error code travels as the reason of an ErrorInfo detail.
+func errorInterceptor(logger *zap.Logger, translator *i18n.Translator) grpc.UnaryServerInterceptor {
+	const op = "rpc.errorInterceptor"
+
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		resp, err := handler(ctx, req)
+		if err == nil {
+			return resp, nil
+		}
+		if _, ok := status.FromError(err); ok {
+			return nil, err
+		}
+
+		serviceErr := services.AsError(err)
+		if serviceErr.Kind == services.KindInternal || serviceErr.Kind == services.KindTimeout {
+			logging.WithContext(ctx, logger).Error("call failed", zap.String("op", op), zap.String("method", info.FullMethod),
+				zap.String("code", serviceErr.Code), zap.Error(err))
+		} else {
+			logging.WithContext(ctx, logger).Info("call rejected", zap.String("op", op), zap.String("method", info.FullMethod),
+				zap.String("code", serviceErr.Code))
+		}
+		return nil, toStatus(serviceErr, translator, requestLocale(ctx, translator)).Err()
+	}
+}
+
+func toStatus(serviceErr *services.Error, translator *i18n.Translator, locale string) *status.Status {
+	code, ok := kindCodes[serviceErr.Kind]
+	if !ok {
+		code = codes.Unknown
+	}
+	st := status.New(code, translator.Text(locale, "error."+serviceErr.Code, nil, serviceErr.Message))
+
+	withDetails, err := st.WithDetails(&errdetails.ErrorInfo{Reason: serviceErr.Code, Domain: errorDomain})
+	if err != nil {
+		return st
+	}
+	if len(serviceErr.InvalidParams) == 0 {
+		return withDetails
+	}
+
+	badRequest := &errdetails.BadRequest{}
+	for _, param := range serviceErr.InvalidParams {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       param.Name,
+			Description: translator.Text(locale, "validation."+param.Code, param.Params, param.Reason),
+		})
+	}
+	if withViolations, err := withDetails.WithDetails(badRequest); err == nil {
+		return withViolations
+	}
+	return withDetails
+}
+
+func requestLocale(ctx context.Context, translator *i18n.Translator) string {
+	if translator == nil {
+		return ""
+	}
+	var acceptLanguage string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("accept-language"); len(values) > 0 {
+			acceptLanguage = values[0]
+		}
+	}
+	return translator.Match(acceptLanguage)
+}
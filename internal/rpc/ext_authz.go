@@ -0,0 +1,117 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"go.uber.org/zap"
+	rpcstatus "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"net/http"
+	"strings"
+	"tutorial-auth/internal/config"
+	"tutorial-auth/internal/i18n"
+	"tutorial-auth/internal/services"
+	"tutorial-auth/internal/transport"
+	"tutorial-auth/pkg/authToken"
+	"tutorial-auth/pkg/logging"
+)
+
+// rolesExtension is the context extension of Envoy routes that lists the required roles,
+// comma separated, like the roles query parameter of the HTTP forward-auth endpoint.
+const rolesExtension = "roles"
+
+// extAuthzServer implements the Envoy ext_authz check service with the semantics of the
+// HTTP forward-auth endpoint: identity headers when allowed, 401 or 403 when denied.
+type extAuthzServer struct {
+	authv3.UnimplementedAuthorizationServer
+	logger      *zap.Logger
+	cfg         *config.AppConfig
+	translator  *i18n.Translator
+	authService *services.AuthService
+}
+
+func (s *extAuthzServer) Check(ctx context.Context, req *authv3.CheckRequest) (*authv3.CheckResponse, error) {
+	const op = "rpc.extAuthzServer.Check"
+
+	httpReq := req.GetAttributes().GetRequest().GetHttp()
+	headers := httpReq.GetHeaders()
+	token := authToken.FromAuthorizationHeader(headers["authorization"])
+	if token == "" {
+		token = cookie(headers["cookie"], s.cfg.ForwardAuth.Cookie)
+	}
+	required := transport.SplitRoles(req.GetAttributes().GetContextExtensions()[rolesExtension])
+
+	user, err := s.authService.Authorize(token, required)
+	if err != nil {
+		serviceErr := services.AsError(err)
+		logging.WithContext(ctx, s.logger).Info("request denied", zap.String("op", op), zap.String("path", httpReq.GetPath()),
+			zap.String("code", serviceErr.Code))
+		return s.denied(serviceErr, headers["accept-language"]), nil
+	}
+
+	return &authv3.CheckResponse{
+		Status: &rpcstatus.Status{Code: int32(codes.OK)},
+		HttpResponse: &authv3.CheckResponse_OkResponse{OkResponse: &authv3.OkHttpResponse{
+			Headers: []*corev3.HeaderValueOption{
+				overwrite(transport.HeaderUserID, user.ID),
+				overwrite(transport.HeaderUserLogin, user.Login),
+				overwrite(transport.HeaderUserRoles, strings.Join(user.Roles, ",")),
+			},
+		}},
+	}, nil
+}
+
+func (s *extAuthzServer) denied(serviceErr *services.Error, acceptLanguage string) *authv3.CheckResponse {
+	httpStatus, grpcCode := http.StatusUnauthorized, codes.Unauthenticated
+	if errors.Is(serviceErr, services.AccessDenied) {
+		httpStatus, grpcCode = http.StatusForbidden, codes.PermissionDenied
+	}
+
+	var locale string
+	if s.translator != nil {
+		locale = s.translator.Match(acceptLanguage)
+	}
+	body, _ := json.Marshal(transport.Problem{
+		Type:   "urn:go-auth:problem:" + serviceErr.Code,
+		Title:  http.StatusText(httpStatus),
+		Status: httpStatus,
+		Detail: s.translator.Text(locale, "error."+serviceErr.Code, nil, serviceErr.Message),
+		Code:   serviceErr.Code,
+	})
+
+	headers := []*corev3.HeaderValueOption{overwrite("Content-Type", transport.ProblemContentType)}
+	if httpStatus == http.StatusUnauthorized {
+		headers = append(headers, overwrite("WWW-Authenticate", `Bearer realm="go-auth"`))
+	}
+	return &authv3.CheckResponse{
+		Status: &rpcstatus.Status{Code: int32(grpcCode), Message: serviceErr.Code},
+		HttpResponse: &authv3.CheckResponse_DeniedResponse{DeniedResponse: &authv3.DeniedHttpResponse{
+			Status:  &typev3.HttpStatus{Code: typev3.StatusCode(httpStatus)},
+			Headers: headers,
+			Body:    string(body),
+		}},
+	}
+}
+
+func overwrite(name string, value string) *corev3.HeaderValueOption {
+	return &corev3.HeaderValueOption{
+		Header:       &corev3.HeaderValue{Key: name, Value: value},
+		AppendAction: corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
+	}
+}
+
+// cookie returns the value of the named cookie of a Cookie header.
+func cookie(header string, name string) string {
+	if header == "" || name == "" {
+		return ""
+	}
+	c, err := (&http.Request{Header: http.Header{"Cookie": {header}}}).Cookie(name)
+	if err != nil {
+		return ""
+	}
+	return c.Value
+}
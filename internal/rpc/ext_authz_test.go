@@ -0,0 +1,54 @@
+package rpc
+
+import (
+	"context"
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"testing"
+	"tutorial-auth/internal/config"
+	"tutorial-auth/internal/services"
+	"tutorial-auth/pkg/authToken"
+)
+
+func checkRequest(headers map[string]string, roles string) *authv3.CheckRequest {
+	return &authv3.CheckRequest{Attributes: &authv3.AttributeContext{
+		Request: &authv3.AttributeContext_Request{
+			Http: &authv3.AttributeContext_HttpRequest{Method: "GET", Path: "/app", Headers: headers},
+		},
+		ContextExtensions: map[string]string{rolesExtension: roles},
+	}}
+}
+
+func TestExtAuthzCheck(t *testing.T) {
+	cfg := &config.AppConfig{TokenSecret: "secret", ForwardAuth: config.ForwardAuthConfig{Cookie: "access_token"}}
+	s := &extAuthzServer{logger: zap.NewNop(), cfg: cfg, authService: services.NewAuthService(cfg, zap.NewNop(), nil)}
+	token, err := authToken.NewToken("secret", 5, &authToken.UserTokenInfo{ID: "guid", Login: "user", Roles: []string{"admin"}})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	resp, err := s.Check(ctx, checkRequest(map[string]string{"authorization": "Bearer " + token}, "admin"))
+	require.NoError(t, err)
+	require.Equal(t, int32(codes.OK), resp.GetStatus().GetCode())
+	headers := map[string]string{}
+	for _, header := range resp.GetOkResponse().GetHeaders() {
+		headers[header.GetHeader().GetKey()] = header.GetHeader().GetValue()
+	}
+	require.Equal(t, map[string]string{"X-User-Id": "guid", "X-User-Login": "user", "X-User-Roles": "admin"}, headers)
+
+	resp, err = s.Check(ctx, checkRequest(map[string]string{"cookie": "theme=dark; access_token=" + token}, ""))
+	require.NoError(t, err)
+	require.Equal(t, int32(codes.OK), resp.GetStatus().GetCode())
+
+	resp, err = s.Check(ctx, checkRequest(map[string]string{"authorization": "Bearer " + token}, "admin,billing"))
+	require.NoError(t, err)
+	require.Equal(t, int32(codes.PermissionDenied), resp.GetStatus().GetCode())
+	require.EqualValues(t, 403, resp.GetDeniedResponse().GetStatus().GetCode())
+	require.Contains(t, resp.GetDeniedResponse().GetBody(), `"code":"access_denied"`)
+
+	resp, err = s.Check(ctx, checkRequest(map[string]string{}, ""))
+	require.NoError(t, err)
+	require.Equal(t, int32(codes.Unauthenticated), resp.GetStatus().GetCode())
+	require.EqualValues(t, 401, resp.GetDeniedResponse().GetStatus().GetCode())
+}
@@ -0,0 +1,118 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"net"
+	"tutorial-auth/internal/audit"
+	"tutorial-auth/internal/config"
+	"tutorial-auth/internal/i18n"
+	"tutorial-auth/internal/services"
+	authv1 "tutorial-auth/pkg/api/auth/v1"
+)
+
+// Server serves the gRPC API and the Envoy ext_authz check service on its own port, next to the HTTP API.
+type Server struct {
+	log    *zap.Logger
+	cfg    *config.GrpcServerConfig
+	server *grpc.Server
+	health *health.Server
+}
+
+func NewServer(logger *zap.Logger, cfg *config.GrpcServerConfig, appCfg *config.AppConfig, translator *i18n.Translator,
+	authService *services.AuthService, userService *services.UserService) *Server {
+	s := &Server{
+		log:    logger,
+		cfg:    cfg,
+		health: health.NewServer(),
+	}
+	s.server = grpc.NewServer(
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(clientInterceptor(), errorInterceptor(logger, translator)),
+	)
+
+	authv1.RegisterAuthServiceServer(s.server, &authServer{
+		cfg:         appCfg,
+		authService: authService,
+		userService: userService,
+	})
+	authv3.RegisterAuthorizationServer(s.server, &extAuthzServer{
+		logger:      logger,
+		cfg:         appCfg,
+		translator:  translator,
+		authService: authService,
+	})
+	healthpb.RegisterHealthServer(s.server, s.health)
+	if cfg.Reflection {
+		reflection.Register(s.server)
+	}
+	s.health.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	s.health.SetServingStatus(authv1.AuthService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	return s
+}
+
+func (s *Server) Run() error {
+	const op = "rpc.Server.Run"
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", s.cfg.Port))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	s.log.Info("serving grpc", zap.String("op", op), zap.Int("port", s.cfg.Port))
+	return s.Serve(listener)
+}
+
+func (s *Server) Serve(listener net.Listener) error {
+	return s.server.Serve(listener)
+}
+
+// Drain reports the server as not serving to health checks, while it still serves calls.
+func (s *Server) Drain() {
+	s.health.Shutdown()
+}
+
+// Shutdown reports the server as not serving to health checks and waits for running calls to
+// finish. Calls still running when ctx is done are cancelled.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.Drain()
+
+	stopped := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		s.server.Stop()
+		<-stopped
+		return ctx.Err()
+	}
+}
+
+// clientInterceptor attributes the audit events of a call to the address and the user agent of the client.
+func clientInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		var client audit.Client
+		if p, ok := peer.FromContext(ctx); ok {
+			client.IP = p.Addr.String()
+			if host, _, err := net.SplitHostPort(client.IP); err == nil {
+				client.IP = host
+			}
+		}
+		if userAgent := metadata.ValueFromIncomingContext(ctx, "user-agent"); len(userAgent) > 0 {
+			client.UserAgent = userAgent[0]
+		}
+		return handler(audit.WithClient(ctx, client), req)
+	}
+}
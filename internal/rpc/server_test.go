@@ -0,0 +1,141 @@
+package rpc
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+	"tutorial-auth/internal/config"
+	"tutorial-auth/internal/database"
+	"tutorial-auth/internal/i18n"
+	"tutorial-auth/internal/services"
+	authv1 "tutorial-auth/pkg/api/auth/v1"
+)
+
+func newTestClient(t *testing.T) (authv1.AuthServiceClient, *grpc.ClientConn) {
+	dbCfg := &config.DBConnectionConfig{Type: "sqlite", Database: filepath.Join(t.TempDir(), "auth.db"), BusyTimeout: 5 * time.Second}
+	db, err := database.NewConnectionDB(dbCfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	require.NoError(t, database.ApplyMigration(zap.NewNop(), dbCfg.Type, db))
+
+	appCfg := &config.AppConfig{
+		PasswordLifeTime:                  1,
+		PasswordMinLength:                 8,
+		TokenExpirationTimeMinutes:        5,
+		RefreshTokenExpirationTimeMinutes: 60,
+		TokenSecret:                       "secret",
+	}
+	translator, err := i18n.NewTranslator("en")
+	require.NoError(t, err)
+	userService := services.NewUserService(appCfg, zap.NewNop(), database.NewUserStore(db), db)
+	server := NewServer(zap.NewNop(), &config.GrpcServerConfig{Reflection: true}, appCfg, translator,
+		services.NewAuthService(appCfg, zap.NewNop(), userService), userService)
+
+	listener := bufconn.Listen(1 << 20)
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Shutdown(context.Background()) })
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return authv1.NewAuthServiceClient(conn), conn
+}
+
+func TestAuthServiceFlow(t *testing.T) {
+	ctx := context.Background()
+	client, _ := newTestClient(t)
+
+	registered, err := client.Register(ctx, &authv1.RegisterRequest{
+		Login: "user@example.com", Password: "password", ConfirmPassword: "password", Name: "User",
+	})
+	require.NoError(t, err)
+	guid := registered.GetUser().GetGuid()
+	require.NotEmpty(t, guid)
+
+	_, err = client.Register(ctx, &authv1.RegisterRequest{
+		Login: "user@example.com", Password: "password", ConfirmPassword: "password",
+	})
+	require.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	tokens, err := client.Login(ctx, &authv1.LoginRequest{Login: "user@example.com", Password: "password"})
+	require.NoError(t, err)
+	require.Equal(t, guid, tokens.GetUser().GetGuid())
+
+	verified, err := client.VerifyToken(ctx, &authv1.VerifyTokenRequest{Token: tokens.GetToken()})
+	require.NoError(t, err)
+	require.Equal(t, guid, verified.GetUserId())
+	require.Equal(t, "user@example.com", verified.GetLogin())
+	require.True(t, verified.GetExpiresAt().AsTime().After(time.Now()))
+
+	_, err = client.VerifyToken(ctx, &authv1.VerifyTokenRequest{Token: tokens.GetRefreshToken()})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// users read only themselves, with their access token
+	_, err = client.GetUser(ctx, &authv1.GetUserRequest{Id: guid})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+	authorized := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+tokens.GetToken())
+	user, err := client.GetUser(authorized, &authv1.GetUserRequest{Id: guid})
+	require.NoError(t, err)
+	require.Equal(t, "User", user.GetUser().GetName())
+
+	_, err = client.GetUser(authorized, &authv1.GetUserRequest{Id: "missing"})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	refreshed, err := client.Refresh(ctx, &authv1.RefreshRequest{Id: guid, RefreshToken: tokens.GetRefreshToken()})
+	require.NoError(t, err)
+
+	// the refresh token is spent once it has been exchanged
+	_, err = client.Refresh(ctx, &authv1.RefreshRequest{Id: guid, RefreshToken: tokens.GetRefreshToken()})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = client.Logout(ctx, &authv1.LogoutRequest{Id: guid, RefreshToken: refreshed.GetRefreshToken()})
+	require.NoError(t, err)
+	_, err = client.Refresh(ctx, &authv1.RefreshRequest{Id: guid, RefreshToken: refreshed.GetRefreshToken()})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestAuthServiceErrors(t *testing.T) {
+	client, conn := newTestClient(t)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "accept-language", "ru")
+
+	_, err := client.Register(ctx, &authv1.RegisterRequest{Login: "user@example.com", Password: "short"})
+	st := status.Convert(err)
+	require.Equal(t, codes.InvalidArgument, st.Code())
+	require.Equal(t, "запрос не прошёл проверку", st.Message())
+
+	var reason string
+	var fields []string
+	for _, detail := range st.Details() {
+		switch detail := detail.(type) {
+		case *errdetails.ErrorInfo:
+			reason = detail.GetReason()
+		case *errdetails.BadRequest:
+			for _, violation := range detail.GetFieldViolations() {
+				fields = append(fields, violation.GetField())
+			}
+		}
+	}
+	require.Equal(t, "validation_failed", reason)
+	require.Equal(t, []string{"password", "confirm_password"}, fields)
+
+	_, err = client.Login(ctx, &authv1.LoginRequest{Login: "nobody@example.com", Password: "password"})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	health, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: "auth.v1.AuthService"})
+	require.NoError(t, err)
+	require.Equal(t, healthpb.HealthCheckResponse_SERVING, health.GetStatus())
+}
@@ -1,76 +1,18 @@
 package controllers
 
 import (
-	"fmt"
-	"github.com/go-playground/validator/v10"
+	"context"
 	"github.com/gofiber/fiber/v2"
 	"go.uber.org/zap"
+	"time"
 	"tutorial-auth/internal/config"
+	"tutorial-auth/internal/i18n"
 	"tutorial-auth/internal/mongodb/models"
 	"tutorial-auth/internal/services"
+	"tutorial-auth/internal/transport"
+	"tutorial-auth/pkg/logging"
 )
 
-var validate = validator.New()
-
-var LoginRequiredError = fmt.Errorf("login required")
-var PasswordRequiredError = fmt.Errorf("password required")
-
-type ValidationError struct {
-	Error       bool
-	FailedField string
-	Tag         string
-	Value       interface{}
-}
-
-type RefreshAuthRequest struct {
-	ID           string `json:"id" validate:"required"`
-	RefreshToken string `json:"refresh_token" validate:"required"`
-}
-
-func (ra *RefreshAuthRequest) Validate() []*ValidationError {
-	var validationErrors []*ValidationError
-
-	errs := validate.Struct(ra)
-	if errs != nil {
-		for _, err := range errs.(validator.ValidationErrors) {
-			// In this case data object is actually holding the User struct
-			var elem ValidationError
-
-			elem.FailedField = err.Field() // Export struct field name
-			elem.Tag = err.Tag()           // Export struct tag
-			elem.Value = err.Value()       // Export field value
-			elem.Error = true
-
-			validationErrors = append(validationErrors, &elem)
-		}
-	}
-
-	return validationErrors
-}
-
-type AuthRequest struct {
-	Login    string `json:"login"`
-	Password string `json:"password"`
-}
-
-func (r *AuthRequest) Validate() (bool, error) {
-	if len(r.Login) == 0 {
-		return false, LoginRequiredError
-	}
-
-	if len(r.Password) == 0 {
-		return false, PasswordRequiredError
-	}
-
-	return true, nil
-}
-
-type AuthResponseError struct {
-	OK     bool               `json:"ok"`
-	Cause  string             `json:"cause"`
-	Errors []*ValidationError `json:"errors,omitempty"`
-}
-
 type AuthResponseOK struct {
 	OK           bool         `json:"ok"`
 	Token        string       `json:"authToken,omitempty"`
@@ -101,10 +43,29 @@ func (c *AuthController) GetHandlers() []ControllerHandler {
 		&Handler{
 			Method: "POST", Path: "/login",
 			Handler: c.authHandler(),
+			Doc: &Doc{
+				Summary:  "Log in with login and password",
+				Request:  transport.AuthRequest{},
+				Response: AuthResponseOK{},
+				Errors: []*services.Error{
+					services.MalformedRequest, services.ValidationFailed(""), services.LoginOrPasswordInvalid,
+					services.PasswordExpired, services.RegistrationNotCompleted, services.EmailNotVerified,
+					services.OperationTimedOut,
+				},
+			},
 		},
 		&Handler{
 			Method: "POST", Path: "/refresh",
 			Handler: c.refreshHandler(),
+			Doc: &Doc{
+				Summary:  "Exchange a refresh token for new tokens",
+				Request:  transport.RefreshAuthRequest{},
+				Response: AuthResponseOK{},
+				Errors: []*services.Error{
+					services.MalformedRequest, services.ValidationFailed(""), services.RefreshTokenInvalid,
+					services.RefreshTokenExpired, services.RegistrationNotCompleted, services.OperationTimedOut,
+				},
+			},
 		},
 	}
 }
@@ -114,34 +75,59 @@ func (c *AuthController) authHandler() func(fc *fiber.Ctx) error {
 
 	return func(fc *fiber.Ctx) error {
 		fc.Accepts("application/json")
-		var req AuthRequest
+		var req transport.AuthRequest
 		if err := fc.BodyParser(&req); err != nil {
-			return err
+			return services.MalformedRequest
 		}
-		if valid, err := (*AuthRequest).Validate(&req); !valid {
-			c.logger.Error("Validation error", zap.String("op", op), zap.String("error", err.Error()))
-			return fc.JSON(AuthResponseError{
-				OK:    false,
-				Cause: err.Error(),
-			})
+		if err := transport.ValidateRequest(fc.UserContext(), transport.PasswordPolicy{}, &req); err != nil {
+			logging.WithContext(fc.UserContext(), c.logger).Info("Validation error", zap.String("op", op), zap.Error(err))
+			return err
 		}
 
-		authResult := c.authService.Login(req.Login, req.Password)
-		if authResult.Err != nil {
-			c.logger.Error("Login error", zap.String("op", op), zap.String("error", authResult.Err.Error()))
-			return fc.JSON(AuthResponseError{
-				OK:    false,
-				Cause: authResult.Err.Error(),
-			})
-		}
+		ctx, cancel := loginContext(fc, c.cfg)
+		defer cancel()
 
-		return fc.JSON(AuthResponseOK{
-			OK:           true,
-			Token:        authResult.Token,
-			RefreshToken: authResult.RefreshToken,
-			User:         authResult.User,
+		return respondLogin(fc, c.cfg, c.authService.Login(ctx, req.Login, req.Password))
+	}
+}
+
+// loginContext bounds a login by the login timeout and carries the device token of the client for
+// the login monitor to recognise the device.
+func loginContext(fc *fiber.Ctx, cfg *config.AppConfig) (context.Context, context.CancelFunc) {
+	ctx, cancel := operationContext(fc, cfg.Timeouts.Login)
+	if alerts := cfg.LoginAlerts; alerts.Enabled {
+		ctx = services.WithDeviceToken(ctx, fc.Cookies(alerts.DeviceCookie))
+	}
+	return ctx, cancel
+}
+
+// respondLogin answers a login with its tokens, and sets the device cookie when the login monitor
+// issued a new device token.
+func respondLogin(fc *fiber.Ctx, cfg *config.AppConfig, authResult *services.AuthResult) error {
+	if authResult.User != nil {
+		i18n.SetUserLocale(fc, authResult.User.Attributes)
+	}
+	if authResult.Err != nil {
+		return authResult.Err
+	}
+	if authResult.DeviceToken != "" {
+		fc.Cookie(&fiber.Cookie{
+			Name:     cfg.LoginAlerts.DeviceCookie,
+			Value:    authResult.DeviceToken,
+			Path:     "/",
+			Expires:  time.Now().Add(cfg.LoginAlerts.DeviceLifetime),
+			Secure:   fc.Protocol() == "https",
+			HTTPOnly: true,
+			SameSite: fiber.CookieSameSiteLaxMode,
 		})
 	}
+
+	return fc.JSON(AuthResponseOK{
+		OK:           true,
+		Token:        authResult.Token,
+		RefreshToken: authResult.RefreshToken,
+		User:         authResult.User,
+	})
 }
 
 func (c *AuthController) refreshHandler() func(fc *fiber.Ctx) error {
@@ -149,30 +135,24 @@ func (c *AuthController) refreshHandler() func(fc *fiber.Ctx) error {
 
 	return func(fc *fiber.Ctx) error {
 		fc.Accepts("application/json")
-		var req RefreshAuthRequest
+		var req transport.RefreshAuthRequest
 		if err := fc.BodyParser(&req); err != nil {
+			return services.MalformedRequest
+		}
+		if err := transport.ValidateRequest(fc.UserContext(), transport.PasswordPolicy{}, &req); err != nil {
+			logging.WithContext(fc.UserContext(), c.logger).Info("Validation error", zap.String("op", op), zap.Error(err))
 			return err
 		}
 
-		validationErrors := (*RefreshAuthRequest).Validate(&req)
-		if len(validationErrors) > 0 {
-			for _, validationError := range validationErrors {
-				c.logger.Error("Validation error", zap.String("op", op), zap.String("error", validationError.FailedField))
-			}
-			return fc.JSON(AuthResponseError{
-				OK:     false,
-				Cause:  "validation errors",
-				Errors: validationErrors,
-			})
-		}
+		ctx, cancel := operationContext(fc, c.cfg.Timeouts.Refresh)
+		defer cancel()
 
-		authResult := c.authService.Refresh(req.ID, req.RefreshToken)
+		authResult := c.authService.Refresh(ctx, req.ID, req.RefreshToken)
+		if authResult.User != nil {
+			i18n.SetUserLocale(fc, authResult.User.Attributes)
+		}
 		if authResult.Err != nil {
-			c.logger.Error("Refresh error", zap.String("op", op), zap.String("error", authResult.Err.Error()))
-			return fc.JSON(AuthResponseError{
-				OK:    false,
-				Cause: authResult.Err.Error(),
-			})
+			return authResult.Err
 		}
 
 		return fc.JSON(AuthResponseOK{
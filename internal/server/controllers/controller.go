@@ -1,6 +1,11 @@
 package controllers
 
-import "github.com/gofiber/fiber/v2"
+import (
+	"context"
+	"github.com/gofiber/fiber/v2"
+	"time"
+	"tutorial-auth/internal/services"
+)
 
 type GroupController interface {
 	GetGroup() string
@@ -11,12 +16,26 @@ type ControllerHandler interface {
 	GetMethod() string
 	GetHandler() func(c *fiber.Ctx) error
 	GetPath() string
+	GetDoc() *Doc
+}
+
+// Doc describes a route for the OpenAPI document. Request and Response hold values of the
+// body types, whose schemas are derived by reflection; a nil Request means the route takes no body.
+// Query holds a value of the struct the query string is parsed into, whose fields become query
+// parameters. Errors lists the service errors the route can answer with.
+type Doc struct {
+	Summary  string
+	Request  any
+	Query    any
+	Response any
+	Errors   []*services.Error
 }
 
 type Handler struct {
 	Method  string
 	Path    string
 	Handler func(c *fiber.Ctx) error
+	Doc     *Doc
 }
 
 func (h *Handler) GetPath() string {
@@ -30,3 +49,17 @@ func (h *Handler) GetHandler() func(c *fiber.Ctx) error {
 func (h *Handler) GetMethod() string {
 	return h.Method
 }
+
+func (h *Handler) GetDoc() *Doc {
+	return h.Doc
+}
+
+// operationContext returns the context an operation of the request runs in, bounded by timeout.
+// It derives from the user context of fiber, so it also ends when the server stops waiting for the
+// request at shutdown; a client that disconnects is not noticed, and its operation runs until timeout.
+func operationContext(fc *fiber.Ctx, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(fc.UserContext())
+	}
+	return context.WithTimeout(fc.UserContext(), timeout)
+}
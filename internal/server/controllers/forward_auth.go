@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+	"strings"
+	"tutorial-auth/internal/config"
+	"tutorial-auth/internal/services"
+	"tutorial-auth/internal/transport"
+	"tutorial-auth/pkg/authToken"
+)
+
+// ForwardAuthController lets reverse proxies delegate authentication: nginx auth_request and
+// Traefik ForwardAuth send a copy of each request, and only forward it when the answer is 200.
+type ForwardAuthController struct {
+	cfg         *config.AppConfig
+	logger      *zap.Logger
+	authService *services.AuthService
+}
+
+func NewForwardAuthController(cfg *config.AppConfig, logger *zap.Logger, authService *services.AuthService) *ForwardAuthController {
+	return &ForwardAuthController{
+		cfg:         cfg,
+		logger:      logger,
+		authService: authService,
+	}
+}
+
+func (c *ForwardAuthController) GetGroup() string {
+	return "/auth"
+}
+
+func (c *ForwardAuthController) GetHandlers() []ControllerHandler {
+	return []ControllerHandler{
+		&Handler{
+			Method: "ALL", Path: "/forward",
+			Handler: c.forwardHandler(),
+			Doc: &Doc{
+				Summary: "Check the access token of a proxied request. Roles required by the " +
+					"roles query parameter (comma separated) must all be granted to the user",
+				Errors: []*services.Error{services.AccessTokenInvalid, services.AccessDenied},
+			},
+		},
+	}
+}
+
+func (c *ForwardAuthController) forwardHandler() func(fc *fiber.Ctx) error {
+	return func(fc *fiber.Ctx) error {
+		token := authToken.FromAuthorizationHeader(fc.Get(fiber.HeaderAuthorization))
+		if token == "" {
+			token = fc.Cookies(c.cfg.ForwardAuth.Cookie)
+		}
+
+		user, err := c.authService.Authorize(token, transport.SplitRoles(fc.Query("roles")))
+		if err != nil {
+			if errors.Is(err, services.AccessTokenInvalid) {
+				fc.Set(fiber.HeaderWWWAuthenticate, `Bearer realm="go-auth"`)
+			}
+			return err
+		}
+
+		fc.Set(transport.HeaderUserID, user.ID)
+		fc.Set(transport.HeaderUserLogin, user.Login)
+		fc.Set(transport.HeaderUserRoles, strings.Join(user.Roles, ","))
+		return fc.SendStatus(fiber.StatusOK)
+	}
+}
@@ -0,0 +1,64 @@
+package controllers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+	"tutorial-auth/internal/health"
+)
+
+// HealthController serves the probes of orchestrators: /healthz answers as long as the process
+// serves HTTP, /readyz only while the dependencies are usable and the server is not draining.
+type HealthController struct {
+	logger  *zap.Logger
+	checker *health.Checker
+}
+
+func NewHealthController(logger *zap.Logger, checker *health.Checker) *HealthController {
+	return &HealthController{
+		logger:  logger,
+		checker: checker,
+	}
+}
+
+func (c *HealthController) GetGroup() string {
+	return ""
+}
+
+func (c *HealthController) GetHandlers() []ControllerHandler {
+	return []ControllerHandler{
+		&Handler{
+			Method: "GET", Path: "/healthz",
+			Handler: c.livenessHandler(),
+			Doc: &Doc{
+				Summary:  "Liveness probe",
+				Response: health.Report{},
+			},
+		},
+		&Handler{
+			Method: "GET", Path: "/readyz",
+			Handler: c.readinessHandler(),
+			Doc: &Doc{
+				Summary: "Readiness probe with a breakdown per dependency. Answers 503 with the same " +
+					"body when a dependency fails or the server is draining",
+				Response: health.Report{},
+			},
+		},
+	}
+}
+
+func (c *HealthController) livenessHandler() func(fc *fiber.Ctx) error {
+	return func(fc *fiber.Ctx) error {
+		return fc.JSON(health.Report{Status: health.StatusOK})
+	}
+}
+
+func (c *HealthController) readinessHandler() func(fc *fiber.Ctx) error {
+	return func(fc *fiber.Ctx) error {
+		report := c.checker.Ready(fc.UserContext())
+		if report.Status != health.StatusOK {
+			fc.Status(fiber.StatusServiceUnavailable)
+		}
+		fc.Set(fiber.HeaderCacheControl, "no-store")
+		return fc.JSON(report)
+	}
+}
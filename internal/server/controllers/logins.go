@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+	"time"
+	"tutorial-auth/internal/config"
+	"tutorial-auth/internal/services"
+	"tutorial-auth/pkg/authToken"
+)
+
+// LoginHistoryRequest selects a page of the login history of the user.
+type LoginHistoryRequest struct {
+	Cursor string `query:"cursor" json:"cursor"` // next_cursor of the previous page
+	Limit  int    `query:"limit" json:"limit"`   // 20 by default, at most 100
+}
+
+// AdminLoginHistoryRequest selects a page of the login attempts of any user.
+type AdminLoginHistoryRequest struct {
+	User   string `query:"user" json:"user"`     // user ID
+	From   string `query:"from" json:"from"`     // RFC 3339 time, inclusive
+	To     string `query:"to" json:"to"`         // RFC 3339 time, exclusive
+	Result string `query:"result" json:"result"` // "success", "failure" or the code of a failure
+	Cursor string `query:"cursor" json:"cursor"`
+	Limit  int    `query:"limit" json:"limit"`
+}
+
+// LoginHistoryController lists login attempts: users see their own, admins those of anyone.
+type LoginHistoryController struct {
+	cfg         *config.AppConfig
+	logger      *zap.Logger
+	authService *services.AuthService
+	userService *services.UserService
+}
+
+func NewLoginHistoryController(cfg *config.AppConfig, logger *zap.Logger, authService *services.AuthService,
+	userService *services.UserService) *LoginHistoryController {
+	return &LoginHistoryController{
+		cfg:         cfg,
+		logger:      logger,
+		authService: authService,
+		userService: userService,
+	}
+}
+
+func (c *LoginHistoryController) GetGroup() string {
+	return ""
+}
+
+func (c *LoginHistoryController) GetHandlers() []ControllerHandler {
+	return []ControllerHandler{
+		&Handler{
+			Method: "GET", Path: "/users/me/logins",
+			Handler: c.ownHistoryHandler(),
+			Doc: &Doc{
+				Summary:  "List the login attempts of the user of the bearer token, newest first",
+				Query:    LoginHistoryRequest{},
+				Response: services.LoginHistoryPage{},
+				Errors: []*services.Error{
+					services.MalformedRequest, services.ValidationFailed(""), services.AccessTokenInvalid,
+					services.OperationTimedOut,
+				},
+			},
+		},
+		&Handler{
+			Method: "GET", Path: "/admin/logins",
+			Handler: c.adminHistoryHandler(),
+			Doc: &Doc{
+				Summary:  "List the login attempts of all users, newest first. Requires the admin role",
+				Query:    AdminLoginHistoryRequest{},
+				Response: services.LoginHistoryPage{},
+				Errors: []*services.Error{
+					services.MalformedRequest, services.ValidationFailed(""), services.AccessTokenInvalid,
+					services.AccessDenied, services.OperationTimedOut,
+				},
+			},
+		},
+	}
+}
+
+func (c *LoginHistoryController) ownHistoryHandler() func(fc *fiber.Ctx) error {
+	return func(fc *fiber.Ctx) error {
+		user, err := c.authorize(fc)
+		if err != nil {
+			return err
+		}
+		var req LoginHistoryRequest
+		if err = fc.QueryParser(&req); err != nil {
+			return services.MalformedRequest
+		}
+
+		ctx, cancel := operationContext(fc, c.cfg.Timeouts.Query)
+		defer cancel()
+
+		page, err := c.userService.LoginHistory().List(ctx, &services.LoginHistoryQuery{UserID: user.ID, Cursor: req.Cursor, Limit: req.Limit})
+		if err != nil {
+			return err
+		}
+		return fc.JSON(page)
+	}
+}
+
+func (c *LoginHistoryController) adminHistoryHandler() func(fc *fiber.Ctx) error {
+	return func(fc *fiber.Ctx) error {
+		if _, err := c.authorize(fc, services.RoleAdmin); err != nil {
+			return err
+		}
+		var req AdminLoginHistoryRequest
+		if err := fc.QueryParser(&req); err != nil {
+			return services.MalformedRequest
+		}
+
+		var invalid []services.InvalidParam
+		query := &services.LoginHistoryQuery{
+			UserID: req.User,
+			From:   parseTimeParam("from", req.From, &invalid),
+			To:     parseTimeParam("to", req.To, &invalid),
+			Result: req.Result,
+			Cursor: req.Cursor,
+			Limit:  req.Limit,
+		}
+		if len(invalid) > 0 {
+			return services.ValidationFailed("request validation failed", invalid...)
+		}
+
+		ctx, cancel := operationContext(fc, c.cfg.Timeouts.Query)
+		defer cancel()
+
+		page, err := c.userService.LoginHistory().List(ctx, query)
+		if err != nil {
+			return err
+		}
+		return fc.JSON(page)
+	}
+}
+
+// authorize checks the bearer token of the request and requires the user to have every role in required.
+func (c *LoginHistoryController) authorize(fc *fiber.Ctx, required ...string) (*authToken.UserTokenInfo, error) {
+	user, err := c.authService.Authorize(authToken.FromAuthorizationHeader(fc.Get(fiber.HeaderAuthorization)), required)
+	if errors.Is(err, services.AccessTokenInvalid) {
+		fc.Set(fiber.HeaderWWWAuthenticate, `Bearer realm="go-auth"`)
+	}
+	return user, err
+}
+
+// parseTimeParam parses an optional RFC 3339 query parameter and reports it to invalid when it is malformed.
+func parseTimeParam(name string, value string, invalid *[]services.InvalidParam) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		*invalid = append(*invalid, services.InvalidParam{Name: name, Code: "datetime", Reason: "must be a time in RFC 3339 format"})
+	}
+	return t
+}
@@ -0,0 +1,249 @@
+package controllers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+	"tutorial-auth/internal/config"
+	"tutorial-auth/internal/services"
+	"tutorial-auth/internal/transport"
+	"tutorial-auth/pkg/authToken"
+	"tutorial-auth/pkg/logging"
+)
+
+type MagicLinkRequest struct {
+	Login string `json:"login" validate:"required"`
+}
+
+// MagicLinkLoginRequest carries the token of the link of a magic link email.
+type MagicLinkLoginRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type LoginCodeRequest struct {
+	Login   string `json:"login" validate:"required"`
+	Channel string `json:"channel,omitempty" validate:"omitempty,oneof=email sms"` // "email" by default; "sms" sends the code to the phone attribute
+}
+
+type LoginCodeResponseOK struct {
+	OK          bool   `json:"ok"`
+	ChallengeID string `json:"challenge_id"` // to log in with together with the code
+}
+
+type LoginCodeLoginRequest struct {
+	ChallengeID string `json:"challenge_id" validate:"required"`
+	Code        string `json:"code" validate:"required"`
+}
+
+type SetPasswordRequest struct {
+	CurrentPassword string `json:"current_password,omitempty"` // required unless the user has no password yet
+	Password        string `json:"password" validate:"required,password"`
+	ConfirmPassword string `json:"confirm_password" validate:"required,eqfield=Password"`
+}
+
+type PasswordlessResponseOK struct {
+	OK bool `json:"ok"`
+}
+
+// PasswordlessController logs users in with magic links and one-time codes, and lets them set a
+// password, which passwordless users do not have at first.
+type PasswordlessController struct {
+	cfg         *config.AppConfig
+	logger      *zap.Logger
+	authService *services.AuthService
+	userService *services.UserService
+}
+
+func NewPasswordlessController(cfg *config.AppConfig, logger *zap.Logger, authService *services.AuthService,
+	userService *services.UserService) *PasswordlessController {
+	return &PasswordlessController{
+		cfg:         cfg,
+		logger:      logger,
+		authService: authService,
+		userService: userService,
+	}
+}
+
+func (c *PasswordlessController) GetGroup() string {
+	return "/auth"
+}
+
+func (c *PasswordlessController) GetHandlers() []ControllerHandler {
+	return []ControllerHandler{
+		&Handler{
+			Method: "POST", Path: "/magic-link",
+			Handler: c.sendMagicLinkHandler(),
+			Doc: &Doc{
+				Summary:  "Email a link that logs the user in once. Nothing is sent for unknown logins",
+				Request:  MagicLinkRequest{},
+				Response: PasswordlessResponseOK{},
+				Errors: []*services.Error{
+					services.MalformedRequest, services.ValidationFailed(""), services.PasswordlessDisabled,
+					services.ChallengesThrottled, services.OperationTimedOut,
+				},
+			},
+		},
+		&Handler{
+			Method: "POST", Path: "/magic-link/login",
+			Handler: c.magicLinkLoginHandler(),
+			Doc: &Doc{
+				Summary:  "Log in with the token of a magic link",
+				Request:  MagicLinkLoginRequest{},
+				Response: AuthResponseOK{},
+				Errors: []*services.Error{
+					services.MalformedRequest, services.ValidationFailed(""), services.PasswordlessDisabled,
+					services.LoginChallengeInvalid, services.LoginChallengeExpired, services.TooManyAttempts,
+					services.RegistrationNotCompleted, services.EmailNotVerified, services.OperationTimedOut,
+				},
+			},
+		},
+		&Handler{
+			Method: "POST", Path: "/code",
+			Handler: c.sendCodeHandler(),
+			Doc: &Doc{
+				Summary: "Send a one-time login code by email or SMS. Unknown logins and users without a phone " +
+					"number are sent nothing, but get a challenge ID all the same",
+				Request:  LoginCodeRequest{},
+				Response: LoginCodeResponseOK{},
+				Errors: []*services.Error{
+					services.MalformedRequest, services.ValidationFailed(""), services.PasswordlessDisabled,
+					services.ChallengesThrottled, services.OperationTimedOut,
+				},
+			},
+		},
+		&Handler{
+			Method: "POST", Path: "/code/login",
+			Handler: c.codeLoginHandler(),
+			Doc: &Doc{
+				Summary:  "Log in with a one-time code",
+				Request:  LoginCodeLoginRequest{},
+				Response: AuthResponseOK{},
+				Errors: []*services.Error{
+					services.MalformedRequest, services.ValidationFailed(""), services.PasswordlessDisabled,
+					services.LoginChallengeInvalid, services.LoginChallengeExpired, services.TooManyAttempts,
+					services.RegistrationNotCompleted, services.EmailNotVerified, services.OperationTimedOut,
+				},
+			},
+		},
+		&Handler{
+			Method: "POST", Path: "/password",
+			Handler: c.setPasswordHandler(),
+			Doc: &Doc{
+				Summary:  "Set the password of the user of the bearer token, who must give the current one if there is one",
+				Request:  SetPasswordRequest{},
+				Response: PasswordlessResponseOK{},
+				Errors: []*services.Error{
+					services.MalformedRequest, services.ValidationFailed(""), services.AccessTokenInvalid,
+					services.LoginOrPasswordInvalid, services.UserNotFound, services.OperationTimedOut,
+				},
+			},
+		},
+	}
+}
+
+func (c *PasswordlessController) sendMagicLinkHandler() func(fc *fiber.Ctx) error {
+	return func(fc *fiber.Ctx) error {
+		fc.Accepts("application/json")
+		var req MagicLinkRequest
+		if err := fc.BodyParser(&req); err != nil {
+			return services.MalformedRequest
+		}
+		if err := transport.ValidateRequest(fc.UserContext(), transport.PasswordPolicy{}, &req); err != nil {
+			return err
+		}
+
+		ctx, cancel := operationContext(fc, c.cfg.Timeouts.Login)
+		defer cancel()
+
+		if err := c.authService.SendMagicLink(ctx, req.Login); err != nil {
+			return err
+		}
+		return fc.JSON(PasswordlessResponseOK{OK: true})
+	}
+}
+
+func (c *PasswordlessController) magicLinkLoginHandler() func(fc *fiber.Ctx) error {
+	return func(fc *fiber.Ctx) error {
+		fc.Accepts("application/json")
+		var req MagicLinkLoginRequest
+		if err := fc.BodyParser(&req); err != nil {
+			return services.MalformedRequest
+		}
+		if err := transport.ValidateRequest(fc.UserContext(), transport.PasswordPolicy{}, &req); err != nil {
+			return err
+		}
+
+		ctx, cancel := loginContext(fc, c.cfg)
+		defer cancel()
+
+		return respondLogin(fc, c.cfg, c.authService.LoginWithMagicLink(ctx, req.Token))
+	}
+}
+
+func (c *PasswordlessController) sendCodeHandler() func(fc *fiber.Ctx) error {
+	return func(fc *fiber.Ctx) error {
+		fc.Accepts("application/json")
+		var req LoginCodeRequest
+		if err := fc.BodyParser(&req); err != nil {
+			return services.MalformedRequest
+		}
+		if err := transport.ValidateRequest(fc.UserContext(), transport.PasswordPolicy{}, &req); err != nil {
+			return err
+		}
+
+		ctx, cancel := operationContext(fc, c.cfg.Timeouts.Login)
+		defer cancel()
+
+		challengeID, err := c.authService.SendLoginCode(ctx, req.Login, req.Channel)
+		if err != nil {
+			return err
+		}
+		return fc.JSON(LoginCodeResponseOK{OK: true, ChallengeID: challengeID})
+	}
+}
+
+func (c *PasswordlessController) codeLoginHandler() func(fc *fiber.Ctx) error {
+	return func(fc *fiber.Ctx) error {
+		fc.Accepts("application/json")
+		var req LoginCodeLoginRequest
+		if err := fc.BodyParser(&req); err != nil {
+			return services.MalformedRequest
+		}
+		if err := transport.ValidateRequest(fc.UserContext(), transport.PasswordPolicy{}, &req); err != nil {
+			return err
+		}
+
+		ctx, cancel := loginContext(fc, c.cfg)
+		defer cancel()
+
+		return respondLogin(fc, c.cfg, c.authService.LoginWithCode(ctx, req.ChallengeID, req.Code))
+	}
+}
+
+func (c *PasswordlessController) setPasswordHandler() func(fc *fiber.Ctx) error {
+	const op = "internal.server.controllers.passwordless.setPasswordHandler"
+
+	return func(fc *fiber.Ctx) error {
+		user, err := c.authService.Authorize(authToken.FromAuthorizationHeader(fc.Get(fiber.HeaderAuthorization)), nil)
+		if err != nil {
+			fc.Set(fiber.HeaderWWWAuthenticate, `Bearer realm="go-auth"`)
+			return err
+		}
+		fc.Accepts("application/json")
+		var req SetPasswordRequest
+		if err = fc.BodyParser(&req); err != nil {
+			return services.MalformedRequest
+		}
+		if err = transport.ValidateRequest(fc.UserContext(), transport.PasswordPolicy{MinLength: c.cfg.PasswordMinLength}, &req); err != nil {
+			logging.WithContext(fc.UserContext(), c.logger).Info("Validation error", zap.String("op", op), zap.Error(err))
+			return err
+		}
+
+		ctx, cancel := operationContext(fc, c.cfg.Timeouts.Register)
+		defer cancel()
+
+		if err = c.userService.SetPassword(ctx, user.ID, req.CurrentPassword, req.Password); err != nil {
+			return err
+		}
+		return fc.JSON(PasswordlessResponseOK{OK: true})
+	}
+}
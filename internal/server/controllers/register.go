@@ -1,68 +1,30 @@
 package controllers
 
 import (
-	"context"
-	"errors"
-	"fmt"
 	"github.com/gofiber/fiber/v2"
 	"go.uber.org/zap"
 	"tutorial-auth/internal/config"
 	"tutorial-auth/internal/mongodb/models"
 	"tutorial-auth/internal/services"
+	"tutorial-auth/internal/transport"
 )
 
-var PasswordNotEqualError = fmt.Errorf("password not equal")
-
-type RegisterRequestValidationConfig struct {
-	LoginRequired     bool `json:"login_required"`
-	PasswordRequired  bool `json:"password_required"`
-	PasswordEqual     bool `json:"password_not_equal"`
-	PasswordMinLength int  `json:"password_min_length"`
+type RegisterResponseOK struct {
+	OK   bool         `json:"ok"`
+	User *models.User `json:"user,omitempty"`
 }
 
-type RegisterRequest struct {
-	Login           string `json:"login"`
-	Password        string `json:"password"`
-	ConfirmPassword string `json:"confirm_password"`
-	Name            string `json:"name"`
-	LastName        string `json:"last_name,omitempty"`
+// VerifyEmailRequest carries the token of the link of a verification email.
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required"`
 }
 
-func (r *RegisterRequest) Validate(cfg RegisterRequestValidationConfig) (bool, error) {
-	if cfg.LoginRequired && len(r.Login) == 0 {
-		return false, LoginRequiredError
-	}
-
-	if cfg.PasswordRequired {
-		if len(r.Password) == 0 {
-			return false, PasswordRequiredError
-		}
-
-		if len(r.ConfirmPassword) == 0 {
-			return false, PasswordRequiredError
-		}
-	}
-
-	if cfg.PasswordEqual && r.Password != r.ConfirmPassword {
-		return false, PasswordNotEqualError
-	}
-
-	if cfg.PasswordMinLength > 0 && len(r.Password) < cfg.PasswordMinLength {
-		errMsg := fmt.Sprintf("Password is too short. Min length is %d", cfg.PasswordMinLength)
-		return false, errors.New(errMsg)
-	}
-
-	return true, nil
+type ResendVerificationRequest struct {
+	Login string `json:"login" validate:"required"`
 }
 
-type RegisterResponseError struct {
-	OK    bool   `json:"ok"`
-	Cause string `json:"cause"`
-}
-
-type RegisterResponseOK struct {
-	OK   bool         `json:"ok"`
-	User *models.User `json:"user,omitempty"`
+type ResendVerificationResponseOK struct {
+	OK bool `json:"ok"`
 }
 
 type RegisterController struct {
@@ -84,6 +46,42 @@ func (c *RegisterController) GetHandlers() []ControllerHandler {
 		&Handler{
 			Method: "POST", Path: "/register",
 			Handler: c.RegisterHandler(),
+			Doc: &Doc{
+				Summary:  "Register a user, with a password or, when passwordless login is enabled, without one",
+				Request:  transport.RegisterRequest{},
+				Response: RegisterResponseOK{},
+				Errors: []*services.Error{
+					services.MalformedRequest, services.ValidationFailed(""), services.UserAlreadyExistsError,
+					services.OperationTimedOut,
+				},
+			},
+		},
+		&Handler{
+			Method: "POST", Path: "/verify-email",
+			Handler: c.verifyEmailHandler(),
+			Doc: &Doc{
+				Summary:  "Verify the email address of a user with the token of a verification link",
+				Request:  VerifyEmailRequest{},
+				Response: RegisterResponseOK{},
+				Errors: []*services.Error{
+					services.MalformedRequest, services.ValidationFailed(""), services.VerificationTokenInvalid,
+					services.VerificationTokenExpired, services.OperationTimedOut,
+				},
+			},
+		},
+		&Handler{
+			Method: "POST", Path: "/verify-email/resend",
+			Handler: c.resendVerificationHandler(),
+			Doc: &Doc{
+				Summary: "Send a new verification link to a user who has not verified their email address. " +
+					"Nothing is sent for unknown or verified logins, or when a link was sent recently",
+				Request:  ResendVerificationRequest{},
+				Response: ResendVerificationResponseOK{},
+				Errors: []*services.Error{
+					services.MalformedRequest, services.ValidationFailed(""),
+					services.OperationTimedOut,
+				},
+			},
 		},
 	}
 }
@@ -95,23 +93,16 @@ func (c *RegisterController) GetGroup() string {
 func (c *RegisterController) RegisterHandler() func(*fiber.Ctx) error {
 	return func(fc *fiber.Ctx) error {
 		fc.Accepts("application/json")
-		var req RegisterRequest
+		var req transport.RegisterRequest
 		if err := fc.BodyParser(&req); err != nil {
-			return err
+			return services.MalformedRequest
 		}
-		if valid, err := (*RegisterRequest).Validate(&req, RegisterRequestValidationConfig{
-			LoginRequired:     true,
-			PasswordRequired:  true,
-			PasswordEqual:     true,
-			PasswordMinLength: c.cfg.PasswordMinLength,
-		}); !valid {
-			return fc.JSON(RegisterResponseError{
-				OK:    false,
-				Cause: err.Error(),
-			})
+		if err := transport.ValidateRequest(fc.UserContext(), c.passwordPolicy(), &req); err != nil {
+			return err
 		}
 
-		ctx := context.WithValue(context.Background(), "cfg", c.cfg)
+		ctx, cancel := operationContext(fc, c.cfg.Timeouts.Register)
+		defer cancel()
 
 		user, err := c.userService.Register(ctx, &services.NewUser{
 			Login:    req.Login,
@@ -120,10 +111,7 @@ func (c *RegisterController) RegisterHandler() func(*fiber.Ctx) error {
 			LastName: req.LastName,
 		})
 		if err != nil {
-			return fc.JSON(RegisterResponseError{
-				OK:    false,
-				Cause: err.Error(),
-			})
+			return err
 		}
 
 		return fc.JSON(RegisterResponseOK{
@@ -132,3 +120,54 @@ func (c *RegisterController) RegisterHandler() func(*fiber.Ctx) error {
 		})
 	}
 }
+
+func (c *RegisterController) verifyEmailHandler() func(*fiber.Ctx) error {
+	return func(fc *fiber.Ctx) error {
+		fc.Accepts("application/json")
+		var req VerifyEmailRequest
+		if err := fc.BodyParser(&req); err != nil {
+			return services.MalformedRequest
+		}
+		if err := transport.ValidateRequest(fc.UserContext(), transport.PasswordPolicy{}, &req); err != nil {
+			return err
+		}
+
+		ctx, cancel := operationContext(fc, c.cfg.Timeouts.Register)
+		defer cancel()
+
+		user, err := c.userService.EmailVerification().Verify(ctx, req.Token)
+		if err != nil {
+			return err
+		}
+
+		return fc.JSON(RegisterResponseOK{
+			OK:   true,
+			User: user,
+		})
+	}
+}
+
+func (c *RegisterController) resendVerificationHandler() func(*fiber.Ctx) error {
+	return func(fc *fiber.Ctx) error {
+		fc.Accepts("application/json")
+		var req ResendVerificationRequest
+		if err := fc.BodyParser(&req); err != nil {
+			return services.MalformedRequest
+		}
+		if err := transport.ValidateRequest(fc.UserContext(), transport.PasswordPolicy{}, &req); err != nil {
+			return err
+		}
+
+		ctx, cancel := operationContext(fc, c.cfg.Timeouts.Register)
+		defer cancel()
+
+		if err := c.userService.EmailVerification().Resend(ctx, req.Login); err != nil {
+			return err
+		}
+		return fc.JSON(ResendVerificationResponseOK{OK: true})
+	}
+}
+
+func (c *RegisterController) passwordPolicy() transport.PasswordPolicy {
+	return transport.PasswordPolicy{MinLength: c.cfg.PasswordMinLength}
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"net/http/httptest"
+	"testing"
+	"tutorial-auth/internal/config"
+	"tutorial-auth/internal/server/controllers"
+	"tutorial-auth/internal/services"
+	"tutorial-auth/pkg/authToken"
+)
+
+func TestForwardAuth(t *testing.T) {
+	cfg := &config.AppConfig{TokenSecret: "secret", ForwardAuth: config.ForwardAuthConfig{Cookie: "access_token"}}
+	ws := NewWebServer(zap.NewNop(), &config.WebServerConfig{}, nil)
+	ws.RegisterRoutes([]controllers.GroupController{
+		controllers.NewForwardAuthController(cfg, zap.NewNop(), services.NewAuthService(cfg, zap.NewNop(), nil)),
+	})
+
+	token, err := authToken.NewToken("secret", 5, &authToken.UserTokenInfo{ID: "guid", Login: "user", Roles: []string{"admin", "staff"}})
+	require.NoError(t, err)
+	refreshToken, err := authToken.NewToken("secret", 60, nil)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		Method        string
+		Target        string
+		Authorization string
+		Cookie        string
+		Status        int
+	}{
+		{Method: "GET", Target: "/auth/forward", Authorization: "Bearer " + token, Status: 200},
+		{Method: "POST", Target: "/auth/forward?roles=admin", Authorization: "bearer " + token, Status: 200},
+		{Method: "GET", Target: "/auth/forward?roles=admin,staff", Cookie: "access_token=" + token, Status: 200},
+		{Method: "GET", Target: "/auth/forward?roles=admin,billing", Authorization: "Bearer " + token, Status: 403},
+		{Method: "GET", Target: "/auth/forward", Status: 401},
+		{Method: "GET", Target: "/auth/forward", Authorization: "Basic dXNlcjpwYXNz", Status: 401},
+		{Method: "GET", Target: "/auth/forward", Authorization: "Bearer " + refreshToken, Status: 401},
+		{Method: "GET", Target: "/auth/forward", Cookie: "other=" + token, Status: 401},
+	}
+
+	for _, testCase := range testCases {
+		req := httptest.NewRequest(testCase.Method, testCase.Target, nil)
+		if testCase.Authorization != "" {
+			req.Header.Set("Authorization", testCase.Authorization)
+		}
+		if testCase.Cookie != "" {
+			req.Header.Set("Cookie", testCase.Cookie)
+		}
+		resp, err := ws.client.Test(req)
+		require.NoError(t, err)
+		require.Equal(t, testCase.Status, resp.StatusCode, "%s %s", testCase.Method, testCase.Target)
+
+		switch testCase.Status {
+		case 200:
+			require.Equal(t, "guid", resp.Header.Get("X-User-Id"))
+			require.Equal(t, "user", resp.Header.Get("X-User-Login"))
+			require.Equal(t, "admin,staff", resp.Header.Get("X-User-Roles"))
+		case 401:
+			require.Equal(t, `Bearer realm="go-auth"`, resp.Header.Get("WWW-Authenticate"))
+			require.Empty(t, resp.Header.Get("X-User-Id"))
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"tutorial-auth/internal/config"
+	"tutorial-auth/internal/database"
+	"tutorial-auth/internal/server/controllers"
+	"tutorial-auth/internal/services"
+	"tutorial-auth/internal/transport"
+)
+
+// testServer serves the routes of controllers over services on a migrated sqlite database.
+type testServer struct {
+	t           *testing.T
+	ws          *WebServer
+	userService *services.UserService
+	authService *services.AuthService
+	header      http.Header // sent with every request
+}
+
+func newTestServer(t *testing.T, cfg *config.AppConfig,
+	routes func(userService *services.UserService, authService *services.AuthService) []controllers.GroupController) *testServer {
+	return newTestServerWith(t, cfg, &config.WebServerConfig{}, routes)
+}
+
+func newTestServerWith(t *testing.T, cfg *config.AppConfig, webCfg *config.WebServerConfig,
+	routes func(userService *services.UserService, authService *services.AuthService) []controllers.GroupController) *testServer {
+	dbCfg := &config.DBConnectionConfig{Type: "sqlite", Database: filepath.Join(t.TempDir(), "auth.db"), BusyTimeout: 5 * time.Second}
+	db, err := database.NewConnectionDB(dbCfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	require.NoError(t, database.ApplyMigration(zap.NewNop(), dbCfg.Type, db))
+
+	userService := services.NewUserService(cfg, zap.NewNop(), database.NewUserStore(db), db)
+	authService := services.NewAuthService(cfg, zap.NewNop(), userService)
+	ws := NewWebServer(zap.NewNop(), webCfg, nil)
+	ws.RegisterRoutes(routes(userService, authService))
+	return &testServer{t: t, ws: ws, userService: userService, authService: authService, header: http.Header{}}
+}
+
+// do sends a request with the JSON body, if any, and the bearer token, if any. A 200 response is
+// decoded into response, if not nil, and any other into the returned problem.
+func (s *testServer) do(method string, target string, token string, body string, response any) (int, transport.Problem) {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, target, reader)
+	for key, values := range s.header {
+		req.Header[key] = values
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := s.ws.client.Test(req)
+	require.NoError(s.t, err)
+	defer resp.Body.Close()
+
+	var problem transport.Problem
+	if resp.StatusCode != 200 {
+		require.NoError(s.t, json.NewDecoder(resp.Body).Decode(&problem))
+	} else if response != nil {
+		require.NoError(s.t, json.NewDecoder(resp.Body).Decode(response))
+	}
+	return resp.StatusCode, problem
+}
+
+func (s *testServer) post(target string, body string, response any) (int, transport.Problem) {
+	return s.do("POST", target, "", body, response)
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"net/http/httptest"
+	"testing"
+	"tutorial-auth/internal/config"
+	"tutorial-auth/internal/health"
+	"tutorial-auth/internal/server/controllers"
+)
+
+func TestHealthEndpoints(t *testing.T) {
+	var dbErr error
+	checker := health.NewChecker(zap.NewNop(), health.Check{Name: "sql", Run: func(context.Context) (any, error) {
+		return nil, dbErr
+	}})
+	ws := NewWebServer(zap.NewNop(), &config.WebServerConfig{}, nil)
+	ws.RegisterRoutes([]controllers.GroupController{controllers.NewHealthController(zap.NewNop(), checker)})
+
+	probe := func(target string) (int, *health.Report) {
+		resp, err := ws.client.Test(httptest.NewRequest("GET", target, nil))
+		require.NoError(t, err)
+		report := &health.Report{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(report))
+		return resp.StatusCode, report
+	}
+
+	status, report := probe("/readyz")
+	require.Equal(t, 200, status)
+	require.Equal(t, health.StatusOK, report.Checks["sql"].Status)
+
+	dbErr = errors.New("connection refused")
+	status, report = probe("/readyz")
+	require.Equal(t, 503, status)
+	require.Equal(t, health.StatusFail, report.Status)
+	require.Equal(t, "connection refused", report.Checks["sql"].Error)
+
+	// liveness does not depend on the dependencies or on draining
+	checker.Drain()
+	status, report = probe("/readyz")
+	require.Equal(t, 503, status)
+	require.Equal(t, health.StatusDraining, report.Status)
+	status, report = probe("/healthz")
+	require.Equal(t, 200, status)
+	require.Equal(t, health.StatusOK, report.Status)
+}
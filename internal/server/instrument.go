@@ -0,0 +1,79 @@
+package server
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"strconv"
+	"time"
+	"tutorial-auth/internal/metrics"
+)
+
+var tracer = otel.Tracer("tutorial-auth/internal/server")
+
+// instrumentMiddleware traces and measures every request. The span continues the W3C trace
+// context of the request and becomes the parent of the spans of the handler through the user
+// context. Metrics are recorded by the template of the route that served the request, so path
+// parameters do not make a time series per value. Errors are rendered here, as the fiber logger
+// middleware does, so that the status is the one the client gets.
+func instrumentMiddleware() fiber.Handler {
+	return func(fc *fiber.Ctx) error {
+		started := time.Now()
+		ctx := otel.GetTextMapPropagator().Extract(fc.UserContext(), headerCarrier{&fc.Request().Header})
+		ctx, span := tracer.Start(ctx, fc.Method(),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPRequestMethodKey.String(fc.Method()), semconv.URLPath(fc.Path())))
+		defer span.End()
+		fc.SetUserContext(ctx)
+
+		middleware := fc.Route()
+		if err := fc.Next(); err != nil {
+			if err = fc.App().ErrorHandler(fc, err); err != nil {
+				_ = fc.SendStatus(fiber.StatusInternalServerError)
+			}
+		}
+
+		status := fc.Response().StatusCode()
+		// the route stays the one of this middleware when no handler matched
+		route := fc.Route().Path
+		if fc.Route() == middleware {
+			route = "unmatched"
+		} else {
+			span.SetName(fc.Method() + " " + route)
+			span.SetAttributes(semconv.HTTPRoute(route))
+		}
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= fiber.StatusInternalServerError {
+			span.SetStatus(codes.Error, "")
+		}
+
+		metrics.HTTPRequestDuration.
+			WithLabelValues(fc.Method(), route, strconv.Itoa(status)).
+			Observe(time.Since(started).Seconds())
+		return nil
+	}
+}
+
+// headerCarrier lets propagators read and write fasthttp request headers.
+type headerCarrier struct {
+	header *fasthttp.RequestHeader
+}
+
+func (c headerCarrier) Get(key string) string {
+	return string(c.header.Peek(key))
+}
+
+func (c headerCarrier) Set(key string, value string) {
+	c.header.Set(key, value)
+}
+
+func (c headerCarrier) Keys() []string {
+	var keys []string
+	c.header.VisitAll(func(key, _ []byte) {
+		keys = append(keys, string(key))
+	})
+	return keys
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"testing"
+	"time"
+	"tutorial-auth/internal/config"
+	"tutorial-auth/internal/server/controllers"
+	"tutorial-auth/internal/services"
+	"tutorial-auth/internal/transport"
+	"tutorial-auth/pkg/authToken"
+)
+
+func TestLoginHistoryEndpoints(t *testing.T) {
+	cfg := &config.AppConfig{PasswordLifeTime: 1, TokenSecret: "secret", TokenExpirationTimeMinutes: 5, RefreshTokenExpirationTimeMinutes: 60}
+	srv := newTestServer(t, cfg, func(userService *services.UserService, authService *services.AuthService) []controllers.GroupController {
+		return []controllers.GroupController{controllers.NewLoginHistoryController(cfg, zap.NewNop(), authService, userService)}
+	})
+
+	ctx := context.Background()
+	user, err := srv.userService.Register(ctx, &services.NewUser{Login: "user@example.com", Password: "password"})
+	require.NoError(t, err)
+	require.NoError(t, srv.authService.Login(ctx, "user@example.com", "password").Err)
+	require.Error(t, srv.authService.Login(ctx, "other@example.com", "password").Err)
+
+	userToken, err := authToken.NewToken("secret", 5, &authToken.UserTokenInfo{ID: user.GUID, Login: "user@example.com"})
+	require.NoError(t, err)
+	adminToken, err := authToken.NewToken("secret", 5, &authToken.UserTokenInfo{ID: "admin", Login: "admin", Roles: []string{services.RoleAdmin}})
+	require.NoError(t, err)
+
+	get := func(target string, token string) (int, services.LoginHistoryPage, transport.Problem) {
+		var page services.LoginHistoryPage
+		status, problem := srv.do("GET", target, token, "", &page)
+		return status, page, problem
+	}
+
+	status, _, problem := get("/users/me/logins", "")
+	require.Equal(t, 401, status)
+	require.Equal(t, services.AccessTokenInvalid.Code, problem.Code)
+
+	status, page, _ := get("/users/me/logins?limit=10", userToken)
+	require.Equal(t, 200, status)
+	require.Len(t, page.Attempts, 1)
+	require.Equal(t, user.GUID, page.Attempts[0].UserID)
+
+	status, _, problem = get("/admin/logins", userToken)
+	require.Equal(t, 403, status)
+	require.Equal(t, services.AccessDenied.Code, problem.Code)
+
+	status, page, _ = get("/admin/logins?result=failure", adminToken)
+	require.Equal(t, 200, status)
+	require.Len(t, page.Attempts, 1)
+	require.Equal(t, "other@example.com", page.Attempts[0].Login)
+
+	status, page, _ = get("/admin/logins?user="+user.GUID+"&from="+time.Now().Add(-time.Hour).UTC().Format(time.RFC3339), adminToken)
+	require.Equal(t, 200, status)
+	require.Len(t, page.Attempts, 1)
+
+	status, _, problem = get("/admin/logins?from=yesterday", adminToken)
+	require.Equal(t, 400, status)
+	require.Equal(t, "from", problem.InvalidParams[0].Name)
+}
@@ -0,0 +1,352 @@
+package server
+
+import (
+	"encoding"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"tutorial-auth/internal/server/controllers"
+	"tutorial-auth/internal/services"
+	"tutorial-auth/internal/transport"
+)
+
+const (
+	openAPIPath         = "/openapi.json"
+	swaggerUIPath       = "/docs"
+	swaggerUIAssetsPath = "/docs/assets"
+	apiTitle            = "go-auth"
+	apiVersion          = "1.0.0"
+	jsonType            = "application/json"
+	componentsRoot      = "#/components/schemas/"
+)
+
+// OpenAPI is an OpenAPI 3.1 document. Schemas are JSON Schema objects kept as plain maps.
+type OpenAPI struct {
+	OpenAPI    string                          `json:"openapi"`
+	Info       OpenAPIInfo                     `json:"info"`
+	Paths      map[string]map[string]Operation `json:"paths"`
+	Components OpenAPIComponents               `json:"components"`
+}
+
+type OpenAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type OpenAPIComponents struct {
+	Schemas map[string]map[string]any `json:"schemas"`
+}
+
+type Operation struct {
+	OperationID string              `json:"operationId"`
+	Summary     string              `json:"summary,omitempty"`
+	Tags        []string            `json:"tags,omitempty"`
+	Parameters  []Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]Response `json:"responses"`
+}
+
+type Parameter struct {
+	Name     string         `json:"name"`
+	In       string         `json:"in"`
+	Required bool           `json:"required,omitempty"`
+	Schema   map[string]any `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema map[string]any `json:"schema"`
+}
+
+// allMethods are the operations documented for routes that accept any method.
+var allMethods = []string{"get", "post", "put", "patch", "delete"}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// BuildOpenAPI describes the documented routes of groups. Routes without a Doc are left out,
+// and UndocumentedRoutes reports them.
+func BuildOpenAPI(groups []controllers.GroupController) *OpenAPI {
+	b := &schemaBuilder{schemas: make(map[string]map[string]any), names: make(map[reflect.Type]string)}
+	doc := &OpenAPI{
+		OpenAPI: "3.1.0",
+		Info:    OpenAPIInfo{Title: apiTitle, Version: apiVersion},
+		Paths:   make(map[string]map[string]Operation),
+	}
+
+	for _, group := range groups {
+		for _, handler := range group.GetHandlers() {
+			handlerDoc := handler.GetDoc()
+			if handlerDoc == nil {
+				continue
+			}
+			path := openAPIPathOf(group.GetGroup() + handler.GetPath())
+			methods := []string{strings.ToLower(handler.GetMethod())}
+			if methods[0] == "all" {
+				methods = allMethods
+			}
+			for _, method := range methods {
+				if doc.Paths[path] == nil {
+					doc.Paths[path] = make(map[string]Operation)
+				}
+				doc.Paths[path][method] = b.operation(group, method, path, handlerDoc)
+			}
+		}
+	}
+	doc.Components.Schemas = b.schemas
+	return doc
+}
+
+func (b *schemaBuilder) operation(group controllers.GroupController, method string, path string, handlerDoc *controllers.Doc) Operation {
+	operation := Operation{
+		OperationID: operationID(method, path),
+		Summary:     handlerDoc.Summary,
+		Responses:   make(map[string]Response),
+	}
+	if tag := strings.Trim(group.GetGroup(), "/"); tag != "" {
+		operation.Tags = []string{tag}
+	}
+	if handlerDoc.Query != nil {
+		operation.Parameters = b.queryParameters(reflect.TypeOf(handlerDoc.Query))
+	}
+	if handlerDoc.Request != nil {
+		operation.RequestBody = &RequestBody{
+			Required: true,
+			Content:  map[string]MediaType{jsonType: {Schema: b.schemaOf(reflect.TypeOf(handlerDoc.Request))}},
+		}
+	}
+	ok := Response{Description: http.StatusText(http.StatusOK)}
+	if handlerDoc.Response != nil {
+		ok.Content = map[string]MediaType{jsonType: {Schema: b.schemaOf(reflect.TypeOf(handlerDoc.Response))}}
+	}
+	operation.Responses[strconv.Itoa(http.StatusOK)] = ok
+	for status, response := range b.errorResponses(handlerDoc.Errors) {
+		operation.Responses[status] = response
+	}
+	return operation
+}
+
+// queryParameters describes the fields of a query struct, named by their query tags as fiber parses them.
+func (b *schemaBuilder) queryParameters(t reflect.Type) []Parameter {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	var parameters []Parameter
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Tag.Get("query")
+		if name == "" || name == "-" || !field.IsExported() {
+			continue
+		}
+		parameters = append(parameters, Parameter{
+			Name:     name,
+			In:       "query",
+			Required: strings.Contains(field.Tag.Get("validate"), "required"),
+			Schema:   b.schemaOf(field.Type),
+		})
+	}
+	return parameters
+}
+
+// UndocumentedRoutes returns "METHOD /path" for every registered route without a Doc.
+func (ws *WebServer) UndocumentedRoutes() []string {
+	var result []string
+	for _, group := range ws.groups {
+		for _, handler := range group.GetHandlers() {
+			if handler.GetDoc() == nil {
+				result = append(result, handler.GetMethod()+" "+group.GetGroup()+handler.GetPath())
+			}
+		}
+	}
+	return result
+}
+
+// errorResponses groups errors by their HTTP status. Every route can fail with internal_error.
+func (b *schemaBuilder) errorResponses(errs []*services.Error) map[string]Response {
+	codes := make(map[int][]string)
+	for _, err := range append(errs, services.InternalError) {
+		status := kindStatus[err.Kind]
+		if !containsString(codes[status], err.Code) {
+			codes[status] = append(codes[status], err.Code)
+		}
+	}
+
+	problem := b.schemaOf(reflect.TypeOf(transport.Problem{}))
+	responses := make(map[string]Response, len(codes))
+	for status, statusCodes := range codes {
+		sort.Strings(statusCodes)
+		enum := make([]any, len(statusCodes))
+		for i, code := range statusCodes {
+			enum[i] = code
+		}
+		responses[strconv.Itoa(status)] = Response{
+			Description: http.StatusText(status) + ": " + strings.Join(statusCodes, ", "),
+			Content: map[string]MediaType{transport.ProblemContentType: {Schema: map[string]any{
+				"allOf": []any{problem, map[string]any{
+					"properties": map[string]any{"code": map[string]any{"enum": enum}},
+				}},
+			}}},
+		}
+	}
+	return responses
+}
+
+// schemaBuilder derives JSON schemas from Go types the way encoding/json encodes them.
+// Named structs become components and are referenced.
+type schemaBuilder struct {
+	schemas map[string]map[string]any
+	names   map[reflect.Type]string
+}
+
+func (b *schemaBuilder) schemaOf(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType):
+		return map[string]any{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]any{"type": "array", "items": b.schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": b.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.objectSchema(t)
+		}
+		return map[string]any{"$ref": componentsRoot + b.component(t)}
+	default:
+		// interfaces and anything else encoding/json decides on at run time
+		return map[string]any{}
+	}
+}
+
+// component registers the schema of a named struct and returns its component name.
+func (b *schemaBuilder) component(t reflect.Type) string {
+	if name, ok := b.names[t]; ok {
+		return name
+	}
+	name := t.Name()
+	if _, taken := b.schemas[name]; taken {
+		name = strings.ReplaceAll(t.PkgPath(), "/", ".") + "." + name
+	}
+	b.names[t] = name
+	// reserve the name before descending so that recursive types terminate
+	b.schemas[name] = map[string]any{}
+	b.schemas[name] = b.objectSchema(t)
+	return name
+}
+
+func (b *schemaBuilder) objectSchema(t reflect.Type) map[string]any {
+	properties := make(map[string]any)
+	var required []string
+	b.addFields(t, properties, &required)
+
+	schema := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func (b *schemaBuilder) addFields(t reflect.Type, properties map[string]any, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			for embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				b.addFields(embedded, properties, required)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		schema := b.schemaOf(field.Type)
+		for _, rule := range strings.Split(field.Tag.Get("validate"), ",") {
+			rule, param, _ := strings.Cut(rule, "=")
+			switch rule {
+			case "required":
+				*required = append(*required, name)
+			case "max":
+				if n, err := strconv.Atoi(param); err == nil && schema["type"] == "string" {
+					schema["maxLength"] = n
+				}
+			case "login":
+				schema["pattern"] = transport.LoginPattern
+			}
+		}
+		properties[name] = schema
+	}
+}
+
+// openAPIPathOf turns fiber parameters (/users/:id) into OpenAPI ones (/users/{id}).
+func openAPIPathOf(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			segments[i] = "{" + strings.TrimSuffix(strings.TrimPrefix(segment, ":"), "?") + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// operationID derives a stable identifier such as postAuthLogin from the method and path.
+func operationID(method string, path string) string {
+	var sb strings.Builder
+	sb.WriteString(method)
+	for _, part := range strings.FieldsFunc(path, func(r rune) bool { return r == '/' || r == '{' || r == '}' || r == '_' || r == '-' }) {
+		sb.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return sb.String()
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
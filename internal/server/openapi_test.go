@@ -0,0 +1,112 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"tutorial-auth/internal/config"
+	"tutorial-auth/internal/server/controllers"
+	"tutorial-auth/internal/services"
+)
+
+type testNode struct {
+	ID       string      `json:"id" validate:"required"`
+	Label    string      `json:"label,omitempty" validate:"max=10"`
+	Children []*testNode `json:"children"`
+	Created  time.Time   `json:"created"`
+	Secret   string      `json:"-"`
+	Extra    map[string]any
+}
+
+type testController struct{}
+
+func (c *testController) GetGroup() string {
+	return "/nodes"
+}
+
+func (c *testController) GetHandlers() []controllers.ControllerHandler {
+	handler := func(fc *fiber.Ctx) error { return nil }
+	return []controllers.ControllerHandler{
+		&controllers.Handler{
+			Method: "PUT", Path: "/:id", Handler: handler,
+			Doc: &controllers.Doc{
+				Summary:  "Replace a node",
+				Request:  testNode{},
+				Response: &testNode{},
+				Errors:   []*services.Error{services.MalformedRequest, services.ValidationFailed(""), services.RefreshTokenInvalid, services.RefreshTokenExpired},
+			},
+		},
+		&controllers.Handler{Method: "DELETE", Path: "/:id", Handler: handler},
+	}
+}
+
+func TestBuildOpenAPI(t *testing.T) {
+	ws := NewWebServer(zap.NewNop(), &config.WebServerConfig{}, nil)
+	ws.RegisterRoutes([]controllers.GroupController{&testController{}})
+	doc := ws.OpenAPI()
+
+	require.Equal(t, "3.1.0", doc.OpenAPI)
+	operation, ok := doc.Paths["/nodes/{id}"]["put"]
+	require.True(t, ok)
+	require.Equal(t, "putNodesId", operation.OperationID)
+	require.Equal(t, []string{"nodes"}, operation.Tags)
+	require.Equal(t, map[string]any{"$ref": "#/components/schemas/testNode"}, operation.RequestBody.Content["application/json"].Schema)
+	require.Equal(t, map[string]any{"$ref": "#/components/schemas/testNode"}, operation.Responses["200"].Content["application/json"].Schema)
+	require.Equal(t, "Bad Request: malformed_request, validation_failed", operation.Responses["400"].Description)
+	require.Equal(t, "Unauthorized: invalid_refresh_token, refresh_token_expired", operation.Responses["401"].Description)
+	require.Contains(t, operation.Responses, "500")
+
+	node := doc.Components.Schemas["testNode"]
+	require.Equal(t, []string{"id"}, node["required"])
+	properties := node["properties"].(map[string]any)
+	require.NotContains(t, properties, "Secret")
+	require.Equal(t, map[string]any{"type": "string", "maxLength": 10}, properties["label"])
+	require.Equal(t, map[string]any{"type": "string", "format": "date-time"}, properties["created"])
+	require.Equal(t, map[string]any{"type": "array", "items": map[string]any{"$ref": "#/components/schemas/testNode"}}, properties["children"])
+	require.Equal(t, map[string]any{"type": "object", "additionalProperties": map[string]any{}}, properties["Extra"])
+	require.Contains(t, doc.Components.Schemas, "Problem")
+
+	require.Equal(t, []string{"DELETE /nodes/:id"}, ws.UndocumentedRoutes())
+}
+
+func TestOpenAPIRoutes(t *testing.T) {
+	ws := NewWebServer(zap.NewNop(), &config.WebServerConfig{SwaggerUI: true, SwaggerUIAssets: "https://assets.example/"}, nil)
+	ws.RegisterRoutes([]controllers.GroupController{&testController{}})
+
+	resp, err := ws.client.Test(httptest.NewRequest("GET", "/openapi.json", nil))
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	var doc OpenAPI
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&doc))
+	require.Contains(t, doc.Paths, "/nodes/{id}")
+
+	resp, err = ws.client.Test(httptest.NewRequest("GET", "/docs", nil))
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	page, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Contains(t, string(page), "https://assets.example/swagger-ui-bundle.js")
+
+	// without a base URL the page loads the embedded assets
+	ws = NewWebServer(zap.NewNop(), &config.WebServerConfig{SwaggerUI: true}, nil)
+	resp, err = ws.client.Test(httptest.NewRequest("GET", "/docs", nil))
+	require.NoError(t, err)
+	page, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Contains(t, string(page), `src="/docs/assets/swagger-ui-bundle.js"`)
+	for _, asset := range []string{"/docs/assets/swagger-ui-bundle.js", "/docs/assets/swagger-ui.css"} {
+		resp, err = ws.client.Test(httptest.NewRequest("GET", asset, nil))
+		require.NoError(t, err)
+		require.Equal(t, 200, resp.StatusCode, asset)
+	}
+
+	ws = NewWebServer(zap.NewNop(), &config.WebServerConfig{}, nil)
+	resp, err = ws.client.Test(httptest.NewRequest("GET", "/docs", nil))
+	require.NoError(t, err)
+	require.Equal(t, 404, resp.StatusCode)
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"testing"
+	"time"
+	"tutorial-auth/internal/config"
+	"tutorial-auth/internal/server/controllers"
+	"tutorial-auth/internal/services"
+)
+
+func TestPasswordlessEndpoints(t *testing.T) {
+	cfg := &config.AppConfig{PasswordLifeTime: 1, TokenSecret: "secret"}
+	cfg.Passwordless = config.PasswordlessConfig{Enabled: true, MagicLinkLifetime: time.Hour, CodeLifetime: time.Hour, MaxAttempts: 3}
+	srv := newTestServer(t, cfg, func(userService *services.UserService, authService *services.AuthService) []controllers.GroupController {
+		return []controllers.GroupController{controllers.NewPasswordlessController(cfg, zap.NewNop(), authService, userService)}
+	})
+
+	// unknown logins get a challenge that no code answers
+	var sent controllers.LoginCodeResponseOK
+	status, _ := srv.post("/auth/code", `{"login":"nobody@example.com"}`, &sent)
+	require.Equal(t, 200, status)
+	require.NotEmpty(t, sent.ChallengeID)
+	status, problem := srv.post("/auth/code/login", `{"challenge_id":"`+sent.ChallengeID+`","code":"123456"}`, nil)
+	require.Equal(t, 401, status)
+	require.Equal(t, services.LoginChallengeInvalid.Code, problem.Code)
+
+	status, problem = srv.post("/auth/code", `{"login":"nobody@example.com","channel":"fax"}`, nil)
+	require.Equal(t, 400, status)
+	require.Equal(t, "one_of", problem.InvalidParams[0].Code)
+
+	status, _ = srv.post("/auth/password", `{"password":"password","confirm_password":"password"}`, nil)
+	require.Equal(t, 401, status)
+}
+
+func TestPasswordlessThrottlesForwardedClients(t *testing.T) {
+	cfg := &config.AppConfig{PasswordLifeTime: 1, TokenSecret: "secret"}
+	cfg.Passwordless = config.PasswordlessConfig{Enabled: true, MagicLinkLifetime: time.Hour, CodeLifetime: time.Hour,
+		MaxAttempts: 3, ClientLimit: 1, ClientWindow: time.Hour}
+	routes := func(userService *services.UserService, authService *services.AuthService) []controllers.GroupController {
+		return []controllers.GroupController{controllers.NewPasswordlessController(cfg, zap.NewNop(), authService, userService)}
+	}
+	requestCode := func(srv *testServer, forwardedFor string, login string) int {
+		srv.header.Set("X-Forwarded-For", forwardedFor)
+		status, _ := srv.post("/auth/code", `{"login":"`+login+`"}`, nil)
+		return status
+	}
+
+	// requests of fiber's test connection come from 0.0.0.0, the proxy here
+	srv := newTestServerWith(t, cfg, &config.WebServerConfig{ProxyHeader: "X-Forwarded-For", TrustedProxies: []string{"0.0.0.0"}}, routes)
+	require.Equal(t, 200, requestCode(srv, "203.0.113.5", "first@example.com"))
+	require.Equal(t, 429, requestCode(srv, "203.0.113.5, 0.0.0.0", "second@example.com"))
+	require.Equal(t, 200, requestCode(srv, "203.0.113.6", "third@example.com"))
+
+	// the header of a proxy that is not trusted is ignored, so its clients share its address
+	srv = newTestServerWith(t, cfg, &config.WebServerConfig{ProxyHeader: "X-Forwarded-For", TrustedProxies: []string{"192.0.2.1"}}, routes)
+	require.Equal(t, 200, requestCode(srv, "203.0.113.5", "first@example.com"))
+	require.Equal(t, 429, requestCode(srv, "203.0.113.6", "second@example.com"))
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+	"net/http"
+	"strings"
+	"tutorial-auth/internal/i18n"
+	"tutorial-auth/internal/services"
+	"tutorial-auth/internal/transport"
+	"tutorial-auth/pkg/logging"
+)
+
+var kindStatus = map[services.ErrorKind]int{
+	services.KindInternal:           fiber.StatusInternalServerError,
+	services.KindValidation:         fiber.StatusBadRequest,
+	services.KindInvalidCredentials: fiber.StatusUnauthorized,
+	services.KindConflict:           fiber.StatusConflict,
+	services.KindLocked:             fiber.StatusLocked,
+	services.KindExpired:            fiber.StatusUnauthorized,
+	services.KindTimeout:            fiber.StatusGatewayTimeout,
+	services.KindNotFound:           fiber.StatusNotFound,
+	services.KindForbidden:          fiber.StatusForbidden,
+	services.KindRateLimited:        fiber.StatusTooManyRequests,
+}
+
+// ErrorHandler writes every error returned by a handler as problem+json. Internal errors are
+// logged with their cause, and clients only see the generic message of the error code.
+// Detail and the reasons of invalid params are translated into the locale of the request,
+// while codes stay the same in every locale.
+func ErrorHandler(logger *zap.Logger, translator *i18n.Translator) fiber.ErrorHandler {
+	const op = "server.ErrorHandler"
+
+	return func(fc *fiber.Ctx, err error) error {
+		problem := transport.Problem{Instance: fc.OriginalURL()}
+		var locale string
+		if translator != nil {
+			locale = translator.RequestLocale(fc)
+			fc.Set(fiber.HeaderContentLanguage, locale)
+		}
+
+		var fiberErr *fiber.Error
+		if errors.As(err, &fiberErr) {
+			problem.Status = fiberErr.Code
+			problem.Code = strings.ReplaceAll(strings.ToLower(http.StatusText(fiberErr.Code)), " ", "_")
+			problem.Detail = fiberErr.Message
+		} else {
+			serviceErr := services.AsError(err)
+			problem.Status = kindStatus[serviceErr.Kind]
+			problem.Code = serviceErr.Code
+			problem.Detail = translator.Text(locale, "error."+serviceErr.Code, nil, serviceErr.Message)
+			problem.InvalidParams = make([]services.InvalidParam, len(serviceErr.InvalidParams))
+			for i, param := range serviceErr.InvalidParams {
+				param.Reason = translator.Text(locale, "validation."+param.Code, param.Params, param.Reason)
+				problem.InvalidParams[i] = param
+			}
+
+			if serviceErr.Kind == services.KindInternal || serviceErr.Kind == services.KindTimeout {
+				logging.WithContext(fc.UserContext(), logger).Error("request failed", zap.String("op", op), zap.String("path", fc.Path()),
+					zap.String("code", serviceErr.Code), zap.Error(err))
+			} else {
+				logging.WithContext(fc.UserContext(), logger).Info("request rejected", zap.String("op", op), zap.String("path", fc.Path()),
+					zap.String("code", serviceErr.Code))
+			}
+		}
+		problem.Type = "urn:go-auth:problem:" + problem.Code
+		problem.Title = http.StatusText(problem.Status)
+
+		body, err := json.Marshal(problem)
+		if err != nil {
+			return err
+		}
+		fc.Set(fiber.HeaderContentType, transport.ProblemContentType)
+		return fc.Status(problem.Status).Send(body)
+	}
+}
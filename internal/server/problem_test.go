@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"tutorial-auth/internal/i18n"
+	"tutorial-auth/internal/services"
+	"tutorial-auth/internal/transport"
+)
+
+func TestErrorHandler(t *testing.T) {
+	testCases := []struct {
+		Err    error
+		Status int
+		Code   string
+		Detail string
+	}{
+		{Err: services.LoginOrPasswordInvalid, Status: 401, Code: "invalid_credentials", Detail: "login or password invalid"},
+		{Err: services.UserAlreadyExistsError, Status: 409, Code: "user_already_exists", Detail: "user already exists"},
+		{Err: services.RegistrationNotCompleted, Status: 423, Code: "registration_pending", Detail: "registration is not completed"},
+		{Err: services.RefreshTokenExpired, Status: 401, Code: "refresh_token_expired", Detail: "refresh token expired"},
+		{Err: services.ValidationFailed("invalid", services.InvalidParam{Name: "id", Code: "required", Reason: "required"}), Status: 400, Code: "validation_failed", Detail: "request validation failed"},
+		{Err: errors.New("sql: no rows in result set"), Status: 500, Code: "internal_error", Detail: "internal error"},
+		{Err: fmt.Errorf("find user: %w", context.DeadlineExceeded), Status: 504, Code: "timeout", Detail: "request timed out"},
+		{Err: fiber.ErrNotFound, Status: 404, Code: "not_found", Detail: "Cannot GET /missing"},
+	}
+
+	translator, err := i18n.NewTranslator("en")
+	require.NoError(t, err)
+
+	for _, testCase := range testCases {
+		app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler(zap.NewNop(), translator)})
+		err := testCase.Err
+		app.Post("/fail", func(c *fiber.Ctx) error { return err })
+
+		path := "/fail"
+		method := "POST"
+		if errors.Is(err, fiber.ErrNotFound) {
+			path, method = "/missing", "GET"
+		}
+		resp, testErr := app.Test(httptest.NewRequest(method, path, nil))
+		require.NoError(t, testErr)
+		require.Equal(t, testCase.Status, resp.StatusCode)
+		require.Equal(t, "application/problem+json", resp.Header.Get("Content-Type"))
+
+		var problem transport.Problem
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&problem))
+		require.Equal(t, testCase.Status, problem.Status)
+		require.Equal(t, testCase.Code, problem.Code)
+		require.Equal(t, testCase.Detail, problem.Detail)
+		require.True(t, strings.HasSuffix(problem.Type, testCase.Code))
+	}
+}
+
+func TestErrorHandlerLocalization(t *testing.T) {
+	translator, err := i18n.NewTranslator("en")
+	require.NoError(t, err)
+
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler(zap.NewNop(), translator)})
+	app.Post("/invalid", func(c *fiber.Ctx) error {
+		return services.ValidationFailed("request validation failed", services.InvalidParam{
+			Name: "password", Code: "password_policy", Reason: "too short", Params: map[string]any{"min": 8, "max": 72},
+		})
+	})
+	app.Post("/expired", func(c *fiber.Ctx) error {
+		i18n.SetUserLocale(c, map[string]any{"locale": "ru"})
+		return services.PasswordExpired
+	})
+
+	req := httptest.NewRequest("POST", "/invalid", nil)
+	req.Header.Set("Accept-Language", "ru-RU,ru;q=0.9,en;q=0.8")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, "ru", resp.Header.Get("Content-Language"))
+	var problem transport.Problem
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&problem))
+	require.Equal(t, "validation_failed", problem.Code)
+	require.Equal(t, "запрос не прошёл проверку", problem.Detail)
+	require.Equal(t, "password_policy", problem.InvalidParams[0].Code)
+	require.Equal(t, "должен быть не короче 8 символов и не длиннее 72 байт", problem.InvalidParams[0].Reason)
+
+	// the stored preference of the user wins over the header
+	req = httptest.NewRequest("POST", "/expired", nil)
+	req.Header.Set("Accept-Language", "en")
+	resp, err = app.Test(req)
+	require.NoError(t, err)
+	problem = transport.Problem{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&problem))
+	require.Equal(t, "password_expired", problem.Code)
+	require.Equal(t, "срок действия пароля истёк", problem.Detail)
+}
@@ -1,38 +1,126 @@
 package server
 
 import (
+	"bytes"
+	"context"
+	_ "embed"
 	"fmt"
 	"github.com/gofiber/fiber/v2"
-	"github.com/jmoiron/sqlx"
+	"github.com/gofiber/fiber/v2/middleware/filesystem"
+	"github.com/gofiber/fiber/v2/utils"
+	swaggerFiles "github.com/swaggo/files/v2"
 	"go.uber.org/zap"
+	"html/template"
+	"net/http"
 	"reflect"
+	"strings"
 	"time"
+	"tutorial-auth/internal/audit"
 	"tutorial-auth/internal/config"
-	"tutorial-auth/internal/mongodb"
+	"tutorial-auth/internal/i18n"
 	"tutorial-auth/internal/server/controllers"
-	"tutorial-auth/internal/services"
 )
 
+//go:embed swagger.html
+var swaggerPage string
+
+var swaggerTemplate = template.Must(template.New("swagger").Parse(swaggerPage))
+
 type WebServer struct {
 	log    *zap.Logger
 	cfg    *config.WebServerConfig
 	client *fiber.App
+	groups []controllers.GroupController
+	ctx    context.Context // of every request; cancelled once Shutdown stops waiting for them
+	cancel context.CancelFunc
 }
 
-func NewWebServer(logger *zap.Logger, cfg *config.WebServerConfig) *WebServer {
-	return &WebServer{
-		log: logger,
-		cfg: cfg,
+func NewWebServer(logger *zap.Logger, cfg *config.WebServerConfig, translator *i18n.Translator) *WebServer {
+	ctx, cancel := context.WithCancel(context.Background())
+	ws := &WebServer{
+		log:    logger,
+		cfg:    cfg,
+		ctx:    ctx,
+		cancel: cancel,
 		client: fiber.New(fiber.Config{
 			ReadTimeout:  15 * time.Second,
 			WriteTimeout: 15 * time.Second,
 			IdleTimeout:  60 * time.Second,
 			AppName:      "My App v1.0.0",
+			ErrorHandler: ErrorHandler(logger, translator),
+			// the client address is taken from the proxy header only for requests of trusted proxies,
+			// and is the first valid address of a header that lists several
+			ProxyHeader:             cfg.ProxyHeader,
+			EnableTrustedProxyCheck: true,
+			TrustedProxies:          cfg.TrustedProxies,
+			EnableIPValidation:      true,
 		}),
 	}
+	ws.client.Use(ws.contextMiddleware(), instrumentMiddleware(), clientMiddleware())
+	ws.client.Get(openAPIPath, ws.openAPIHandler())
+	if cfg.SwaggerUI {
+		ws.client.Get(swaggerUIPath, ws.swaggerUIHandler())
+		// the swagger-ui-dist files are embedded, so the page works without access to a CDN
+		ws.client.Use(swaggerUIAssetsPath, filesystem.New(filesystem.Config{Root: http.FS(swaggerFiles.FS)}))
+	}
+	return ws
+}
+
+// contextMiddleware starts the user context of every request from the context of the server, so
+// that operations still running when Shutdown gives up on them are cancelled. fasthttp does not
+// report clients that disconnect, so their requests run on until the operation times out.
+func (ws *WebServer) contextMiddleware() fiber.Handler {
+	return func(fc *fiber.Ctx) error {
+		fc.SetUserContext(ws.ctx)
+		return fc.Next()
+	}
+}
+
+// clientMiddleware attributes the audit events and throttling of a request to the address and the
+// user agent of the client. Behind a reverse proxy the address is that of the proxy header, see
+// WebServerConfig.TrustedProxies.
+func clientMiddleware() fiber.Handler {
+	return func(fc *fiber.Ctx) error {
+		fc.SetUserContext(audit.WithClient(fc.UserContext(), audit.Client{
+			IP:        fc.IP(),
+			UserAgent: utils.CopyString(fc.Get(fiber.HeaderUserAgent)),
+		}))
+		return fc.Next()
+	}
+}
+
+// OpenAPI describes the routes registered so far.
+func (ws *WebServer) OpenAPI() *OpenAPI {
+	return BuildOpenAPI(ws.groups)
+}
+
+func (ws *WebServer) openAPIHandler() func(fc *fiber.Ctx) error {
+	return func(fc *fiber.Ctx) error {
+		return fc.JSON(ws.OpenAPI())
+	}
+}
+
+func (ws *WebServer) swaggerUIHandler() func(fc *fiber.Ctx) error {
+	return func(fc *fiber.Ctx) error {
+		var page bytes.Buffer
+		assets := strings.TrimSuffix(ws.cfg.SwaggerUIAssets, "/")
+		if assets == "" {
+			assets = swaggerUIAssetsPath
+		}
+		err := swaggerTemplate.Execute(&page, struct{ Assets, Spec string }{
+			Assets: assets,
+			Spec:   openAPIPath,
+		})
+		if err != nil {
+			return err
+		}
+		fc.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+		return fc.Send(page.Bytes())
+	}
 }
 
 func (ws *WebServer) RegisterRoutes(routes []controllers.GroupController) {
+	ws.groups = append(ws.groups, routes...)
 	for _, route := range routes {
 		group := ws.client.Group(route.GetGroup())
 		for _, handler := range route.GetHandlers() {
@@ -47,6 +135,8 @@ func (ws *WebServer) RegisterRoutes(routes []controllers.GroupController) {
 				group.Patch(handler.GetPath(), handler.GetHandler())
 			case "DELETE":
 				group.Delete(handler.GetPath(), handler.GetHandler())
+			case "ALL":
+				group.All(handler.GetPath(), handler.GetHandler())
 			default:
 				ws.log.Error(
 					"unsupported HTTP method",
@@ -59,13 +149,15 @@ func (ws *WebServer) RegisterRoutes(routes []controllers.GroupController) {
 	}
 }
 
-func (ws *WebServer) Run(cfg *config.AppConfig, logger *zap.Logger, mongoClient *mongodb.MongoDB, db *sqlx.DB) {
-	ws.RegisterRoutes([]controllers.GroupController{
-		controllers.NewAuthController(
-			cfg,
-			logger,
-			services.NewAuthService(cfg, logger, services.NewUserService(logger, mongoClient, db)),
-		),
-	})
-	ws.client.Listen(fmt.Sprintf(":%d", ws.cfg.Port))
+// Run serves HTTP until Shutdown is called.
+func (ws *WebServer) Run() error {
+	return ws.client.Listen(fmt.Sprintf(":%d", ws.cfg.Port))
+}
+
+// Shutdown stops accepting connections and waits for in-flight requests until ctx is done, when
+// the contexts of the requests still running are cancelled.
+func (ws *WebServer) Shutdown(ctx context.Context) error {
+	stop := context.AfterFunc(ctx, ws.cancel)
+	defer stop()
+	return ws.client.ShutdownWithContext(ctx)
 }
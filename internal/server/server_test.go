@@ -0,0 +1,174 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"tutorial-auth/internal/config"
+	"tutorial-auth/internal/metrics"
+	"tutorial-auth/internal/metrics/metricstest"
+	"tutorial-auth/internal/server/controllers"
+	"tutorial-auth/internal/services"
+)
+
+type slowController struct {
+	started   chan struct{}
+	cancelled chan struct{}
+}
+
+func (c *slowController) GetGroup() string {
+	return ""
+}
+
+func (c *slowController) GetHandlers() []controllers.ControllerHandler {
+	return []controllers.ControllerHandler{&controllers.Handler{
+		Method: "GET", Path: "/slow",
+		Handler: func(fc *fiber.Ctx) error {
+			close(c.started)
+			time.Sleep(200 * time.Millisecond)
+			return fc.SendString("done")
+		},
+	}, &controllers.Handler{
+		Method: "GET", Path: "/stuck",
+		Handler: func(fc *fiber.Ctx) error {
+			close(c.started)
+			<-fc.UserContext().Done()
+			close(c.cancelled)
+			return fc.UserContext().Err()
+		},
+	}}
+}
+
+func TestShutdownDrainsRequests(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := listener.Addr().(*net.TCPAddr).Port
+	require.NoError(t, listener.Close())
+
+	ws := NewWebServer(zap.NewNop(), &config.WebServerConfig{Port: port}, nil)
+	ws.client.Server().DisableKeepalive = true
+	slow := &slowController{started: make(chan struct{})}
+	ws.RegisterRoutes([]controllers.GroupController{slow})
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- ws.Run() }()
+	require.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+		if err == nil {
+			conn.Close()
+		}
+		return err == nil
+	}, 2*time.Second, 10*time.Millisecond)
+
+	body := make(chan string, 1)
+	go func() {
+		resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/slow", port))
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		body <- string(data)
+	}()
+	<-slow.started
+
+	require.NoError(t, ws.Shutdown(context.Background()))
+	require.Equal(t, "done", <-body)
+	require.NoError(t, <-stopped)
+}
+
+func TestRequestMetrics(t *testing.T) {
+	ws := NewWebServer(zap.NewNop(), &config.WebServerConfig{}, nil)
+	ws.RegisterRoutes([]controllers.GroupController{controllers.NewForwardAuthController(
+		&config.AppConfig{TokenSecret: "secret"}, zap.NewNop(), services.NewAuthService(&config.AppConfig{TokenSecret: "secret"}, zap.NewNop(), nil))})
+
+	forwarded := metrics.HTTPRequestDuration.WithLabelValues("GET", "/auth/forward", "401")
+	unmatched := metrics.HTTPRequestDuration.WithLabelValues("GET", "unmatched", "404")
+	before := []uint64{metricstest.SampleCount(t, forwarded), metricstest.SampleCount(t, unmatched)}
+
+	for _, target := range []string{"/auth/forward", "/auth/forward?roles=admin", "/missing"} {
+		_, err := ws.client.Test(httptest.NewRequest("GET", target, nil))
+		require.NoError(t, err)
+	}
+	require.Equal(t, before[0]+2, metricstest.SampleCount(t, forwarded))
+	require.Equal(t, before[1]+1, metricstest.SampleCount(t, unmatched))
+}
+
+func TestRequestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	core, logs := observer.New(zap.InfoLevel)
+	cfg := &config.AppConfig{TokenSecret: "secret"}
+	ws := NewWebServer(zap.New(core), &config.WebServerConfig{}, nil)
+	ws.RegisterRoutes([]controllers.GroupController{
+		controllers.NewForwardAuthController(cfg, zap.NewNop(), services.NewAuthService(cfg, zap.NewNop(), nil)),
+	})
+
+	req := httptest.NewRequest("GET", "/auth/forward", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	resp, err := ws.client.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, 401, resp.StatusCode)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	span := spans[0]
+	require.Equal(t, "GET /auth/forward", span.Name())
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+	require.Equal(t, "00f067aa0ba902b7", span.Parent().SpanID().String())
+	require.Contains(t, span.Attributes(), semconv.HTTPResponseStatusCode(401))
+
+	entries := logs.FilterMessage("request rejected").All()
+	require.Len(t, entries, 1)
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", entries[0].ContextMap()["trace_id"])
+	require.Equal(t, span.SpanContext().SpanID().String(), entries[0].ContextMap()["span_id"])
+}
+
+func TestShutdownCancelsStuckRequests(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ws := NewWebServer(zap.NewNop(), &config.WebServerConfig{}, nil)
+	ws.client.Server().DisableKeepalive = true
+	stuck := &slowController{started: make(chan struct{}), cancelled: make(chan struct{})}
+	ws.RegisterRoutes([]controllers.GroupController{stuck})
+	go func() { _ = ws.client.Listener(listener) }()
+
+	go func() {
+		resp, err := http.Get(fmt.Sprintf("http://%s/stuck", listener.Addr()))
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-stuck.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	require.Error(t, ws.Shutdown(ctx))
+	select {
+	case <-stuck.cancelled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the request was not cancelled")
+	}
+}
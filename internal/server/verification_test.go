@@ -0,0 +1,34 @@
+package server
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"testing"
+	"time"
+	"tutorial-auth/internal/config"
+	"tutorial-auth/internal/server/controllers"
+	"tutorial-auth/internal/services"
+)
+
+func TestEmailVerificationEndpoints(t *testing.T) {
+	cfg := &config.AppConfig{PasswordLifeTime: 1, TokenSecret: "secret"}
+	cfg.EmailVerification = config.EmailVerificationConfig{Enabled: true, TokenLifetime: time.Hour, ResendInterval: time.Hour}
+	srv := newTestServer(t, cfg, func(userService *services.UserService, _ *services.AuthService) []controllers.GroupController {
+		return []controllers.GroupController{controllers.NewRegisterController(cfg, zap.NewNop(), userService)}
+	})
+
+	_, err := srv.userService.Register(context.Background(), &services.NewUser{Login: "user@example.com", Password: "password"})
+	require.NoError(t, err)
+
+	status, problem := srv.post("/auth/verify-email", `{"token":"garbage"}`, nil)
+	require.Equal(t, 401, status)
+	require.Equal(t, services.VerificationTokenInvalid.Code, problem.Code)
+
+	// a throttled resend answers as an unknown login does
+	status, _ = srv.post("/auth/verify-email/resend", `{"login":"user@example.com"}`, nil)
+	require.Equal(t, 200, status)
+
+	status, _ = srv.post("/auth/verify-email/resend", `{"login":"nobody@example.com"}`, nil)
+	require.Equal(t, 200, status)
+}
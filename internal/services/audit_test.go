@@ -0,0 +1,37 @@
+package services
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"testing"
+	"tutorial-auth/internal/audit"
+	"tutorial-auth/internal/database"
+)
+
+func TestAuditEvents(t *testing.T) {
+	ctx := audit.WithClient(context.Background(), audit.Client{IP: "192.0.2.1", UserAgent: "curl/8.0"})
+	us := newSqliteUserService(t, testConfig())
+	as := NewAuthService(us.cfg, zap.NewNop(), us)
+
+	user, err := us.Register(ctx, &NewUser{Login: "user@example.com", Password: "password"})
+	require.NoError(t, err)
+	require.ErrorIs(t, as.Login(ctx, "nobody@example.com", "password").Err, LoginOrPasswordInvalid)
+	result := as.Login(ctx, "user@example.com", "password")
+	require.NoError(t, result.Err)
+	require.NoError(t, as.Logout(context.Background(), user.GUID, result.RefreshToken))
+
+	events, err := database.NewAuditStore(us.dbClient).Range(ctx, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 4)
+	for i, expected := range []audit.Event{
+		{Type: audit.Registration, Actor: user.GUID, Subject: user.GUID, IP: "192.0.2.1", UserAgent: "curl/8.0", Result: audit.ResultSuccess},
+		{Type: audit.Login, Actor: "nobody@example.com", Subject: "nobody@example.com", IP: "192.0.2.1", UserAgent: "curl/8.0", Result: LoginOrPasswordInvalid.Code},
+		{Type: audit.Login, Actor: user.GUID, Subject: user.GUID, IP: "192.0.2.1", UserAgent: "curl/8.0", Result: audit.ResultSuccess},
+		{Type: audit.SessionRevoked, Actor: user.GUID, Subject: user.GUID, Result: audit.ResultSuccess},
+	} {
+		event := events[i]
+		require.Equal(t, expected, audit.Event{Type: event.Type, Actor: event.Actor, Subject: event.Subject,
+			IP: event.IP, UserAgent: event.UserAgent, Result: event.Result}, "event %d", i+1)
+	}
+}
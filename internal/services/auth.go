@@ -1,16 +1,22 @@
 package services
 
 import (
-	"fmt"
+	"context"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+	"slices"
 	"time"
+	"tutorial-auth/internal/audit"
 	"tutorial-auth/internal/config"
+	"tutorial-auth/internal/database"
+	"tutorial-auth/internal/metrics"
 	"tutorial-auth/internal/mongodb/models"
 	"tutorial-auth/pkg/authToken"
 )
 
-var LoginOrPasswordInvalid = fmt.Errorf("login or password invalid")
-var RefreshTokenExpired = fmt.Errorf("refresh token expired")
+// RoleAdmin is the role that grants access to the admin API.
+const RoleAdmin = "admin"
 
 type AuthService struct {
 	cfg         *config.AppConfig
@@ -23,6 +29,7 @@ type AuthResult struct {
 	RefreshToken string       `json:"refresh_token"`
 	User         *models.User `json:"user"`
 	Err          error        `json:"error"`
+	DeviceToken  string       `json:"-"` // for the client to present at its next login, see WithDeviceToken
 }
 
 func NewAuthService(cfg *config.AppConfig, logger *zap.Logger, userService *UserService) *AuthService {
@@ -33,23 +40,84 @@ func NewAuthService(cfg *config.AppConfig, logger *zap.Logger, userService *User
 	}
 }
 
-func (as *AuthService) Login(login string, password string) *AuthResult {
-	user, err := as.userService.GetByLogin(login)
-	if err != nil {
-		return &AuthResult{Err: err}
+func (as *AuthService) Login(ctx context.Context, login string, password string) *AuthResult {
+	ctx, span := tracer.Start(ctx, "AuthService.Login")
+	result, userID := as.authenticate(ctx, login, password)
+	endSpan(span, result.Err)
+	as.completeLogin(ctx, MethodPassword, login, userID, result)
+	return result
+}
+
+// completeLogin counts, assesses, records and audits a login attempt made with method by the user
+// userID, which is empty when the login is unknown.
+func (as *AuthService) completeLogin(ctx context.Context, method string, login string, userID string, result *AuthResult) {
+	metrics.Logins.WithLabelValues(resultOf(result.Err)).Inc()
+	if result.Err != nil {
+		if serviceErr := AsError(result.Err); serviceErr.Kind == KindLocked {
+			metrics.Lockouts.WithLabelValues(serviceErr.Code).Inc()
+		}
+	}
+
+	var assessment *Assessment
+	if result.Err == nil {
+		assessment = as.userService.monitor.Assess(ctx, result.User)
+		result.DeviceToken = assessment.DeviceToken
 	}
+	as.userService.history.Record(ctx, database.LoginAttempt{UserID: userID, Login: login, Method: method, Result: resultOf(result.Err)})
+	subject := login
+	if userID != "" {
+		subject = userID
+	}
+	as.userService.auditLog.Record(ctx, audit.Event{Type: audit.Login, Actor: subject, Subject: subject, Result: resultOf(result.Err)})
+	if assessment != nil {
+		as.userService.monitor.Alert(ctx, result.User, assessment)
+	}
+}
 
-	userPassword, err := as.userService.GetPassword(user.GUID)
+// authenticate also returns the ID of the user the login belongs to, which is known before the
+// password is checked and is never shown to the client.
+func (as *AuthService) authenticate(ctx context.Context, login string, password string) (*AuthResult, string) {
+	user, err := as.userService.GetByLogin(ctx, login)
 	if err != nil {
-		return &AuthResult{Err: err}
+		return &AuthResult{Err: err}, ""
+	}
+	if user == nil {
+		return &AuthResult{Err: LoginOrPasswordInvalid}, ""
 	}
 
-	valid := as.userService.CheckPasswordHash(password, userPassword)
+	userPassword, expiresAt, err := as.userService.GetPassword(ctx, user.GUID)
+	if isNotFound(err) {
+		return &AuthResult{Err: LoginOrPasswordInvalid}, user.GUID
+	} else if err != nil {
+		return &AuthResult{Err: err}, user.GUID
+	}
+
+	valid, err := as.userService.CheckPasswordHash(ctx, password, userPassword)
+	if err != nil {
+		return &AuthResult{Err: err}, user.GUID
+	}
 	if !valid {
-		return &AuthResult{Err: LoginOrPasswordInvalid}
+		return &AuthResult{Err: LoginOrPasswordInvalid}, user.GUID
 	}
+	// only tell that the registration is pending or the password has expired to someone who knows
+	// the password; the user is returned so that the error can be rendered in the language the
+	// user prefers
+	if !user.IsActive() {
+		return &AuthResult{Err: RegistrationNotCompleted, User: user}, user.GUID
+	}
+	if expiresAt.Before(time.Now()) {
+		return &AuthResult{Err: PasswordExpired, User: user}, user.GUID
+	}
+	return as.issue(ctx, user), user.GUID
+}
 
-	token, refreshToken, err := as.generateTokens(user)
+// issue logs in user, who has proven who they are, unless the address must be verified first.
+func (as *AuthService) issue(ctx context.Context, user *models.User) *AuthResult {
+	if !user.EmailVerified && as.userService.verifier.required() {
+		return &AuthResult{Err: EmailNotVerified, User: user}
+	}
+
+	token, refreshToken, err := as.generateTokens(ctx, user)
 	if err != nil {
 		return &AuthResult{Err: err}
 	}
@@ -62,18 +130,35 @@ func (as *AuthService) Login(login string, password string) *AuthResult {
 	}
 }
 
-func (as *AuthService) Refresh(guid string, rt string) *AuthResult {
-	user, err := as.userService.GetByGuid(guid)
-	if err != nil {
-		return &AuthResult{Err: err}
-	}
+func (as *AuthService) Refresh(ctx context.Context, guid string, rt string) *AuthResult {
+	ctx, span := tracer.Start(ctx, "AuthService.Refresh", trace.WithAttributes(attribute.String("user.id", guid)))
+	result := as.refresh(ctx, guid, rt)
+	endSpan(span, result.Err)
+	metrics.Refreshes.WithLabelValues(resultOf(result.Err)).Inc()
+	return result
+}
 
+func (as *AuthService) refresh(ctx context.Context, guid string, rt string) *AuthResult {
 	_, valid := authToken.VerifyToken(as.cfg.TokenSecret, rt)
 	if !valid {
 		return &AuthResult{Err: RefreshTokenExpired}
 	}
 
-	token, refreshToken, err := as.generateTokens(user)
+	user, err := as.userService.GetByGuid(ctx, guid)
+	if isNotFound(err) {
+		return &AuthResult{Err: RefreshTokenInvalid}
+	} else if err != nil {
+		return &AuthResult{Err: err}
+	}
+	// only the latest refresh token of the user is valid, so logging out or logging in again revokes it
+	if user.RefreshToken != rt {
+		return &AuthResult{Err: RefreshTokenInvalid}
+	}
+	if !user.IsActive() {
+		return &AuthResult{Err: RegistrationNotCompleted}
+	}
+
+	token, refreshToken, err := as.generateTokens(ctx, user)
 	if err != nil {
 		return &AuthResult{Err: err}
 	}
@@ -86,11 +171,67 @@ func (as *AuthService) Refresh(guid string, rt string) *AuthResult {
 	}
 }
 
-func (as *AuthService) generateTokens(user *models.User) (string, string, error) {
+// Logout revokes the refresh token of the user, provided it is the current one.
+func (as *AuthService) Logout(ctx context.Context, guid string, rt string) (err error) {
+	ctx, span := tracer.Start(ctx, "AuthService.Logout", trace.WithAttributes(attribute.String("user.id", guid)))
+	defer func() {
+		endSpan(span, err)
+		as.userService.auditLog.Record(ctx, audit.Event{Type: audit.SessionRevoked, Actor: guid, Subject: guid, Result: resultOf(err)})
+	}()
+
+	if _, valid := authToken.VerifyToken(as.cfg.TokenSecret, rt); !valid {
+		return RefreshTokenExpired
+	}
+
+	user, err := as.userService.GetByGuid(ctx, guid)
+	if isNotFound(err) {
+		return RefreshTokenInvalid
+	} else if err != nil {
+		return err
+	}
+	if user.RefreshToken != rt {
+		return RefreshTokenInvalid
+	}
+	return as.userService.UpdateRefreshToken(ctx, guid, "")
+}
+
+// VerifyToken checks an access token and returns the user it was issued to and when it expires.
+// Refresh tokens carry no user and are rejected.
+func (as *AuthService) VerifyToken(token string) (*authToken.UserTokenInfo, time.Time, error) {
+	claims, valid := authToken.VerifyTokenClaims(as.cfg.TokenSecret, token)
+	if !valid || claims.User == nil || claims.ExpiresAt == nil {
+		metrics.TokenVerifications.WithLabelValues(AccessTokenInvalid.Code).Inc()
+		return nil, time.Time{}, AccessTokenInvalid
+	}
+	metrics.TokenVerifications.WithLabelValues(metrics.ResultSuccess).Inc()
+	return claims.User, claims.ExpiresAt.Time, nil
+}
+
+// Authorize checks an access token for a forward-auth request and requires the user to have
+// every role in required.
+func (as *AuthService) Authorize(token string, required []string) (*authToken.UserTokenInfo, error) {
+	if token == "" {
+		return nil, AccessTokenInvalid
+	}
+	user, _, err := as.VerifyToken(token)
+	if err != nil {
+		return nil, err
+	}
+	for _, role := range required {
+		if !slices.Contains(user.Roles, role) {
+			return nil, AccessDenied
+		}
+	}
+	return user, nil
+}
+
+func (as *AuthService) generateTokens(ctx context.Context, user *models.User) (string, string, error) {
 	token, err := authToken.NewToken(as.cfg.TokenSecret, as.cfg.TokenExpirationTimeMinutes, &authToken.UserTokenInfo{
-		ID:    user.GUID,
-		Login: user.Login,
-		Name:  user.Name,
+		ID:            user.GUID,
+		Login:         user.Login,
+		Name:          user.Name,
+		Roles:         user.Roles(),
+		EmailVerified: user.EmailVerified,
 	})
 	if err != nil {
 		return "", "", err
@@ -101,7 +242,7 @@ func (as *AuthService) generateTokens(user *models.User) (string, string, error)
 		return "", "", err
 	}
 
-	if err = as.userService.UpdateRefreshTokenAndLastLoginAt(user.GUID, refreshToken); err != nil {
+	if err = as.userService.UpdateRefreshTokenAndLastLoginAt(ctx, user.GUID, refreshToken); err != nil {
 		return "", "", err
 	}
 
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"go.mongodb.org/mongo-driver/mongo"
+	"tutorial-auth/internal/metrics"
+)
+
+// ErrorKind classifies service errors; every transport maps kinds to its own status codes.
+type ErrorKind int
+
+const (
+	KindInternal ErrorKind = iota
+	KindValidation
+	KindInvalidCredentials
+	KindConflict
+	KindLocked
+	KindExpired
+	KindTimeout
+	KindNotFound
+	KindForbidden
+	KindRateLimited
+)
+
+// InvalidParam describes one rejected request field. Code names the failed rule and, together with
+// Params, is enough to render Reason in another language.
+type InvalidParam struct {
+	Name   string         `json:"name"`
+	Code   string         `json:"code"`
+	Reason string         `json:"reason"`
+	Params map[string]any `json:"params,omitempty"`
+}
+
+// Error is an error that is safe to show to clients. Code is stable and meant for programs,
+// Message is meant for people. The wrapped cause is only ever logged.
+type Error struct {
+	Kind          ErrorKind
+	Code          string
+	Message       string
+	InvalidParams []InvalidParam
+	cause         error
+}
+
+func NewError(kind ErrorKind, code string, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+func (e *Error) Error() string {
+	if e.cause != nil {
+		return e.Message + ": " + e.cause.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// Is matches errors of the same code, so errors.Is(err, LoginOrPasswordInvalid) holds for wrapped copies.
+func (e *Error) Is(target error) bool {
+	var t *Error
+	return errors.As(target, &t) && t.Code == e.Code
+}
+
+var (
+	LoginOrPasswordInvalid   = NewError(KindInvalidCredentials, "invalid_credentials", "login or password invalid")
+	RefreshTokenInvalid      = NewError(KindInvalidCredentials, "invalid_refresh_token", "refresh token invalid")
+	RefreshTokenExpired      = NewError(KindExpired, "refresh_token_expired", "refresh token expired")
+	AccessTokenInvalid       = NewError(KindInvalidCredentials, "invalid_token", "access token invalid or expired")
+	AccessDenied             = NewError(KindForbidden, "access_denied", "access denied")
+	PasswordExpired          = NewError(KindExpired, "password_expired", "password expired")
+	UserAlreadyExistsError   = NewError(KindConflict, "user_already_exists", "user already exists")
+	UserNotFound             = NewError(KindNotFound, "user_not_found", "user not found")
+	RegistrationNotCompleted = NewError(KindLocked, "registration_pending", "registration is not completed")
+	EmailNotVerified         = NewError(KindLocked, "email_not_verified", "email is not verified")
+	VerificationTokenInvalid = NewError(KindInvalidCredentials, "invalid_verification_token", "verification token invalid")
+	VerificationTokenExpired = NewError(KindExpired, "verification_token_expired", "verification token expired")
+	PasswordlessDisabled     = NewError(KindForbidden, "passwordless_disabled", "passwordless login is disabled")
+	LoginChallengeInvalid    = NewError(KindInvalidCredentials, "invalid_login_challenge", "login link or code invalid")
+	LoginChallengeExpired    = NewError(KindExpired, "login_challenge_expired", "login link or code expired")
+	TooManyAttempts          = NewError(KindRateLimited, "too_many_attempts", "too many attempts, request a new link or code")
+	ChallengesThrottled      = NewError(KindRateLimited, "login_challenges_throttled", "too many links or codes requested, try again later")
+	MalformedRequest         = NewError(KindValidation, "malformed_request", "request body is malformed")
+	OperationTimedOut        = NewError(KindTimeout, "timeout", "request timed out")
+	InternalError            = NewError(KindInternal, "internal_error", "internal error")
+)
+
+// ValidationFailed reports rejected request fields.
+func ValidationFailed(message string, params ...InvalidParam) *Error {
+	return &Error{Kind: KindValidation, Code: "validation_failed", Message: message, InvalidParams: params}
+}
+
+// AsError classifies err: service errors stay as they are, timeouts become OperationTimedOut
+// and everything else becomes InternalError. The original error is kept as the cause.
+func AsError(err error) *Error {
+	var serviceErr *Error
+	if errors.As(err, &serviceErr) {
+		return serviceErr
+	}
+
+	classified := *InternalError
+	if IsTimeout(err) {
+		classified = *OperationTimedOut
+	}
+	classified.cause = err
+	return &classified
+}
+
+// resultOf is the result label of metrics for an operation that ended with err.
+func resultOf(err error) string {
+	if err == nil {
+		return metrics.ResultSuccess
+	}
+	return AsError(err).Code
+}
+
+func isNotFound(err error) bool {
+	return errors.Is(err, mongo.ErrNoDocuments) || errors.Is(err, sql.ErrNoRows)
+}
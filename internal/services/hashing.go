@@ -0,0 +1,58 @@
+package services
+
+import (
+	"context"
+	"runtime"
+	"sync/atomic"
+	"time"
+	"tutorial-auth/internal/metrics"
+)
+
+// HashingPool bounds the number of concurrent bcrypt operations. bcrypt is CPU bound, so running
+// more of them than there are cores only makes every request slower; the others wait for a slot.
+type HashingPool struct {
+	slots   chan struct{}
+	waiting atomic.Int64
+}
+
+// HashingStats is a snapshot of the pool.
+type HashingStats struct {
+	Size    int   `json:"size"`
+	InUse   int   `json:"in_use"`
+	Waiting int64 `json:"waiting"`
+}
+
+// NewHashingPool makes a pool of size slots, or of one slot per CPU when size is not positive.
+func NewHashingPool(size int) *HashingPool {
+	if size <= 0 {
+		size = runtime.NumCPU()
+	}
+	return &HashingPool{slots: make(chan struct{}, size)}
+}
+
+// Do runs fn once a slot is free, or returns the error of ctx if it is done before then.
+func (p *HashingPool) Do(ctx context.Context, fn func()) error {
+	p.waiting.Add(1)
+	select {
+	case p.slots <- struct{}{}:
+		p.waiting.Add(-1)
+	case <-ctx.Done():
+		p.waiting.Add(-1)
+		return ctx.Err()
+	}
+	defer func() { <-p.slots }()
+	fn()
+	return nil
+}
+
+func (p *HashingPool) Stats() HashingStats {
+	return HashingStats{
+		Size:    cap(p.slots),
+		InUse:   len(p.slots),
+		Waiting: p.waiting.Load(),
+	}
+}
+
+func observeHashing(operation string, started time.Time) {
+	metrics.PasswordHashDuration.WithLabelValues(operation).Observe(time.Since(started).Seconds())
+}
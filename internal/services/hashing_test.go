@@ -0,0 +1,28 @@
+package services
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestHashingPoolAbandonedWait(t *testing.T) {
+	pool := NewHashingPool(1)
+	release := make(chan struct{})
+	go pool.Do(context.Background(), func() { <-release })
+	require.Eventually(t, func() bool { return pool.Stats().InUse == 1 }, time.Second, time.Millisecond)
+
+	// a caller whose context ends while it waits gives up its place without running fn
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	ran := false
+	err := pool.Do(ctx, func() { ran = true })
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.False(t, ran)
+	require.Equal(t, HashingStats{Size: 1, InUse: 1, Waiting: 0}, pool.Stats())
+
+	close(release)
+	require.NoError(t, pool.Do(context.Background(), func() { ran = true }))
+	require.True(t, ran)
+}
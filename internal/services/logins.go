@@ -0,0 +1,226 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/mssola/useragent"
+	"go.uber.org/zap"
+	"strings"
+	"time"
+	"tutorial-auth/internal/audit"
+	"tutorial-auth/internal/config"
+	"tutorial-auth/internal/database"
+	"tutorial-auth/internal/metrics"
+	"tutorial-auth/pkg/logging"
+)
+
+// Methods of login attempts.
+const (
+	MethodPassword  = "password"
+	MethodMagicLink = "magic_link"
+	MethodCode      = "code" // a one-time code sent by email or SMS
+)
+
+// ResultFailure selects every failed attempt in LoginHistoryQuery.Result.
+const ResultFailure = "failure"
+
+const (
+	defaultLoginHistoryLimit = 20
+	maxLoginHistoryLimit     = 100
+	purgeBatchSize           = 1000
+	purgeMaxBatches          = 100 // per run, so that a large backlog is purged over several runs
+)
+
+// LoginHistoryQuery selects a page of login attempts. Result is "success", ResultFailure or the
+// code of a failure; Cursor is the NextCursor of the previous page.
+type LoginHistoryQuery struct {
+	UserID string
+	From   time.Time
+	To     time.Time
+	Result string
+	Cursor string
+	Limit  int
+}
+
+type LoginHistoryPage struct {
+	Attempts   []database.LoginAttempt `json:"attempts"`
+	NextCursor string                  `json:"next_cursor,omitempty"`
+}
+
+// LoginHistory keeps every login attempt with the client it came from, so users can tell their
+// own logins from someone else's. Attempts older than the retention are purged.
+type LoginHistory struct {
+	cfg    *config.AppConfig
+	logger *zap.Logger
+	store  *database.LoginHistoryStore
+}
+
+func NewLoginHistory(cfg *config.AppConfig, logger *zap.Logger, db *sqlx.DB) *LoginHistory {
+	return &LoginHistory{
+		cfg:    cfg,
+		logger: logger,
+		store:  database.NewLoginHistoryStore(db),
+	}
+}
+
+// Record stores an attempt made by the client of ctx. Like audit events, it is stored even when
+// ctx has been cancelled, and a failure to store it does not fail the login.
+func (h *LoginHistory) Record(ctx context.Context, attempt database.LoginAttempt) {
+	const op = "services.LoginHistory.Record"
+
+	client := audit.ClientFrom(ctx)
+	attempt.ID = uuid.NewString()
+	attempt.IP = client.IP
+	attempt.UserAgent = client.UserAgent
+	attempt.Device, attempt.Browser, attempt.OS = describeUserAgent(client.UserAgent)
+	attempt.CreatedAt = time.Now()
+
+	ctx = context.WithoutCancel(ctx)
+	if h.cfg.Timeouts.Query > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.cfg.Timeouts.Query)
+		defer cancel()
+	}
+	if err := h.store.Insert(ctx, &attempt); err != nil {
+		logging.WithContext(ctx, h.logger).Error("failed to record login attempt", zap.String("op", op),
+			zap.String("guid", attempt.UserID), zap.Error(err))
+	}
+}
+
+// List returns a page of the attempts selected by query, newest first.
+func (h *LoginHistory) List(ctx context.Context, query *LoginHistoryQuery) (*LoginHistoryPage, error) {
+	filter := &database.LoginAttemptFilter{UserID: query.UserID, From: query.From, To: query.To, Limit: query.Limit}
+	if filter.Limit <= 0 {
+		filter.Limit = defaultLoginHistoryLimit
+	}
+	filter.Limit = min(filter.Limit, maxLoginHistoryLimit)
+	if query.Result == ResultFailure {
+		filter.ExcludeResult = metrics.ResultSuccess
+	} else {
+		filter.Result = query.Result
+	}
+	if query.Cursor != "" {
+		before, err := decodeLoginCursor(query.Cursor)
+		if err != nil {
+			return nil, ValidationFailed("request validation failed",
+				InvalidParam{Name: "cursor", Code: "cursor", Reason: "is not a cursor of this listing"})
+		}
+		filter.Before = before
+	}
+
+	// one more than asked for tells whether there is a next page
+	filter.Limit++
+	attempts, err := h.store.List(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	page := &LoginHistoryPage{Attempts: attempts}
+	if len(attempts) == filter.Limit {
+		page.Attempts = attempts[:len(attempts)-1]
+		page.NextCursor = encodeLoginCursor(&page.Attempts[len(page.Attempts)-1])
+	}
+	if page.Attempts == nil {
+		page.Attempts = []database.LoginAttempt{}
+	}
+	return page, nil
+}
+
+// Run purges expired attempts right away and then on every purge interval, until ctx is done.
+// Without a retention attempts are kept forever.
+func (h *LoginHistory) Run(ctx context.Context) {
+	if h.cfg.LoginHistory.Retention <= 0 {
+		return
+	}
+	ticker := time.NewTicker(h.cfg.LoginHistory.PurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		h.Purge(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Purge removes the attempts older than the retention, batch by batch, and returns how many it removed.
+func (h *LoginHistory) Purge(ctx context.Context) int {
+	const op = "services.LoginHistory.Purge"
+
+	before := time.Now().Add(-h.cfg.LoginHistory.Retention)
+	removed, err := purgeBatches(ctx, purgeBatchSize, purgeMaxBatches, func(ctx context.Context, limit int) (int, error) {
+		return h.store.DeleteBefore(ctx, before, limit)
+	})
+	if err != nil {
+		h.logger.Error("failed to purge login attempts", zap.String("op", op), zap.Error(err))
+	}
+	if removed > 0 {
+		h.logger.Info("purged login attempts", zap.String("op", op), zap.Int("removed", removed))
+	}
+	return removed
+}
+
+// purgeBatches calls deleteBatch until a batch of batchSize rows comes back short, or for
+// maxBatches batches, and leaves the rest to the next run. The stores delete the rows they select
+// by ID, so instances that purge at the same time do not fail; each one just deletes fewer.
+func purgeBatches(ctx context.Context, batchSize int, maxBatches int,
+	deleteBatch func(ctx context.Context, limit int) (int, error)) (removed int, err error) {
+	for i := 0; i < maxBatches && ctx.Err() == nil; i++ {
+		n, err := deleteBatch(ctx, batchSize)
+		removed += n
+		if err != nil || n < batchSize {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
+
+func encodeLoginCursor(last *database.LoginAttempt) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(last.CreatedAt.UTC().Format(time.RFC3339Nano) + " " + last.ID))
+}
+
+func decodeLoginCursor(cursor string) (*database.LoginAttempt, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+	createdAt, id, _ := strings.Cut(string(raw), " ")
+	last := &database.LoginAttempt{ID: id}
+	last.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt)
+	return last, err
+}
+
+// describeUserAgent parses a User-Agent header into the kind of device, the browser and the
+// operating system, for people to recognise their own logins.
+func describeUserAgent(header string) (device string, browser string, os string) {
+	if header == "" {
+		return "unknown", "", ""
+	}
+	ua := useragent.New(header)
+	name, version := ua.Browser()
+	browser = strings.TrimSpace(name + " " + version)
+	info := ua.OSInfo()
+	if info.Name == "OS" && ua.Platform() == "iPad" {
+		info.Name = "iPadOS"
+	}
+	os = info.Name + " " + info.Version
+
+	switch {
+	case ua.Bot():
+		device = "bot"
+	case ua.Platform() == "iPad" || strings.Contains(header, "Tablet"):
+		device = "tablet"
+	case ua.Mobile():
+		device = "mobile"
+	case info.Name == "":
+		// command line clients and libraries name no operating system
+		device = "unknown"
+	default:
+		device = "desktop"
+	}
+	return device, browser, strings.TrimSpace(os)
+}
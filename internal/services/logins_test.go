@@ -0,0 +1,117 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"testing"
+	"time"
+	"tutorial-auth/internal/audit"
+	"tutorial-auth/internal/config"
+	"tutorial-auth/internal/database"
+)
+
+const iPhoneSafari = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1"
+
+func TestLoginHistory(t *testing.T) {
+	ctx := audit.WithClient(context.Background(), audit.Client{IP: "198.51.100.7", UserAgent: iPhoneSafari})
+	us := newSqliteUserService(t, testConfig())
+	as := NewAuthService(us.cfg, zap.NewNop(), us)
+
+	user, err := us.Register(ctx, &NewUser{Login: "user@example.com", Password: "password"})
+	require.NoError(t, err)
+	require.NoError(t, as.Login(ctx, "user@example.com", "password").Err)
+	require.ErrorIs(t, as.Login(ctx, "user@example.com", "wrong").Err, LoginOrPasswordInvalid)
+	require.NoError(t, as.Login(ctx, "user@example.com", "password").Err)
+	require.ErrorIs(t, as.Login(ctx, "nobody@example.com", "password").Err, LoginOrPasswordInvalid)
+
+	// the failed attempt on the account belongs to the user, the one on an unknown login does not
+	page, err := us.history.List(ctx, &LoginHistoryQuery{UserID: user.GUID, Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, page.Attempts, 2)
+	require.Equal(t, LoginOrPasswordInvalid.Code, page.Attempts[1].Result)
+	attempt := page.Attempts[0]
+	require.Equal(t, "success", attempt.Result)
+	require.Equal(t, MethodPassword, attempt.Method)
+	require.Equal(t, "198.51.100.7", attempt.IP)
+	require.Equal(t, "mobile", attempt.Device)
+	require.Equal(t, "Safari 17.0", attempt.Browser)
+	require.Equal(t, "iPhone OS 17.0", attempt.OS)
+	require.NotEmpty(t, page.NextCursor)
+
+	page, err = us.history.List(ctx, &LoginHistoryQuery{UserID: user.GUID, Limit: 2, Cursor: page.NextCursor})
+	require.NoError(t, err)
+	require.Len(t, page.Attempts, 1)
+	require.Equal(t, "success", page.Attempts[0].Result)
+	require.Empty(t, page.NextCursor)
+
+	page, err = us.history.List(ctx, &LoginHistoryQuery{Result: ResultFailure})
+	require.NoError(t, err)
+	require.Len(t, page.Attempts, 2)
+	require.Equal(t, "nobody@example.com", page.Attempts[0].Login)
+	require.Empty(t, page.Attempts[0].UserID)
+
+	page, err = us.history.List(ctx, &LoginHistoryQuery{To: time.Now().Add(-time.Minute)})
+	require.NoError(t, err)
+	require.Empty(t, page.Attempts)
+
+	_, err = us.history.List(ctx, &LoginHistoryQuery{Cursor: "not a cursor"})
+	require.Equal(t, KindValidation, AsError(err).Kind)
+
+	// attempts past the retention are purged
+	require.NoError(t, us.history.store.Insert(ctx, &database.LoginAttempt{ID: "old", UserID: user.GUID, CreatedAt: time.Now().Add(-48 * time.Hour)}))
+	us.cfg.LoginHistory.Retention = 24 * time.Hour
+	require.Equal(t, 1, us.history.Purge(ctx))
+	page, err = us.history.List(ctx, &LoginHistoryQuery{})
+	require.NoError(t, err)
+	require.Len(t, page.Attempts, 4)
+}
+
+func TestPurgeBatches(t *testing.T) {
+	ctx := context.Background()
+	us := newSqliteUserService(t, &config.AppConfig{})
+	for i := 0; i < 7; i++ {
+		require.NoError(t, us.history.store.Insert(ctx, &database.LoginAttempt{ID: fmt.Sprint(i), CreatedAt: time.Now().Add(-time.Hour)}))
+	}
+	deleteBatch := func(ctx context.Context, limit int) (int, error) {
+		return us.history.store.DeleteBefore(ctx, time.Now(), limit)
+	}
+
+	// a run stops after its batches, and the next one goes on
+	removed, err := purgeBatches(ctx, 2, 2, deleteBatch)
+	require.NoError(t, err)
+	require.Equal(t, 4, removed)
+
+	// instances purging at the same time split the rows between them
+	results := make(chan int, 2)
+	for i := 0; i < cap(results); i++ {
+		go func() {
+			removed, err := purgeBatches(ctx, 1, 10, deleteBatch)
+			require.NoError(t, err)
+			results <- removed
+		}()
+	}
+	require.Equal(t, 3, <-results+<-results)
+	page, err := us.history.List(ctx, &LoginHistoryQuery{})
+	require.NoError(t, err)
+	require.Empty(t, page.Attempts)
+}
+
+func TestDescribeUserAgent(t *testing.T) {
+	for header, expected := range map[string][3]string{
+		"":           {"unknown", "", ""},
+		iPhoneSafari: {"mobile", "Safari 17.0", "iPhone OS 17.0"},
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/118.0.0.0 Safari/537.36": {
+			"desktop", "Chrome 118.0.0.0", "Windows 10"},
+		"Mozilla/5.0 (iPad; CPU OS 16_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.6 Mobile/15E148 Safari/604.1": {
+			"tablet", "Safari 16.6", "iPadOS 16.6"},
+		"Mozilla/5.0 (Linux; Android 13; SM-S911B) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/118.0.0.0 Mobile Safari/537.36": {
+			"mobile", "Chrome 118.0.0.0", "Android 13"},
+		"curl/8.4.0": {"unknown", "curl 8.4.0", ""},
+		"Googlebot/2.1 (+http://www.google.com/bot.html)": {"bot", "Googlebot", ""},
+	} {
+		device, browser, os := describeUserAgent(header)
+		require.Equal(t, expected, [3]string{device, browser, os}, header)
+	}
+}
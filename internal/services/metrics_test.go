@@ -0,0 +1,75 @@
+package services
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"testing"
+	"time"
+	"tutorial-auth/internal/metrics"
+	"tutorial-auth/internal/metrics/metricstest"
+	"tutorial-auth/internal/mongodb/models"
+)
+
+// counted returns how much fn adds to counter.
+func counted(counter prometheus.Counter, fn func()) float64 {
+	before := testutil.ToFloat64(counter)
+	fn()
+	return testutil.ToFloat64(counter) - before
+}
+
+func TestAuthMetrics(t *testing.T) {
+	ctx := context.Background()
+	us := newSqliteUserService(t, testConfig())
+	as := NewAuthService(us.cfg, zap.NewNop(), us)
+	hashes := metricstest.SampleCount(t, metrics.PasswordHashDuration.WithLabelValues("hash"))
+
+	require.Equal(t, 1.0, counted(metrics.Registrations.WithLabelValues(metrics.ResultSuccess), func() {
+		_, err := us.Register(ctx, &NewUser{Login: "user@example.com", Password: "password"})
+		require.NoError(t, err)
+	}))
+	require.Equal(t, 1.0, counted(metrics.Registrations.WithLabelValues(UserAlreadyExistsError.Code), func() {
+		_, err := us.Register(ctx, &NewUser{Login: "user@example.com", Password: "password"})
+		require.ErrorIs(t, err, UserAlreadyExistsError)
+	}))
+	require.Equal(t, hashes+1, metricstest.SampleCount(t, metrics.PasswordHashDuration.WithLabelValues("hash")))
+
+	var result *AuthResult
+	require.Equal(t, 1.0, counted(metrics.Logins.WithLabelValues(metrics.ResultSuccess), func() {
+		result = as.Login(ctx, "user@example.com", "password")
+		require.NoError(t, result.Err)
+	}))
+	require.Equal(t, 1.0, counted(metrics.Logins.WithLabelValues(LoginOrPasswordInvalid.Code), func() {
+		require.ErrorIs(t, as.Login(ctx, "user@example.com", "wrong").Err, LoginOrPasswordInvalid)
+	}))
+
+	// a pending registration is only told to someone who knows the password
+	require.NoError(t, us.users.Insert(ctx, &models.User{GUID: "pending", Login: "pending@example.com", Status: models.UserStatusPending, CreatedAt: time.Now()}))
+	require.ErrorIs(t, as.Login(ctx, "pending@example.com", "password").Err, LoginOrPasswordInvalid)
+	require.NoError(t, us.outbox.Start(ctx, "pending", "pending@example.com"))
+	hash, err := us.HashPassword(ctx, "password")
+	require.NoError(t, err)
+	require.NoError(t, us.outbox.WriteCredential(ctx, "pending", hash, time.Now().Add(time.Hour)))
+	require.ErrorIs(t, as.Login(ctx, "pending@example.com", "wrong").Err, LoginOrPasswordInvalid)
+	require.Equal(t, 1.0, counted(metrics.Lockouts.WithLabelValues(RegistrationNotCompleted.Code), func() {
+		require.ErrorIs(t, as.Login(ctx, "pending@example.com", "password").Err, RegistrationNotCompleted)
+	}))
+
+	require.Equal(t, 1.0, counted(metrics.TokenVerifications.WithLabelValues(metrics.ResultSuccess), func() {
+		_, _, err := as.VerifyToken(result.Token)
+		require.NoError(t, err)
+	}))
+	require.Equal(t, 1.0, counted(metrics.TokenVerifications.WithLabelValues(AccessTokenInvalid.Code), func() {
+		_, _, err := as.VerifyToken(result.RefreshToken)
+		require.ErrorIs(t, err, AccessTokenInvalid)
+	}))
+
+	require.Equal(t, 1.0, counted(metrics.Refreshes.WithLabelValues(metrics.ResultSuccess), func() {
+		require.NoError(t, as.Refresh(ctx, result.User.GUID, result.RefreshToken).Err)
+	}))
+	require.Equal(t, 1.0, counted(metrics.Refreshes.WithLabelValues(RefreshTokenInvalid.Code), func() {
+		require.ErrorIs(t, as.Refresh(ctx, result.User.GUID, result.RefreshToken).Err, RefreshTokenInvalid)
+	}))
+}
@@ -0,0 +1,279 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/mssola/useragent"
+	"go.uber.org/zap"
+	"strings"
+	"time"
+	"tutorial-auth/internal/audit"
+	"tutorial-auth/internal/config"
+	"tutorial-auth/internal/database"
+	"tutorial-auth/internal/metrics"
+	"tutorial-auth/internal/mongodb/models"
+	"tutorial-auth/internal/notify"
+	"tutorial-auth/internal/risk"
+	"tutorial-auth/pkg/logging"
+)
+
+// maxRiskHistory bounds the earlier logins that the risk rules compare a login with.
+const maxRiskHistory = 200
+
+type deviceTokenKey struct{}
+
+// WithDeviceToken returns a context for a login from the device that presented token, such as in a cookie.
+func WithDeviceToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, deviceTokenKey{}, token)
+}
+
+func deviceTokenFrom(ctx context.Context) string {
+	token, _ := ctx.Value(deviceTokenKey{}).(string)
+	return token
+}
+
+// LoginMonitor recognises the devices users log in from and checks successful logins against the
+// risk rules. A flagged login is audited and the user is notified of it.
+//
+// A device is recognised only by the long-lived token it was given at its first login. A user agent
+// is easy to imitate, so clients that present no known token, because they keep no cookies or have
+// cleared them, log in from a new device and are given a new token.
+type LoginMonitor struct {
+	cfg      *config.AppConfig
+	logger   *zap.Logger
+	devices  *database.DeviceStore
+	history  *database.LoginHistoryStore
+	auditLog *audit.Log
+	notifier notify.Notifier
+	geo      *risk.GeoIP
+}
+
+func NewLoginMonitor(cfg *config.AppConfig, logger *zap.Logger, db *sqlx.DB, auditLog *audit.Log) *LoginMonitor {
+	return &LoginMonitor{
+		cfg:      cfg,
+		logger:   logger,
+		devices:  database.NewDeviceStore(db),
+		history:  database.NewLoginHistoryStore(db),
+		auditLog: auditLog,
+		notifier: notify.NewLogNotifier(logger),
+	}
+}
+
+// SetGeoIP enables the impossible travel rule. It is called before the monitor is used.
+func (m *LoginMonitor) SetGeoIP(geo *risk.GeoIP) {
+	m.geo = geo
+}
+
+// SetNotifier replaces the notifier, which logs notifications by default. It is called before the
+// monitor is used.
+func (m *LoginMonitor) SetNotifier(notifier notify.Notifier) {
+	m.notifier = notifier
+}
+
+func (m *LoginMonitor) engine() *risk.Engine {
+	alerts := m.cfg.LoginAlerts
+	rules := []risk.Rule{risk.NewDeviceRule(), risk.NewNetworkRule()}
+	if m.geo != nil {
+		rules = append(rules, risk.ImpossibleTravelRule(m.geo, alerts.MaxTravelSpeed))
+	}
+	rules = append(rules, risk.UnusualHoursRule(alerts.UnusualHoursMinLogins))
+	return risk.NewEngine(rules...)
+}
+
+// Assessment is the outcome of checking a successful login. DeviceToken is for the client to keep,
+// empty when login alerts are disabled.
+type Assessment struct {
+	DeviceToken string
+	Login       *risk.Login
+	Flags       []risk.Flag
+}
+
+// Assess recognises the device of a successful login of user by the client of ctx and runs the
+// risk rules. It is called before the attempt is recorded, for the rules to compare the login with
+// earlier ones only. Like the login history, it goes on when ctx has been cancelled, and a failure
+// does not fail the login: the login is then not flagged, so as not to alert users wrongly.
+func (m *LoginMonitor) Assess(ctx context.Context, user *models.User) *Assessment {
+	const op = "services.LoginMonitor.Assess"
+
+	if m.cfg == nil || !m.cfg.LoginAlerts.Enabled {
+		return &Assessment{}
+	}
+	ctx = context.WithoutCancel(ctx)
+	if m.cfg.Timeouts.Query > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.cfg.Timeouts.Query)
+		defer cancel()
+	}
+	logger := logging.WithContext(ctx, m.logger)
+
+	client := audit.ClientFrom(ctx)
+	login := &risk.Login{UserID: user.GUID, IP: client.IP, Time: time.Now()}
+	token, known, err := m.recognize(ctx, user.GUID, deviceTokenFrom(ctx), client.UserAgent, login.Time)
+	if err != nil {
+		logger.Error("failed to recognise device", zap.String("op", op), zap.String("guid", user.GUID), zap.Error(err))
+		return &Assessment{DeviceToken: deviceTokenFrom(ctx)}
+	}
+	login.KnownDevice = known
+
+	attempts, err := m.history.List(ctx, &database.LoginAttemptFilter{
+		UserID: user.GUID,
+		From:   login.Time.Add(-m.cfg.LoginAlerts.HistoryWindow),
+		Result: metrics.ResultSuccess,
+		Limit:  maxRiskHistory,
+	})
+	if err != nil {
+		logger.Error("failed to load login history", zap.String("op", op), zap.String("guid", user.GUID), zap.Error(err))
+		return &Assessment{DeviceToken: token}
+	}
+	for _, attempt := range attempts {
+		login.History = append(login.History, risk.Attempt{IP: attempt.IP, Time: attempt.CreatedAt})
+	}
+	return &Assessment{DeviceToken: token, Login: login, Flags: m.engine().Evaluate(login)}
+}
+
+// recognize returns the token of the device of a login and whether the device is known to the user.
+// A device that presents no known token is stored as a new one, and never takes over another.
+func (m *LoginMonitor) recognize(ctx context.Context, userID string, token string, userAgent string,
+	now time.Time) (string, bool, error) {
+	fingerprint, description := fingerprintUserAgent(userAgent)
+	if token != "" {
+		device, err := m.devices.Find(ctx, userID, hashDeviceToken(token))
+		if err == nil {
+			device.Fingerprint = fingerprint
+			device.Description = description
+			device.LastSeenAt = now
+			return token, true, m.devices.Touch(ctx, device)
+		} else if !isNotFound(err) {
+			return "", false, err
+		}
+	}
+
+	// an unknown token is replaced too, so that clients cannot choose their own
+	token, err := newDeviceToken()
+	if err != nil {
+		return "", false, err
+	}
+	return token, false, m.devices.Insert(ctx, &database.Device{
+		ID:          uuid.NewString(),
+		UserID:      userID,
+		TokenHash:   hashDeviceToken(token),
+		Fingerprint: fingerprint,
+		Description: description,
+		CreatedAt:   now,
+		LastSeenAt:  now,
+	})
+}
+
+// Run purges the devices unseen for longer than the retention right away and then on every purge
+// interval of the login history, until ctx is done. Without a retention devices are kept forever.
+func (m *LoginMonitor) Run(ctx context.Context) {
+	if !m.cfg.LoginAlerts.Enabled || m.cfg.LoginAlerts.DeviceRetention <= 0 {
+		return
+	}
+	ticker := time.NewTicker(m.cfg.LoginHistory.PurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		m.Purge(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Purge removes the devices unseen for longer than the retention, batch by batch, and returns how
+// many it removed. A client of a removed device logs in from a new device the next time.
+func (m *LoginMonitor) Purge(ctx context.Context) int {
+	const op = "services.LoginMonitor.Purge"
+
+	before := time.Now().Add(-m.cfg.LoginAlerts.DeviceRetention)
+	removed, err := purgeBatches(ctx, purgeBatchSize, purgeMaxBatches, func(ctx context.Context, limit int) (int, error) {
+		return m.devices.DeleteUnseenSince(ctx, before, limit)
+	})
+	if err != nil {
+		m.logger.Error("failed to purge devices", zap.String("op", op), zap.Error(err))
+	}
+	if removed > 0 {
+		m.logger.Info("purged devices", zap.String("op", op), zap.Int("removed", removed))
+	}
+	return removed
+}
+
+// Alert audits a login that the assessment has flagged, after the login itself, and notifies the
+// user of it. Logins that were not flagged are left alone.
+func (m *LoginMonitor) Alert(ctx context.Context, user *models.User, assessment *Assessment) {
+	const op = "services.LoginMonitor.Alert"
+
+	if len(assessment.Flags) == 0 {
+		return
+	}
+	login := assessment.Login
+	rules := risk.Rules(assessment.Flags)
+	for _, rule := range rules {
+		metrics.SuspiciousLogins.WithLabelValues(rule).Inc()
+	}
+	m.auditLog.Record(ctx, audit.Event{
+		Type:    audit.SuspiciousLogin,
+		Actor:   user.GUID,
+		Subject: user.GUID,
+		Result:  audit.ResultSuccess,
+		Detail:  strings.Join(rules, ","),
+	})
+
+	_, device := fingerprintUserAgent(audit.ClientFrom(ctx).UserAgent)
+	data := map[string]any{"time": login.Time, "ip": login.IP, "device": device, "flags": assessment.Flags}
+	if location, ok := m.geo.Locate(login.IP); ok {
+		data["location"] = location.String()
+	}
+	locale, _ := user.Attributes["locale"].(string)
+	tenant, _ := user.Attributes["tenant"].(string)
+	err := m.notifier.Notify(ctx, &notify.Notification{
+		Channel:  notify.ChannelEmail,
+		Template: notify.SuspiciousLogin,
+		UserID:   user.GUID,
+		To:       user.Login,
+		Locale:   locale,
+		Tenant:   tenant,
+		Data:     data,
+	})
+	if err != nil {
+		logging.WithContext(ctx, m.logger).Error("failed to notify of suspicious login", zap.String("op", op),
+			zap.String("guid", user.GUID), zap.Error(err))
+	}
+}
+
+// fingerprintUserAgent returns the fingerprint of a User-Agent header, which leaves out versions
+// so that it survives updates of the browser, and a description of the device for people.
+func fingerprintUserAgent(header string) (fingerprint string, description string) {
+	kind, browser, os := describeUserAgent(header)
+	ua := useragent.New(header)
+	name, _ := ua.Browser()
+	sum := sha256.Sum256([]byte(kind + "\n" + name + "\n" + ua.OSInfo().Name))
+
+	description = browser
+	if os != "" {
+		description += " on " + os
+	}
+	return hex.EncodeToString(sum[:]), strings.TrimSpace(description)
+}
+
+func newDeviceToken() (string, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
+
+func hashDeviceToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
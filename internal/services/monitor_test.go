@@ -0,0 +1,107 @@
+package services
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"testing"
+	"time"
+	"tutorial-auth/internal/audit"
+	"tutorial-auth/internal/config"
+	"tutorial-auth/internal/database"
+	"tutorial-auth/internal/notify"
+	"tutorial-auth/internal/risk"
+)
+
+const windowsChrome = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+
+type recordingNotifier struct {
+	notifications []*notify.Notification
+}
+
+func (n *recordingNotifier) Notify(_ context.Context, notification *notify.Notification) error {
+	n.notifications = append(n.notifications, notification)
+	return nil
+}
+
+func TestLoginMonitor(t *testing.T) {
+	cfg := testConfig()
+	cfg.LoginAlerts = config.LoginAlertsConfig{Enabled: true, HistoryWindow: 24 * time.Hour}
+	us := newSqliteUserService(t, cfg)
+	notifier := &recordingNotifier{}
+	us.monitor.SetNotifier(notifier)
+	as := NewAuthService(us.cfg, zap.NewNop(), us)
+
+	laptop := audit.WithClient(context.Background(), audit.Client{IP: "198.51.100.7", UserAgent: windowsChrome})
+	user, err := us.Register(laptop, &NewUser{Login: "user@example.com", Password: "password"})
+	require.NoError(t, err)
+
+	// the first login is nothing unusual and hands out a device token
+	result := as.Login(laptop, "user@example.com", "password")
+	require.NoError(t, result.Err)
+	token := result.DeviceToken
+	require.NotEmpty(t, token)
+
+	// the device is recognised by its token
+	result = as.Login(WithDeviceToken(laptop, token), "user@example.com", "password")
+	require.NoError(t, result.Err)
+	require.Equal(t, token, result.DeviceToken)
+	require.Empty(t, notifier.notifications)
+
+	// the same user agent without the token, or with one that is not known, is a new device, which
+	// takes nothing over from the laptop
+	for _, presented := range []string{"", "forged"} {
+		ctx := WithDeviceToken(audit.WithClient(context.Background(), audit.Client{IP: "198.51.100.8", UserAgent: windowsChrome}), presented)
+		result = as.Login(ctx, "user@example.com", "password")
+		require.NoError(t, result.Err)
+		require.NotEqual(t, token, result.DeviceToken)
+		require.NotEqual(t, presented, result.DeviceToken)
+	}
+	require.Len(t, notifier.notifications, 2)
+	require.Equal(t, []risk.Flag{{Rule: risk.NewDevice}}, notifier.notifications[0].Data["flags"])
+	result = as.Login(WithDeviceToken(laptop, token), "user@example.com", "password")
+	require.NoError(t, result.Err)
+	require.Equal(t, token, result.DeviceToken)
+	require.Len(t, notifier.notifications, 2)
+	notifier.notifications = nil
+
+	// a failed login is not assessed
+	phone := audit.WithClient(context.Background(), audit.Client{IP: "203.0.113.5", UserAgent: iPhoneSafari})
+	require.ErrorIs(t, as.Login(phone, "user@example.com", "wrong").Err, LoginOrPasswordInvalid)
+	require.Empty(t, notifier.notifications)
+
+	result = as.Login(phone, "user@example.com", "password")
+	require.NoError(t, result.Err)
+	require.Len(t, notifier.notifications, 1)
+	notification := notifier.notifications[0]
+	require.Equal(t, notify.SuspiciousLogin, notification.Template)
+	require.Equal(t, user.GUID, notification.UserID)
+	require.Equal(t, "user@example.com", notification.To)
+	require.Equal(t, "203.0.113.5", notification.Data["ip"])
+	require.Equal(t, "Safari 17.0 on iPhone OS 17.0", notification.Data["device"])
+	require.Equal(t, []risk.Flag{{Rule: risk.NewDevice}, {Rule: risk.NewNetwork, Detail: "203.0.113.0/24"}}, notification.Data["flags"])
+
+	// the suspicious login is audited after the login
+	events, err := database.NewAuditStore(us.dbClient).Range(context.Background(), 0, 100)
+	require.NoError(t, err)
+	last := events[len(events)-1]
+	require.Equal(t, audit.SuspiciousLogin, last.Type)
+	require.Equal(t, user.GUID, last.Subject)
+	require.Equal(t, "new_device,new_network", last.Detail)
+	require.Equal(t, audit.Login, events[len(events)-2].Type)
+
+	// the phone is known from now on
+	result = as.Login(WithDeviceToken(phone, result.DeviceToken), "user@example.com", "password")
+	require.NoError(t, result.Err)
+	require.Len(t, notifier.notifications, 1)
+
+	// a device unseen for longer than the retention is removed, and its token is not known anymore
+	us.cfg.LoginAlerts.DeviceRetention = time.Hour
+	_, err = us.dbClient.Exec("UPDATE devices SET last_seen_at = ?", time.Now().Add(-2*time.Hour).UTC())
+	require.NoError(t, err)
+	require.Equal(t, 4, us.monitor.Purge(context.Background()))
+	phoneToken := result.DeviceToken
+	result = as.Login(WithDeviceToken(phone, phoneToken), "user@example.com", "password")
+	require.NoError(t, result.Err)
+	require.NotEqual(t, phoneToken, result.DeviceToken)
+}
@@ -0,0 +1,404 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+	"tutorial-auth/internal/audit"
+	"tutorial-auth/internal/config"
+	"tutorial-auth/internal/database"
+	"tutorial-auth/internal/mongodb/models"
+	"tutorial-auth/internal/notify"
+	"tutorial-auth/pkg/logging"
+)
+
+// LoginChallenges issues and answers the challenges of passwordless logins: magic links, which
+// carry a random token, and six-digit codes sent by email or SMS. A challenge expires, takes a
+// limited number of attempts and logs in once. Only an HMAC of its secret under the token secret
+// is stored, so that the table alone lets nobody log in.
+type LoginChallenges struct {
+	cfg      *config.AppConfig
+	logger   *zap.Logger
+	users    *UserService
+	store    *database.LoginChallengeStore
+	notifier notify.Notifier
+}
+
+func NewLoginChallenges(cfg *config.AppConfig, logger *zap.Logger, users *UserService) *LoginChallenges {
+	return &LoginChallenges{
+		cfg:      cfg,
+		logger:   logger,
+		users:    users,
+		store:    database.NewLoginChallengeStore(users.dbClient),
+		notifier: notify.NewLogNotifier(logger),
+	}
+}
+
+// SetNotifier replaces the notifier that links and codes are sent through, which logs them by
+// default. It is called before challenges are issued.
+func (c *LoginChallenges) SetNotifier(notifier notify.Notifier) {
+	c.notifier = notifier
+}
+
+func (c *LoginChallenges) enabled() bool {
+	return c.cfg != nil && c.cfg.Passwordless.Enabled
+}
+
+// Issue stores a challenge for user, a magic link or a code sent over channel, and returns it with
+// its secret, which is not kept. A new code replaces the open codes of the user, so that guesses
+// only ever have the attempts of one code.
+func (c *LoginChallenges) Issue(ctx context.Context, user *models.User, method string, channel string) (*database.LoginChallenge, string, error) {
+	lifetime := c.cfg.Passwordless.MagicLinkLifetime
+	var secret string
+	var err error
+	if method == MethodCode {
+		lifetime = c.cfg.Passwordless.CodeLifetime
+		secret, err = randomCode()
+	} else {
+		secret, err = randomSecret()
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	challenge := &database.LoginChallenge{
+		ID:        uuid.NewString(),
+		UserID:    user.GUID,
+		Method:    method,
+		Channel:   channel,
+		ExpiresAt: now.Add(lifetime),
+		CreatedAt: now,
+	}
+	challenge.SecretHash = c.hash(challenge.ID, secret)
+	if method == MethodCode {
+		if err = c.users.query(ctx, func(ctx context.Context) error { return c.store.Revoke(ctx, user.GUID, method, now) }); err != nil {
+			return nil, "", err
+		}
+	}
+	if err = c.users.query(ctx, func(ctx context.Context) error { return c.store.Insert(ctx, challenge) }); err != nil {
+		return nil, "", err
+	}
+	return challenge, secret, nil
+}
+
+// allowClient counts a request for a link or a code against the limit of the address of the client
+// of ctx, and returns ChallengesThrottled past it. Requests without an address are not limited.
+func (c *LoginChallenges) allowClient(ctx context.Context) error {
+	ip := audit.ClientFrom(ctx).IP
+	if ip == "" {
+		return nil
+	}
+	allowed, err := c.limit(ctx, "client:"+ip, c.cfg.Passwordless.ClientWindow, c.cfg.Passwordless.ClientLimit)
+	if err == nil && !allowed {
+		return ChallengesThrottled
+	}
+	return err
+}
+
+// allowUser reports whether a link or a code may be sent to user, which is once per resend interval.
+func (c *LoginChallenges) allowUser(ctx context.Context, user *models.User) (bool, error) {
+	return c.limit(ctx, "user:"+user.GUID, c.cfg.Passwordless.ResendInterval, 1)
+}
+
+func (c *LoginChallenges) limit(ctx context.Context, subject string, window time.Duration, limit int) (allowed bool, err error) {
+	if window <= 0 || limit <= 0 {
+		return true, nil
+	}
+	err = c.users.query(ctx, func(ctx context.Context) (err error) {
+		allowed, err = c.store.Limit(ctx, subject, time.Now(), window, limit)
+		return err
+	})
+	return allowed, err
+}
+
+// Answer checks secret against the challenge id of method and uses the challenge up. The
+// challenge is returned whenever it exists, so that a failed attempt can be told to its user.
+// Every attempt counts, right or wrong, so a code cannot be guessed in the attempts it takes.
+func (c *LoginChallenges) Answer(ctx context.Context, id string, method string, secret string) (*database.LoginChallenge, error) {
+	var challenge *database.LoginChallenge
+	err := c.users.query(ctx, func(ctx context.Context) (err error) {
+		challenge, err = c.store.Get(ctx, id)
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, LoginChallengeInvalid
+	} else if err != nil {
+		return nil, err
+	}
+	if challenge.Method != method || challenge.ConsumedAt.Valid {
+		return challenge, LoginChallengeInvalid
+	}
+	if challenge.ExpiresAt.Before(time.Now()) {
+		return challenge, LoginChallengeExpired
+	}
+
+	var counted bool
+	err = c.users.query(ctx, func(ctx context.Context) (err error) {
+		counted, err = c.store.Attempt(ctx, id, c.cfg.Passwordless.MaxAttempts)
+		return err
+	})
+	if err != nil {
+		return challenge, err
+	}
+	if !counted {
+		return challenge, TooManyAttempts
+	}
+	if !hmac.Equal([]byte(c.hash(id, secret)), []byte(challenge.SecretHash)) {
+		return challenge, LoginChallengeInvalid
+	}
+
+	// a concurrent attempt with the same secret may have used the challenge in the meantime
+	var consumed bool
+	err = c.users.query(ctx, func(ctx context.Context) (err error) {
+		consumed, err = c.store.Consume(ctx, id, time.Now())
+		return err
+	})
+	if err != nil {
+		return challenge, err
+	}
+	if !consumed {
+		return challenge, LoginChallengeInvalid
+	}
+	return challenge, nil
+}
+
+// Run purges expired challenges right away and then on every purge interval, until ctx is done.
+func (c *LoginChallenges) Run(ctx context.Context) {
+	if !c.enabled() || c.cfg.Passwordless.PurgeInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(c.cfg.Passwordless.PurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		c.Purge(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Purge removes the expired challenges, batch by batch, and returns how many it removed.
+func (c *LoginChallenges) Purge(ctx context.Context) int {
+	const op = "services.LoginChallenges.Purge"
+
+	now := time.Now()
+	removed, err := purgeBatches(ctx, purgeBatchSize, purgeMaxBatches, func(ctx context.Context, limit int) (int, error) {
+		return c.store.DeleteExpired(ctx, now, limit)
+	})
+	if err != nil {
+		c.logger.Error("failed to purge login challenges", zap.String("op", op), zap.Error(err))
+	}
+
+	// a limit is only counted against within its window
+	window := max(c.cfg.Passwordless.ResendInterval, c.cfg.Passwordless.ClientWindow)
+	limits, err := purgeBatches(ctx, purgeBatchSize, purgeMaxBatches, func(ctx context.Context, limit int) (int, error) {
+		return c.store.DeleteExpiredLimits(ctx, now.Add(-window), limit)
+	})
+	if err != nil {
+		c.logger.Error("failed to purge login challenge limits", zap.String("op", op), zap.Error(err))
+	}
+	if limits > 0 {
+		c.logger.Info("purged login challenge limits", zap.String("op", op), zap.Int("removed", limits))
+	}
+	if removed > 0 {
+		c.logger.Info("purged login challenges", zap.String("op", op), zap.Int("removed", removed))
+	}
+	return removed
+}
+
+// hash returns the hex HMAC-SHA256 of the secret of the challenge id under the token secret.
+func (c *LoginChallenges) hash(id string, secret string) string {
+	mac := hmac.New(sha256.New, []byte(c.cfg.TokenSecret))
+	mac.Write([]byte("login_challenge\n" + id + "\n" + secret))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func randomSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+func randomCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// SendMagicLink emails the user with login a link that logs the user in once. Unknown logins, and
+// users sent a link or a code less than the resend interval ago, are sent nothing without an error,
+// so that the response does not tell which logins are registered. A client that asks for too many
+// links or codes is refused with ChallengesThrottled.
+func (as *AuthService) SendMagicLink(ctx context.Context, login string) error {
+	challenges := as.userService.challenges
+	if !challenges.enabled() {
+		return PasswordlessDisabled
+	}
+	if err := challenges.allowClient(ctx); err != nil {
+		return err
+	}
+	user, err := as.userService.GetByLogin(ctx, login)
+	if err != nil || user == nil || !user.IsActive() {
+		return err
+	}
+	if allowed, err := challenges.allowUser(ctx, user); err != nil || !allowed {
+		return err
+	}
+
+	challenge, secret, err := challenges.Issue(ctx, user, MethodMagicLink, notify.ChannelEmail)
+	if err != nil {
+		return err
+	}
+	token := challenge.ID + "." + secret
+	magicLinkURL := as.cfg.Passwordless.MagicLinkURL
+	separator := "?"
+	if strings.Contains(magicLinkURL, "?") {
+		separator = "&"
+	}
+	link := magicLinkURL + separator + "token=" + url.QueryEscape(token)
+	return challenges.send(ctx, user, notify.ChannelEmail, user.Login, notify.MagicLink,
+		map[string]any{"name": user.Name, "link": link, "expires_at": challenge.ExpiresAt})
+}
+
+// SendLoginCode sends the user with login a six-digit code by email or, to the phone number in the
+// "phone" attribute, by SMS, and returns the ID of the challenge that the code answers. Unknown
+// logins, users without a phone number and users throttled as by SendMagicLink get the ID of a
+// challenge that does not exist.
+func (as *AuthService) SendLoginCode(ctx context.Context, login string, channel string) (string, error) {
+	challenges := as.userService.challenges
+	if !challenges.enabled() {
+		return "", PasswordlessDisabled
+	}
+	if err := challenges.allowClient(ctx); err != nil {
+		return "", err
+	}
+	user, err := as.userService.GetByLogin(ctx, login)
+	if err != nil {
+		return "", err
+	}
+	to := ""
+	if user != nil && user.IsActive() {
+		to = user.Login
+		if channel == notify.ChannelSMS {
+			to, _ = user.Attributes["phone"].(string)
+		}
+	}
+	if to == "" {
+		return uuid.NewString(), nil
+	}
+	if allowed, err := challenges.allowUser(ctx, user); err != nil {
+		return "", err
+	} else if !allowed {
+		return uuid.NewString(), nil
+	}
+	if channel != notify.ChannelSMS {
+		channel = notify.ChannelEmail
+	}
+
+	challenge, code, err := challenges.Issue(ctx, user, MethodCode, channel)
+	if err != nil {
+		return "", err
+	}
+	err = challenges.send(ctx, user, channel, to, notify.LoginCode,
+		map[string]any{"name": user.Name, "code": code, "expires_at": challenge.ExpiresAt})
+	if err != nil {
+		return "", err
+	}
+	return challenge.ID, nil
+}
+
+func (c *LoginChallenges) send(ctx context.Context, user *models.User, channel string, to string, template string, data map[string]any) error {
+	const op = "services.LoginChallenges.send"
+
+	locale, _ := user.Attributes["locale"].(string)
+	tenant, _ := user.Attributes["tenant"].(string)
+	err := c.notifier.Notify(ctx, &notify.Notification{
+		Channel:  channel,
+		Template: template,
+		UserID:   user.GUID,
+		To:       to,
+		Locale:   locale,
+		Tenant:   tenant,
+		Data:     data,
+	})
+	if err != nil {
+		logging.WithContext(ctx, c.logger).Error("failed to send login challenge", zap.String("op", op),
+			zap.String("guid", user.GUID), zap.String("template", template), zap.Error(err))
+	}
+	return err
+}
+
+// LoginWithMagicLink logs in the user that the token of a magic link was sent to.
+func (as *AuthService) LoginWithMagicLink(ctx context.Context, token string) *AuthResult {
+	ctx, span := tracer.Start(ctx, "AuthService.LoginWithMagicLink")
+	id, secret, _ := strings.Cut(token, ".")
+	result, user := as.answerChallenge(ctx, MethodMagicLink, id, secret)
+	endSpan(span, result.Err)
+	as.completeLogin(ctx, MethodMagicLink, user.Login, user.GUID, result)
+	return result
+}
+
+// LoginWithCode logs in the user that code was sent to for the challenge challengeID.
+func (as *AuthService) LoginWithCode(ctx context.Context, challengeID string, code string) *AuthResult {
+	ctx, span := tracer.Start(ctx, "AuthService.LoginWithCode")
+	result, user := as.answerChallenge(ctx, MethodCode, challengeID, code)
+	endSpan(span, result.Err)
+	as.completeLogin(ctx, MethodCode, user.Login, user.GUID, result)
+	return result
+}
+
+// answerChallenge also returns the user the challenge was sent to, or an empty one, for the
+// attempt to be recorded against.
+func (as *AuthService) answerChallenge(ctx context.Context, method string, id string, secret string) (*AuthResult, *models.User) {
+	const op = "services.AuthService.answerChallenge"
+
+	if !as.userService.challenges.enabled() {
+		return &AuthResult{Err: PasswordlessDisabled}, &models.User{}
+	}
+	challenge, answerErr := as.userService.challenges.Answer(ctx, id, method, secret)
+	if challenge == nil {
+		return &AuthResult{Err: answerErr}, &models.User{}
+	}
+	user, err := as.userService.GetByGuid(ctx, challenge.UserID)
+	if isNotFound(err) {
+		return &AuthResult{Err: LoginChallengeInvalid}, &models.User{GUID: challenge.UserID}
+	} else if err != nil {
+		return &AuthResult{Err: err}, &models.User{GUID: challenge.UserID}
+	}
+	if answerErr != nil {
+		return &AuthResult{Err: answerErr}, user
+	}
+	if !user.IsActive() {
+		return &AuthResult{Err: RegistrationNotCompleted}, user
+	}
+
+	if challenge.Channel == notify.ChannelEmail && !user.EmailVerified && as.userService.verifier.enabled() {
+		if err = as.userService.verifier.markVerified(ctx, user); err != nil {
+			// the user is still logged in, and verified by the next link or code
+			logging.WithContext(ctx, as.logger).Warn("failed to mark email verified", zap.String("op", op),
+				zap.String("guid", user.GUID), zap.Error(err))
+		}
+	}
+	return as.issue(ctx, user), user
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"net/url"
+	"testing"
+	"time"
+	"tutorial-auth/internal/audit"
+	"tutorial-auth/internal/config"
+	"tutorial-auth/internal/database"
+	"tutorial-auth/internal/notify"
+)
+
+func TestPasswordlessLogin(t *testing.T) {
+	cfg := testConfig()
+	cfg.EmailVerification = config.EmailVerificationConfig{Enabled: true, RequireVerified: true, TokenLifetime: time.Hour}
+	cfg.Passwordless = config.PasswordlessConfig{
+		Enabled:           true,
+		MagicLinkURL:      "https://example.com/magic",
+		MagicLinkLifetime: time.Hour,
+		CodeLifetime:      time.Hour,
+		MaxAttempts:       3,
+	}
+	us := newSqliteUserService(t, cfg)
+	notifier := &recordingNotifier{}
+	us.SetNotifier(notifier)
+	as := NewAuthService(us.cfg, zap.NewNop(), us)
+	ctx := context.Background()
+
+	// a user registers without a password and has no password to log in with
+	user, err := us.Register(ctx, &NewUser{Login: "user@example.com", Name: "Ivan"})
+	require.NoError(t, err)
+	require.True(t, user.Passwordless)
+	require.ErrorIs(t, as.Login(ctx, "user@example.com", "").Err, LoginOrPasswordInvalid)
+
+	// a magic link logs in once, which verifies the address it was sent to
+	require.NoError(t, as.SendMagicLink(ctx, "user@example.com"))
+	require.NoError(t, as.SendMagicLink(ctx, "nobody@example.com"))
+	require.Len(t, notifier.notifications, 2)
+	notification := notifier.notifications[1]
+	require.Equal(t, notify.MagicLink, notification.Template)
+	link, err := url.Parse(notification.Data["link"].(string))
+	require.NoError(t, err)
+	token := link.Query().Get("token")
+	require.NotEmpty(t, token)
+
+	require.ErrorIs(t, as.LoginWithMagicLink(ctx, token+"x").Err, LoginChallengeInvalid)
+	require.ErrorIs(t, as.LoginWithMagicLink(ctx, "garbage").Err, LoginChallengeInvalid)
+	result := as.LoginWithMagicLink(ctx, token)
+	require.NoError(t, result.Err)
+	require.NotEmpty(t, result.Token)
+	require.True(t, result.User.EmailVerified)
+	require.ErrorIs(t, as.LoginWithMagicLink(ctx, token).Err, LoginChallengeInvalid)
+
+	// a code takes a limited number of attempts, right or wrong
+	challengeID, err := as.SendLoginCode(ctx, "user@example.com", notify.ChannelEmail)
+	require.NoError(t, err)
+	code := notifier.notifications[2].Data["code"].(string)
+	require.Len(t, code, 6)
+	_, err = us.LoginChallenges().store.Get(ctx, challengeID)
+	require.NoError(t, err)
+	require.ErrorIs(t, as.LoginWithMagicLink(ctx, challengeID+"."+code).Err, LoginChallengeInvalid)
+	for i := 0; i < 3; i++ {
+		require.ErrorIs(t, as.LoginWithCode(ctx, challengeID, "wrong").Err, LoginChallengeInvalid)
+	}
+	require.ErrorIs(t, as.LoginWithCode(ctx, challengeID, code).Err, TooManyAttempts)
+
+	challengeID, err = as.SendLoginCode(ctx, "user@example.com", notify.ChannelEmail)
+	require.NoError(t, err)
+	code = notifier.notifications[3].Data["code"].(string)
+	require.NoError(t, as.LoginWithCode(ctx, challengeID, code).Err)
+	require.ErrorIs(t, as.LoginWithCode(ctx, challengeID, code).Err, LoginChallengeInvalid)
+
+	// users without a phone number are sent no SMS, but cannot tell
+	challengeID, err = as.SendLoginCode(ctx, "user@example.com", notify.ChannelSMS)
+	require.NoError(t, err)
+	require.Len(t, notifier.notifications, 4)
+	require.ErrorIs(t, as.LoginWithCode(ctx, challengeID, "000000").Err, LoginChallengeInvalid)
+
+	// expired challenges are refused and then purged
+	require.NoError(t, us.LoginChallenges().store.Insert(ctx, &database.LoginChallenge{
+		ID: "expired", UserID: user.GUID, Method: MethodCode, Channel: notify.ChannelEmail,
+		SecretHash: us.LoginChallenges().hash("expired", "123456"), ExpiresAt: time.Now().Add(-time.Minute), CreatedAt: time.Now(),
+	}))
+	require.ErrorIs(t, as.LoginWithCode(ctx, "expired", "123456").Err, LoginChallengeExpired)
+	require.Equal(t, 1, us.LoginChallenges().Purge(ctx))
+
+	// the first password needs no current one, and a later one does
+	require.NoError(t, us.SetPassword(ctx, user.GUID, "", "password"))
+	require.NoError(t, as.Login(ctx, "user@example.com", "password").Err)
+	require.ErrorIs(t, us.SetPassword(ctx, user.GUID, "", "new password"), LoginOrPasswordInvalid)
+	reloaded, err := us.GetByGuid(ctx, user.GUID)
+	require.NoError(t, err)
+	require.False(t, reloaded.Passwordless)
+
+	// without passwordless login registration requires a password
+	us.cfg.Passwordless.Enabled = false
+	_, err = us.Register(ctx, &NewUser{Login: "other@example.com"})
+	require.ErrorIs(t, err, ValidationFailed(""))
+	require.ErrorIs(t, as.SendMagicLink(ctx, "user@example.com"), PasswordlessDisabled)
+}
+
+func TestLoginChallengeThrottling(t *testing.T) {
+	cfg := &config.AppConfig{TokenSecret: "secret"}
+	cfg.Passwordless = config.PasswordlessConfig{
+		Enabled:           true,
+		MagicLinkLifetime: time.Hour,
+		CodeLifetime:      time.Hour,
+		MaxAttempts:       3,
+		ResendInterval:    time.Minute,
+		ClientLimit:       3,
+		ClientWindow:      time.Hour,
+	}
+	us := newSqliteUserService(t, cfg)
+	notifier := &recordingNotifier{}
+	us.SetNotifier(notifier)
+	as := NewAuthService(us.cfg, zap.NewNop(), us)
+	ctx := audit.WithClient(context.Background(), audit.Client{IP: "203.0.113.5"})
+
+	user, err := us.Register(ctx, &NewUser{Login: "user@example.com", Name: "Ivan"})
+	require.NoError(t, err)
+
+	// inside the resend interval nothing more is sent, and the challenge ID does not exist
+	require.NoError(t, as.SendMagicLink(ctx, "user@example.com"))
+	challengeID, err := as.SendLoginCode(ctx, "user@example.com", notify.ChannelEmail)
+	require.NoError(t, err)
+	require.Len(t, notifier.notifications, 1)
+	_, err = us.LoginChallenges().store.Get(ctx, challengeID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	// the client is refused past its limit, whatever the login
+	require.NoError(t, as.SendMagicLink(ctx, "nobody@example.com"))
+	require.ErrorIs(t, as.SendMagicLink(ctx, "nobody@example.com"), ChallengesThrottled)
+	_, err = as.SendLoginCode(ctx, "user@example.com", notify.ChannelEmail)
+	require.ErrorIs(t, err, ChallengesThrottled)
+	require.NoError(t, as.SendMagicLink(audit.WithClient(ctx, audit.Client{IP: "198.51.100.7"}), "nobody@example.com"))
+
+	// a new code replaces the open one
+	first, firstCode, err := us.LoginChallenges().Issue(ctx, user, MethodCode, notify.ChannelEmail)
+	require.NoError(t, err)
+	second, secondCode, err := us.LoginChallenges().Issue(ctx, user, MethodCode, notify.ChannelEmail)
+	require.NoError(t, err)
+	require.ErrorIs(t, as.LoginWithCode(ctx, first.ID, firstCode).Err, LoginChallengeInvalid)
+	require.NoError(t, as.LoginWithCode(ctx, second.ID, secondCode).Err)
+}
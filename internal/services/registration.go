@@ -0,0 +1,84 @@
+package services
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+	"time"
+	"tutorial-auth/internal/config"
+	"tutorial-auth/pkg/logging"
+)
+
+const recoveryBatchSize = 100
+
+// RegistrationRecovery finishes registration sagas that stopped halfway, for example because
+// the process crashed between writing the user and writing the credential.
+type RegistrationRecovery struct {
+	cfg         *config.AppConfig
+	logger      *zap.Logger
+	userService *UserService
+}
+
+func NewRegistrationRecovery(cfg *config.AppConfig, logger *zap.Logger, userService *UserService) *RegistrationRecovery {
+	return &RegistrationRecovery{
+		cfg:         cfg,
+		logger:      logger,
+		userService: userService,
+	}
+}
+
+// Run recovers stuck registrations right away and then on every recovery interval, until ctx is done.
+func (r *RegistrationRecovery) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.RegistrationRecoveryInterval)
+	defer ticker.Stop()
+
+	for {
+		r.Recover(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Recover completes or rolls back every registration that has not progressed for the registration timeout.
+func (r *RegistrationRecovery) Recover(ctx context.Context) (recovered int) {
+	const op = "services.RegistrationRecovery.Recover"
+
+	ctx, span := tracer.Start(ctx, "RegistrationRecovery.Recover")
+	defer func() {
+		span.SetAttributes(attribute.Int("registrations.recovered", recovered))
+		span.End()
+	}()
+	logger := logging.WithContext(ctx, r.logger)
+
+	for {
+		before := time.Now().Add(-r.cfg.RegistrationTimeout)
+		registrations, err := r.userService.outbox.Stale(ctx, before, recoveryBatchSize)
+		if err != nil {
+			logger.Error("failed to load stuck registrations", zap.String("op", op), zap.Error(err))
+			return recovered
+		}
+
+		failed := false
+		for i := range registrations {
+			registration := &registrations[i]
+			if err = r.userService.RecoverRegistration(ctx, registration); err != nil {
+				logger.Error("failed to recover registration", zap.String("op", op),
+					zap.String("guid", registration.UserID), zap.String("step", registration.Step), zap.Error(err))
+				failed = true
+				continue
+			}
+			logger.Info("recovered registration", zap.String("op", op),
+				zap.String("guid", registration.UserID), zap.String("step", registration.Step))
+			recovered++
+		}
+
+		// a failed registration stays stale, so stop instead of loading it again
+		if failed || len(registrations) < recoveryBatchSize {
+			return recovered
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"path/filepath"
+	"testing"
+	"time"
+	"tutorial-auth/internal/config"
+	"tutorial-auth/internal/database"
+	"tutorial-auth/internal/mongodb/models"
+)
+
+// testConfig returns the configuration of a service that issues tokens.
+func testConfig() *config.AppConfig {
+	return &config.AppConfig{PasswordLifeTime: 1, TokenSecret: "secret", TokenExpirationTimeMinutes: 5, RefreshTokenExpirationTimeMinutes: 60}
+}
+
+// newSqliteUserService returns a service configured by cfg on a migrated sqlite database.
+func newSqliteUserService(t *testing.T, cfg *config.AppConfig) *UserService {
+	dbConfig := &config.DBConnectionConfig{
+		Type:        "sqlite",
+		Database:    filepath.Join(t.TempDir(), "auth.db"),
+		BusyTimeout: 5 * time.Second,
+	}
+	db, err := database.NewConnectionDB(dbConfig)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	require.NoError(t, database.ApplyMigration(zap.NewNop(), dbConfig.Type, db))
+
+	return NewUserService(cfg, zap.NewNop(), database.NewUserStore(db), db)
+}
+
+func TestRegistrationRecovery(t *testing.T) {
+	ctx := context.Background()
+	us := newSqliteUserService(t, &config.AppConfig{})
+
+	// crashed after writing the pending user
+	require.NoError(t, us.outbox.Start(ctx, "started", "started@example.com"))
+	require.NoError(t, us.users.Insert(ctx, &models.User{GUID: "started", Login: "started@example.com", Status: models.UserStatusPending}))
+
+	// crashed after writing the credential
+	require.NoError(t, us.outbox.Start(ctx, "credential", "credential@example.com"))
+	require.NoError(t, us.users.Insert(ctx, &models.User{GUID: "credential", Login: "credential@example.com", Status: models.UserStatusPending}))
+	require.NoError(t, us.outbox.WriteCredential(ctx, "credential", "hash", time.Now().Add(time.Hour)))
+
+	// crashed before writing the user
+	require.NoError(t, us.outbox.Start(ctx, "orphan", "orphan@example.com"))
+
+	recovery := NewRegistrationRecovery(&config.AppConfig{}, zap.NewNop(), us)
+	require.Equal(t, 3, recovery.Recover(ctx))
+
+	user, err := us.GetByLogin(ctx, "started@example.com")
+	require.NoError(t, err)
+	require.Nil(t, user)
+
+	user, err = us.GetByLogin(ctx, "credential@example.com")
+	require.NoError(t, err)
+	require.True(t, user.IsActive())
+
+	password, _, err := us.GetPassword(ctx, "credential")
+	require.NoError(t, err)
+	require.Equal(t, "hash", password)
+
+	stale, err := us.outbox.Stale(ctx, time.Now(), recoveryBatchSize)
+	require.NoError(t, err)
+	require.Empty(t, stale)
+}
+
+func TestRegistrationCredentialAfterRollback(t *testing.T) {
+	ctx := context.Background()
+	us := newSqliteUserService(t, &config.AppConfig{})
+
+	require.NoError(t, us.outbox.Start(ctx, "guid", "user@example.com"))
+	aborted, err := us.outbox.Abort(ctx, "guid")
+	require.NoError(t, err)
+	require.True(t, aborted)
+
+	err = us.outbox.WriteCredential(ctx, "guid", "hash", time.Now().Add(time.Hour))
+	require.ErrorIs(t, err, database.RegistrationAbortedError)
+}
+
+func TestRegistrationRecoveryAfterRollback(t *testing.T) {
+	ctx := context.Background()
+	us := newSqliteUserService(t, &config.AppConfig{})
+
+	// the registration was rolled back and left the outbox, but the pending user is still there
+	require.NoError(t, us.users.Insert(ctx, &models.User{GUID: "pending", Login: "pending@example.com", Status: models.UserStatusPending}))
+	require.NoError(t, us.RecoverRegistration(ctx, &database.Registration{UserID: "pending", Step: database.RegistrationStarted}))
+	user, err := us.GetByLogin(ctx, "pending@example.com")
+	require.NoError(t, err)
+	require.Nil(t, user)
+
+	// a completed registration has left the outbox too, and its user stays
+	require.NoError(t, us.users.Insert(ctx, &models.User{GUID: "active", Login: "active@example.com", Status: models.UserStatusActive}))
+	require.NoError(t, us.RecoverRegistration(ctx, &database.Registration{UserID: "active", Step: database.RegistrationStarted}))
+	user, err = us.GetByLogin(ctx, "active@example.com")
+	require.NoError(t, err)
+	require.True(t, user.IsActive())
+}
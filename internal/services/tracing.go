@@ -0,0 +1,24 @@
+package services
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("tutorial-auth/internal/services")
+
+// endSpan ends span with the outcome of its operation. Errors that clients cause, such as invalid
+// credentials, are only recorded as the error code; the others mark the span as failed.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		serviceErr := AsError(err)
+		span.SetAttributes(attribute.String("error.code", serviceErr.Code))
+		if serviceErr.Kind == KindInternal || serviceErr.Kind == KindTimeout {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, serviceErr.Code)
+		}
+	}
+	span.End()
+}
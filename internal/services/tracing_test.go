@@ -0,0 +1,54 @@
+package services
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/zap"
+	"testing"
+)
+
+func TestLoginTracing(t *testing.T) {
+	ctx := context.Background()
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	us := newSqliteUserService(t, testConfig())
+	_, err := us.Register(ctx, &NewUser{Login: "user@example.com", Password: "password"})
+	require.NoError(t, err)
+
+	ctx, parent := otel.Tracer("test").Start(ctx, "request")
+	require.ErrorIs(t, NewAuthService(us.cfg, zap.NewNop(), us).Login(ctx, "user@example.com", "wrong").Err, LoginOrPasswordInvalid)
+	parent.End()
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	var queries int
+	for _, span := range recorder.Ended() {
+		if span.SpanContext().TraceID() != parent.SpanContext().TraceID() {
+			continue
+		}
+		spans[span.Name()] = span
+		if span.Name() == "sql.query" {
+			queries++
+		}
+	}
+
+	login := spans["AuthService.Login"]
+	require.NotNil(t, login)
+	require.Equal(t, parent.SpanContext().SpanID(), login.Parent().SpanID())
+	require.Contains(t, login.Attributes(), attribute.String("error.code", LoginOrPasswordInvalid.Code))
+
+	check := spans["UserService.CheckPasswordHash"]
+	require.NotNil(t, check)
+	require.Equal(t, login.SpanContext().SpanID(), check.Parent().SpanID())
+	require.Equal(t, "hashing slot acquired", check.Events()[0].Name)
+
+	// the user, the password and the head of the audit log were read below the login span
+	require.Equal(t, 3, queries)
+	require.Equal(t, login.SpanContext().SpanID(), spans["sql.query"].Parent().SpanID())
+}
@@ -3,22 +3,21 @@ package services
 import (
 	"context"
 	"errors"
-	"fmt"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
 	"time"
+	"tutorial-auth/internal/audit"
 	"tutorial-auth/internal/config"
-	"tutorial-auth/internal/mongodb"
+	"tutorial-auth/internal/database"
+	"tutorial-auth/internal/metrics"
 	"tutorial-auth/internal/mongodb/models"
+	"tutorial-auth/internal/notify"
+	"tutorial-auth/pkg/logging"
 )
 
-var UserAlreadyExistsError = fmt.Errorf("user already exists")
-
 type NewUser struct {
 	Login    string `json:"login"`
 	Password string `json:"password"`
@@ -26,62 +25,175 @@ type NewUser struct {
 	LastName string `json:"last_name,omitempty"`
 }
 
+// UserStore persists user documents. It is backed by MongoDB (mongodb.UserStore)
+// or by the SQL database itself (database.UserStore).
+type UserStore interface {
+	GetByGuid(ctx context.Context, guid string) (*models.User, error)
+	GetByLogin(ctx context.Context, login string) (*models.User, error)
+	Insert(ctx context.Context, user *models.User) error
+	DeleteByGuid(ctx context.Context, guid string) error
+	UpdateRefreshToken(ctx context.Context, guid string, refreshToken string) error
+	SetStatus(ctx context.Context, guid string, status string) error
+	SetEmailVerified(ctx context.Context, guid string, verified bool) error
+	SetPasswordless(ctx context.Context, guid string, passwordless bool) error
+	UpdateLastLoginAt(ctx context.Context, guid string) error
+	UpdateRefreshTokenAndLastLoginAt(ctx context.Context, guid string, refreshToken string) error
+}
+
 type UserService struct {
-	logger      *zap.Logger
-	mongoClient *mongodb.MongoDB
-	dbClient    *sqlx.DB
-	collection  string
+	cfg        *config.AppConfig
+	logger     *zap.Logger
+	users      UserStore
+	dbClient   *sqlx.DB
+	outbox     *database.RegistrationOutbox
+	hashing    *HashingPool
+	auditLog   *audit.Log
+	history    *LoginHistory
+	monitor    *LoginMonitor
+	verifier   *EmailVerification
+	challenges *LoginChallenges
+	passwords  *database.PasswordStore
 }
 
-func NewUserService(logger *zap.Logger, mongoClient *mongodb.MongoDB, db *sqlx.DB) *UserService {
-	return &UserService{
-		logger:      logger,
-		mongoClient: mongoClient,
-		dbClient:    db,
-		collection:  "users",
+func NewUserService(cfg *config.AppConfig, logger *zap.Logger, users UserStore, db *sqlx.DB) *UserService {
+	var poolSize int
+	if cfg != nil {
+		poolSize = cfg.HashingPoolSize
+	}
+	auditLog := audit.NewLog(logger, database.NewAuditStore(db))
+	us := &UserService{
+		cfg:       cfg,
+		logger:    logger,
+		users:     users,
+		dbClient:  db,
+		outbox:    database.NewRegistrationOutbox(db),
+		hashing:   NewHashingPool(poolSize),
+		auditLog:  auditLog,
+		history:   NewLoginHistory(cfg, logger, db),
+		monitor:   NewLoginMonitor(cfg, logger, db, auditLog),
+		passwords: database.NewPasswordStore(db),
 	}
+	us.verifier = NewEmailVerification(cfg, logger, us)
+	us.challenges = NewLoginChallenges(cfg, logger, us)
+	return us
 }
 
-func (us *UserService) GetByGuid(guid string) (*models.User, error) {
-	var user *models.User
-	collection := us.mongoClient.GetCollection(us.collection)
-	err := collection.FindOne(context.TODO(), bson.M{"guid": guid}).Decode(&user)
-	if err != nil {
-		return nil, err
+// HashingPool returns the pool that password hashing and checking run in.
+func (us *UserService) HashingPool() *HashingPool {
+	return us.hashing
+}
+
+// AuditLog returns the log that security events are recorded in.
+func (us *UserService) AuditLog() *audit.Log {
+	return us.auditLog
+}
+
+// LoginHistory returns the history of the login attempts of users.
+func (us *UserService) LoginHistory() *LoginHistory {
+	return us.history
+}
+
+// LoginMonitor returns the monitor that flags suspicious logins.
+func (us *UserService) LoginMonitor() *LoginMonitor {
+	return us.monitor
+}
+
+// EmailVerification returns the verification of the email addresses of users.
+func (us *UserService) EmailVerification() *EmailVerification {
+	return us.verifier
+}
+
+// LoginChallenges returns the challenges of passwordless logins.
+func (us *UserService) LoginChallenges() *LoginChallenges {
+	return us.challenges
+}
+
+// SetNotifier replaces the notifier of the emails to users, which are logged by default. It is
+// called before the service is used.
+func (us *UserService) SetNotifier(notifier notify.Notifier) {
+	us.monitor.SetNotifier(notifier)
+	us.verifier.SetNotifier(notifier)
+	us.challenges.SetNotifier(notifier)
+}
+
+// queryContext bounds a single database call by the query timeout, within the deadline of ctx.
+func (us *UserService) queryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if us.cfg == nil || us.cfg.Timeouts.Query <= 0 {
+		return context.WithCancel(ctx)
 	}
-	return user, nil
+	return context.WithTimeout(ctx, us.cfg.Timeouts.Query)
 }
 
-func (us *UserService) GetByLogin(login string) (*models.User, error) {
-	var user *models.User
-	collection := us.mongoClient.GetCollection(us.collection)
-	err := collection.FindOne(context.TODO(), bson.M{"login": login}).Decode(&user)
-	if errors.Is(err, mongo.ErrNoDocuments) {
-		return nil, nil
-	} else if err != nil {
-		return nil, err
+func (us *UserService) GetByGuid(ctx context.Context, guid string) (*models.User, error) {
+	ctx, cancel := us.queryContext(ctx)
+	defer cancel()
+	return us.users.GetByGuid(ctx, guid)
+}
+
+// GetUser is GetByGuid for clients: a missing user is reported as UserNotFound.
+func (us *UserService) GetUser(ctx context.Context, guid string) (*models.User, error) {
+	user, err := us.GetByGuid(ctx, guid)
+	if isNotFound(err) {
+		return nil, UserNotFound
 	}
-	return user, nil
+	return user, err
+}
+
+func (us *UserService) GetByLogin(ctx context.Context, login string) (*models.User, error) {
+	ctx, cancel := us.queryContext(ctx)
+	defer cancel()
+	return us.users.GetByLogin(ctx, login)
 }
 
-func (us *UserService) GetPassword(guid string) (string, error) {
+// GetPassword returns the latest password hash of the user and when it expires.
+func (us *UserService) GetPassword(ctx context.Context, guid string) (string, time.Time, error) {
 	var password string
+	var expiresAt time.Time
 
-	query := "SELECT password FROM passwords WHERE user_id = $1 AND expires_at > $2 ORDER BY expires_at DESC LIMIT 1"
+	query := us.dbClient.Rebind("SELECT password, expires_at FROM passwords WHERE user_id = ? ORDER BY expires_at DESC LIMIT 1")
 
-	err := us.dbClient.QueryRow(query, guid, time.Now()).Scan(&password)
+	ctx, cancel := us.queryContext(ctx)
+	defer cancel()
+	err := us.dbClient.QueryRowContext(ctx, query, guid).Scan(&password, &expiresAt)
 	if err != nil {
-		return "", err
+		return "", time.Time{}, err
 	}
-	return password, nil
+	return password, expiresAt, nil
 }
 
+// Register creates the user as a saga: the registration is recorded in the outbox, the user is
+// written as pending, the credential is written, and then the user is marked active. Every step
+// that fails is compensated here; a crash between steps is picked up by RegistrationRecovery.
 func (us *UserService) Register(ctx context.Context, nur *NewUser) (*models.User, error) {
-	var user *models.User
-	collection := us.mongoClient.GetCollection(us.collection)
+	ctx, span := tracer.Start(ctx, "UserService.Register")
+	user, err := us.register(ctx, nur)
+	endSpan(span, err)
+	metrics.Registrations.WithLabelValues(resultOf(err)).Inc()
+
+	subject := nur.Login
+	if user != nil {
+		subject = user.GUID
+	}
+	us.auditLog.Record(ctx, audit.Event{Type: audit.Registration, Actor: subject, Subject: subject, Result: resultOf(err)})
+	if err == nil {
+		us.verifier.sendAfterRegistration(ctx, user)
+	}
+	return user, err
+}
+
+func (us *UserService) register(ctx context.Context, nur *NewUser) (*models.User, error) {
+	const op = "services.UserService.Register"
+	logger := logging.WithContext(ctx, us.logger)
 
-	existedUser, err := us.GetByLogin(nur.Login)
-	us.logger.Info("checking if user already exists", zap.String("login", nur.Login), zap.Error(err))
+	// without a password the user logs in with magic links and codes, and may add one later
+	passwordless := nur.Password == ""
+	if passwordless && !us.challenges.enabled() {
+		return nil, ValidationFailed("request validation failed",
+			InvalidParam{Name: "password", Code: "required", Reason: "is required"})
+	}
+
+	existedUser, err := us.GetByLogin(ctx, nur.Login)
+	logger.Info("checking if user already exists", zap.String("login", nur.Login), zap.Error(err))
 	if existedUser != nil {
 		return nil, UserAlreadyExistsError
 	}
@@ -90,92 +202,240 @@ func (us *UserService) Register(ctx context.Context, nur *NewUser) (*models.User
 		return nil, err
 	}
 
+	var hashedPass string
+	if !passwordless {
+		hashedPass, err = us.HashPassword(ctx, nur.Password)
+		if err != nil {
+			logger.Error("failed to hashing password", zap.String("op", op), zap.Error(err))
+			return nil, err
+		}
+	}
+
 	userGUID := uuid.New().String()
-	newUser := &models.User{
-		GUID:      userGUID,
-		Login:     nur.Login,
-		LoginType: models.LoginType{ID: 1, Name: "email"},
-		Name:      nur.Name,
-		LastName:  nur.LastName,
-		CreatedAt: time.Now(),
-	}
-	insertResult, err := collection.InsertOne(ctx, newUser)
-	if err != nil {
+	if err = us.query(ctx, func(ctx context.Context) error { return us.outbox.Start(ctx, userGUID, nur.Login) }); err != nil {
 		return nil, err
 	}
 
-	sql := `INSERT INTO passwords (user_id, password, expires_at) VALUES ($1, $2, $3)`
-	hashedPass, err := us.HashPassword(nur.Password)
-	if err != nil {
-		us.logger.Error("failed to hashing password", zap.Error(err))
-		errDelete := us.DeleteByID(ctx, insertResult.InsertedID.(primitive.ObjectID))
-		if errDelete != nil {
-			return nil, errDelete
+	newUser := &models.User{
+		GUID:         userGUID,
+		Login:        nur.Login,
+		LoginType:    models.LoginType{ID: 1, Name: "email"},
+		Name:         nur.Name,
+		LastName:     nur.LastName,
+		Status:       models.UserStatusPending,
+		Passwordless: passwordless,
+		// there is nothing to verify when verification is off
+		EmailVerified: !us.verifier.enabled(),
+		CreatedAt:     time.Now(),
+	}
+	if err = us.query(ctx, func(ctx context.Context) error { return us.users.Insert(ctx, newUser) }); err != nil {
+		us.rollbackRegistration(ctx, userGUID)
+		// a concurrent registration of the same login won the race for the unique index
+		if isDuplicateKey(err) {
+			return nil, UserAlreadyExistsError
 		}
+		logger.Error("failed to inserting user", zap.String("op", op), zap.Error(err))
 		return nil, err
 	}
 
-	cfg := ctx.Value("cfg").(*config.AppConfig)
-	_, err = us.dbClient.ExecContext(ctx, sql, userGUID, hashedPass, time.Now().Add(time.Duration(cfg.PasswordLifeTime)*time.Hour))
+	expiresAt := time.Now().Add(time.Duration(us.cfg.PasswordLifeTime) * time.Hour)
+	err = us.query(ctx, func(ctx context.Context) error {
+		return us.outbox.WriteCredential(ctx, userGUID, hashedPass, expiresAt)
+	})
 	if err != nil {
-		us.logger.Error("failed to inserting password", zap.Error(err))
-		errDelete := us.DeleteByID(ctx, insertResult.InsertedID.(primitive.ObjectID))
-		if errDelete != nil {
-			return nil, errDelete
-		}
+		logger.Error("failed to inserting password", zap.String("op", op), zap.Error(err))
+		us.rollbackRegistration(ctx, userGUID)
 		return nil, err
 	}
-	return user, nil
+
+	// the credential is durable from here on, so a client that went away does not stop the activation
+	if err = us.completeRegistration(context.WithoutCancel(ctx), userGUID); err != nil {
+		// the credential is durable, so the registration has succeeded and the recovery worker activates the user
+		logger.Warn("failed to activate user", zap.String("op", op), zap.String("guid", userGUID), zap.Error(err))
+		return newUser, nil
+	}
+	newUser.Status = models.UserStatusActive
+	return newUser, nil
 }
 
-func (us *UserService) DeleteByID(ctx context.Context, id primitive.ObjectID) error {
-	collection := us.mongoClient.GetCollection(us.collection)
-	_, err := collection.DeleteOne(ctx, bson.M{"_id": id})
+// RecoverRegistration completes a registration whose credential is written and rolls back any other.
+func (us *UserService) RecoverRegistration(ctx context.Context, registration *database.Registration) error {
+	if registration.Step == database.RegistrationCredential {
+		return us.completeRegistration(ctx, registration.UserID)
+	}
+
+	var aborted bool
+	err := us.query(ctx, func(ctx context.Context) (err error) {
+		aborted, err = us.outbox.Abort(ctx, registration.UserID)
+		return err
+	})
+	if errors.Is(err, database.RegistrationNotFoundError) {
+		return us.deletePendingUser(ctx, registration.UserID)
+	}
 	if err != nil {
 		return err
 	}
-	return nil
+	if !aborted {
+		// the credential was written after the registration was loaded
+		return us.completeRegistration(ctx, registration.UserID)
+	}
+	if err = us.DeleteByGuid(ctx, registration.UserID); err != nil {
+		return err
+	}
+	return us.query(ctx, func(ctx context.Context) error { return us.outbox.Finish(ctx, registration.UserID) })
 }
 
-func (us *UserService) HashPassword(password string) (string, error) {
-	hashed, err := bcrypt.GenerateFromPassword([]byte(password), 14)
+// deletePendingUser removes the user of a registration that is no longer in the outbox. A completed
+// registration activated its user before leaving the outbox, so a user still pending was rolled back,
+// and has no credential to be activated with.
+func (us *UserService) deletePendingUser(ctx context.Context, guid string) error {
+	user, err := us.GetByGuid(ctx, guid)
+	if isNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if user.IsActive() {
+		return nil
+	}
+	return us.DeleteByGuid(ctx, guid)
+}
+
+func (us *UserService) completeRegistration(ctx context.Context, guid string) error {
+	err := us.query(ctx, func(ctx context.Context) error { return us.users.SetStatus(ctx, guid, models.UserStatusActive) })
 	if err != nil {
-		return "", err
+		return err
 	}
-	return string(hashed), nil
+	return us.query(ctx, func(ctx context.Context) error { return us.outbox.Finish(ctx, guid) })
 }
 
-func (us *UserService) CheckPasswordHash(password string, hash string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err == nil
+// rollbackRegistration is called once a step has failed, possibly because ctx is done,
+// so the compensation runs detached from ctx.
+func (us *UserService) rollbackRegistration(ctx context.Context, guid string) {
+	const op = "services.UserService.rollbackRegistration"
+
+	ctx = context.WithoutCancel(ctx)
+	err := us.RecoverRegistration(ctx, &database.Registration{UserID: guid, Step: database.RegistrationStarted})
+	if err != nil {
+		// the outbox still holds the registration, so the recovery worker retries
+		logging.WithContext(ctx, us.logger).Error("failed to roll back registration", zap.String("op", op), zap.String("guid", guid), zap.Error(err))
+	}
+}
+
+func (us *UserService) DeleteByGuid(ctx context.Context, guid string) error {
+	return us.query(ctx, func(ctx context.Context) error { return us.users.DeleteByGuid(ctx, guid) })
+}
+
+// query runs a single database call under queryContext.
+func (us *UserService) query(ctx context.Context, call func(ctx context.Context) error) error {
+	ctx, cancel := us.queryContext(ctx)
+	defer cancel()
+	return call(ctx)
 }
 
-func (us *UserService) UpdateRefreshToken(guid string, refreshToken string) error {
-	collection := us.mongoClient.GetCollection(us.collection)
-	_, err := collection.UpdateOne(context.TODO(), bson.M{"guid": guid}, bson.M{"$set": bson.M{"refresh_token": refreshToken}})
+func isDuplicateKey(err error) bool {
+	return mongo.IsDuplicateKeyError(err) || database.IsUniqueViolation(err)
+}
+
+func (us *UserService) HashPassword(ctx context.Context, password string) (string, error) {
+	_, span := tracer.Start(ctx, "UserService.HashPassword")
+	var hashed []byte
+	var err error
+	waitErr := us.hashing.Do(ctx, func() {
+		span.AddEvent("hashing slot acquired")
+		defer observeHashing("hash", time.Now())
+		hashed, err = bcrypt.GenerateFromPassword([]byte(password), 14)
+	})
+	if waitErr != nil {
+		err = waitErr
+	}
+	endSpan(span, err)
 	if err != nil {
-		return err
+		return "", err
 	}
-	return nil
+	return string(hashed), nil
+}
+
+// CheckPasswordHash reports whether password matches hash, or returns the error of ctx if it is
+// done before a hashing slot is free. The span of the check records the wait for the hashing pool
+// as an event, to tell a saturated pool from slow hashing.
+func (us *UserService) CheckPasswordHash(ctx context.Context, password string, hash string) (bool, error) {
+	_, span := tracer.Start(ctx, "UserService.CheckPasswordHash")
+	var err error
+	waitErr := us.hashing.Do(ctx, func() {
+		span.AddEvent("hashing slot acquired")
+		defer observeHashing("compare", time.Now())
+		err = bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	})
+	endSpan(span, waitErr)
+	if waitErr != nil {
+		return false, waitErr
+	}
+	return err == nil, nil
+}
+
+func (us *UserService) UpdateRefreshToken(ctx context.Context, guid string, refreshToken string) error {
+	return us.query(ctx, func(ctx context.Context) error { return us.users.UpdateRefreshToken(ctx, guid, refreshToken) })
 }
 
-func (us *UserService) UpdateLastLoginAt(guid string) error {
-	collection := us.mongoClient.GetCollection(us.collection)
-	_, err := collection.UpdateOne(context.TODO(), bson.M{"guid": guid}, bson.M{"$set": bson.M{"last_login_at": time.Now()}})
+func (us *UserService) SetEmailVerified(ctx context.Context, guid string, verified bool) error {
+	return us.query(ctx, func(ctx context.Context) error { return us.users.SetEmailVerified(ctx, guid, verified) })
+}
+
+// SetPassword sets a new password of the user guid. A user who has a password must give it as
+// current; a passwordless user adds the first one without, and logs in with either from then on.
+func (us *UserService) SetPassword(ctx context.Context, guid string, current string, password string) (err error) {
+	ctx, span := tracer.Start(ctx, "UserService.SetPassword")
+	defer func() {
+		endSpan(span, err)
+		us.auditLog.Record(ctx, audit.Event{Type: audit.PasswordChange, Actor: guid, Subject: guid, Result: resultOf(err)})
+	}()
+
+	user, err := us.GetUser(ctx, guid)
 	if err != nil {
 		return err
 	}
-	return nil
-}
+	if !user.Passwordless {
+		hash, _, err := us.GetPassword(ctx, guid)
+		if isNotFound(err) {
+			return LoginOrPasswordInvalid
+		} else if err != nil {
+			return err
+		}
+		valid, err := us.CheckPasswordHash(ctx, current, hash)
+		if err != nil {
+			return err
+		}
+		if !valid {
+			return LoginOrPasswordInvalid
+		}
+	}
 
-func (us *UserService) UpdateRefreshTokenAndLastLoginAt(guid string, refreshToken string) error {
-	collection := us.mongoClient.GetCollection(us.collection)
-	_, err := collection.UpdateOne(context.TODO(), bson.M{"guid": guid}, bson.M{"$set": bson.M{
-		"refresh_token": refreshToken,
-		"last_login_at": time.Now(),
-	}})
+	hashed, err := us.HashPassword(ctx, password)
 	if err != nil {
 		return err
 	}
+	expiresAt := time.Now().Add(time.Duration(us.cfg.PasswordLifeTime) * time.Hour)
+	if err = us.query(ctx, func(ctx context.Context) error { return us.passwords.Save(ctx, guid, hashed, expiresAt) }); err != nil {
+		return err
+	}
+	if user.Passwordless {
+		return us.query(ctx, func(ctx context.Context) error { return us.users.SetPasswordless(ctx, guid, false) })
+	}
 	return nil
 }
+
+func (us *UserService) UpdateLastLoginAt(ctx context.Context, guid string) error {
+	return us.query(ctx, func(ctx context.Context) error { return us.users.UpdateLastLoginAt(ctx, guid) })
+}
+
+func (us *UserService) UpdateRefreshTokenAndLastLoginAt(ctx context.Context, guid string, refreshToken string) error {
+	return us.query(ctx, func(ctx context.Context) error {
+		return us.users.UpdateRefreshTokenAndLastLoginAt(ctx, guid, refreshToken)
+	})
+}
+
+// IsTimeout reports whether err means that an operation ran out of time.
+func IsTimeout(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || mongo.IsTimeout(err)
+}
@@ -0,0 +1,202 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"go.uber.org/zap"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"tutorial-auth/internal/audit"
+	"tutorial-auth/internal/config"
+	"tutorial-auth/internal/database"
+	"tutorial-auth/internal/metrics"
+	"tutorial-auth/internal/mongodb/models"
+	"tutorial-auth/internal/notify"
+	"tutorial-auth/pkg/logging"
+)
+
+// EmailVerification confirms that users own the email addresses they register with. A new user is
+// emailed a link to the verification page of the client, which hands the token of the link to
+// Verify. The token names the user and when it expires, and is signed with the token secret over
+// the address as well, so it needs no storage and stops working if the address changes.
+type EmailVerification struct {
+	cfg      *config.AppConfig
+	logger   *zap.Logger
+	users    *UserService
+	store    *database.EmailVerificationStore
+	notifier notify.Notifier
+}
+
+func NewEmailVerification(cfg *config.AppConfig, logger *zap.Logger, users *UserService) *EmailVerification {
+	return &EmailVerification{
+		cfg:      cfg,
+		logger:   logger,
+		users:    users,
+		store:    database.NewEmailVerificationStore(users.dbClient),
+		notifier: notify.NewLogNotifier(logger),
+	}
+}
+
+// SetNotifier replaces the notifier, which logs notifications by default. It is called before
+// verification is used.
+func (v *EmailVerification) SetNotifier(notifier notify.Notifier) {
+	v.notifier = notifier
+}
+
+func (v *EmailVerification) enabled() bool {
+	return v.cfg != nil && v.cfg.EmailVerification.Enabled
+}
+
+// required reports whether users must verify their address before they can log in.
+func (v *EmailVerification) required() bool {
+	return v.enabled() && v.cfg.EmailVerification.RequireVerified
+}
+
+// Send emails a verification link to user.
+func (v *EmailVerification) Send(ctx context.Context, user *models.User) error {
+	cfg := v.cfg.EmailVerification
+	expiresAt := time.Now().Add(cfg.TokenLifetime)
+	token := v.token(user.GUID, user.Login, expiresAt)
+	separator := "?"
+	if strings.Contains(cfg.URL, "?") {
+		separator = "&"
+	}
+	link := cfg.URL + separator + "token=" + url.QueryEscape(token)
+
+	locale, _ := user.Attributes["locale"].(string)
+	tenant, _ := user.Attributes["tenant"].(string)
+	return v.notifier.Notify(ctx, &notify.Notification{
+		Channel:  notify.ChannelEmail,
+		Template: notify.EmailVerification,
+		UserID:   user.GUID,
+		To:       user.Login,
+		Locale:   locale,
+		Tenant:   tenant,
+		Data:     map[string]any{"name": user.Name, "link": link, "expires_at": expiresAt},
+	})
+}
+
+// sendAfterRegistration sends the first verification link to a user who has just registered. The
+// registration has succeeded by then, so a failure is only logged: the user can ask for a new link.
+func (v *EmailVerification) sendAfterRegistration(ctx context.Context, user *models.User) {
+	const op = "services.EmailVerification.sendAfterRegistration"
+
+	if !v.enabled() {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	if err := v.Send(ctx, user); err != nil {
+		logging.WithContext(ctx, v.logger).Error("failed to send verification email", zap.String("op", op),
+			zap.String("guid", user.GUID), zap.Error(err))
+		return
+	}
+	if err := v.users.query(ctx, func(ctx context.Context) error { return v.store.Sent(ctx, user.GUID, time.Now()) }); err != nil {
+		logging.WithContext(ctx, v.logger).Warn("failed to record verification email", zap.String("op", op),
+			zap.String("guid", user.GUID), zap.Error(err))
+	}
+}
+
+// Resend emails a new verification link to the user with login, unless one was sent less than the
+// resend interval ago. Unknown logins, verified users and throttled resends are all sent nothing
+// without an error, so that the answer does not tell which logins are registered.
+func (v *EmailVerification) Resend(ctx context.Context, login string) error {
+	if !v.enabled() {
+		return nil
+	}
+	user, err := v.users.GetByLogin(ctx, login)
+	if err != nil || user == nil || user.EmailVerified {
+		return err
+	}
+
+	// claiming the send first lets only one of concurrent resends through
+	var claimed bool
+	err = v.users.query(ctx, func(ctx context.Context) (err error) {
+		now := time.Now()
+		claimed, err = v.store.Claim(ctx, user.GUID, now, now.Add(-v.cfg.EmailVerification.ResendInterval))
+		return err
+	})
+	if err != nil || !claimed {
+		return err
+	}
+	return v.Send(ctx, user)
+}
+
+// Verify marks the address of the user that token was sent to as verified and returns the user.
+// Verifying again with a valid token changes nothing. Access tokens issued before carry the
+// verification status of then until they are refreshed.
+func (v *EmailVerification) Verify(ctx context.Context, token string) (user *models.User, err error) {
+	ctx, span := tracer.Start(ctx, "EmailVerification.Verify")
+	defer func() {
+		endSpan(span, err)
+		metrics.EmailVerifications.WithLabelValues(resultOf(err)).Inc()
+	}()
+
+	guid, expiresAt, ok := parseVerificationToken(token)
+	if !ok {
+		return nil, VerificationTokenInvalid
+	}
+	user, err = v.users.GetByGuid(ctx, guid)
+	if isNotFound(err) {
+		return nil, VerificationTokenInvalid
+	} else if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal([]byte(token), []byte(v.token(user.GUID, user.Login, expiresAt))) {
+		return nil, VerificationTokenInvalid
+	}
+	if user.EmailVerified {
+		return user, nil
+	}
+	if expiresAt.Before(time.Now()) {
+		return nil, VerificationTokenExpired
+	}
+
+	if err = v.markVerified(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// markVerified marks the address of user as verified, which a login by a link or a code emailed
+// to the address proves as well.
+func (v *EmailVerification) markVerified(ctx context.Context, user *models.User) error {
+	const op = "services.EmailVerification.markVerified"
+
+	if err := v.users.SetEmailVerified(ctx, user.GUID, true); err != nil {
+		return err
+	}
+	user.EmailVerified = true
+	v.users.auditLog.Record(ctx, audit.Event{Type: audit.EmailVerified, Actor: user.GUID, Subject: user.GUID, Result: audit.ResultSuccess})
+	if err := v.users.query(ctx, func(ctx context.Context) error { return v.store.Delete(ctx, user.GUID) }); err != nil {
+		// the row only throttles resending, which a verified user does not do
+		logging.WithContext(ctx, v.logger).Warn("failed to forget verification email", zap.String("op", op),
+			zap.String("guid", user.GUID), zap.Error(err))
+	}
+	return nil
+}
+
+// token returns the verification token of the address login of the user guid until expiresAt:
+// "<guid>.<expiry in Unix seconds>.<signature>", where the signature is the HMAC-SHA256 of the
+// rest and the address under the token secret.
+func (v *EmailVerification) token(guid string, login string, expiresAt time.Time) string {
+	payload := guid + "." + strconv.FormatInt(expiresAt.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(v.cfg.TokenSecret))
+	mac.Write([]byte("email_verification\n" + payload + "\n" + login))
+	return payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func parseVerificationToken(token string) (guid string, expiresAt time.Time, ok bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] == "" {
+		return "", time.Time{}, false
+	}
+	expiry, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	return parts[0], time.Unix(expiry, 0), true
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"net/url"
+	"testing"
+	"time"
+	"tutorial-auth/internal/config"
+	"tutorial-auth/internal/notify"
+	"tutorial-auth/pkg/authToken"
+)
+
+func TestEmailVerification(t *testing.T) {
+	cfg := testConfig()
+	cfg.EmailVerification = config.EmailVerificationConfig{
+		Enabled:         true,
+		RequireVerified: true,
+		URL:             "https://example.com/verify?from=email",
+		TokenLifetime:   time.Hour,
+		ResendInterval:  time.Minute,
+	}
+	us := newSqliteUserService(t, cfg)
+	notifier := &recordingNotifier{}
+	us.SetNotifier(notifier)
+	as := NewAuthService(us.cfg, zap.NewNop(), us)
+	ctx := context.Background()
+
+	// registration sends a link, and the user cannot log in before following it
+	user, err := us.Register(ctx, &NewUser{Login: "user@example.com", Password: "password", Name: "Ivan"})
+	require.NoError(t, err)
+	require.False(t, user.EmailVerified)
+	require.Len(t, notifier.notifications, 1)
+	notification := notifier.notifications[0]
+	require.Equal(t, notify.EmailVerification, notification.Template)
+	require.Equal(t, "user@example.com", notification.To)
+	link, err := url.Parse(notification.Data["link"].(string))
+	require.NoError(t, err)
+	require.Equal(t, "email", link.Query().Get("from"))
+	token := link.Query().Get("token")
+	require.NotEmpty(t, token)
+	require.ErrorIs(t, as.Login(ctx, "user@example.com", "password").Err, EmailNotVerified)
+
+	// throttled resends and unknown logins are sent nothing, alike
+	require.NoError(t, us.EmailVerification().Resend(ctx, "user@example.com"))
+	require.NoError(t, us.EmailVerification().Resend(ctx, "nobody@example.com"))
+	require.Len(t, notifier.notifications, 1)
+	require.NoError(t, us.verifier.store.Sent(ctx, user.GUID, time.Now().Add(-2*time.Minute)))
+	require.NoError(t, us.EmailVerification().Resend(ctx, "user@example.com"))
+	require.Len(t, notifier.notifications, 2)
+
+	// tokens are bound to the user, the address and the expiry
+	for _, forged := range []string{"", "garbage", user.GUID + ".1.x", token + "x", "other" + token[len(user.GUID):]} {
+		_, err = us.EmailVerification().Verify(ctx, forged)
+		require.ErrorIs(t, err, VerificationTokenInvalid, forged)
+	}
+	expired := us.verifier.token(user.GUID, user.Login, time.Now().Add(-time.Minute))
+	_, err = us.EmailVerification().Verify(ctx, expired)
+	require.ErrorIs(t, err, VerificationTokenExpired)
+
+	verified, err := us.EmailVerification().Verify(ctx, token)
+	require.NoError(t, err)
+	require.True(t, verified.EmailVerified)
+	verified, err = us.EmailVerification().Verify(ctx, token)
+	require.NoError(t, err)
+	require.True(t, verified.EmailVerified)
+
+	// the access token tells that the address is verified, and verified users are sent nothing
+	result := as.Login(ctx, "user@example.com", "password")
+	require.NoError(t, result.Err)
+	claims, valid := authToken.VerifyToken("secret", result.Token)
+	require.True(t, valid)
+	require.True(t, claims.EmailVerified)
+	require.NoError(t, us.EmailVerification().Resend(ctx, "user@example.com"))
+	require.Len(t, notifier.notifications, 2)
+}
+
+func TestEmailVerificationDisabled(t *testing.T) {
+	us := newSqliteUserService(t, &config.AppConfig{})
+	ctx := context.Background()
+
+	// with nothing to verify, users are stored as verified
+	_, err := us.Register(ctx, &NewUser{Login: "user@example.com", Password: "password", Name: "Ivan"})
+	require.NoError(t, err)
+	user, err := us.GetByLogin(ctx, "user@example.com")
+	require.NoError(t, err)
+	require.True(t, user.EmailVerified)
+}
@@ -0,0 +1,89 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"io"
+	"os"
+	"tutorial-auth/internal/config"
+)
+
+// Setup installs the W3C trace context and baggage propagators and, when tracing is enabled, a
+// tracer provider that exports to the configured exporter. The returned function flushes the
+// spans that are still buffered and stops the exporter.
+//
+// The propagators are installed even when tracing is disabled, so that the trace IDs of incoming
+// requests still reach the logs.
+func Setup(ctx context.Context, cfg *config.TracingConfig, serviceName string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if !cfg.Enabled {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, closeOutput, err := newExporter(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(serviceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+	)
+	if err != nil {
+		return nil, errors.Join(err, closeOutput())
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	return func(ctx context.Context) error {
+		return errors.Join(provider.Shutdown(ctx), closeOutput())
+	}, nil
+}
+
+// newExporter returns the exporter of cfg and a function that closes its output file, if any.
+func newExporter(ctx context.Context, cfg *config.TracingConfig) (sdktrace.SpanExporter, func() error, error) {
+	noop := func() error { return nil }
+
+	switch cfg.Exporter {
+	case "otlp":
+		var opts []otlptracegrpc.Option
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		exporter, err := otlptracegrpc.New(ctx, opts...)
+		return exporter, noop, err
+	case "stdout":
+		var output io.Writer = os.Stdout
+		closeOutput := noop
+		if cfg.File != "" {
+			file, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+			if err != nil {
+				return nil, nil, err
+			}
+			output, closeOutput = file, file.Close
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(output))
+		if err != nil {
+			return nil, nil, errors.Join(err, closeOutput())
+		}
+		return exporter, closeOutput, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported trace exporter: %s", cfg.Exporter)
+	}
+}
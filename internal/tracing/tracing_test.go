@@ -0,0 +1,41 @@
+package tracing
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"os"
+	"path/filepath"
+	"testing"
+	"tutorial-auth/internal/config"
+)
+
+func TestSetup(t *testing.T) {
+	ctx := context.Background()
+	// Setup replaces the global provider and propagator
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+
+	_, err := Setup(ctx, &config.TracingConfig{Enabled: true, Exporter: "zipkin"}, "auth")
+	require.ErrorContains(t, err, "unsupported trace exporter")
+
+	shutdown, err := Setup(ctx, &config.TracingConfig{}, "auth")
+	require.NoError(t, err)
+	require.NoError(t, shutdown(ctx))
+	require.ElementsMatch(t, []string{"traceparent", "tracestate", "baggage"}, otel.GetTextMapPropagator().Fields())
+
+	file := filepath.Join(t.TempDir(), "traces.json")
+	shutdown, err = Setup(ctx, &config.TracingConfig{Enabled: true, Exporter: "stdout", File: file, SampleRatio: 1}, "auth")
+	require.NoError(t, err)
+	_, span := otel.Tracer("test").Start(ctx, "exported span")
+	span.End()
+	require.NoError(t, shutdown(ctx))
+
+	exported, err := os.ReadFile(file)
+	require.NoError(t, err)
+	require.Contains(t, string(exported), `"Name":"exported span"`)
+	require.Contains(t, string(exported), `"Key":"service.name","Value":{"Type":"STRING","Value":"auth"}`)
+}
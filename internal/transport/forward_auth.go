@@ -0,0 +1,23 @@
+package transport
+
+import (
+	"strings"
+)
+
+// Identity headers of successful forward-auth responses; proxies copy them to the upstream request.
+const (
+	HeaderUserID    = "X-User-Id"
+	HeaderUserLogin = "X-User-Login"
+	HeaderUserRoles = "X-User-Roles"
+)
+
+// SplitRoles parses a comma separated list of roles.
+func SplitRoles(roles string) []string {
+	var result []string
+	for _, role := range strings.Split(roles, ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			result = append(result, role)
+		}
+	}
+	return result
+}
@@ -0,0 +1,18 @@
+package transport
+
+import (
+	"tutorial-auth/internal/services"
+)
+
+const ProblemContentType = "application/problem+json"
+
+// Problem is an RFC 7807 problem details body. Code is the stable error code of the service error.
+type Problem struct {
+	Type          string                  `json:"type"`
+	Title         string                  `json:"title"`
+	Status        int                     `json:"status"`
+	Detail        string                  `json:"detail,omitempty"`
+	Instance      string                  `json:"instance,omitempty"`
+	Code          string                  `json:"code"`
+	InvalidParams []services.InvalidParam `json:"invalid_params,omitempty"`
+}
@@ -0,0 +1,19 @@
+package transport
+
+type RefreshAuthRequest struct {
+	ID           string `json:"id" validate:"required"`
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+type AuthRequest struct {
+	Login    string `json:"login" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+type RegisterRequest struct {
+	Login           string `json:"login" validate:"required,login"`
+	Password        string `json:"password" validate:"omitempty,password"` // without one the user logs in with magic links and codes
+	ConfirmPassword string `json:"confirm_password" validate:"eqfield=Password"`
+	Name            string `json:"name" validate:"max=255"`
+	LastName        string `json:"last_name,omitempty" validate:"max=255"`
+}
@@ -0,0 +1,122 @@
+// Package transport holds what the HTTP and gRPC transports share: the request bodies and their
+// validation, and the problem details of rejected requests.
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"reflect"
+	"regexp"
+	"strings"
+	"tutorial-auth/internal/services"
+	"unicode/utf8"
+)
+
+// maxPasswordBytes is the longest password bcrypt takes into account.
+const maxPasswordBytes = 72
+
+// LoginPattern is the format of logins accepted at registration, as long as the longest email address.
+const LoginPattern = `^[A-Za-z0-9._+@-]{3,254}$`
+
+var loginPattern = regexp.MustCompile(LoginPattern)
+
+// PasswordPolicy holds the configurable part of the password rule.
+type PasswordPolicy struct {
+	MinLength int
+}
+
+type passwordPolicyKey struct{}
+
+var validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			return field.Name
+		}
+		return name
+	})
+	_ = v.RegisterValidation("login", func(fl validator.FieldLevel) bool {
+		return loginPattern.MatchString(fl.Field().String())
+	})
+	_ = v.RegisterValidationCtx("password", func(ctx context.Context, fl validator.FieldLevel) bool {
+		password := fl.Field().String()
+		policy, _ := ctx.Value(passwordPolicyKey{}).(PasswordPolicy)
+		return utf8.RuneCountInString(password) >= policy.MinLength && len(password) <= maxPasswordBytes
+	})
+	return v
+}
+
+// ValidateRequest checks req against its validate tags and reports every rejected field at once.
+// Field names are the JSON names of the request, so clients can match them to their input.
+func ValidateRequest(ctx context.Context, policy PasswordPolicy, req any) error {
+	err := validate.StructCtx(context.WithValue(ctx, passwordPolicyKey{}, policy), req)
+	if err == nil {
+		return nil
+	}
+	var fieldErrors validator.ValidationErrors
+	if !errors.As(err, &fieldErrors) {
+		return err
+	}
+
+	params := make([]services.InvalidParam, len(fieldErrors))
+	for i, fe := range fieldErrors {
+		params[i] = invalidParam(req, fe, policy)
+	}
+	return services.ValidationFailed("request validation failed", params...)
+}
+
+// invalidParam turns a failed rule into a message key with its arguments and the English message.
+func invalidParam(req any, fe validator.FieldError, policy PasswordPolicy) services.InvalidParam {
+	p := services.InvalidParam{Name: fe.Field()}
+	switch fe.Tag() {
+	case "required":
+		p.Code, p.Reason = "required", "is required"
+	case "login":
+		p.Code = "login_format"
+		p.Reason = "must be 3 to 254 letters, digits or . _ + @ - characters"
+	case "password":
+		p.Code = "password_policy"
+		p.Params = map[string]any{"min": policy.MinLength, "max": maxPasswordBytes}
+		p.Reason = fmt.Sprintf("must be at least %d characters and at most %d bytes long", policy.MinLength, maxPasswordBytes)
+	case "eqfield":
+		field := jsonFieldName(req, fe.Param())
+		p.Code = "must_match"
+		p.Params = map[string]any{"field": field}
+		p.Reason = "must match " + field
+	case "oneof":
+		values := strings.ReplaceAll(fe.Param(), " ", ", ")
+		p.Code = "one_of"
+		p.Params = map[string]any{"values": values}
+		p.Reason = "must be one of " + values
+	case "max":
+		p.Code = "too_long"
+		p.Params = map[string]any{"max": fe.Param()}
+		p.Reason = fmt.Sprintf("must be at most %s characters long", fe.Param())
+	default:
+		p.Code = fe.Tag()
+		if fe.Param() != "" {
+			p.Params = map[string]any{"param": fe.Param()}
+		}
+		p.Reason = fmt.Sprintf("failed the %s rule", fe.Tag())
+	}
+	return p
+}
+
+// jsonFieldName returns the JSON name of the named field of req, which eqfield rules refer to.
+func jsonFieldName(req any, field string) string {
+	t := reflect.TypeOf(req)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if f, ok := t.FieldByName(field); ok {
+		if name, _, _ := strings.Cut(f.Tag.Get("json"), ","); name != "" && name != "-" {
+			return name
+		}
+	}
+	return field
+}
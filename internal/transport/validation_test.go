@@ -0,0 +1,99 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"tutorial-auth/internal/services"
+)
+
+func TestAuthRequestValidation(t *testing.T) {
+	testCases := []struct {
+		Request *AuthRequest
+		Fields  []string
+	}{
+		{Request: &AuthRequest{}, Fields: []string{"login", "password"}},
+		{Request: &AuthRequest{Password: "password"}, Fields: []string{"login"}},
+		{Request: &AuthRequest{Login: "login"}, Fields: []string{"password"}},
+		{Request: &AuthRequest{Login: "login", Password: "password"}},
+	}
+
+	for _, testCase := range testCases {
+		err := ValidateRequest(context.Background(), PasswordPolicy{}, testCase.Request)
+		require.Equal(t, testCase.Fields, invalidFields(err))
+	}
+}
+
+func TestRefreshAuthRequestValidation(t *testing.T) {
+	err := ValidateRequest(context.Background(), PasswordPolicy{}, &RefreshAuthRequest{})
+	require.Equal(t, []string{"id", "refresh_token"}, invalidFields(err))
+
+	var serviceErr *services.Error
+	require.ErrorAs(t, err, &serviceErr)
+	require.Equal(t, "validation_failed", serviceErr.Code)
+	require.Equal(t, "required", serviceErr.InvalidParams[0].Code)
+}
+
+// invalidFields returns the names of the fields err rejects, or nil when err is nil.
+func invalidFields(err error) []string {
+	var serviceErr *services.Error
+	if !errors.As(err, &serviceErr) {
+		return nil
+	}
+	fields := make([]string, len(serviceErr.InvalidParams))
+	for i, param := range serviceErr.InvalidParams {
+		fields[i] = param.Name
+	}
+	return fields
+}
+
+func TestRegisterRequestValidation(t *testing.T) {
+	testCases := []struct {
+		Request *RegisterRequest
+		Fields  []string
+	}{
+		{Request: &RegisterRequest{}, Fields: []string{"login"}},
+		{Request: &RegisterRequest{Password: "password"}, Fields: []string{"login", "confirm_password"}},
+		{Request: &RegisterRequest{Login: "login"}},
+		{Request: &RegisterRequest{Login: "login", ConfirmPassword: "password"}, Fields: []string{"confirm_password"}},
+		{Request: &RegisterRequest{Login: "login", Password: "password"}, Fields: []string{"confirm_password"}},
+		{Request: &RegisterRequest{Login: "login", Password: "password", ConfirmPassword: "qwerty"}, Fields: []string{"confirm_password"}},
+		{Request: &RegisterRequest{Login: "a b", Password: "short", ConfirmPassword: "short"}, Fields: []string{"login", "password"}},
+		{Request: &RegisterRequest{Login: "user@example.com", Password: strings.Repeat("p", 73), ConfirmPassword: strings.Repeat("p", 73)}, Fields: []string{"password"}},
+		{Request: &RegisterRequest{Login: "login", Password: "password", ConfirmPassword: "password"}},
+		{Request: &RegisterRequest{Login: strings.Repeat("a", 242) + "@example.com"}},
+		{Request: &RegisterRequest{Login: strings.Repeat("a", 243) + "@example.com"}, Fields: []string{"login"}},
+	}
+
+	for _, testCase := range testCases {
+		err := ValidateRequest(context.Background(), PasswordPolicy{MinLength: 8}, testCase.Request)
+		require.Equal(t, testCase.Fields, invalidFields(err))
+	}
+}
+
+func TestRegisterRequestValidationParams(t *testing.T) {
+	err := ValidateRequest(context.Background(), PasswordPolicy{MinLength: 8}, &RegisterRequest{
+		Login:           "login",
+		Password:        "short",
+		ConfirmPassword: "other",
+	})
+
+	var serviceErr *services.Error
+	require.ErrorAs(t, err, &serviceErr)
+	require.Equal(t, []services.InvalidParam{
+		{
+			Name:   "password",
+			Code:   "password_policy",
+			Reason: "must be at least 8 characters and at most 72 bytes long",
+			Params: map[string]any{"min": 8, "max": 72},
+		},
+		{
+			Name:   "confirm_password",
+			Code:   "must_match",
+			Reason: "must match password",
+			Params: map[string]any{"field": "password"},
+		},
+	}, serviceErr.InvalidParams)
+}
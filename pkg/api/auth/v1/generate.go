@@ -0,0 +1,4 @@
+// Package authv1 holds the generated gRPC API of the auth service, defined in api/proto/auth/v1.
+package authv1
+
+//go:generate protoc -I ../../../../api/proto --go_out=../.. --go_opt=module=tutorial-auth/pkg/api --go-grpc_out=../.. --go-grpc_opt=module=tutorial-auth/pkg/api auth/v1/auth.proto
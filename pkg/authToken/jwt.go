@@ -2,13 +2,17 @@ package authToken
 
 import (
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"strings"
 	"time"
 )
 
 type UserTokenInfo struct {
-	ID    string `json:"id"`
-	Login string `json:"login"`
-	Name  string `json:"name"`
+	ID            string   `json:"id"`
+	Login         string   `json:"login"`
+	Name          string   `json:"name"`
+	Roles         []string `json:"roles,omitempty"`
+	EmailVerified bool     `json:"email_verified"`
 }
 
 type JWTUserInfoClaims struct {
@@ -19,6 +23,7 @@ type JWTUserInfoClaims struct {
 func NewToken(secret string, expirationTime int, userInfo *UserTokenInfo) (string, error) {
 	claims := JWTUserInfoClaims{
 		jwt.RegisteredClaims{
+			ID:        uuid.NewString(), // tokens issued in the same second must still differ
 			ExpiresAt: jwt.NewNumericDate(time.Now().Local().Add(time.Duration(expirationTime) * time.Minute)),
 			IssuedAt:  jwt.NewNumericDate(time.Now().Local()),
 		},
@@ -31,6 +36,15 @@ func NewToken(secret string, expirationTime int, userInfo *UserTokenInfo) (strin
 }
 
 func VerifyToken(secret string, token string) (*UserTokenInfo, bool) {
+	claims, valid := VerifyTokenClaims(secret, token)
+	if !valid {
+		return nil, false
+	}
+	return claims.User, true
+}
+
+// VerifyTokenClaims is VerifyToken returning all claims of the token.
+func VerifyTokenClaims(secret string, token string) (*JWTUserInfoClaims, bool) {
 	t, err := jwt.ParseWithClaims(token, &JWTUserInfoClaims{}, func(token *jwt.Token) (interface{}, error) {
 		return []byte(secret), nil
 	})
@@ -47,9 +61,18 @@ func VerifyToken(secret string, token string) (*UserTokenInfo, bool) {
 		return nil, false
 	}
 
-	if userInfo, ok := t.Claims.(*JWTUserInfoClaims); ok {
-		return userInfo.User, true
+	if claims, ok := t.Claims.(*JWTUserInfoClaims); ok {
+		return claims, true
 	}
 
 	return nil, false
 }
+
+// FromAuthorizationHeader returns the token of a "Bearer <token>" Authorization header, or "".
+func FromAuthorizationHeader(value string) string {
+	scheme, token, found := strings.Cut(strings.TrimSpace(value), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
@@ -0,0 +1,20 @@
+package logging
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// WithContext adds the trace and span IDs of the span in ctx to the entries of logger, so that
+// log entries can be found from a trace and the other way around.
+func WithContext(ctx context.Context, logger *zap.Logger) *zap.Logger {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.IsValid() {
+		return logger
+	}
+	return logger.With(
+		zap.String("trace_id", spanContext.TraceID().String()),
+		zap.String("span_id", spanContext.SpanID().String()),
+	)
+}